@@ -4,7 +4,7 @@ import (
 	"embed"
 )
 
-//go:embed *.yaml rbac/*.yaml network-policy/*.yaml
+//go:embed *.yaml admission/*.yaml rbac/*.yaml network-policy/*.yaml providers/*/*.yaml
 var f embed.FS
 
 // ReadFile reads and returns the content of the named file.
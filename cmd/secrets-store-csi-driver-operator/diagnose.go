@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	libgoclient "github.com/openshift/library-go/pkg/config/client"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/rest"
+
+	"github.com/openshift/secrets-store-csi-driver-operator/pkg/operator"
+)
+
+// diagnoseOptions are the flags of the diagnose command.
+type diagnoseOptions struct {
+	namespace      string
+	kubeConfigFile string
+	mustGatherDir  string
+	output         string
+}
+
+// newDiagnoseCommand returns the "diagnose" command, which explains the
+// configuration the operator resolves from a cluster or a must-gather.
+func newDiagnoseCommand() *cobra.Command {
+	o := &diagnoseOptions{}
+	cmd := &cobra.Command{
+		Use:   "diagnose",
+		Short: "Explain the effective driver configuration of a cluster or a must-gather",
+		Long: `Explain which driverConfig branch the operator takes, the resolved secret rotation,
+tokenRequests and TLS adherence, whether the live DaemonSet args and CSIDriver match
+what the operator would apply, and the operator conditions. The objects are read from
+the cluster, or from the must-gather output given with --must-gather.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if o.output != "text" && o.output != "json" {
+				return fmt.Errorf("unsupported --output %q, expected text or json", o.output)
+			}
+			opts, err := o.load(cmd)
+			if err != nil {
+				return err
+			}
+			diagnosis, err := operator.Diagnose(cmd.Context(), opts)
+			if err != nil {
+				return err
+			}
+			if o.output == "json" {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(diagnosis)
+			}
+			diagnosis.WriteText(cmd.OutOrStdout())
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&o.namespace, "namespace", operator.DefaultOperatorNamespace, "Namespace of the operator and the driver.")
+	cmd.Flags().StringVar(&o.kubeConfigFile, "kubeconfig", "", "Kubeconfig of the cluster. Defaults to the in-cluster config.")
+	cmd.Flags().StringVar(&o.mustGatherDir, "must-gather", "", "Must-gather output to read the objects from instead of a cluster.")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "text", "Output format, text or json.")
+	cmd.MarkFlagsMutuallyExclusive("kubeconfig", "must-gather")
+	return cmd
+}
+
+// load reads the objects to diagnose.
+func (o *diagnoseOptions) load(cmd *cobra.Command) (operator.RenderOptions, error) {
+	if o.mustGatherDir != "" {
+		return operator.LoadMustGatherObjects(o.mustGatherDir, o.namespace)
+	}
+	restConfig, err := libgoclient.GetKubeConfigOrInClusterConfig(o.kubeConfigFile, nil)
+	if err != nil {
+		return operator.RenderOptions{}, err
+	}
+	return operator.LoadClusterObjects(cmd.Context(), rest.AddUserAgent(restConfig, componentName), o.namespace)
+}
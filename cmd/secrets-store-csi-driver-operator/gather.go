@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	libgoclient "github.com/openshift/library-go/pkg/config/client"
+	"github.com/spf13/cobra"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/openshift/secrets-store-csi-driver-operator/pkg/mustgather"
+	"github.com/openshift/secrets-store-csi-driver-operator/pkg/operator"
+)
+
+// gatherOptions are the flags of the gather command.
+type gatherOptions struct {
+	namespace      string
+	kubeConfigFile string
+	destDir        string
+	ocPath         string
+}
+
+// newGatherCommand returns the "gather" command, which the must-gather image
+// runs after `oc adm inspect` to collect what it does not.
+func newGatherCommand() *cobra.Command {
+	o := &gatherOptions{}
+	cmd := &cobra.Command{
+		Use:   "gather",
+		Short: "Collect driver diagnostics into must-gather output",
+		Long: `Collect, for each node, the provider socket directories and the driver metrics, the
+SecretProviderClassPodStatuses grouped by node, the Secrets the driver syncs with their
+values redacted, and the configuration the operator resolves, into --dest-dir.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(cmd)
+		},
+	}
+	cmd.Flags().StringVar(&o.namespace, "namespace", operator.DefaultOperatorNamespace, "Namespace of the operator and the driver.")
+	cmd.Flags().StringVar(&o.kubeConfigFile, "kubeconfig", "", "Kubeconfig of the cluster. Defaults to the in-cluster config.")
+	cmd.Flags().StringVar(&o.destDir, "dest-dir", "must-gather", "Directory to write to.")
+	cmd.Flags().StringVar(&o.ocPath, "oc", "/usr/bin/oc", "oc binary used to exec into the driver pods.")
+	return cmd
+}
+
+func (o *gatherOptions) run(cmd *cobra.Command) error {
+	ctx := cmd.Context()
+	restConfig, err := libgoclient.GetKubeConfigOrInClusterConfig(o.kubeConfigFile, nil)
+	if err != nil {
+		return err
+	}
+	restConfig = rest.AddUserAgent(restConfig, componentName)
+	kubeClient, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	nodes, err := mustgather.NewClusterNodeDiagnostics(ctx, restConfig, kubeClient, o.ocPath, o.kubeConfigFile, o.namespace)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	collector := &mustgather.Collector{
+		Namespace:     o.namespace,
+		KubeClient:    kubeClient,
+		DynamicClient: dynamicClient,
+		Nodes:         nodes,
+	}
+	if err := collector.Collect(ctx, o.destDir); err != nil {
+		errs = append(errs, err)
+	}
+	if err := o.gatherResolvedConfig(cmd, restConfig); err != nil {
+		errs = append(errs, fmt.Errorf("failed to collect the resolved config: %w", err))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// gatherResolvedConfig writes the diagnosis and the rendered manifests of
+// the cluster.
+func (o *gatherOptions) gatherResolvedConfig(cmd *cobra.Command, restConfig *rest.Config) error {
+	opts, err := operator.LoadClusterObjects(cmd.Context(), restConfig, o.namespace)
+	if err != nil {
+		return err
+	}
+	diagnosis, err := operator.Diagnose(cmd.Context(), opts)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(diagnosis, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := mustgather.WriteFile(filepath.Join(o.destDir, mustgather.DriverDir, "resolved-config.json"), content); err != nil {
+		return err
+	}
+	rendered, err := operator.Render(cmd.Context(), opts)
+	if err != nil {
+		return err
+	}
+	return mustgather.WriteFile(filepath.Join(o.destDir, mustgather.DriverDir, "rendered-manifests.yaml"), rendered)
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync/atomic"
 
+	configv1 "github.com/openshift/api/config/v1"
+	leaderelectionconverter "github.com/openshift/library-go/pkg/config/leaderelection"
 	"github.com/openshift/library-go/pkg/controller/controllercmd"
 	"github.com/spf13/cobra"
 	"k8s.io/component-base/cli"
@@ -34,24 +37,42 @@ func NewOperatorCommand() *cobra.Command {
 		},
 	}
 	cmd.AddCommand(newStartCommand())
+	cmd.AddCommand(newRenderCommand())
+	cmd.AddCommand(newDiagnoseCommand())
+	cmd.AddCommand(newGatherCommand())
 	return cmd
 }
 
-// newStartCommand builds the stock Controllercmd "start" command unchanged and
-// adds a PersistentPreRunE that resolves the cluster TLS security profile and
-// feeds it through --config so StartController's own config parsing picks it
-// up. This avoids re-implementing StartController just to reach ServingInfo.
+// newStartCommand builds the stock Controllercmd "start" command and adds a
+// PersistentPreRunE that resolves the cluster TLS security profile and feeds
+// it through --config so StartController's own config parsing picks it up.
+// This avoids re-implementing StartController just to reach ServingInfo.
 //
-// The resolved profile is also threaded to RunOperator (for the live-change
-// watcher) via a closure variable that PersistentPreRunE fills before Run —
+// Controllercmd serves its metrics server with a tls.Config it does not
+// expose, so its serving is disabled and Run serves the server Controllercmd
+// builds through sscsitls.Serve instead, which negotiates new connections
+// with a sscsitls.DynamicServingConfig. PersistentPreRunE fills that
+// DynamicServingConfig, which is also threaded to RunOperator, before Run —
 // cobra runs those strictly in that order on the same goroutine.
+//
+// Every replica serves metrics, so Run also watches the profile in every
+// replica, outside of leader election. A profile change conflicting with the
+// TLS settings of --config fails like one that cannot be applied, restarting
+// the replica, which then reports the conflict at startup like
+// sscsitls.MergeConfigFile does. startFunc only runs once the replica
+// leads, which is how the watcher tells the leader from standby replicas
+// when it has to restart them.
 func newStartCommand() *cobra.Command {
-	var resolvedTLS sscsitls.ResolvedProfile
+	var servingConfig *sscsitls.DynamicServingConfig
+	complianceAudit := &sscsitls.ComplianceAudit{}
+	var leading atomic.Bool
 
 	startFunc := func(ctx context.Context, controllerContext *controllercmd.ControllerContext) error {
-		return operator.RunOperator(ctx, controllerContext, resolvedTLS)
+		leading.Store(true)
+		return operator.RunOperator(ctx, controllerContext, servingConfig, complianceAudit)
 	}
 	cmdcfg := controllercmd.NewControllerCommandConfig(componentName, version.Get(), startFunc, clock.RealClock{})
+	cmdcfg.DisableServing = true
 
 	cmd := cmdcfg.NewCommand()
 	cmd.Use = "start"
@@ -68,19 +89,90 @@ func newStartCommand() *cobra.Command {
 		if err != nil {
 			return err
 		}
-		resolvedTLS, err = sscsitls.ResolveFromCluster(context.Background(), kubeConfigFile, componentName)
+		resolvedTLS, err := sscsitls.ResolveFromCluster(context.Background(), kubeConfigFile, componentName)
 		if err != nil {
 			return fmt.Errorf("failed to resolve cluster TLS security profile: %w", err)
 		}
+		configFile, err := cmd.Flags().GetString("config")
+		if err != nil {
+			return err
+		}
+		configured, err := sscsitls.ReadConfigServingInfo(configFile)
+		if err != nil {
+			return err
+		}
+		servingConfig, err = sscsitls.NewDynamicServingConfig(resolvedTLS, configured)
+		if err != nil {
+			return err
+		}
 		return applyTLSProfileToConfigFlag(cmd, resolvedTLS)
 	}
 
+	existingRun := cmd.Run
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if err := serveMetrics(ctx, cmdcfg, cmd, servingConfig, complianceAudit); err != nil {
+			klog.Fatal(err)
+		}
+		kubeConfigFile, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			klog.Fatal(err)
+		}
+		if err := operator.RunTLSProfileWatcher(ctx, kubeConfigFile, servingConfig, leading.Load); err != nil {
+			klog.Fatal(err)
+		}
+		existingRun(cmd, args)
+	}
+
 	return cmd
 }
 
+// serveMetrics serves the operator's metrics, health checks and TLS
+// compliance audit until ctx is done, from the same config and with the same
+// defaults as StartController would with serving enabled.
+func serveMetrics(
+	ctx context.Context,
+	cmdcfg *controllercmd.ControllerCommandConfig,
+	cmd *cobra.Command,
+	servingConfig *sscsitls.DynamicServingConfig,
+	complianceAudit *sscsitls.ComplianceAudit,
+) error {
+	_, config, configContent, err := cmdcfg.Config()
+	if err != nil {
+		return err
+	}
+	if _, _, err := cmdcfg.AddDefaultRotationToConfig(config, configContent); err != nil {
+		return err
+	}
+	if bindAddress, err := cmd.Flags().GetString("listen"); err != nil {
+		return err
+	} else if len(bindAddress) != 0 {
+		config.ServingInfo.BindAddress = bindAddress
+	}
+	kubeConfigFile, err := cmd.Flags().GetString("kubeconfig")
+	if err != nil {
+		return err
+	}
+
+	var leaderElection *configv1.LeaderElection
+	if !cmdcfg.DisableLeaderElection {
+		namespace, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			return err
+		}
+		defaulted := leaderelectionconverter.LeaderElectionDefaulting(config.LeaderElection, namespace, componentName+"-lock")
+		leaderElection = &defaulted
+	}
+
+	return sscsitls.ServeMetrics(ctx, componentName, config.ServingInfo, config.Authentication, config.Authorization,
+		kubeConfigFile, leaderElection, version.Get(), servingConfig, complianceAudit)
+}
+
 // applyTLSProfileToConfigFlag points --config at a generated config file
-// carrying resolved's TLS settings. Errors if --config is already set rather
-// than merging: the shipped CSV never passes --config.
+// carrying resolved's TLS settings. When --config is already set, the
+// generated file is that config with resolved's TLS settings merged into its
+// ServingInfo; a conflicting setting is an error, see sscsitls.MergeConfigFile.
 func applyTLSProfileToConfigFlag(cmd *cobra.Command, resolved sscsitls.ResolvedProfile) error {
 	if !resolved.Honor {
 		klog.Infof("TLS adherence policy is %q; leaving --config as-is", resolved.Adherence)
@@ -91,12 +183,13 @@ func applyTLSProfileToConfigFlag(cmd *cobra.Command, resolved sscsitls.ResolvedP
 	if err != nil {
 		return err
 	}
+
+	var tmpFile string
 	if configFile != "" {
-		return fmt.Errorf("cannot apply cluster TLS security profile: --config %q is already set and merging "+
-			"into an existing config file is not yet supported", configFile)
+		tmpFile, err = sscsitls.MergeConfigFile(configFile, resolved)
+	} else {
+		tmpFile, err = sscsitls.WriteConfigFile(resolved)
 	}
-
-	tmpFile, err := sscsitls.WriteConfigFile(resolved)
 	if err != nil {
 		return err
 	}
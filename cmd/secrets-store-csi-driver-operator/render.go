@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	configv1 "github.com/openshift/api/config/v1"
+	opv1 "github.com/openshift/api/operator/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/openshift/secrets-store-csi-driver-operator/pkg/operator"
+)
+
+// renderOptions are the flags of the render command.
+type renderOptions struct {
+	namespace            string
+	clusterCSIDriverFile string
+	csiDriverFile        string
+	apiServerFile        string
+	operatorConfigFile   string
+	spcFile              string
+	spcPodStatusFile     string
+	nodesFile            string
+}
+
+// newRenderCommand returns the "render" command, which prints the manifests
+// the operator would apply for the given objects without a cluster.
+func newRenderCommand() *cobra.Command {
+	o := &renderOptions{}
+	cmd := &cobra.Command{
+		Use:   "render",
+		Short: "Print the manifests the operator would apply, without a cluster",
+		Long: `Print the driver's CSIDriver, DaemonSet, RBAC and NetworkPolicy manifests as the
+operator would apply them for the given ClusterCSIDriver, CSIDriver, APIServer,
+operator config, SecretProviderClasses, SecretProviderClassPodStatuses and nodes,
+read from files. Nothing that is not given is read from a cluster.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			renderOpts, err := o.load()
+			if err != nil {
+				return err
+			}
+			out, err := operator.Render(cmd.Context(), renderOpts)
+			if err != nil {
+				return err
+			}
+			_, err = cmd.OutOrStdout().Write(out)
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&o.namespace, "namespace", operator.DefaultOperatorNamespace, "Namespace of the operator and the driver.")
+	cmd.Flags().StringVar(&o.clusterCSIDriverFile, "cluster-csi-driver", "", "File with the secrets-store.csi.k8s.io ClusterCSIDriver.")
+	cmd.Flags().StringVar(&o.csiDriverFile, "csi-driver", "", "File with the existing CSIDriver, if any.")
+	cmd.Flags().StringVar(&o.apiServerFile, "apiserver", "", "File with the cluster APIServer config, if any.")
+	cmd.Flags().StringVar(&o.operatorConfigFile, "operator-config", "", "File with the operator config ConfigMap, if any.")
+	cmd.Flags().StringVar(&o.spcFile, "secret-provider-classes", "", "File with the list of SecretProviderClasses of all namespaces, if any.")
+	cmd.Flags().StringVar(&o.spcPodStatusFile, "secret-provider-class-pod-statuses", "", "File with the list of SecretProviderClassPodStatuses of all namespaces, if any.")
+	cmd.Flags().StringVar(&o.nodesFile, "nodes", "", "File with the list of nodes, if any.")
+	_ = cmd.MarkFlagRequired("cluster-csi-driver")
+	return cmd
+}
+
+// load reads the files of o.
+func (o *renderOptions) load() (operator.RenderOptions, error) {
+	opts := operator.RenderOptions{OperatorNamespace: o.namespace}
+	opts.ClusterCSIDriver = &opv1.ClusterCSIDriver{}
+	if err := readObjectFile(o.clusterCSIDriverFile, opts.ClusterCSIDriver); err != nil {
+		return opts, err
+	}
+	if o.csiDriverFile != "" {
+		opts.CSIDriver = &storagev1.CSIDriver{}
+		if err := readObjectFile(o.csiDriverFile, opts.CSIDriver); err != nil {
+			return opts, err
+		}
+	}
+	if o.apiServerFile != "" {
+		opts.APIServer = &configv1.APIServer{}
+		if err := readObjectFile(o.apiServerFile, opts.APIServer); err != nil {
+			return opts, err
+		}
+	}
+	if o.operatorConfigFile != "" {
+		opts.OperatorConfig = &corev1.ConfigMap{}
+		if err := readObjectFile(o.operatorConfigFile, opts.OperatorConfig); err != nil {
+			return opts, err
+		}
+	}
+	for _, list := range []struct {
+		file string
+		objs *[]*unstructured.Unstructured
+	}{
+		{o.spcFile, &opts.SecretProviderClasses},
+		{o.spcPodStatusFile, &opts.SecretProviderClassPodStatuses},
+	} {
+		if list.file == "" {
+			continue
+		}
+		objs := &unstructured.UnstructuredList{}
+		if err := readObjectFile(list.file, objs); err != nil {
+			return opts, err
+		}
+		for i := range objs.Items {
+			*list.objs = append(*list.objs, &objs.Items[i])
+		}
+	}
+	if o.nodesFile != "" {
+		list := &corev1.NodeList{}
+		if err := readObjectFile(o.nodesFile, list); err != nil {
+			return opts, err
+		}
+		for i := range list.Items {
+			opts.Nodes = append(opts.Nodes, &list.Items[i])
+		}
+	}
+	return opts, nil
+}
+
+// readObjectFile decodes the YAML or JSON object in file into obj.
+func readObjectFile(file string, obj interface{}) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := sigsyaml.Unmarshal(content, obj); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", file, err)
+	}
+	return nil
+}
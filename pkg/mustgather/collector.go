@@ -0,0 +1,206 @@
+package mustgather
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	// DriverDir is the directory of root the Collector writes to, besides
+	// the synced Secrets it writes in the `oc adm inspect` layout.
+	DriverDir = "secrets-store-csi-driver"
+	// driverPodSelector selects the driver pods, see assets/node.yaml, and
+	// the ones of the driver's debug window.
+	driverPodSelector = "app in (secrets-store-csi-driver-node, secrets-store-csi-driver-node-debug)"
+	// syncedSecretSelector selects the Secrets the driver syncs from
+	// SecretProviderClass secretObjects.
+	syncedSecretSelector = "secrets-store.csi.k8s.io/managed=true"
+	// podStatusNodeLabel is the label the driver sets to the node of a
+	// SecretProviderClassPodStatus.
+	podStatusNodeLabel = "internal.secrets-store.csi.k8s.io/node-name"
+	// redactedValue replaces the values of synced Secrets.
+	redactedValue = "<redacted>"
+	// lastAppliedAnnotation may hold a copy of the values of a Secret.
+	lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+)
+
+var secretProviderClassPodStatusGVR = schema.GroupVersionResource{
+	Group:    "secrets-store.csi.x-k8s.io",
+	Version:  "v1",
+	Resource: "secretproviderclasspodstatuses",
+}
+
+// NodeDiagnostics reads the state of the node of a driver pod.
+type NodeDiagnostics interface {
+	// ProviderSockets lists the provider socket directories of the node.
+	ProviderSockets(ctx context.Context, pod *corev1.Pod) ([]byte, error)
+	// DriverMetrics returns the driver's metrics on the node.
+	DriverMetrics(ctx context.Context, pod *corev1.Pod) ([]byte, error)
+}
+
+// Collector gathers what `oc adm inspect` does not: per-node driver
+// diagnostics, SecretProviderClassPodStatus summaries and the synced
+// Secrets, redacted.
+type Collector struct {
+	// Namespace is the namespace of the driver.
+	Namespace     string
+	KubeClient    kubernetes.Interface
+	DynamicClient dynamic.Interface
+	Nodes         NodeDiagnostics
+}
+
+// PodStatusSummary summarizes a SecretProviderClassPodStatus.
+type PodStatusSummary struct {
+	Namespace           string `json:"namespace"`
+	Pod                 string `json:"pod"`
+	SecretProviderClass string `json:"secretProviderClass"`
+	Mounted             bool   `json:"mounted"`
+	Objects             int    `json:"objects"`
+}
+
+// Collect writes to root. A failure of one part does not stop the others,
+// and the failures of a node are written in place of its output.
+func (c *Collector) Collect(ctx context.Context, root string) error {
+	var errs []error
+	if err := c.collectNodeDiagnostics(ctx, root); err != nil {
+		errs = append(errs, fmt.Errorf("failed to collect node diagnostics: %w", err))
+	}
+	if err := c.collectPodStatusSummaries(ctx, root); err != nil {
+		errs = append(errs, fmt.Errorf("failed to collect SecretProviderClassPodStatus summaries: %w", err))
+	}
+	if err := c.collectSyncedSecrets(ctx, root); err != nil {
+		errs = append(errs, fmt.Errorf("failed to collect synced Secrets: %w", err))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (c *Collector) collectNodeDiagnostics(ctx context.Context, root string) error {
+	pods, err := c.KubeClient.CoreV1().Pods(c.Namespace).List(ctx, metav1.ListOptions{LabelSelector: driverPodSelector})
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.NodeName == "" {
+			continue
+		}
+		nodeDir := filepath.Join(root, DriverDir, "nodes", pod.Spec.NodeName)
+		for file, read := range map[string]func(context.Context, *corev1.Pod) ([]byte, error){
+			"provider-sockets.txt": c.Nodes.ProviderSockets,
+			"driver-metrics.txt":   c.Nodes.DriverMetrics,
+		} {
+			content, err := read(ctx, pod)
+			if err != nil {
+				klog.Warningf("failed to collect %s of node %s from pod %s: %v", file, pod.Spec.NodeName, pod.Name, err)
+				content = []byte(fmt.Sprintf("failed to collect from pod %s: %v\n", pod.Name, err))
+			}
+			if err := WriteFile(filepath.Join(nodeDir, file), content); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (c *Collector) collectPodStatusSummaries(ctx context.Context, root string) error {
+	list, err := c.DynamicClient.Resource(secretProviderClassPodStatusGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	summaries := map[string][]PodStatusSummary{}
+	for _, podStatus := range list.Items {
+		node := podStatus.GetLabels()[podStatusNodeLabel]
+		if node == "" {
+			node = "unknown"
+		}
+		summaries[node] = append(summaries[node], summarizePodStatus(&podStatus))
+	}
+	for _, nodeSummaries := range summaries {
+		sort.Slice(nodeSummaries, func(i, j int) bool {
+			if nodeSummaries[i].Namespace != nodeSummaries[j].Namespace {
+				return nodeSummaries[i].Namespace < nodeSummaries[j].Namespace
+			}
+			return nodeSummaries[i].Pod < nodeSummaries[j].Pod
+		})
+	}
+	return WriteYAML(filepath.Join(root, DriverDir, "secretproviderclasspodstatuses-by-node.yaml"), summaries)
+}
+
+func summarizePodStatus(podStatus *unstructured.Unstructured) PodStatusSummary {
+	summary := PodStatusSummary{Namespace: podStatus.GetNamespace()}
+	summary.Pod, _, _ = unstructured.NestedString(podStatus.Object, "status", "podName")
+	summary.SecretProviderClass, _, _ = unstructured.NestedString(podStatus.Object, "status", "secretProviderClassName")
+	summary.Mounted, _, _ = unstructured.NestedBool(podStatus.Object, "status", "mounted")
+	objects, _, _ := unstructured.NestedSlice(podStatus.Object, "status", "objects")
+	summary.Objects = len(objects)
+	return summary
+}
+
+func (c *Collector) collectSyncedSecrets(ctx context.Context, root string) error {
+	secrets, err := c.KubeClient.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: syncedSecretSelector})
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := range secrets.Items {
+		secret := RedactSecret(&secrets.Items[i])
+		file := ObjectPath(root, corev1.SchemeGroupVersion.WithResource("secrets").GroupResource(), secret.Namespace, secret.Name)
+		if err := WriteYAML(file, secret); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// RedactSecret returns a copy of secret with its values replaced by
+// redactedValue and without the annotations that may hold them.
+func RedactSecret(secret *corev1.Secret) *corev1.Secret {
+	redacted := secret.DeepCopy()
+	redacted.Data = nil
+	redacted.StringData = nil
+	for key := range secret.Data {
+		if redacted.StringData == nil {
+			redacted.StringData = map[string]string{}
+		}
+		redacted.StringData[key] = redactedValue
+	}
+	for key := range secret.StringData {
+		if redacted.StringData == nil {
+			redacted.StringData = map[string]string{}
+		}
+		redacted.StringData[key] = redactedValue
+	}
+	delete(redacted.Annotations, lastAppliedAnnotation)
+	return redacted
+}
+
+// WriteYAML writes obj to file as YAML.
+func WriteYAML(file string, obj interface{}) error {
+	content, err := sigsyaml.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", file, err)
+	}
+	return WriteFile(file, content)
+}
+
+// WriteFile writes content to file, creating its directory.
+func WriteFile(file string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, content, 0644)
+}
@@ -0,0 +1,191 @@
+package mustgather
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+const testNamespace = "openshift-cluster-csi-drivers"
+
+// fakeNodeDiagnostics returns output naming the pod, and err.
+type fakeNodeDiagnostics struct {
+	err error
+}
+
+func (d *fakeNodeDiagnostics) ProviderSockets(ctx context.Context, pod *corev1.Pod) ([]byte, error) {
+	return []byte("sockets of " + pod.Name), d.err
+}
+
+func (d *fakeNodeDiagnostics) DriverMetrics(ctx context.Context, pod *corev1.Pod) ([]byte, error) {
+	return []byte("metrics of " + pod.Name), d.err
+}
+
+func newTestDriverPod(name, node string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Labels: map[string]string{"app": "secrets-store-csi-driver-node"}},
+		Spec:       corev1.PodSpec{NodeName: node},
+	}
+}
+
+func newTestPodStatus(namespace, pod, node string, mounted bool) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "secrets-store.csi.x-k8s.io/v1",
+		"kind":       "SecretProviderClassPodStatus",
+		"metadata": map[string]interface{}{
+			"name":      pod + "-spc",
+			"namespace": namespace,
+			"labels":    map[string]interface{}{podStatusNodeLabel: node},
+		},
+		"status": map[string]interface{}{
+			"podName":                 pod,
+			"secretProviderClassName": "spc",
+			"mounted":                 mounted,
+			"objects":                 []interface{}{map[string]interface{}{"id": "a"}},
+		},
+	}}
+}
+
+func newTestCollector(nodeErr error, kubeObjects []runtime.Object, podStatuses ...runtime.Object) *Collector {
+	scheme := runtime.NewScheme()
+	listKinds := map[schema.GroupVersionResource]string{secretProviderClassPodStatusGVR: "SecretProviderClassPodStatusList"}
+	return &Collector{
+		Namespace:     testNamespace,
+		KubeClient:    fake.NewClientset(kubeObjects...),
+		DynamicClient: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme, listKinds, podStatuses...),
+		Nodes:         &fakeNodeDiagnostics{err: nodeErr},
+	}
+}
+
+func readTestFile(t *testing.T, file string) string {
+	t.Helper()
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestCollectNodeDiagnostics(t *testing.T) {
+	cases := []struct {
+		name            string
+		nodeErr         error
+		expectedSockets string
+	}{
+		{
+			name:            "collected",
+			expectedSockets: "sockets of driver-a",
+		},
+		{
+			name:            "failures are written in place",
+			nodeErr:         errors.New("exec failed"),
+			expectedSockets: "failed to collect from pod driver-a: exec failed",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			collector := newTestCollector(tc.nodeErr, []runtime.Object{
+				newTestDriverPod("driver-a", "node-a"),
+				newTestDriverPod("driver-pending", ""),
+			})
+			if err := collector.Collect(context.Background(), root); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			nodeDir := filepath.Join(root, DriverDir, "nodes", "node-a")
+			if got := readTestFile(t, filepath.Join(nodeDir, "provider-sockets.txt")); !strings.Contains(got, tc.expectedSockets) {
+				t.Errorf("expected provider sockets to contain %q, got %q", tc.expectedSockets, got)
+			}
+			if _, err := os.Stat(filepath.Join(nodeDir, "driver-metrics.txt")); err != nil {
+				t.Errorf("expected driver metrics: %v", err)
+			}
+			entries, err := os.ReadDir(filepath.Join(root, DriverDir, "nodes"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("expected only node-a, got %v", entries)
+			}
+		})
+	}
+}
+
+func TestCollectPodStatusSummaries(t *testing.T) {
+	root := t.TempDir()
+	collector := newTestCollector(nil, nil,
+		newTestPodStatus("ns-b", "pod-b", "node-a", true),
+		newTestPodStatus("ns-a", "pod-a", "node-a", false),
+		newTestPodStatus("ns-a", "pod-c", "node-b", true),
+	)
+	if err := collector.Collect(context.Background(), root); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	summaries := map[string][]PodStatusSummary{}
+	content := readTestFile(t, filepath.Join(root, DriverDir, "secretproviderclasspodstatuses-by-node.yaml"))
+	if err := sigsyaml.Unmarshal([]byte(content), &summaries); err != nil {
+		t.Fatal(err)
+	}
+	expectedNodeA := []PodStatusSummary{
+		{Namespace: "ns-a", Pod: "pod-a", SecretProviderClass: "spc", Objects: 1},
+		{Namespace: "ns-b", Pod: "pod-b", SecretProviderClass: "spc", Mounted: true, Objects: 1},
+	}
+	if len(summaries) != 2 || len(summaries["node-b"]) != 1 {
+		t.Fatalf("unexpected summaries %v", summaries)
+	}
+	for i, expected := range expectedNodeA {
+		if summaries["node-a"][i] != expected {
+			t.Errorf("expected %+v, got %+v", expected, summaries["node-a"][i])
+		}
+	}
+}
+
+func TestCollectSyncedSecrets(t *testing.T) {
+	root := t.TempDir()
+	collector := newTestCollector(nil, []runtime.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "synced",
+				Namespace:   "app",
+				Labels:      map[string]string{"secrets-store.csi.k8s.io/managed": "true"},
+				Annotations: map[string]string{lastAppliedAnnotation: `{"data":{"password":"c2VjcmV0"}}`},
+			},
+			Data: map[string][]byte{"password": []byte("secret")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "app"},
+			Data:       map[string][]byte{"password": []byte("secret")},
+		},
+	})
+	if err := collector.Collect(context.Background(), root); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secret := &corev1.Secret{}
+	found, err := ReadObject(root, corev1.SchemeGroupVersion.WithResource("secrets").GroupResource(), "app", "synced", secret)
+	if err != nil || !found {
+		t.Fatalf("expected the synced Secret, got found=%t err=%v", found, err)
+	}
+	if len(secret.Data) != 0 || secret.StringData["password"] != redactedValue {
+		t.Errorf("expected the password to be redacted, got %+v", secret)
+	}
+	if _, ok := secret.Annotations[lastAppliedAnnotation]; ok {
+		t.Errorf("expected %s to be dropped", lastAppliedAnnotation)
+	}
+	if found, _ := ReadObject(root, corev1.SchemeGroupVersion.WithResource("secrets").GroupResource(), "app", "unrelated", &corev1.Secret{}); found {
+		t.Errorf("expected only synced Secrets to be collected")
+	}
+	if content := readTestFile(t, filepath.Join(root, "namespaces", "app", "core", "secrets", "synced.yaml")); strings.Contains(content, "c2VjcmV0") {
+		t.Errorf("expected no secret value, got:\n%s", content)
+	}
+}
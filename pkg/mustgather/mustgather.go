@@ -0,0 +1,210 @@
+// Package mustgather reads and writes Kubernetes objects in the directory
+// layout of `oc adm inspect`, which must-gather images use:
+//
+//	<root>/cluster-scoped-resources/<group>/<resource>/<name>.yaml
+//	<root>/namespaces/<namespace>/<group>/<resource>/<name>.yaml
+//
+// where <group> is "core" for the core API group. `oc adm inspect` also
+// writes some namespaced resources as a single list,
+// <root>/namespaces/<namespace>/<group>/<resource>.yaml, which ReadObject
+// falls back to. Collector gathers what `oc adm inspect` does not into the
+// same layout.
+package mustgather
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	clusterScopedDir = "cluster-scoped-resources"
+	namespacesDir    = "namespaces"
+	coreGroupDir     = "core"
+)
+
+// ObjectPath returns the file of the object name of resource gr in
+// namespace, or of the cluster-scoped object name if namespace is "".
+func ObjectPath(root string, gr schema.GroupResource, namespace, name string) string {
+	return filepath.Join(resourceDir(root, gr, namespace), name+".yaml")
+}
+
+func resourceDir(root string, gr schema.GroupResource, namespace string) string {
+	group := gr.Group
+	if group == "" {
+		group = coreGroupDir
+	}
+	if namespace == "" {
+		return filepath.Join(root, clusterScopedDir, group, gr.Resource)
+	}
+	return filepath.Join(root, namespacesDir, namespace, group, gr.Resource)
+}
+
+// FindRoot returns dir if it holds an `oc adm inspect` layout, or its only
+// subdirectory that does: `oc adm must-gather` puts the output of each
+// image in a subdirectory of its own.
+func FindRoot(dir string) (string, error) {
+	if isRoot(dir) {
+		return dir, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var roots []string
+	for _, entry := range entries {
+		if entry.IsDir() && isRoot(filepath.Join(dir, entry.Name())) {
+			roots = append(roots, filepath.Join(dir, entry.Name()))
+		}
+	}
+	switch len(roots) {
+	case 0:
+		return "", fmt.Errorf("%s holds no %s or %s directory", dir, clusterScopedDir, namespacesDir)
+	case 1:
+		return roots[0], nil
+	default:
+		return "", fmt.Errorf("%s holds several must-gather outputs, pass one of %v", dir, roots)
+	}
+}
+
+func isRoot(dir string) bool {
+	for _, sub := range []string{clusterScopedDir, namespacesDir} {
+		if info, err := os.Stat(filepath.Join(dir, sub)); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadObject decodes the object name of resource gr in namespace ("" for
+// cluster-scoped objects) into obj. It returns false if the object is not in
+// root.
+func ReadObject(root string, gr schema.GroupResource, namespace, name string, obj interface{}) (bool, error) {
+	file := ObjectPath(root, gr, namespace, name)
+	content, err := os.ReadFile(file)
+	if err == nil {
+		if err := sigsyaml.Unmarshal(content, obj); err != nil {
+			return false, fmt.Errorf("failed to decode %s: %w", file, err)
+		}
+		return true, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+
+	listFile := resourceDir(root, gr, namespace) + ".yaml"
+	content, err = os.ReadFile(listFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	list := struct {
+		Items []json.RawMessage `json:"items"`
+	}{}
+	if err := sigsyaml.Unmarshal(content, &list); err != nil {
+		return false, fmt.Errorf("failed to decode %s: %w", listFile, err)
+	}
+	for _, item := range list.Items {
+		meta := struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		}{}
+		if err := json.Unmarshal(item, &meta); err != nil {
+			return false, fmt.Errorf("failed to decode %s: %w", listFile, err)
+		}
+		if meta.Metadata.Name != name {
+			continue
+		}
+		if err := json.Unmarshal(item, obj); err != nil {
+			return false, fmt.Errorf("failed to decode %s in %s: %w", name, listFile, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// ListObjects returns, as JSON, the objects of resource gr in root: the
+// cluster-scoped ones, or those of all namespaces if namespaced is set. Like
+// ReadObject, it reads both object files and list files.
+func ListObjects(root string, gr schema.GroupResource, namespaced bool) ([]json.RawMessage, error) {
+	dirs := []string{resourceDir(root, gr, "")}
+	if namespaced {
+		entries, err := os.ReadDir(filepath.Join(root, namespacesDir))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		dirs = nil
+		for _, entry := range entries {
+			if entry.IsDir() {
+				dirs = append(dirs, resourceDir(root, gr, entry.Name()))
+			}
+		}
+	}
+
+	var objects []json.RawMessage
+	for _, dir := range dirs {
+		// An object may be both in its file and in the list file.
+		seen := map[string]bool{}
+		entries, err := os.ReadDir(dir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".yaml") {
+				continue
+			}
+			file := filepath.Join(dir, entry.Name())
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			object, err := sigsyaml.YAMLToJSON(content)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode %s: %w", file, err)
+			}
+			seen[strings.TrimSuffix(entry.Name(), ".yaml")] = true
+			objects = append(objects, object)
+		}
+
+		listFile := dir + ".yaml"
+		content, err := os.ReadFile(listFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list := struct {
+			Items []json.RawMessage `json:"items"`
+		}{}
+		if err := sigsyaml.Unmarshal(content, &list); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", listFile, err)
+		}
+		for _, item := range list.Items {
+			meta := struct {
+				Metadata struct {
+					Name string `json:"name"`
+				} `json:"metadata"`
+			}{}
+			if err := json.Unmarshal(item, &meta); err != nil {
+				return nil, fmt.Errorf("failed to decode %s: %w", listFile, err)
+			}
+			if seen[meta.Metadata.Name] {
+				continue
+			}
+			seen[meta.Metadata.Name] = true
+			objects = append(objects, item)
+		}
+	}
+	return objects, nil
+}
@@ -0,0 +1,164 @@
+package mustgather
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestObjectPath(t *testing.T) {
+	cases := []struct {
+		name      string
+		gr        schema.GroupResource
+		namespace string
+		expected  string
+	}{
+		{
+			name:     "cluster-scoped",
+			gr:       schema.GroupResource{Group: "storage.k8s.io", Resource: "csidrivers"},
+			expected: "root/cluster-scoped-resources/storage.k8s.io/csidrivers/obj.yaml",
+		},
+		{
+			name:      "namespaced core",
+			gr:        schema.GroupResource{Resource: "configmaps"},
+			namespace: "ns",
+			expected:  "root/namespaces/ns/core/configmaps/obj.yaml",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ObjectPath("root", tc.gr, tc.namespace, "obj"); got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestFindRoot(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := FindRoot(dir); err == nil {
+		t.Errorf("expected an error for an empty directory")
+	}
+
+	root := filepath.Join(dir, "image")
+	if err := os.MkdirAll(filepath.Join(root, namespacesDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{dir, root} {
+		got, err := FindRoot(d)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != root {
+			t.Errorf("expected %q, got %q", root, got)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "other", clusterScopedDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FindRoot(dir); err == nil {
+		t.Errorf("expected an error for several must-gather outputs")
+	}
+}
+
+func TestReadObject(t *testing.T) {
+	root := t.TempDir()
+	gr := schema.GroupResource{Resource: "configmaps"}
+	write := func(file, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(ObjectPath(root, gr, "ns", "single"), "metadata:\n  name: single\ndata:\n  key: single\n")
+	write(filepath.Join(root, namespacesDir, "ns", coreGroupDir, "configmaps.yaml"),
+		"items:\n- metadata:\n    name: listed\n  data:\n    key: listed\n")
+
+	type object struct {
+		Data map[string]string `json:"data"`
+	}
+	cases := []struct {
+		name          string
+		objName       string
+		expectedFound bool
+		expectedKey   string
+	}{
+		{name: "object file", objName: "single", expectedFound: true, expectedKey: "single"},
+		{name: "list file", objName: "listed", expectedFound: true, expectedKey: "listed"},
+		{name: "missing", objName: "missing"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			obj := &object{}
+			found, err := ReadObject(root, gr, "ns", tc.objName, obj)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if found != tc.expectedFound || obj.Data["key"] != tc.expectedKey {
+				t.Errorf("expected found=%t key=%q, got found=%t key=%q", tc.expectedFound, tc.expectedKey, found, obj.Data["key"])
+			}
+		})
+	}
+}
+
+func TestListObjects(t *testing.T) {
+	root := t.TempDir()
+	write := func(file, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configMaps := schema.GroupResource{Resource: "configmaps"}
+	write(ObjectPath(root, configMaps, "a", "single"), "metadata:\n  name: single\n")
+	write(filepath.Join(root, namespacesDir, "a", coreGroupDir, "configmaps.yaml"),
+		"items:\n- metadata:\n    name: single\n- metadata:\n    name: listed\n")
+	write(ObjectPath(root, configMaps, "b", "other"), "metadata:\n  name: other\n")
+	nodes := schema.GroupResource{Resource: "nodes"}
+	write(ObjectPath(root, nodes, "", "node-a"), "metadata:\n  name: node-a\n")
+
+	cases := []struct {
+		name       string
+		gr         schema.GroupResource
+		namespaced bool
+		expected   []string
+	}{
+		{name: "namespaced", gr: configMaps, namespaced: true, expected: []string{"single", "listed", "other"}},
+		{name: "cluster-scoped", gr: nodes, expected: []string{"node-a"}},
+		{name: "missing", gr: schema.GroupResource{Resource: "secrets"}, namespaced: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			objects, err := ListObjects(root, tc.gr, tc.namespaced)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var names []string
+			for _, object := range objects {
+				meta := struct {
+					Metadata struct {
+						Name string `json:"name"`
+					} `json:"metadata"`
+				}{}
+				if err := json.Unmarshal(object, &meta); err != nil {
+					t.Fatal(err)
+				}
+				names = append(names, meta.Metadata.Name)
+			}
+			if !reflect.DeepEqual(names, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, names)
+			}
+		})
+	}
+}
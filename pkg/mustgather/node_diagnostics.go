@@ -0,0 +1,130 @@
+package mustgather
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// driverContainerName is the driver container of the driver pods.
+	driverContainerName = "csi-driver"
+	// driverMetricsPort is the kube-rbac-proxy port in front of the driver
+	// metrics.
+	driverMetricsPort = 9095
+	// driverMetricsServiceName is the Service whose service-ca certificate
+	// the kube-rbac-proxy serves.
+	driverMetricsServiceName = "secrets-store-csi-driver-node-metrics"
+	// serviceCAConfigMapName is the ConfigMap the service-ca operator
+	// publishes its CA to in every namespace.
+	serviceCAConfigMapName = "openshift-service-ca.crt"
+	serviceCAConfigMapKey  = "service-ca.crt"
+)
+
+// providerSocketDirs are the provider socket directories the driver
+// watches, see assets/node.yaml.
+var providerSocketDirs = []string{
+	"/var/run/secrets-store-csi-providers",
+	"/etc/kubernetes/secrets-store-csi-providers",
+}
+
+// clusterNodeDiagnostics reads the provider socket directories with
+// `oc exec`, as client-go's remotecommand is not vendored, and scrapes the
+// driver metrics from the kube-rbac-proxy of the pod with the caller's
+// credentials.
+type clusterNodeDiagnostics struct {
+	ocPath         string
+	kubeConfigFile string
+	namespace      string
+	metricsClient  *http.Client
+	// metricsErr is why the driver metrics cannot be scraped, if they
+	// cannot.
+	metricsErr error
+}
+
+var _ NodeDiagnostics = &clusterNodeDiagnostics{}
+
+// NewClusterNodeDiagnostics returns the NodeDiagnostics of the driver pods
+// in namespace. ocPath is the oc binary and kubeConfigFile, if not empty,
+// its kubeconfig. Without the service CA of namespace, the driver metrics
+// are reported as not collected.
+func NewClusterNodeDiagnostics(ctx context.Context, restConfig *rest.Config, kubeClient kubernetes.Interface, ocPath, kubeConfigFile, namespace string) (NodeDiagnostics, error) {
+	diagnostics := &clusterNodeDiagnostics{
+		ocPath:         ocPath,
+		kubeConfigFile: kubeConfigFile,
+		namespace:      namespace,
+	}
+	serviceCA, err := kubeClient.CoreV1().ConfigMaps(namespace).Get(ctx, serviceCAConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		diagnostics.metricsErr = fmt.Errorf("failed to get the service CA: %w", err)
+		return diagnostics, nil
+	}
+	metricsConfig := rest.CopyConfig(restConfig)
+	metricsConfig.TLSClientConfig = rest.TLSClientConfig{
+		CertFile:   restConfig.CertFile,
+		KeyFile:    restConfig.KeyFile,
+		CertData:   restConfig.CertData,
+		KeyData:    restConfig.KeyData,
+		CAData:     []byte(serviceCA.Data[serviceCAConfigMapKey]),
+		ServerName: fmt.Sprintf("%s.%s.svc", driverMetricsServiceName, namespace),
+	}
+	diagnostics.metricsClient, err = rest.HTTPClientFor(metricsConfig)
+	if err != nil {
+		return nil, err
+	}
+	return diagnostics, nil
+}
+
+func (d *clusterNodeDiagnostics) ProviderSockets(ctx context.Context, pod *corev1.Pod) ([]byte, error) {
+	args := []string{"exec", "--namespace", d.namespace, pod.Name, "--container", driverContainerName}
+	if d.kubeConfigFile != "" {
+		args = append(args, "--kubeconfig", d.kubeConfigFile)
+	}
+	args = append(args, "--", "ls", "-la")
+	args = append(args, providerSocketDirs...)
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, d.ocPath, args...)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, stderr.String())
+	}
+	return out, nil
+}
+
+func (d *clusterNodeDiagnostics) DriverMetrics(ctx context.Context, pod *corev1.Pod) ([]byte, error) {
+	if d.metricsErr != nil {
+		return nil, d.metricsErr
+	}
+	if pod.Status.PodIP == "" {
+		return nil, fmt.Errorf("pod %s has no IP", pod.Name)
+	}
+	url := "https://" + net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(driverMetricsPort)) + "/metrics"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.metricsClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s: %s", url, resp.Status, body)
+	}
+	return body, nil
+}
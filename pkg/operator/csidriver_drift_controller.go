@@ -0,0 +1,316 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	applyoperatorv1 "github.com/openshift/client-go/operator/applyconfigurations/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceread"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	storagev1listers "k8s.io/client-go/listers/storage/v1"
+	"k8s.io/klog/v2"
+)
+
+// csiDriverDriftedCondition reports fields of the live CSIDriver that differ
+// from the manifest the operator renders. It does not end with Degraded:
+// drift the operator does not revert is the cluster admin's to fix, and
+// must not degrade the operator for as long as it stays.
+const csiDriverDriftedCondition = "SecretsStoreCSIDriverDrifted"
+
+// csiDriverField is a field of the CSIDriver spec checked for drift.
+type csiDriverField struct {
+	name   string
+	get    func(spec *storagev1.CSIDriverSpec) any
+	revert func(live, desired *storagev1.CSIDriverSpec)
+}
+
+// csiDriverFields are the fields the operator sets in csidriver.yaml or
+// renderSecretsStoreCSIDriver. Only the ones with a revert func are reverted
+// in strict mode; the others are either reverted by the static resources
+// controller when the rendered manifest changes, or deliberately preserved.
+// Unmanaged tokenRequests are rendered from the live CSIDriver, so edits of
+// them never show up as drift: they are the cluster admin's to change.
+var csiDriverFields = []csiDriverField{
+	{
+		name: "attachRequired",
+		get:  func(spec *storagev1.CSIDriverSpec) any { return spec.AttachRequired },
+	},
+	{
+		name:   "podInfoOnMount",
+		get:    func(spec *storagev1.CSIDriverSpec) any { return spec.PodInfoOnMount },
+		revert: func(live, desired *storagev1.CSIDriverSpec) { live.PodInfoOnMount = desired.PodInfoOnMount },
+	},
+	{
+		name:   "fsGroupPolicy",
+		get:    func(spec *storagev1.CSIDriverSpec) any { return spec.FSGroupPolicy },
+		revert: func(live, desired *storagev1.CSIDriverSpec) { live.FSGroupPolicy = desired.FSGroupPolicy },
+	},
+	{
+		name:   "volumeLifecycleModes",
+		get:    func(spec *storagev1.CSIDriverSpec) any { return spec.VolumeLifecycleModes },
+		revert: func(live, desired *storagev1.CSIDriverSpec) { live.VolumeLifecycleModes = desired.VolumeLifecycleModes },
+	},
+	{
+		name:   "requiresRepublish",
+		get:    func(spec *storagev1.CSIDriverSpec) any { return spec.RequiresRepublish },
+		revert: func(live, desired *storagev1.CSIDriverSpec) { live.RequiresRepublish = desired.RequiresRepublish },
+	},
+	{
+		name: "tokenRequests",
+		get:  func(spec *storagev1.CSIDriverSpec) any { return spec.TokenRequests },
+	},
+}
+
+// csiDriverDrift is a field of the live CSIDriver that differs from the
+// rendered manifest.
+type csiDriverDrift struct {
+	field    csiDriverField
+	expected string
+	found    string
+}
+
+func (d csiDriverDrift) String() string {
+	return fmt.Sprintf("%s (expected %s, found %s)", d.field.name, d.expected, d.found)
+}
+
+// csiDriverDriftController compares the live CSIDriver with the manifest the
+// static resources controller applies and reports the differing fields in
+// the SecretsStoreCSIDriverDrifted condition and as a Warning event.
+//
+// The static resources controller does not notice such drift: ApplyCSIDriver
+// only compares the spec hash annotation it stores on the object, which an
+// out-of-band edit of the spec leaves untouched. With
+// operatorConfig.CSIDriverDrift.Strict, this controller reverts the fields
+// kubelet relies on for mounts, podInfoOnMount, fsGroupPolicy,
+// volumeLifecycleModes and requiresRepublish. Fields the API server does not allow to update are
+// only reported, unless operatorConfig.CSIDriverDrift.RecreateImmutable opts
+// in to deleting the CSIDriver, which the static resources controller then
+// recreates from the manifest. Deleting it may fail the mounts of pods
+// starting in the meantime.
+type csiDriverDriftController struct {
+	name              string
+	operatorNamespace string
+	driverName        string
+	operatorClient    v1helpers.OperatorClientWithFinalizers
+	kubeClient        kubernetes.Interface
+	assetFunc         resourceapply.AssetFunc
+	csiDriverLister   storagev1listers.CSIDriverLister
+	configMapLister   corev1listers.ConfigMapLister
+
+	// reported is the drift last sent as an event, so that unchanged drift
+	// is not reported again on every resync. It is only accessed from sync,
+	// which the factory never runs concurrently.
+	reported string
+}
+
+func newCSIDriverDriftController(
+	name string,
+	operatorNamespace string,
+	driverName string,
+	operatorClient v1helpers.OperatorClientWithFinalizers,
+	kubeClient kubernetes.Interface,
+	assetFunc resourceapply.AssetFunc,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	recorder events.Recorder,
+) factory.Controller {
+	csiDriverInformer := kubeInformersForNamespaces.InformersFor("").Storage().V1().CSIDrivers()
+	configMapInformer := kubeInformersForNamespaces.InformersFor(operatorNamespace).Core().V1().ConfigMaps()
+	c := &csiDriverDriftController{
+		name:              name,
+		operatorNamespace: operatorNamespace,
+		driverName:        driverName,
+		operatorClient:    operatorClient,
+		kubeClient:        kubeClient,
+		assetFunc:         assetFunc,
+		csiDriverLister:   csiDriverInformer.Lister(),
+		configMapLister:   configMapInformer.Lister(),
+	}
+	return factory.New().WithInformers(
+		operatorClient.Informer(),
+		csiDriverInformer.Informer(),
+		configMapInformer.Informer(),
+	).WithSync(
+		c.sync,
+	).ResyncEvery(
+		time.Minute,
+	).WithSyncDegradedOnError(
+		operatorClient,
+	).ToController(
+		name,
+		recorder.WithComponentSuffix("secrets-store-csidriver-drift-controller"),
+	)
+}
+
+func (c *csiDriverDriftController) sync(ctx context.Context, syncContext factory.SyncContext) error {
+	if getOperatorSyncState(c.operatorClient) != opv1.Managed {
+		return nil
+	}
+
+	config, err := getOperatorConfig(c.configMapLister, c.operatorNamespace)
+	if err != nil {
+		return err
+	}
+	live, err := c.csiDriverLister.Get(c.driverName)
+	if apierrors.IsNotFound(err) {
+		// The static resources controller creates it.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get CSIDriver %q: %w", c.driverName, err)
+	}
+	manifest, err := c.assetFunc(csidriverAssetName)
+	if err != nil {
+		return err
+	}
+	desired := resourceread.ReadCSIDriverV1OrDie(manifest)
+
+	drift := getCSIDriverDrift(&desired.Spec, &live.Spec)
+	immutable := false
+	if config.CSIDriverDrift.Strict {
+		drift, immutable, err = c.revert(ctx, syncContext, live, desired, drift, config.CSIDriverDrift.RecreateImmutable)
+		if err != nil {
+			return err
+		}
+	}
+
+	message := formatCSIDriverDrift(drift)
+	if message != "" && message != c.reported {
+		syncContext.Recorder().Warningf("CSIDriverDrift", "CSIDriver %s differs from the operator's manifest: %s", c.driverName, message)
+	}
+	c.reported = message
+
+	condition := applyoperatorv1.OperatorCondition().
+		WithType(csiDriverDriftedCondition).
+		WithStatus(opv1.ConditionFalse).
+		WithReason("AsExpected")
+	if message != "" {
+		condition = condition.
+			WithStatus(opv1.ConditionTrue).
+			WithReason("DriftDetected").
+			WithMessage(fmt.Sprintf("CSIDriver %s differs from the operator's manifest: %s", c.driverName, message))
+		if immutable {
+			condition = condition.
+				WithReason("ImmutableDriftDetected").
+				WithMessage(fmt.Sprintf("CSIDriver %s differs from the operator's manifest in fields that cannot be updated: %s; set csiDriverDrift.recreateImmutable in ConfigMap %s to delete and recreate it, or recreate it manually",
+					c.driverName, message, operatorConfigMapName))
+		}
+	}
+	return c.operatorClient.ApplyOperatorStatus(ctx, c.name, applyoperatorv1.OperatorStatus().WithConditions(condition))
+}
+
+// revert reverts the revertable fields of drift on live and returns the
+// drift left. If the API server refuses the update, live is deleted when
+// recreate is set, and left as is otherwise: all of drift is then returned,
+// along with true.
+func (c *csiDriverDriftController) revert(
+	ctx context.Context,
+	syncContext factory.SyncContext,
+	live, desired *storagev1.CSIDriver,
+	drift []csiDriverDrift,
+	recreate bool,
+) ([]csiDriverDrift, bool, error) {
+	var reverted, left []csiDriverDrift
+	for _, d := range drift {
+		if d.field.revert != nil {
+			reverted = append(reverted, d)
+		} else {
+			left = append(left, d)
+		}
+	}
+	if len(reverted) == 0 {
+		return drift, false, nil
+	}
+
+	updated := live.DeepCopy()
+	for _, d := range reverted {
+		d.field.revert(&updated.Spec, &desired.Spec)
+	}
+	_, err := c.kubeClient.StorageV1().CSIDrivers().Update(ctx, updated, metav1.UpdateOptions{})
+	if apierrors.IsInvalid(err) && !recreate {
+		klog.V(2).Infof("CSIDriver %s cannot be updated to revert %s: %v", c.driverName, formatCSIDriverDrift(reverted), err)
+		return drift, true, nil
+	}
+	if apierrors.IsInvalid(err) {
+		klog.V(2).Infof("CSIDriver %s cannot be updated, deleting it to revert %s: %v", c.driverName, formatCSIDriverDrift(reverted), err)
+		err = c.kubeClient.StorageV1().CSIDrivers().Delete(ctx, c.driverName, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &live.UID},
+		})
+		// Deleted by an earlier sync the lister has not caught up with yet.
+		if apierrors.IsNotFound(err) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to revert CSIDriver %s: %w", c.driverName, err)
+	}
+	syncContext.Recorder().Eventf("CSIDriverDriftReverted", "Reverted CSIDriver %s: %s", c.driverName, formatCSIDriverDrift(reverted))
+	return left, false, nil
+}
+
+// getCSIDriverDrift returns the csiDriverFields whose value in live differs
+// from desired. Nil and empty lists are equal.
+func getCSIDriverDrift(desired, live *storagev1.CSIDriverSpec) []csiDriverDrift {
+	var drift []csiDriverDrift
+	for _, field := range csiDriverFields {
+		expected, found := field.get(desired), field.get(live)
+		if equality.Semantic.DeepEqual(expected, found) {
+			continue
+		}
+		drift = append(drift, csiDriverDrift{
+			field:    field,
+			expected: formatCSIDriverFieldValue(expected),
+			found:    formatCSIDriverFieldValue(found),
+		})
+	}
+	return drift
+}
+
+func formatCSIDriverDrift(drift []csiDriverDrift) string {
+	descriptions := make([]string, 0, len(drift))
+	for _, d := range drift {
+		descriptions = append(descriptions, d.String())
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// formatCSIDriverFieldValue formats a value returned by csiDriverField.get.
+func formatCSIDriverFieldValue(value any) string {
+	switch v := value.(type) {
+	case *bool:
+		if v == nil {
+			return "unset"
+		}
+		return fmt.Sprintf("%t", *v)
+	case *storagev1.FSGroupPolicy:
+		if v == nil {
+			return "unset"
+		}
+		return string(*v)
+	case []storagev1.VolumeLifecycleMode:
+		modes := make([]string, 0, len(v))
+		for _, mode := range v {
+			modes = append(modes, string(mode))
+		}
+		return "[" + strings.Join(modes, ", ") + "]"
+	case []storagev1.TokenRequest:
+		audiences := make([]string, 0, len(v))
+		for _, request := range v {
+			audiences = append(audiences, fmt.Sprintf("%q", request.Audience))
+		}
+		return "audiences [" + strings.Join(audiences, ", ") + "]"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,241 @@
+package operator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/utils/clock"
+	"k8s.io/utils/ptr"
+)
+
+// newTestLiveCSIDriver returns the CSIDriver of testCSIDriverYAML as the
+// static resources controller creates it, modified by mutate.
+func newTestLiveCSIDriver(mutate func(spec *storagev1.CSIDriverSpec)) *storagev1.CSIDriver {
+	fsGroupPolicy := storagev1.FileFSGroupPolicy
+	driver := &storagev1.CSIDriver{
+		ObjectMeta: metav1.ObjectMeta{Name: providerName, UID: "uid"},
+		Spec: storagev1.CSIDriverSpec{
+			AttachRequired:       ptr.To(false),
+			PodInfoOnMount:       ptr.To(true),
+			FSGroupPolicy:        &fsGroupPolicy,
+			VolumeLifecycleModes: []storagev1.VolumeLifecycleMode{storagev1.VolumeLifecycleEphemeral},
+			RequiresRepublish:    ptr.To(true),
+		},
+	}
+	if mutate != nil {
+		mutate(&driver.Spec)
+	}
+	return driver
+}
+
+func TestCSIDriverDriftControllerSync(t *testing.T) {
+	cases := []struct {
+		name               string
+		driver             *opv1.ClusterCSIDriver
+		live               *storagev1.CSIDriver
+		configMap          *corev1.ConfigMap
+		updateErr          error
+		wantStatus         opv1.ConditionStatus
+		wantMessageContain string
+		wantActions        []string
+		wantEvent          string
+	}{
+		{
+			name:       "no drift",
+			live:       newTestLiveCSIDriver(nil),
+			wantStatus: opv1.ConditionFalse,
+		},
+		{
+			name: "drift is reported",
+			live: newTestLiveCSIDriver(func(spec *storagev1.CSIDriverSpec) {
+				spec.PodInfoOnMount = ptr.To(false)
+				spec.VolumeLifecycleModes = append(spec.VolumeLifecycleModes, storagev1.VolumeLifecyclePersistent)
+			}),
+			wantStatus:         opv1.ConditionTrue,
+			wantMessageContain: "podInfoOnMount (expected true, found false); volumeLifecycleModes (expected [Ephemeral], found [Ephemeral, Persistent])",
+			wantEvent:          "CSIDriverDrift",
+		},
+		{
+			name: "managed token requests drift is reported",
+			driver: secretsStoreDriverConfig(opv1.SecretsStoreCSIDriverConfigSpec{
+				TokenRequests: opv1.SecretsStoreTokenRequests{
+					Type:    opv1.TokenRequestsManaged,
+					Managed: opv1.ManagedTokenRequests{Audiences: &[]opv1.SecretsStoreTokenRequest{}},
+				},
+			}),
+			live: newTestLiveCSIDriver(func(spec *storagev1.CSIDriverSpec) {
+				spec.TokenRequests = []storagev1.TokenRequest{{Audience: "vault"}}
+			}),
+			wantStatus:         opv1.ConditionTrue,
+			wantMessageContain: `tokenRequests (expected audiences [], found audiences ["vault"])`,
+			wantEvent:          "CSIDriverDrift",
+		},
+		{
+			name: "unmanaged token requests are preserved",
+			driver: secretsStoreDriverConfig(opv1.SecretsStoreCSIDriverConfigSpec{
+				TokenRequests: opv1.SecretsStoreTokenRequests{Type: opv1.TokenRequestsUnmanaged},
+			}),
+			live: newTestLiveCSIDriver(func(spec *storagev1.CSIDriverSpec) {
+				spec.TokenRequests = []storagev1.TokenRequest{{Audience: "vault"}}
+			}),
+			wantStatus: opv1.ConditionFalse,
+		},
+		{
+			name: "strict mode reverts by update",
+			live: newTestLiveCSIDriver(func(spec *storagev1.CSIDriverSpec) {
+				spec.PodInfoOnMount = ptr.To(false)
+			}),
+			configMap:   newOperatorConfigMap("csiDriverDrift:\n  strict: true\n"),
+			wantStatus:  opv1.ConditionFalse,
+			wantActions: []string{"update"},
+			wantEvent:   "CSIDriverDriftReverted",
+		},
+		{
+			name: "strict mode reports immutable drift",
+			live: newTestLiveCSIDriver(func(spec *storagev1.CSIDriverSpec) {
+				spec.VolumeLifecycleModes = []storagev1.VolumeLifecycleMode{storagev1.VolumeLifecyclePersistent}
+			}),
+			configMap: newOperatorConfigMap("csiDriverDrift:\n  strict: true\n"),
+			updateErr: apierrors.NewInvalid(schema.GroupKind{Group: "storage.k8s.io", Kind: "CSIDriver"}, providerName, field.ErrorList{
+				field.Invalid(field.NewPath("spec", "volumeLifecycleModes"), nil, "field is immutable"),
+			}),
+			wantStatus:         opv1.ConditionTrue,
+			wantMessageContain: "in fields that cannot be updated: volumeLifecycleModes (expected [Ephemeral], found [Persistent]); set csiDriverDrift.recreateImmutable",
+			wantActions:        []string{"update"},
+			wantEvent:          "CSIDriverDrift",
+		},
+		{
+			name: "strict mode recreates immutable drift when opted in",
+			live: newTestLiveCSIDriver(func(spec *storagev1.CSIDriverSpec) {
+				spec.VolumeLifecycleModes = []storagev1.VolumeLifecycleMode{storagev1.VolumeLifecyclePersistent}
+			}),
+			configMap: newOperatorConfigMap("csiDriverDrift:\n  strict: true\n  recreateImmutable: true\n"),
+			updateErr: apierrors.NewInvalid(schema.GroupKind{Group: "storage.k8s.io", Kind: "CSIDriver"}, providerName, field.ErrorList{
+				field.Invalid(field.NewPath("spec", "volumeLifecycleModes"), nil, "field is immutable"),
+			}),
+			wantStatus:  opv1.ConditionFalse,
+			wantActions: []string{"update", "delete"},
+			wantEvent:   "CSIDriverDriftReverted",
+		},
+		{
+			name: "strict mode reverts requiresRepublish",
+			live: newTestLiveCSIDriver(func(spec *storagev1.CSIDriverSpec) {
+				spec.RequiresRepublish = ptr.To(false)
+			}),
+			configMap:   newOperatorConfigMap("csiDriverDrift:\n  strict: true\n"),
+			wantStatus:  opv1.ConditionFalse,
+			wantActions: []string{"update"},
+			wantEvent:   "CSIDriverDriftReverted",
+		},
+		{
+			name: "strict mode keeps reporting fields it does not revert",
+			live: newTestLiveCSIDriver(func(spec *storagev1.CSIDriverSpec) {
+				spec.AttachRequired = ptr.To(true)
+			}),
+			configMap:          newOperatorConfigMap("csiDriverDrift:\n  strict: true\n"),
+			wantStatus:         opv1.ConditionTrue,
+			wantMessageContain: "attachRequired (expected false, found true)",
+			wantEvent:          "CSIDriverDrift",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			configMapLister := newTestConfigMapLister(t)
+			if tc.configMap != nil {
+				configMapLister = newTestConfigMapLister(t, tc.configMap)
+			}
+			kubeClient := fake.NewClientset(tc.live)
+			if tc.updateErr != nil {
+				kubeClient.PrependReactor("update", "csidrivers", func(clienttesting.Action) (bool, runtime.Object, error) {
+					return true, nil, tc.updateErr
+				})
+			}
+			operatorClient := v1helpers.NewFakeOperatorClientWithObjectMeta(
+				&metav1.ObjectMeta{Name: providerName},
+				&opv1.OperatorSpec{ManagementState: opv1.Managed},
+				&opv1.OperatorStatus{},
+				nil,
+			)
+			csiDriverLister := &fakeCSIDriverLister{driver: tc.live}
+			c := &csiDriverDriftController{
+				name:              "SecretsStoreCSIDriverDriftController",
+				operatorNamespace: testOperatorNamespace,
+				driverName:        providerName,
+				operatorClient:    operatorClient,
+				kubeClient:        kubeClient,
+				assetFunc: withSecretsStoreCSIDriverAsset(
+					baseAssetFunc,
+					newFakeClusterCSIDriverLister(t, tc.driver),
+					csiDriverLister,
+					providerName,
+				),
+				csiDriverLister: csiDriverLister,
+				configMapLister: configMapLister,
+			}
+			recorder := events.NewInMemoryRecorder(c.name, clock.RealClock{})
+			syncContext := factory.NewSyncContext(c.name, recorder)
+
+			if err := c.sync(context.Background(), syncContext); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_, status, _, _ := operatorClient.GetOperatorState()
+			// Drift never degrades the operator, which would otherwise stay
+			// Degraded for as long as the admin keeps the edit.
+			for _, condition := range status.Conditions {
+				if strings.HasSuffix(condition.Type, "Degraded") && condition.Status == opv1.ConditionTrue {
+					t.Fatalf("expected drift not to degrade the operator, got %+v", condition)
+				}
+			}
+			condition := v1helpers.FindOperatorCondition(status.Conditions, csiDriverDriftedCondition)
+			if condition == nil {
+				t.Fatalf("expected condition %s to be set", csiDriverDriftedCondition)
+			}
+			if condition.Status != tc.wantStatus {
+				t.Fatalf("expected condition status %s, got %s: %s", tc.wantStatus, condition.Status, condition.Message)
+			}
+			if !strings.Contains(condition.Message, tc.wantMessageContain) {
+				t.Fatalf("expected condition message to contain %q, got %q", tc.wantMessageContain, condition.Message)
+			}
+
+			var actions []string
+			for _, action := range kubeClient.Actions() {
+				actions = append(actions, action.GetVerb())
+			}
+			if strings.Join(actions, ",") != strings.Join(tc.wantActions, ",") {
+				t.Fatalf("expected actions %v, got %v", tc.wantActions, actions)
+			}
+
+			var reasons []string
+			for _, event := range recorder.Events() {
+				reasons = append(reasons, event.Reason)
+			}
+			if strings.Join(reasons, ",") != tc.wantEvent {
+				t.Fatalf("expected event %q, got %v", tc.wantEvent, reasons)
+			}
+
+			// Unchanged drift is not reported again.
+			if err := c.sync(context.Background(), syncContext); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.wantActions == nil && len(recorder.Events()) != len(reasons) {
+				t.Fatalf("expected no new event on resync, got %v", recorder.Events())
+			}
+		})
+	}
+}
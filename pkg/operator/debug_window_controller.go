@@ -0,0 +1,344 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	applyoperatorv1 "github.com/openshift/client-go/operator/applyconfigurations/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/csi/csidrivernodeservicecontroller"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/loglevel"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/utils/clock"
+)
+
+const (
+	// driverDebugWindowCondition is True while a debug window is open. Its
+	// lastTransitionTime is when the window was opened.
+	driverDebugWindowCondition = "SecretsStoreDriverDebugWindowActive"
+	// driverDebugNodeField is the node field the required node affinities
+	// of the driver and debug DaemonSets match the nodes of the open debug
+	// window by. The driver DaemonSet avoids them, the debug DaemonSet runs
+	// on them.
+	driverDebugNodeField = "metadata.name"
+	// driverDebugDaemonSetName is the DaemonSet running the driver on the
+	// nodes of the open debug window.
+	driverDebugDaemonSetName = "secrets-store-csi-driver-node-debug"
+
+	// maxDebugWindowTTL bounds debug windows, so that a forgotten one does
+	// not leave verbose drivers behind for long.
+	maxDebugWindowTTL = 24 * time.Hour
+)
+
+// getDebugWindowLogLevel returns the csi-driver log level of window,
+// TraceAll unless set.
+func getDebugWindowLogLevel(window *debugWindowConfig) opv1.LogLevel {
+	if window.LogLevel == "" {
+		return opv1.TraceAll
+	}
+	return window.LogLevel
+}
+
+// validateDebugWindow returns an error if window is not a valid
+// operatorConfig.DebugWindow.
+func validateDebugWindow(window *debugWindowConfig) error {
+	if len(window.Nodes) == 0 {
+		return fmt.Errorf("invalid debugWindow in ConfigMap %s: nodes must not be empty", operatorConfigMapName)
+	}
+	if window.TTL.Duration <= 0 || window.TTL.Duration > maxDebugWindowTTL {
+		return fmt.Errorf("invalid debugWindow.ttl %s in ConfigMap %s: must be positive and at most %s", window.TTL.Duration, operatorConfigMapName, maxDebugWindowTTL)
+	}
+	return validateLogLevel("debugWindow.logLevel", window.LogLevel)
+}
+
+// withDebugWindowDaemonSetHook returns a DaemonSetHookFunc that keeps the
+// driver DaemonSet off the nodes of the open debug window, where the debug
+// DaemonSet of debugWindowController runs instead. The window is open while
+// the debug DaemonSet exists, and its nodes are the ones the debug DaemonSet
+// runs on. It must run after the node-placement hook, which may replace the
+// affinity.
+func withDebugWindowDaemonSetHook(daemonSetLister appsv1listers.DaemonSetLister, operatorNamespace string) csidrivernodeservicecontroller.DaemonSetHookFunc {
+	return func(_ *opv1.OperatorSpec, daemonSet *appsv1.DaemonSet) error {
+		debug, err := daemonSetLister.DaemonSets(operatorNamespace).Get(driverDebugDaemonSetName)
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get DaemonSet %s/%s: %w", operatorNamespace, driverDebugDaemonSetName, err)
+		}
+		setDriverDebugNodeRequirement(&daemonSet.Spec.Template.Spec, corev1.NodeSelectorOpNotIn, getDriverDebugNodes(&debug.Spec.Template.Spec))
+		return nil
+	}
+}
+
+// getDriverDebugNodes returns the nodes of the driverDebugNodeField
+// requirement of the required node affinity of podSpec, as set by
+// setDriverDebugNodeRequirement.
+func getDriverDebugNodes(podSpec *corev1.PodSpec) []string {
+	if podSpec.Affinity == nil || podSpec.Affinity.NodeAffinity == nil || podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return nil
+	}
+	for _, term := range podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		for _, requirement := range term.MatchFields {
+			if requirement.Key == driverDebugNodeField {
+				return requirement.Values
+			}
+		}
+	}
+	return nil
+}
+
+// setDriverDebugNodeRequirement sets the requirement that driverDebugNodeField
+// is operator nodes in every term of the required node affinity of podSpec.
+// It leaves podSpec unchanged if nodes is empty.
+func setDriverDebugNodeRequirement(podSpec *corev1.PodSpec, operator corev1.NodeSelectorOperator, nodes []string) {
+	if len(nodes) == 0 {
+		return
+	}
+	requirement := corev1.NodeSelectorRequirement{Key: driverDebugNodeField, Operator: operator, Values: slices.Clone(nodes)}
+	if podSpec.Affinity == nil {
+		podSpec.Affinity = &corev1.Affinity{}
+	}
+	if podSpec.Affinity.NodeAffinity == nil {
+		podSpec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	nodeAffinity := podSpec.Affinity.NodeAffinity
+	if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{}
+	}
+	terms := nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) == 0 {
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms = []corev1.NodeSelectorTerm{{
+			MatchFields: []corev1.NodeSelectorRequirement{requirement},
+		}}
+		return
+	}
+	for i := range terms {
+		term := &terms[i]
+		// A term without requirements matches no node, and must keep
+		// matching none.
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+		term.MatchFields = slices.DeleteFunc(term.MatchFields, func(r corev1.NodeSelectorRequirement) bool {
+			return r.Key == driverDebugNodeField
+		})
+		term.MatchFields = append(term.MatchFields, requirement)
+	}
+}
+
+// newDebugDaemonSet returns the debug DaemonSet of the driver DaemonSet
+// driver: the same pods with the csi-driver container at logLevel, on nodes
+// only. Its pods are not selected by the driver's metrics Service.
+func newDebugDaemonSet(driver *appsv1.DaemonSet, nodes []string, logLevel opv1.LogLevel) (*appsv1.DaemonSet, error) {
+	debugLabels := map[string]string{"app": driverDebugDaemonSetName}
+	debug := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      driverDebugDaemonSetName,
+			Namespace: driver.Namespace,
+			Labels:    debugLabels,
+		},
+		Spec: *driver.Spec.DeepCopy(),
+	}
+	debug.Spec.Selector = &metav1.LabelSelector{MatchLabels: debugLabels}
+	templateLabels := map[string]string{}
+	for key, value := range driver.Spec.Template.Labels {
+		templateLabels[key] = value
+	}
+	for key, value := range debugLabels {
+		templateLabels[key] = value
+	}
+	debug.Spec.Template.Labels = templateLabels
+	setDriverDebugNodeRequirement(&debug.Spec.Template.Spec, corev1.NodeSelectorOpIn, nodes)
+
+	container, err := findContainer(debug, csiDriverContainerName)
+	if err != nil {
+		return nil, err
+	}
+	container.Args = setArg(container.Args, verbosityArgPrefix, strconv.Itoa(loglevel.LogLevelToVerbosity(logLevel)))
+	return debug, nil
+}
+
+// debugWindowController opens and closes the debug window of
+// operatorConfig.DebugWindow. While it is open, the nodes of the window run
+// the debug DaemonSet instead of the driver DaemonSet, see
+// withDebugWindowDaemonSetHook. The window closes once its TTL has passed
+// since it opened, as recorded in the SecretsStoreDriverDebugWindowActive
+// condition, and stays closed until debugWindow is removed from the config.
+// It is closed as well when the operator is Removed.
+type debugWindowController struct {
+	name              string
+	operatorNamespace string
+	operatorClient    v1helpers.OperatorClientWithFinalizers
+	kubeClient        kubernetes.Interface
+	configMapLister   corev1listers.ConfigMapLister
+	daemonSetLister   appsv1listers.DaemonSetLister
+	clock             clock.PassiveClock
+}
+
+func newDebugWindowController(
+	name string,
+	operatorNamespace string,
+	operatorClient v1helpers.OperatorClientWithFinalizers,
+	kubeClient kubernetes.Interface,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	clock clock.PassiveClock,
+	recorder events.Recorder,
+) factory.Controller {
+	configMapInformer := kubeInformersForNamespaces.InformersFor(operatorNamespace).Core().V1().ConfigMaps()
+	daemonSetInformer := kubeInformersForNamespaces.InformersFor(operatorNamespace).Apps().V1().DaemonSets()
+	c := &debugWindowController{
+		name:              name,
+		operatorNamespace: operatorNamespace,
+		operatorClient:    operatorClient,
+		kubeClient:        kubeClient,
+		configMapLister:   configMapInformer.Lister(),
+		daemonSetLister:   daemonSetInformer.Lister(),
+		clock:             clock,
+	}
+	return factory.New().WithInformers(
+		operatorClient.Informer(),
+		configMapInformer.Informer(),
+		daemonSetInformer.Informer(),
+	).WithSync(
+		c.sync,
+	).ResyncEvery(
+		time.Minute,
+	).WithSyncDegradedOnError(
+		operatorClient,
+	).ToController(
+		name,
+		recorder.WithComponentSuffix("secrets-store-debug-window-controller"),
+	)
+}
+
+func (c *debugWindowController) sync(ctx context.Context, syncContext factory.SyncContext) error {
+	switch getOperatorSyncState(c.operatorClient) {
+	case opv1.Managed:
+		return c.syncManaged(ctx, syncContext)
+	case opv1.Removed:
+		return c.closeWindow(ctx, syncContext.Recorder())
+	default:
+		return nil
+	}
+}
+
+func (c *debugWindowController) syncManaged(ctx context.Context, syncContext factory.SyncContext) error {
+	config, err := getOperatorConfig(c.configMapLister, c.operatorNamespace)
+	if err != nil {
+		return err
+	}
+	window := config.DebugWindow
+	if window != nil {
+		if err := validateDebugWindow(window); err != nil {
+			return err
+		}
+	}
+	_, status, _, err := c.operatorClient.GetOperatorState()
+	if err != nil {
+		return err
+	}
+	existing := v1helpers.FindOperatorCondition(status.Conditions, driverDebugWindowCondition)
+
+	condition := applyoperatorv1.OperatorCondition().
+		WithType(driverDebugWindowCondition).
+		WithStatus(opv1.ConditionFalse).
+		WithReason("NoDebugWindow").
+		WithMessage("no debugWindow is configured")
+	open := false
+	switch {
+	case window == nil:
+	case existing != nil && existing.Status == opv1.ConditionFalse && existing.Reason == "DebugWindowExpired":
+		condition = condition.WithReason(existing.Reason).WithMessage(existing.Message)
+	default:
+		start := c.clock.Now()
+		if existing != nil && existing.Status == opv1.ConditionTrue {
+			start = existing.LastTransitionTime.Time
+		}
+		expiry := start.Add(window.TTL.Duration)
+		if !c.clock.Now().Before(expiry) {
+			condition = condition.
+				WithReason("DebugWindowExpired").
+				WithMessage(fmt.Sprintf("the debug window of nodes %s expired at %s; remove debugWindow from ConfigMap %s to open a new one",
+					strings.Join(window.Nodes, ", "), expiry.UTC().Format(time.RFC3339), operatorConfigMapName))
+			break
+		}
+		open, err = c.openWindow(ctx, syncContext.Recorder(), window)
+		if err != nil {
+			return err
+		}
+		if !open {
+			condition = condition.
+				WithReason("WaitingForDriver").
+				WithMessage(fmt.Sprintf("the debug window opens once DaemonSet %s/%s exists", c.operatorNamespace, driverDaemonSetName))
+			break
+		}
+		condition = condition.
+			WithStatus(opv1.ConditionTrue).
+			WithReason("DebugWindowActive").
+			WithMessage(fmt.Sprintf("csi-driver log level %s on nodes %s until %s",
+				getDebugWindowLogLevel(window), strings.Join(window.Nodes, ", "), expiry.UTC().Format(time.RFC3339))).
+			WithLastTransitionTime(metav1.NewTime(start))
+	}
+	if !open {
+		if err := c.closeWindow(ctx, syncContext.Recorder()); err != nil {
+			return err
+		}
+	}
+	return c.operatorClient.ApplyOperatorStatus(ctx, c.name, applyoperatorv1.OperatorStatus().WithConditions(condition))
+}
+
+// openWindow applies the debug DaemonSet of window. It returns false if there is no driver DaemonSet to derive it from yet.
+func (c *debugWindowController) openWindow(ctx context.Context, recorder events.Recorder, window *debugWindowConfig) (bool, error) {
+	driver, err := c.daemonSetLister.DaemonSets(c.operatorNamespace).Get(driverDaemonSetName)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	debug, err := newDebugDaemonSet(driver, window.Nodes, getDebugWindowLogLevel(window))
+	if err != nil {
+		return false, err
+	}
+	expectedGeneration := int64(-1)
+	if existing, err := c.daemonSetLister.DaemonSets(c.operatorNamespace).Get(driverDebugDaemonSetName); err == nil {
+		expectedGeneration = existing.Generation
+	} else if !apierrors.IsNotFound(err) {
+		return false, err
+	}
+	if _, _, err := resourceapply.ApplyDaemonSet(ctx, c.kubeClient.AppsV1(), recorder, debug, expectedGeneration); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// closeWindow deletes the debug DaemonSet, so that the driver DaemonSet runs
+// on its nodes again.
+func (c *debugWindowController) closeWindow(ctx context.Context, recorder events.Recorder) error {
+	if _, err := c.daemonSetLister.DaemonSets(c.operatorNamespace).Get(driverDebugDaemonSetName); apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	err := c.kubeClient.AppsV1().DaemonSets(c.operatorNamespace).Delete(ctx, driverDebugDaemonSetName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	recorder.Eventf("DriverDebugWindowClosed", "Deleted DaemonSet %s/%s", c.operatorNamespace, driverDebugDaemonSetName)
+	return nil
+}
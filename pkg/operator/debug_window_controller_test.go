@@ -0,0 +1,317 @@
+package operator
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
+)
+
+const testDebugWindowConfig = "debugWindow:\n  nodes: [node-a]\n  ttl: 1h\n"
+
+func newTestDebugDaemonSetFixture() *appsv1.DaemonSet {
+	return &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: driverDebugDaemonSetName, Namespace: testOperatorNamespace}}
+}
+
+func TestSetDriverDebugNodeRequirement(t *testing.T) {
+	podSpec := &corev1.PodSpec{}
+	setDriverDebugNodeRequirement(podSpec, corev1.NodeSelectorOpNotIn, nil)
+	if podSpec.Affinity != nil {
+		t.Fatalf("expected no affinity without nodes, got %+v", podSpec.Affinity)
+	}
+	setDriverDebugNodeRequirement(podSpec, corev1.NodeSelectorOpNotIn, []string{"node-a"})
+	terms := podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) != 1 || len(terms[0].MatchFields) != 1 || terms[0].MatchFields[0].Operator != corev1.NodeSelectorOpNotIn {
+		t.Fatalf("expected a single NotIn term, got %+v", terms)
+	}
+
+	// Every non-empty term of a placement affinity gets the requirement,
+	// replacing an earlier one.
+	podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms = append(terms,
+		corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "node-role.kubernetes.io/infra", Operator: corev1.NodeSelectorOpExists}}},
+		corev1.NodeSelectorTerm{},
+	)
+	setDriverDebugNodeRequirement(podSpec, corev1.NodeSelectorOpIn, []string{"node-a", "node-b"})
+	terms = podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms[0].MatchFields) != 1 || terms[0].MatchFields[0].Operator != corev1.NodeSelectorOpIn {
+		t.Errorf("expected the requirement to be replaced, got %+v", terms[0])
+	}
+	if len(terms[1].MatchExpressions) != 1 || len(terms[1].MatchFields) != 1 || terms[1].MatchFields[0].Key != driverDebugNodeField {
+		t.Errorf("expected the requirement to be added, got %+v", terms[1])
+	}
+	if len(terms[2].MatchExpressions) != 0 || len(terms[2].MatchFields) != 0 {
+		t.Errorf("expected the empty term to stay empty, got %+v", terms[2])
+	}
+	if nodes := getDriverDebugNodes(podSpec); !reflect.DeepEqual(nodes, []string{"node-a", "node-b"}) {
+		t.Errorf("expected nodes [node-a node-b], got %v", nodes)
+	}
+}
+
+func TestWithDebugWindowDaemonSetHook(t *testing.T) {
+	debug := newTestDebugDaemonSetFixture()
+	setDriverDebugNodeRequirement(&debug.Spec.Template.Spec, corev1.NodeSelectorOpIn, []string{"node-a"})
+
+	cases := []struct {
+		name       string
+		daemonSets []*appsv1.DaemonSet
+		wantNodes  []string
+	}{
+		{
+			name: "closed window",
+		},
+		{
+			name:       "open window",
+			daemonSets: []*appsv1.DaemonSet{debug},
+			wantNodes:  []string{"node-a"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			daemonSetIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			for _, daemonSet := range tc.daemonSets {
+				if err := daemonSetIndexer.Add(daemonSet); err != nil {
+					t.Fatal(err)
+				}
+			}
+			hook := withDebugWindowDaemonSetHook(appsv1listers.NewDaemonSetLister(daemonSetIndexer), testOperatorNamespace)
+
+			driver := newTestDaemonSet()
+			if err := hook(&opv1.OperatorSpec{}, driver); err != nil {
+				t.Fatalf("unexpected error from hook: %v", err)
+			}
+			if tc.wantNodes == nil {
+				if driver.Spec.Template.Spec.Affinity != nil {
+					t.Fatalf("expected no affinity, got %+v", driver.Spec.Template.Spec.Affinity)
+				}
+				return
+			}
+			requirement := driver.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchFields[0]
+			if requirement.Operator != corev1.NodeSelectorOpNotIn || !reflect.DeepEqual(requirement.Values, tc.wantNodes) {
+				t.Fatalf("expected the driver DaemonSet to avoid nodes %v, got %+v", tc.wantNodes, requirement)
+			}
+		})
+	}
+}
+
+func TestNewDebugDaemonSet(t *testing.T) {
+	driver := newTestDaemonSet()
+	driver.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": driverDaemonSetName}}
+	driver.Spec.Template.Labels = map[string]string{"app": driverDaemonSetName, "openshift.storage.network-policy.api-server": "allow"}
+	driver.Spec.Template.Spec.Containers[0].Args = []string{"--v=2"}
+	setDriverDebugNodeRequirement(&driver.Spec.Template.Spec, corev1.NodeSelectorOpNotIn, []string{"node-a"})
+
+	debug, err := newDebugDaemonSet(driver, []string{"node-a"}, opv1.Trace)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if debug.Spec.Selector.MatchLabels["app"] != driverDebugDaemonSetName || debug.Spec.Template.Labels["app"] != driverDebugDaemonSetName {
+		t.Errorf("expected the debug DaemonSet to select its own pods, got %+v", debug.Spec)
+	}
+	if debug.Spec.Template.Labels["openshift.storage.network-policy.api-server"] != "allow" {
+		t.Errorf("expected the other pod labels to be kept, got %v", debug.Spec.Template.Labels)
+	}
+	fields := debug.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchFields
+	if len(fields) != 1 || fields[0].Operator != corev1.NodeSelectorOpIn || !reflect.DeepEqual(fields[0].Values, []string{"node-a"}) {
+		t.Errorf("expected the debug DaemonSet to run on the debug nodes only, got %+v", fields)
+	}
+	if args := debug.Spec.Template.Spec.Containers[0].Args; len(args) != 1 || args[0] != "--v=6" {
+		t.Errorf("expected --v=6, got %v", args)
+	}
+	if driver.Spec.Template.Spec.Containers[0].Args[0] != "--v=2" {
+		t.Errorf("expected the driver DaemonSet to be left unchanged")
+	}
+}
+
+func TestDebugWindowController(t *testing.T) {
+	cases := []struct {
+		name            string
+		managementState opv1.ManagementState
+		config          string
+		existing        *opv1.OperatorCondition
+		daemonSets      []*appsv1.DaemonSet
+		wantStatus      opv1.ConditionStatus
+		wantReason      string
+		wantMessage     string
+		wantActions     []string
+		wantErrContains string
+	}{
+		{
+			name:        "no debug window",
+			wantStatus:  opv1.ConditionFalse,
+			wantReason:  "NoDebugWindow",
+			wantMessage: "no debugWindow is configured",
+		},
+		{
+			name:        "window opens",
+			config:      testDebugWindowConfig,
+			daemonSets:  []*appsv1.DaemonSet{newTestDaemonSet()},
+			wantStatus:  opv1.ConditionTrue,
+			wantReason:  "DebugWindowActive",
+			wantMessage: "csi-driver log level TraceAll on nodes node-a until 2025-06-01T13:00:00Z",
+			wantActions: []string{"get daemonsets", "create daemonsets"},
+		},
+		{
+			name:   "open window keeps its expiry",
+			config: testDebugWindowConfig,
+			existing: &opv1.OperatorCondition{
+				Type: driverDebugWindowCondition, Status: opv1.ConditionTrue, Reason: "DebugWindowActive",
+				LastTransitionTime: metav1.NewTime(testNow.Add(-30 * time.Minute)),
+			},
+			daemonSets:  []*appsv1.DaemonSet{newTestDaemonSet()},
+			wantStatus:  opv1.ConditionTrue,
+			wantReason:  "DebugWindowActive",
+			wantMessage: "until 2025-06-01T12:30:00Z",
+			wantActions: []string{"get daemonsets", "create daemonsets"},
+		},
+		{
+			name:   "window expires",
+			config: testDebugWindowConfig,
+			existing: &opv1.OperatorCondition{
+				Type: driverDebugWindowCondition, Status: opv1.ConditionTrue, Reason: "DebugWindowActive",
+				LastTransitionTime: metav1.NewTime(testNow.Add(-2 * time.Hour)),
+			},
+			daemonSets:  []*appsv1.DaemonSet{newTestDaemonSet(), newTestDebugDaemonSetFixture()},
+			wantStatus:  opv1.ConditionFalse,
+			wantReason:  "DebugWindowExpired",
+			wantMessage: "the debug window of nodes node-a expired at 2025-06-01T11:00:00Z",
+			wantActions: []string{"delete daemonsets"},
+		},
+		{
+			name:   "expired window stays closed",
+			config: testDebugWindowConfig,
+			existing: &opv1.OperatorCondition{
+				Type: driverDebugWindowCondition, Status: opv1.ConditionFalse, Reason: "DebugWindowExpired", Message: "expired earlier",
+			},
+			daemonSets:  []*appsv1.DaemonSet{newTestDaemonSet()},
+			wantStatus:  opv1.ConditionFalse,
+			wantReason:  "DebugWindowExpired",
+			wantMessage: "expired earlier",
+		},
+		{
+			name:        "removed window closes",
+			daemonSets:  []*appsv1.DaemonSet{newTestDebugDaemonSetFixture()},
+			wantStatus:  opv1.ConditionFalse,
+			wantReason:  "NoDebugWindow",
+			wantActions: []string{"delete daemonsets"},
+		},
+		{
+			name:            "removed operator closes the window",
+			managementState: opv1.Removed,
+			config:          testDebugWindowConfig,
+			daemonSets:      []*appsv1.DaemonSet{newTestDebugDaemonSetFixture()},
+			wantActions:     []string{"delete daemonsets"},
+		},
+		{
+			name:        "waiting for the driver DaemonSet",
+			config:      testDebugWindowConfig,
+			wantStatus:  opv1.ConditionFalse,
+			wantReason:  "WaitingForDriver",
+			wantMessage: "the debug window opens once DaemonSet",
+		},
+		{
+			name:            "ttl above the maximum is an error",
+			config:          "debugWindow:\n  nodes: [node-a]\n  ttl: 48h\n",
+			wantErrContains: "invalid debugWindow.ttl 48h0m0s",
+		},
+		{
+			name:            "window without nodes is an error",
+			config:          "debugWindow:\n  ttl: 1h\n",
+			wantErrContains: "nodes must not be empty",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			configMapLister := newTestConfigMapLister(t)
+			if tc.config != "" {
+				configMapLister = newTestConfigMapLister(t, newOperatorConfigMap(tc.config))
+			}
+			daemonSetIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			for _, daemonSet := range tc.daemonSets {
+				if err := daemonSetIndexer.Add(daemonSet); err != nil {
+					t.Fatal(err)
+				}
+			}
+			managementState := tc.managementState
+			if managementState == "" {
+				managementState = opv1.Managed
+			}
+			status := &opv1.OperatorStatus{}
+			if tc.existing != nil {
+				status.Conditions = []opv1.OperatorCondition{*tc.existing}
+			}
+			operatorClient := v1helpers.NewFakeOperatorClientWithObjectMeta(
+				&metav1.ObjectMeta{Name: providerName},
+				&opv1.OperatorSpec{ManagementState: managementState},
+				status,
+				nil,
+			)
+			kubeClient := fake.NewClientset()
+			for _, daemonSet := range tc.daemonSets {
+				if daemonSet.Name == driverDebugDaemonSetName {
+					if err := kubeClient.Tracker().Add(daemonSet); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			c := &debugWindowController{
+				name:              "SecretsStoreDebugWindowController",
+				operatorNamespace: testOperatorNamespace,
+				operatorClient:    operatorClient,
+				kubeClient:        kubeClient,
+				configMapLister:   configMapLister,
+				daemonSetLister:   appsv1listers.NewDaemonSetLister(daemonSetIndexer),
+				clock:             fakePassiveClock{now: testNow},
+			}
+			syncContext := factory.NewSyncContext(c.name, events.NewInMemoryRecorder(c.name, clock.RealClock{}))
+
+			err := c.sync(context.Background(), syncContext)
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErrContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_, status, _, _ = operatorClient.GetOperatorState()
+			condition := v1helpers.FindOperatorCondition(status.Conditions, driverDebugWindowCondition)
+			switch {
+			case tc.wantReason == "":
+				if condition != nil {
+					t.Fatalf("expected condition %s not to be set, got %+v", driverDebugWindowCondition, condition)
+				}
+			case condition == nil:
+				t.Fatalf("expected condition %s to be set", driverDebugWindowCondition)
+			case condition.Status != tc.wantStatus || condition.Reason != tc.wantReason:
+				t.Fatalf("expected condition %s/%s, got %s/%s: %s", tc.wantStatus, tc.wantReason, condition.Status, condition.Reason, condition.Message)
+			case !strings.Contains(condition.Message, tc.wantMessage):
+				t.Fatalf("expected condition message to contain %q, got %q", tc.wantMessage, condition.Message)
+			}
+
+			var actions []string
+			for _, action := range kubeClient.Actions() {
+				actions = append(actions, action.GetVerb()+" "+action.GetResource().Resource)
+			}
+			if strings.Join(actions, ",") != strings.Join(tc.wantActions, ",") {
+				t.Fatalf("expected actions %v, got %v", tc.wantActions, actions)
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	configv1 "github.com/openshift/api/config/v1"
+	opv1 "github.com/openshift/api/operator/v1"
+	configclient "github.com/openshift/client-go/config/clientset/versioned"
+	operatorclient "github.com/openshift/client-go/operator/clientset/versioned"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/openshift/secrets-store-csi-driver-operator/pkg/mustgather"
+	sscsitls "github.com/openshift/secrets-store-csi-driver-operator/pkg/tls"
+)
+
+// Diagnosis explains the configuration the operator resolves from the
+// cluster and whether the driver runs with it.
+type Diagnosis struct {
+	Rotation      RotationDiagnosis      `json:"rotation"`
+	TokenRequests TokenRequestsDiagnosis `json:"tokenRequests"`
+	TLS           TLSDiagnosis           `json:"tls"`
+	// DaemonSet compares the args of the live driver DaemonSet with the
+	// rendered ones.
+	DaemonSet ObjectDiagnosis `json:"daemonSet"`
+	// CSIDriver compares the live CSIDriver with the rendered one.
+	CSIDriver ObjectDiagnosis `json:"csiDriver"`
+	// Conditions are the operator conditions of the ClusterCSIDriver.
+	Conditions []opv1.OperatorCondition `json:"conditions,omitempty"`
+}
+
+// RotationDiagnosis explains the secret rotation config.
+type RotationDiagnosis struct {
+	// Branch explains the getSecretRotationConfig branch taken.
+	Branch   string `json:"branch"`
+	Enabled  bool   `json:"enabled"`
+	Interval string `json:"interval,omitempty"`
+	// DriverInterval is the interval of the rendered DaemonSet, after the
+	// rotation policies and rotation safety.
+	DriverInterval string `json:"driverInterval,omitempty"`
+}
+
+// TokenRequestsDiagnosis explains the CSIDriver tokenRequests config.
+type TokenRequestsDiagnosis struct {
+	// Branch explains the getEffectiveTokenRequests branch taken.
+	Branch    string   `json:"branch"`
+	Managed   bool     `json:"managed"`
+	Audiences []string `json:"audiences,omitempty"`
+	// Warnings are the managed audiences of the cluster API server, see
+	// checkTokenRequestAudiences.
+	Warnings []string `json:"warnings,omitempty"`
+	// IssuerUnknown is set when the service account issuer, which the
+	// audiences are compared to, is unknown.
+	IssuerUnknown bool `json:"issuerUnknown,omitempty"`
+}
+
+// TLSDiagnosis explains the cluster TLS security profile. Its fields are
+// "unknown" when the APIServer config is.
+type TLSDiagnosis struct {
+	Profile       string `json:"profile"`
+	MinTLSVersion string `json:"minTLSVersion"`
+	Adherence     string `json:"adherence"`
+	Honored       bool   `json:"honored"`
+}
+
+// ObjectDiagnosis compares a live object with the rendered one.
+type ObjectDiagnosis struct {
+	Found       bool     `json:"found"`
+	Differences []string `json:"differences,omitempty"`
+}
+
+// LoadClusterObjects reads the objects Diagnose and Render take from the
+// cluster of restConfig.
+func LoadClusterObjects(ctx context.Context, restConfig *rest.Config, operatorNamespace string) (RenderOptions, error) {
+	opts := RenderOptions{OperatorNamespace: operatorNamespace}
+	kubeClient, err := kubeclient.NewForConfig(restConfig)
+	if err != nil {
+		return opts, err
+	}
+	configClient, err := configclient.NewForConfig(restConfig)
+	if err != nil {
+		return opts, err
+	}
+	operatorClient, err := operatorclient.NewForConfig(restConfig)
+	if err != nil {
+		return opts, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return opts, err
+	}
+
+	opts.ClusterCSIDriver, err = operatorClient.OperatorV1().ClusterCSIDrivers().Get(ctx, providerName, metav1.GetOptions{})
+	if err != nil {
+		return opts, fmt.Errorf("failed to get ClusterCSIDriver %q: %w", providerName, err)
+	}
+	if opts.CSIDriver, err = ignoreNotFound(kubeClient.StorageV1().CSIDrivers().Get(ctx, providerName, metav1.GetOptions{})); err != nil {
+		return opts, err
+	}
+	if opts.DaemonSet, err = ignoreNotFound(kubeClient.AppsV1().DaemonSets(operatorNamespace).Get(ctx, driverDaemonSetName, metav1.GetOptions{})); err != nil {
+		return opts, err
+	}
+	if opts.OperatorConfig, err = ignoreNotFound(kubeClient.CoreV1().ConfigMaps(operatorNamespace).Get(ctx, operatorConfigMapName, metav1.GetOptions{})); err != nil {
+		return opts, err
+	}
+	if opts.APIServer, err = ignoreNotFound(configClient.ConfigV1().APIServers().Get(ctx, sscsitls.APIServerName, metav1.GetOptions{})); err != nil {
+		return opts, err
+	}
+	if opts.Authentication, err = ignoreNotFound(configClient.ConfigV1().Authentications().Get(ctx, authenticationName, metav1.GetOptions{})); err != nil {
+		return opts, err
+	}
+	for gvr, objs := range map[schema.GroupVersionResource]*[]*unstructured.Unstructured{
+		secretProviderClassGVR:          &opts.SecretProviderClasses,
+		secretProviderClassPodStatusGVR: &opts.SecretProviderClassPodStatuses,
+	} {
+		list, err := dynamicClient.Resource(gvr).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return opts, fmt.Errorf("failed to list %s: %w", gvr.Resource, err)
+		}
+		for i := range list.Items {
+			*objs = append(*objs, &list.Items[i])
+		}
+	}
+	nodes, err := kubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return opts, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	for i := range nodes.Items {
+		opts.Nodes = append(opts.Nodes, &nodes.Items[i])
+	}
+	return opts, nil
+}
+
+func ignoreNotFound[T any](obj *T, err error) (*T, error) {
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	return obj, err
+}
+
+// LoadMustGatherObjects reads the objects Diagnose and Render take from the
+// must-gather output in dir, see package mustgather.
+func LoadMustGatherObjects(dir, operatorNamespace string) (RenderOptions, error) {
+	opts := RenderOptions{OperatorNamespace: operatorNamespace}
+	root, err := mustgather.FindRoot(dir)
+	if err != nil {
+		return opts, err
+	}
+
+	opts.ClusterCSIDriver = &opv1.ClusterCSIDriver{}
+	found, err := mustgather.ReadObject(root, opv1.SchemeGroupVersion.WithResource("clustercsidrivers").GroupResource(), "", providerName, opts.ClusterCSIDriver)
+	if err != nil {
+		return opts, err
+	}
+	if !found {
+		return opts, fmt.Errorf("ClusterCSIDriver %q not found in %s", providerName, root)
+	}
+	opts.CSIDriver = &storagev1.CSIDriver{}
+	if opts.CSIDriver, err = readOptionalObject(root, storagev1.SchemeGroupVersion.WithResource("csidrivers").GroupResource(), "", providerName, opts.CSIDriver); err != nil {
+		return opts, err
+	}
+	opts.DaemonSet = &appsv1.DaemonSet{}
+	if opts.DaemonSet, err = readOptionalObject(root, appsv1.SchemeGroupVersion.WithResource("daemonsets").GroupResource(), operatorNamespace, driverDaemonSetName, opts.DaemonSet); err != nil {
+		return opts, err
+	}
+	opts.OperatorConfig = &corev1.ConfigMap{}
+	if opts.OperatorConfig, err = readOptionalObject(root, corev1.SchemeGroupVersion.WithResource("configmaps").GroupResource(), operatorNamespace, operatorConfigMapName, opts.OperatorConfig); err != nil {
+		return opts, err
+	}
+	// Both always exist in a cluster, so if they are not in root, they were
+	// not gathered.
+	opts.APIServer = &configv1.APIServer{}
+	if opts.APIServer, err = readOptionalObject(root, configv1.SchemeGroupVersion.WithResource("apiservers").GroupResource(), "", sscsitls.APIServerName, opts.APIServer); err != nil {
+		return opts, err
+	}
+	opts.APIServerUnknown = opts.APIServer == nil
+	opts.Authentication = &configv1.Authentication{}
+	if opts.Authentication, err = readOptionalObject(root, configv1.SchemeGroupVersion.WithResource("authentications").GroupResource(), "", authenticationName, opts.Authentication); err != nil {
+		return opts, err
+	}
+	opts.AuthenticationUnknown = opts.Authentication == nil
+
+	for gvr, objs := range map[schema.GroupVersionResource]*[]*unstructured.Unstructured{
+		secretProviderClassGVR:          &opts.SecretProviderClasses,
+		secretProviderClassPodStatusGVR: &opts.SecretProviderClassPodStatuses,
+	} {
+		if *objs, err = listMustGatherObjects[unstructured.Unstructured](root, gvr.GroupResource(), true); err != nil {
+			return opts, err
+		}
+	}
+	if opts.Nodes, err = listMustGatherObjects[corev1.Node](root, corev1.SchemeGroupVersion.WithResource("nodes").GroupResource(), false); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// listMustGatherObjects decodes the objects mustgather.ListObjects returns.
+func listMustGatherObjects[T any](root string, gr schema.GroupResource, namespaced bool) ([]*T, error) {
+	contents, err := mustgather.ListObjects(root, gr, namespaced)
+	if err != nil {
+		return nil, err
+	}
+	var objs []*T
+	for _, content := range contents {
+		obj := new(T)
+		if err := json.Unmarshal(content, obj); err != nil {
+			return nil, fmt.Errorf("failed to decode %s in %s: %w", gr, root, err)
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// readOptionalObject reads obj like mustgather.ReadObject and returns it, or
+// nil if it is not in root.
+func readOptionalObject[T any](root string, gr schema.GroupResource, namespace, name string, obj *T) (*T, error) {
+	found, err := mustgather.ReadObject(root, gr, namespace, name, obj)
+	if err != nil || !found {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// Diagnose explains the configuration the operator resolves from opts and
+// compares the live objects of opts with the ones it would apply.
+func Diagnose(ctx context.Context, opts RenderOptions) (*Diagnosis, error) {
+	rendered, err := renderObjects(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	driverConfig := opts.ClusterCSIDriver.Spec.DriverConfig
+	diagnosis := &Diagnosis{}
+
+	enabled, interval := getSecretRotationConfig(driverConfig)
+	diagnosis.Rotation = RotationDiagnosis{
+		Branch:  describeSecretRotationConfig(driverConfig),
+		Enabled: enabled,
+	}
+	if enabled {
+		diagnosis.Rotation.Interval = formatRotationInterval(interval)
+		container, err := findContainer(rendered.daemonSet, csiDriverContainerName)
+		if err != nil {
+			return nil, err
+		}
+		diagnosis.Rotation.DriverInterval, _ = getArg(container.Args, rotationPollIntervalArgPrefix)
+	}
+
+	diagnosis.TokenRequests = TokenRequestsDiagnosis{
+		Branch:  describeTokenRequestsConfig(driverConfig),
+		Managed: isManagedTokenRequests(driverConfig),
+	}
+	for _, request := range rendered.csiDriver.Spec.TokenRequests {
+		diagnosis.TokenRequests.Audiences = append(diagnosis.TokenRequests.Audiences, request.Audience)
+	}
+	if diagnosis.TokenRequests.Managed {
+		issuer := ""
+		if opts.Authentication != nil {
+			issuer = opts.Authentication.Spec.ServiceAccountIssuer
+		}
+		diagnosis.TokenRequests.Warnings = checkTokenRequestAudiences(getEffectiveTokenRequests(driverConfig, nil), issuer)
+		diagnosis.TokenRequests.IssuerUnknown = opts.AuthenticationUnknown
+	}
+
+	profile := "Intermediate (default)"
+	if opts.APIServer != nil && opts.APIServer.Spec.TLSSecurityProfile != nil {
+		profile = string(opts.APIServer.Spec.TLSSecurityProfile.Type)
+	}
+	diagnosis.TLS = TLSDiagnosis{
+		Profile:       profile,
+		MinTLSVersion: string(rendered.tlsProfile.Spec.MinTLSVersion),
+		Adherence:     string(rendered.tlsProfile.Adherence),
+		Honored:       rendered.tlsProfile.Honor,
+	}
+	if opts.APIServerUnknown {
+		diagnosis.TLS = TLSDiagnosis{Profile: "unknown", MinTLSVersion: "unknown", Adherence: "unknown"}
+	}
+
+	if opts.DaemonSet != nil {
+		diagnosis.DaemonSet = ObjectDiagnosis{Found: true, Differences: compareDaemonSetArgs(rendered.daemonSet, opts.DaemonSet)}
+	}
+	if opts.CSIDriver != nil {
+		diagnosis.CSIDriver.Found = true
+		for _, drift := range getCSIDriverDrift(&rendered.csiDriver.Spec, &opts.CSIDriver.Spec) {
+			diagnosis.CSIDriver.Differences = append(diagnosis.CSIDriver.Differences, drift.String())
+		}
+	}
+
+	diagnosis.Conditions = slices.Clone(opts.ClusterCSIDriver.Status.Conditions)
+	sort.Slice(diagnosis.Conditions, func(i, j int) bool {
+		return diagnosis.Conditions[i].Type < diagnosis.Conditions[j].Type
+	})
+	return diagnosis, nil
+}
+
+// compareDaemonSetArgs returns the args of the containers of expected that
+// live lacks or has in excess.
+func compareDaemonSetArgs(expected, live *appsv1.DaemonSet) []string {
+	var differences []string
+	for _, expectedContainer := range expected.Spec.Template.Spec.Containers {
+		liveContainer, err := findContainer(live, expectedContainer.Name)
+		if err != nil {
+			differences = append(differences, fmt.Sprintf("container %s is missing", expectedContainer.Name))
+			continue
+		}
+		for _, arg := range expectedContainer.Args {
+			if !slices.Contains(liveContainer.Args, arg) {
+				differences = append(differences, fmt.Sprintf("container %s lacks %s", expectedContainer.Name, arg))
+			}
+		}
+		for _, arg := range liveContainer.Args {
+			if !slices.Contains(expectedContainer.Args, arg) {
+				differences = append(differences, fmt.Sprintf("container %s has unexpected %s", expectedContainer.Name, arg))
+			}
+		}
+	}
+	return differences
+}
+
+// WriteText writes d for humans.
+func (d *Diagnosis) WriteText(w io.Writer) {
+	fmt.Fprintln(w, "Secret rotation:")
+	fmt.Fprintf(w, "  %s\n", d.Rotation.Branch)
+	if d.Rotation.Enabled {
+		fmt.Fprintf(w, "  enabled, every %s; the driver polls every %s\n", d.Rotation.Interval, d.Rotation.DriverInterval)
+	} else {
+		fmt.Fprintln(w, "  disabled")
+	}
+
+	fmt.Fprintln(w, "Token requests:")
+	fmt.Fprintf(w, "  %s\n", d.TokenRequests.Branch)
+	if len(d.TokenRequests.Audiences) == 0 {
+		fmt.Fprintln(w, "  no audiences")
+	} else {
+		fmt.Fprintf(w, "  audiences: %s\n", strings.Join(d.TokenRequests.Audiences, ", "))
+	}
+	for _, warning := range d.TokenRequests.Warnings {
+		fmt.Fprintf(w, "  warning: %s\n", warning)
+	}
+	if d.TokenRequests.IssuerUnknown {
+		fmt.Fprintf(w, "  Authentication %s is unknown, the audiences are not checked against the service account issuer\n", authenticationName)
+	}
+
+	fmt.Fprintln(w, "TLS:")
+	fmt.Fprintf(w, "  profile %s, minTLSVersion %s\n", d.TLS.Profile, d.TLS.MinTLSVersion)
+	switch {
+	case d.TLS.Profile == "unknown":
+		fmt.Fprintf(w, "  APIServer %s is unknown\n", sscsitls.APIServerName)
+	case d.TLS.Honored:
+		fmt.Fprintf(w, "  tlsAdherence %q: the cluster profile is honored\n", d.TLS.Adherence)
+	default:
+		fmt.Fprintf(w, "  tlsAdherence %q: the operator keeps its default TLS settings\n", d.TLS.Adherence)
+	}
+
+	writeObjectDiagnosis(w, "DaemonSet "+driverDaemonSetName, d.DaemonSet)
+	writeObjectDiagnosis(w, "CSIDriver "+providerName, d.CSIDriver)
+
+	fmt.Fprintln(w, "Conditions:")
+	for _, condition := range d.Conditions {
+		fmt.Fprintf(w, "  %s=%s %s", condition.Type, condition.Status, condition.Reason)
+		if condition.Message != "" {
+			fmt.Fprintf(w, ": %s", condition.Message)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func writeObjectDiagnosis(w io.Writer, name string, diagnosis ObjectDiagnosis) {
+	switch {
+	case !diagnosis.Found:
+		fmt.Fprintf(w, "%s: not found\n", name)
+	case len(diagnosis.Differences) == 0:
+		fmt.Fprintf(w, "%s: matches the operator's manifest\n", name)
+	default:
+		fmt.Fprintf(w, "%s: differs from the operator's manifest:\n", name)
+		for _, difference := range diagnosis.Differences {
+			fmt.Fprintf(w, "  %s\n", difference)
+		}
+	}
+}
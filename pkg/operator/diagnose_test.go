@@ -0,0 +1,230 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/ptr"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// newTestRenderedDaemonSet returns the driver DaemonSet the operator renders
+// for clusterCSIDriver, changed by mutate if not nil.
+func newTestRenderedDaemonSet(t *testing.T, clusterCSIDriver *opv1.ClusterCSIDriver, mutate func(ds *appsv1.DaemonSet)) *appsv1.DaemonSet {
+	t.Helper()
+	rendered, err := renderObjects(context.Background(), RenderOptions{
+		OperatorNamespace: testOperatorNamespace,
+		ClusterCSIDriver:  clusterCSIDriver,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mutate != nil {
+		mutate(rendered.daemonSet)
+	}
+	return rendered.daemonSet
+}
+
+func TestDiagnose(t *testing.T) {
+	defaultDriver := &opv1.ClusterCSIDriver{ObjectMeta: metav1.ObjectMeta{Name: providerName}}
+	cases := []struct {
+		name string
+		opts RenderOptions
+		// check inspects the diagnosis.
+		check func(t *testing.T, diagnosis *Diagnosis)
+	}{
+		{
+			name: "defaults, nothing live",
+			opts: RenderOptions{ClusterCSIDriver: defaultDriver},
+			check: func(t *testing.T, diagnosis *Diagnosis) {
+				if !diagnosis.Rotation.Enabled || diagnosis.Rotation.Interval != "2m" || diagnosis.Rotation.DriverInterval != "2m" {
+					t.Errorf("unexpected rotation %+v", diagnosis.Rotation)
+				}
+				if diagnosis.TokenRequests.Managed {
+					t.Errorf("expected unmanaged tokenRequests, got %+v", diagnosis.TokenRequests)
+				}
+				if diagnosis.TLS.Profile != "Intermediate (default)" {
+					t.Errorf("unexpected TLS %+v", diagnosis.TLS)
+				}
+				if diagnosis.DaemonSet.Found || diagnosis.CSIDriver.Found {
+					t.Errorf("expected no live objects, got %+v and %+v", diagnosis.DaemonSet, diagnosis.CSIDriver)
+				}
+			},
+		},
+		{
+			name: "rotation disabled",
+			opts: RenderOptions{ClusterCSIDriver: rotationDisabledDriver()},
+			check: func(t *testing.T, diagnosis *Diagnosis) {
+				if diagnosis.Rotation.Enabled || diagnosis.Rotation.Branch != "secretRotation.type is None: rotation is disabled" {
+					t.Errorf("unexpected rotation %+v", diagnosis.Rotation)
+				}
+			},
+		},
+		{
+			name: "live objects match",
+			opts: RenderOptions{
+				ClusterCSIDriver: newTestRotationDriver(300),
+				DaemonSet:        newTestRenderedDaemonSet(t, newTestRotationDriver(300), nil),
+				CSIDriver:        newTestLiveCSIDriver(nil),
+			},
+			check: func(t *testing.T, diagnosis *Diagnosis) {
+				if !diagnosis.DaemonSet.Found || len(diagnosis.DaemonSet.Differences) != 0 {
+					t.Errorf("expected a matching DaemonSet, got %+v", diagnosis.DaemonSet)
+				}
+				if !diagnosis.CSIDriver.Found || len(diagnosis.CSIDriver.Differences) != 0 {
+					t.Errorf("expected a matching CSIDriver, got %+v", diagnosis.CSIDriver)
+				}
+				if diagnosis.Rotation.DriverInterval != "5m" {
+					t.Errorf("expected driver interval 5m, got %q", diagnosis.Rotation.DriverInterval)
+				}
+			},
+		},
+		{
+			name: "live objects differ",
+			opts: RenderOptions{
+				ClusterCSIDriver: defaultDriver,
+				DaemonSet: newTestRenderedDaemonSet(t, defaultDriver, func(ds *appsv1.DaemonSet) {
+					container := &ds.Spec.Template.Spec.Containers[0]
+					container.Args = append(container.Args, "--extra")
+				}),
+				CSIDriver: newTestLiveCSIDriver(func(spec *storagev1.CSIDriverSpec) {
+					spec.PodInfoOnMount = ptr.To(false)
+				}),
+			},
+			check: func(t *testing.T, diagnosis *Diagnosis) {
+				if len(diagnosis.DaemonSet.Differences) != 1 || !strings.Contains(diagnosis.DaemonSet.Differences[0], "has unexpected --extra") {
+					t.Errorf("unexpected DaemonSet differences %v", diagnosis.DaemonSet.Differences)
+				}
+				if len(diagnosis.CSIDriver.Differences) != 1 || !strings.Contains(diagnosis.CSIDriver.Differences[0], "podInfoOnMount") {
+					t.Errorf("unexpected CSIDriver differences %v", diagnosis.CSIDriver.Differences)
+				}
+			},
+		},
+		{
+			name: "managed tokenRequests with warnings",
+			opts: RenderOptions{ClusterCSIDriver: newTestManagedTokenRequestsDriver(3600, defaultAPIServerAudience)},
+			check: func(t *testing.T, diagnosis *Diagnosis) {
+				if !diagnosis.TokenRequests.Managed || len(diagnosis.TokenRequests.Warnings) == 0 {
+					t.Errorf("expected warnings, got %+v", diagnosis.TokenRequests)
+				}
+				if !slices.Equal(diagnosis.TokenRequests.Audiences, []string{defaultAPIServerAudience}) {
+					t.Errorf("expected the audience to be applied, got %+v", diagnosis.TokenRequests)
+				}
+			},
+		},
+		{
+			name: "rotation policies use the SecretProviderClasses",
+			opts: RenderOptions{
+				ClusterCSIDriver:      defaultDriver,
+				OperatorConfig:        newOperatorConfigMap("rotationPolicies:\n- provider: aws\n  interval: 10m\n"),
+				SecretProviderClasses: []*unstructured.Unstructured{newTestLabeledSecretProviderClass("db", "aws", nil)},
+			},
+			check: func(t *testing.T, diagnosis *Diagnosis) {
+				if diagnosis.Rotation.Interval != "2m" || diagnosis.Rotation.DriverInterval != "10m" {
+					t.Errorf("unexpected rotation %+v", diagnosis.Rotation)
+				}
+			},
+		},
+		{
+			name: "APIServer and Authentication unknown",
+			opts: RenderOptions{
+				ClusterCSIDriver:      newTestManagedTokenRequestsDriver(3600, "vault"),
+				APIServerUnknown:      true,
+				AuthenticationUnknown: true,
+			},
+			check: func(t *testing.T, diagnosis *Diagnosis) {
+				if diagnosis.TLS.Profile != "unknown" || diagnosis.TLS.MinTLSVersion != "unknown" || diagnosis.TLS.Honored {
+					t.Errorf("expected an unknown TLS profile, got %+v", diagnosis.TLS)
+				}
+				if !diagnosis.TokenRequests.IssuerUnknown {
+					t.Errorf("expected an unknown issuer, got %+v", diagnosis.TokenRequests)
+				}
+			},
+		},
+		{
+			name: "conditions are sorted",
+			opts: RenderOptions{ClusterCSIDriver: &opv1.ClusterCSIDriver{
+				ObjectMeta: metav1.ObjectMeta{Name: providerName},
+				Status: opv1.ClusterCSIDriverStatus{OperatorStatus: opv1.OperatorStatus{Conditions: []opv1.OperatorCondition{
+					{Type: "B", Status: opv1.ConditionFalse},
+					{Type: "A", Status: opv1.ConditionTrue},
+				}}},
+			}},
+			check: func(t *testing.T, diagnosis *Diagnosis) {
+				if len(diagnosis.Conditions) != 2 || diagnosis.Conditions[0].Type != "A" {
+					t.Errorf("unexpected conditions %v", diagnosis.Conditions)
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.OperatorNamespace = testOperatorNamespace
+			diagnosis, err := Diagnose(context.Background(), tc.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tc.check(t, diagnosis)
+			out := &bytes.Buffer{}
+			diagnosis.WriteText(out)
+			if !strings.Contains(out.String(), "Secret rotation:") {
+				t.Errorf("unexpected text output:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestLoadMustGatherObjects(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "quay-io-must-gather")
+	write := func(file string, obj interface{}) {
+		t.Helper()
+		content, err := sigsyaml.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(root, "cluster-scoped-resources", "operator.openshift.io", "clustercsidrivers", providerName+".yaml"), newTestRotationDriver(300))
+	write(filepath.Join(root, "namespaces", testOperatorNamespace, "apps", "daemonsets.yaml"), appsv1.DaemonSetList{
+		Items: []appsv1.DaemonSet{*newTestRenderedDaemonSet(t, newTestRotationDriver(300), nil)},
+	})
+	write(filepath.Join(root, "namespaces", "app", "secrets-store.csi.x-k8s.io", "secretproviderclasses", "db.yaml"), newTestLabeledSecretProviderClass("db", "aws", nil).Object)
+	write(filepath.Join(root, "cluster-scoped-resources", "core", "nodes", "node-a.yaml"), newTestNode("node-a", nil))
+
+	opts, err := LoadMustGatherObjects(filepath.Dir(root), testOperatorNamespace)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.ClusterCSIDriver == nil || opts.DaemonSet == nil {
+		t.Fatalf("expected a ClusterCSIDriver and a DaemonSet, got %+v", opts)
+	}
+	if len(opts.SecretProviderClasses) != 1 || opts.SecretProviderClasses[0].GetName() != "db" || len(opts.Nodes) != 1 || opts.Nodes[0].Name != "node-a" {
+		t.Errorf("expected SecretProviderClass db and node node-a, got %v and %v", opts.SecretProviderClasses, opts.Nodes)
+	}
+	if opts.CSIDriver != nil || opts.APIServer != nil || opts.OperatorConfig != nil || opts.Authentication != nil || len(opts.SecretProviderClassPodStatuses) != 0 {
+		t.Errorf("expected no other objects, got %+v", opts)
+	}
+	if !opts.APIServerUnknown || !opts.AuthenticationUnknown {
+		t.Errorf("expected APIServer and Authentication not gathered to be unknown, got %t and %t", opts.APIServerUnknown, opts.AuthenticationUnknown)
+	}
+
+	if _, err := LoadMustGatherObjects(t.TempDir(), testOperatorNamespace); err == nil {
+		t.Errorf("expected an error for an empty must-gather")
+	}
+}
@@ -0,0 +1,83 @@
+package operator
+
+import (
+	"fmt"
+	"strconv"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/csi/csidrivernodeservicecontroller"
+	"github.com/openshift/library-go/pkg/operator/loglevel"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// csiNodeDriverRegistrarContainerName and csiLivenessProbeContainerName
+	// are the sidecars of the driver DaemonSet.
+	csiNodeDriverRegistrarContainerName = "csi-node-driver-registrar"
+	csiLivenessProbeContainerName       = "csi-liveness-probe"
+	// verbosityArgPrefix is the klog verbosity flag prefix of the driver
+	// containers, set to ${LOG_LEVEL} in assets/node.yaml.
+	verbosityArgPrefix = "--v="
+)
+
+// validateLogLevel returns an error if level, the field of ConfigMap
+// operatorConfigMapName, is not a log level. "" is valid.
+func validateLogLevel(field string, level opv1.LogLevel) error {
+	switch level {
+	case "", opv1.Normal, opv1.Debug, opv1.Trace, opv1.TraceAll:
+		return nil
+	default:
+		return fmt.Errorf("invalid %s %q in ConfigMap %s: must be one of %s, %s, %s or %s",
+			field, level, operatorConfigMapName, opv1.Normal, opv1.Debug, opv1.Trace, opv1.TraceAll)
+	}
+}
+
+// getDriverContainerLogLevels returns the log levels of config by
+// container, without the unset ones.
+func getDriverContainerLogLevels(config driverLogLevelsConfig) (map[string]opv1.LogLevel, error) {
+	levels := map[string]opv1.LogLevel{}
+	for _, container := range []struct {
+		name  string
+		field string
+		level opv1.LogLevel
+	}{
+		{csiDriverContainerName, "driverLogLevels.driver", config.Driver},
+		{csiNodeDriverRegistrarContainerName, "driverLogLevels.registrar", config.Registrar},
+		{csiLivenessProbeContainerName, "driverLogLevels.livenessProbe", config.LivenessProbe},
+	} {
+		if err := validateLogLevel(container.field, container.level); err != nil {
+			return nil, err
+		}
+		if container.level != "" {
+			levels[container.name] = container.level
+		}
+	}
+	return levels, nil
+}
+
+// withDriverLogLevelsDaemonSetHook returns a DaemonSetHookFunc that sets the
+// verbosityArgPrefix arg of the containers operatorConfig.DriverLogLevels
+// has a level for. The others keep the ClusterCSIDriver's logLevel.
+func withDriverLogLevelsDaemonSetHook(configMapLister corev1listers.ConfigMapLister, operatorNamespace string) csidrivernodeservicecontroller.DaemonSetHookFunc {
+	return func(_ *opv1.OperatorSpec, daemonSet *appsv1.DaemonSet) error {
+		config, err := getOperatorConfig(configMapLister, operatorNamespace)
+		if err != nil {
+			return err
+		}
+		levels, err := getDriverContainerLogLevels(config.DriverLogLevels)
+		if err != nil {
+			return err
+		}
+		for name, level := range levels {
+			container, err := findContainer(daemonSet, name)
+			if err != nil {
+				return err
+			}
+			container.Args = setArg(container.Args, verbosityArgPrefix, strconv.Itoa(loglevel.LogLevelToVerbosity(level)))
+			klog.V(4).Infof("resolved log level of container %s of DaemonSet %s/%s: %s", name, daemonSet.Namespace, daemonSet.Name, level)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,74 @@
+package operator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestWithDriverLogLevelsDaemonSetHook(t *testing.T) {
+	cases := []struct {
+		name            string
+		configMap       *corev1.ConfigMap
+		expectedArgs    map[string][]string
+		wantErrContains string
+	}{
+		{
+			name: "no operator config keeps the ClusterCSIDriver's logLevel",
+			expectedArgs: map[string][]string{
+				csiDriverContainerName:              {"--v=2"},
+				csiNodeDriverRegistrarContainerName: {"--v=2"},
+				csiLivenessProbeContainerName:       {"--v=2"},
+			},
+		},
+		{
+			name:      "levels by container",
+			configMap: newOperatorConfigMap("driverLogLevels:\n  driver: TraceAll\n  livenessProbe: Debug\n"),
+			expectedArgs: map[string][]string{
+				csiDriverContainerName:              {"--v=8"},
+				csiNodeDriverRegistrarContainerName: {"--v=2"},
+				csiLivenessProbeContainerName:       {"--v=4"},
+			},
+		},
+		{
+			name:            "unknown level is an error",
+			configMap:       newOperatorConfigMap("driverLogLevels:\n  registrar: Verbose\n"),
+			wantErrContains: `invalid driverLogLevels.registrar "Verbose"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			lister := newTestConfigMapLister(t)
+			if tc.configMap != nil {
+				lister = newTestConfigMapLister(t, tc.configMap)
+			}
+			hook := withDriverLogLevelsDaemonSetHook(lister, testOperatorNamespace)
+
+			daemonSet := newTestDaemonSet()
+			daemonSet.Spec.Template.Spec.Containers = []corev1.Container{
+				{Name: csiDriverContainerName, Args: []string{"--v=2"}},
+				{Name: csiNodeDriverRegistrarContainerName, Args: []string{"--v=2"}},
+				{Name: csiLivenessProbeContainerName, Args: []string{"--v=2"}},
+			}
+			err := hook(&opv1.OperatorSpec{}, daemonSet)
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErrContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error from hook: %v", err)
+			}
+			for _, container := range daemonSet.Spec.Template.Spec.Containers {
+				if !reflect.DeepEqual(container.Args, tc.expectedArgs[container.Name]) {
+					t.Errorf("expected args of %s to be %v, got %v", container.Name, tc.expectedArgs[container.Name], container.Args)
+				}
+			}
+		})
+	}
+}
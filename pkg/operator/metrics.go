@@ -0,0 +1,162 @@
+package operator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/csi/csidrivernodeservicecontroller"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	appsv1 "k8s.io/api/apps/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+
+	sscsitls "github.com/openshift/secrets-store-csi-driver-operator/pkg/tls"
+)
+
+// metricsNamespace prefixes every operator metric, matching the build info
+// metric registered by pkg/version.
+const metricsNamespace = "openshift_secrets_store_csi_driver_operator"
+
+// The metrics below describe what the operator resolved and configured, as
+// opposed to what the driver does with it (the driver serves its own
+// metrics). They are registered with the legacy registry that the
+// controllercmd metrics endpoint serves.
+var (
+	secretRotationEnabledGauge = metrics.NewGauge(&metrics.GaugeOpts{
+		Namespace:      metricsNamespace,
+		Name:           "secret_rotation_enabled",
+		Help:           "Whether the operator configured the driver with secret rotation enabled (1) or disabled (0).",
+		StabilityLevel: metrics.ALPHA,
+	})
+	secretRotationIntervalGauge = metrics.NewGauge(&metrics.GaugeOpts{
+		Namespace:      metricsNamespace,
+		Name:           "secret_rotation_interval_seconds",
+		Help:           "The rotation poll interval the operator configured the driver with.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	requiresRepublishGauge = metrics.NewGauge(&metrics.GaugeOpts{
+		Namespace:      metricsNamespace,
+		Name:           "csidriver_requires_republish",
+		Help:           "Whether the operator set requiresRepublish on the CSIDriver (1) or not (0).",
+		StabilityLevel: metrics.ALPHA,
+	})
+	tokenRequestAudiencesGauge = metrics.NewGauge(&metrics.GaugeOpts{
+		Namespace:      metricsNamespace,
+		Name:           "csidriver_token_request_audiences",
+		Help:           "The number of token request audiences the operator set on the CSIDriver.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	tlsProfileInfoGauge = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Namespace:      metricsNamespace,
+		Name:           "tls_profile_info",
+		Help:           "A metric with a constant '1' value labeled by the minimum TLS version of the resolved cluster TLS profile, the TLS adherence policy and whether the operator honors the profile.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"min_tls_version", "adherence", "honored"})
+	daemonSetHookFailuresCounter = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      metricsNamespace,
+		Name:           "daemonset_hook_failures_total",
+		Help:           "The number of times a hook failed to adjust the driver DaemonSet, by hook.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"hook"})
+)
+
+func init() {
+	legacyregistry.MustRegister(
+		secretRotationEnabledGauge,
+		secretRotationIntervalGauge,
+		requiresRepublishGauge,
+		tokenRequestAudiencesGauge,
+		tlsProfileInfoGauge,
+		daemonSetHookFailuresCounter,
+	)
+}
+
+// recordSecretRotationConfig records the rotation settings the driver
+// DaemonSet is applied with.
+func recordSecretRotationConfig(enabled bool, interval time.Duration) {
+	secretRotationEnabledGauge.Set(boolToFloat64(enabled))
+	secretRotationIntervalGauge.Set(interval.Seconds())
+}
+
+// recordCSIDriverConfig records the requiresRepublish and tokenRequests
+// values rendered into the CSIDriver.
+func recordCSIDriverConfig(requiresRepublish bool, tokenRequestAudiences int) {
+	requiresRepublishGauge.Set(boolToFloat64(requiresRepublish))
+	tokenRequestAudiencesGauge.Set(float64(tokenRequestAudiences))
+}
+
+// withCSIDriverConfigMetrics wraps assetFunc, which must render
+// csidriverAssetName with withSecretsStoreCSIDriverAsset, so that the
+// CSIDriver it renders is recorded by recordCSIDriverConfig. Only the
+// static resources controller applying the CSIDriver uses it: the other
+// renderings of the CSIDriver, like the drift controller's, do not apply
+// it.
+func withCSIDriverConfigMetrics(assetFunc resourceapply.AssetFunc) resourceapply.AssetFunc {
+	return func(name string) ([]byte, error) {
+		manifest, err := assetFunc(name)
+		if err != nil || name != csidriverAssetName {
+			return manifest, err
+		}
+		var csiDriver storagev1.CSIDriver
+		if err := json.Unmarshal(manifest, &csiDriver); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", csidriverAssetName, err)
+		}
+		requiresRepublish := csiDriver.Spec.RequiresRepublish != nil && *csiDriver.Spec.RequiresRepublish
+		recordCSIDriverConfig(requiresRepublish, len(csiDriver.Spec.TokenRequests))
+		return manifest, nil
+	}
+}
+
+// withSecretRotationConfigMetrics returns a DaemonSetHookFunc recording the
+// rotation settings of the csi-driver container by
+// recordSecretRotationConfig. It must run after all other hooks, so that it
+// records what the DaemonSet is applied with.
+func withSecretRotationConfigMetrics() csidrivernodeservicecontroller.DaemonSetHookFunc {
+	return func(_ *opv1.OperatorSpec, daemonSet *appsv1.DaemonSet) error {
+		container, err := findContainer(daemonSet, csiDriverContainerName)
+		if err != nil {
+			return err
+		}
+		enabled, _ := getArg(container.Args, enableRotationArgPrefix)
+		value, _ := getArg(container.Args, rotationPollIntervalArgPrefix)
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s%s in DaemonSet %s/%s: %w", rotationPollIntervalArgPrefix, value, daemonSet.Namespace, daemonSet.Name, err)
+		}
+		recordSecretRotationConfig(enabled == "true", interval)
+		return nil
+	}
+}
+
+// recordTLSProfile records the TLS profile the operator's metrics server
+// currently serves with. Earlier profiles are dropped, so there is only ever
+// one series.
+func recordTLSProfile(resolved sscsitls.ResolvedProfile) {
+	tlsProfileInfoGauge.Reset()
+	tlsProfileInfoGauge.WithLabelValues(string(resolved.Spec.MinTLSVersion), string(resolved.Adherence), strconv.FormatBool(resolved.Honor)).Set(1)
+}
+
+// withDaemonSetHookMetrics wraps hook so that its failures are counted in
+// daemonset_hook_failures_total under the given hook name.
+func withDaemonSetHookMetrics(name string, hook csidrivernodeservicecontroller.DaemonSetHookFunc) csidrivernodeservicecontroller.DaemonSetHookFunc {
+	// Initialize the series so that it is exported before the first failure.
+	daemonSetHookFailuresCounter.WithLabelValues(name)
+	return func(opSpec *opv1.OperatorSpec, daemonSet *appsv1.DaemonSet) error {
+		err := hook(opSpec, daemonSet)
+		if err != nil {
+			daemonSetHookFailuresCounter.WithLabelValues(name).Inc()
+		}
+		return err
+	}
+}
+
+func boolToFloat64(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
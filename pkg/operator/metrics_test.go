@@ -0,0 +1,141 @@
+package operator
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	opv1 "github.com/openshift/api/operator/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/component-base/metrics/testutil"
+	"k8s.io/utils/ptr"
+
+	sscsitls "github.com/openshift/secrets-store-csi-driver-operator/pkg/tls"
+)
+
+func TestRecordSecretRotationConfig(t *testing.T) {
+	recordSecretRotationConfig(true, 90*time.Second)
+
+	if got, _ := testutil.GetGaugeMetricValue(secretRotationEnabledGauge); got != 1 {
+		t.Fatalf("expected secret_rotation_enabled to be 1, got %v", got)
+	}
+	if got, _ := testutil.GetGaugeMetricValue(secretRotationIntervalGauge); got != 90 {
+		t.Fatalf("expected secret_rotation_interval_seconds to be 90, got %v", got)
+	}
+
+	recordSecretRotationConfig(false, defaultRotationInterval)
+	if got, _ := testutil.GetGaugeMetricValue(secretRotationEnabledGauge); got != 0 {
+		t.Fatalf("expected secret_rotation_enabled to be 0, got %v", got)
+	}
+}
+
+func TestRecordCSIDriverConfig(t *testing.T) {
+	recordCSIDriverConfig(true, 2)
+
+	if got, _ := testutil.GetGaugeMetricValue(requiresRepublishGauge); got != 1 {
+		t.Fatalf("expected csidriver_requires_republish to be 1, got %v", got)
+	}
+	if got, _ := testutil.GetGaugeMetricValue(tokenRequestAudiencesGauge); got != 2 {
+		t.Fatalf("expected csidriver_token_request_audiences to be 2, got %v", got)
+	}
+}
+
+func TestWithCSIDriverConfigMetrics(t *testing.T) {
+	csiDriver, err := json.Marshal(&storagev1.CSIDriver{Spec: storagev1.CSIDriverSpec{
+		RequiresRepublish: ptr.To(true),
+		TokenRequests:     []storagev1.TokenRequest{{Audience: "a"}, {Audience: "b"}, {Audience: "c"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordCSIDriverConfig(false, 0)
+	assetFunc := withCSIDriverConfigMetrics(func(name string) ([]byte, error) {
+		if name == csidriverAssetName {
+			return csiDriver, nil
+		}
+		return []byte("not a CSIDriver"), nil
+	})
+
+	if _, err := assetFunc("node.yaml"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := testutil.GetGaugeMetricValue(tokenRequestAudiencesGauge); got != 0 {
+		t.Fatalf("expected other assets not to be recorded, got csidriver_token_request_audiences %v", got)
+	}
+	if _, err := assetFunc(csidriverAssetName); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := testutil.GetGaugeMetricValue(requiresRepublishGauge); got != 1 {
+		t.Fatalf("expected csidriver_requires_republish to be 1, got %v", got)
+	}
+	if got, _ := testutil.GetGaugeMetricValue(tokenRequestAudiencesGauge); got != 3 {
+		t.Fatalf("expected csidriver_token_request_audiences to be 3, got %v", got)
+	}
+}
+
+func TestWithSecretRotationConfigMetrics(t *testing.T) {
+	daemonSet := &appsv1.DaemonSet{}
+	daemonSet.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: csiDriverContainerName,
+		Args: []string{enableRotationArgPrefix + "true", rotationPollIntervalArgPrefix + "5m"},
+	}}
+	recordSecretRotationConfig(false, 0)
+
+	if err := withSecretRotationConfigMetrics()(&opv1.OperatorSpec{}, daemonSet); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := testutil.GetGaugeMetricValue(secretRotationEnabledGauge); got != 1 {
+		t.Fatalf("expected secret_rotation_enabled to be 1, got %v", got)
+	}
+	if got, _ := testutil.GetGaugeMetricValue(secretRotationIntervalGauge); got != 300 {
+		t.Fatalf("expected secret_rotation_interval_seconds to be 300, got %v", got)
+	}
+}
+
+func TestRecordTLSProfile(t *testing.T) {
+	recordTLSProfile(sscsitls.ResolvedProfile{
+		Spec: configv1.TLSProfileSpec{MinTLSVersion: configv1.VersionTLS12},
+	})
+	recordTLSProfile(sscsitls.ResolvedProfile{
+		Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+		Spec:      configv1.TLSProfileSpec{MinTLSVersion: configv1.VersionTLS13},
+		Honor:     true,
+	})
+
+	if got, _ := testutil.GetGaugeMetricValue(tlsProfileInfoGauge.WithLabelValues("VersionTLS13", "StrictAllComponents", "true")); got != 1 {
+		t.Fatalf("expected tls_profile_info for the honored profile to be 1, got %v", got)
+	}
+	// The profile recorded first must have been replaced, not kept alongside.
+	if got, _ := testutil.GetGaugeMetricValue(tlsProfileInfoGauge.WithLabelValues("VersionTLS12", "", "false")); got != 0 {
+		t.Fatalf("expected tls_profile_info for the replaced profile to be gone, got %v", got)
+	}
+}
+
+func TestWithDaemonSetHookMetrics(t *testing.T) {
+	hookErr := errors.New("hook failed")
+	failing := true
+	hook := withDaemonSetHookMetrics("test", func(_ *opv1.OperatorSpec, _ *appsv1.DaemonSet) error {
+		if failing {
+			return hookErr
+		}
+		return nil
+	})
+
+	before, _ := testutil.GetCounterMetricValue(daemonSetHookFailuresCounter.WithLabelValues("test"))
+	if err := hook(&opv1.OperatorSpec{}, &appsv1.DaemonSet{}); !errors.Is(err, hookErr) {
+		t.Fatalf("expected the hook error to be returned, got %v", err)
+	}
+	failing = false
+	if err := hook(&opv1.OperatorSpec{}, &appsv1.DaemonSet{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	after, _ := testutil.GetCounterMetricValue(daemonSetHookFailuresCounter.WithLabelValues("test"))
+	if after-before != 1 {
+		t.Fatalf("expected daemonset_hook_failures_total to increase by 1, got %v", after-before)
+	}
+}
@@ -0,0 +1,49 @@
+package operator
+
+import (
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/staticresourcecontroller"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	"k8s.io/client-go/dynamic"
+)
+
+// monitoringAssets are the cluster monitoring objects that make Prometheus
+// scrape the driver metrics Service and alert on its metrics.
+var monitoringAssets = []string{
+	"servicemonitor.yaml",
+	"prometheusrule.yaml",
+}
+
+// newMonitoringController returns a static resources controller for
+// monitoringAssets. It is what csicontrollerset's WithServiceMonitorController
+// sets up, except that it manages more than one file and follows the same
+// create/delete conditions as the other conditional static resources, so
+// that the ServiceMonitor and PrometheusRule go away with the driver when the
+// ClusterCSIDriver is Removed.
+//
+// NotFound errors on create are ignored, so that clusters without the
+// monitoring CRDs (e.g. with the monitoring capability disabled) are not
+// reported as degraded.
+func newMonitoringController(
+	name string,
+	dynamicClient dynamic.Interface,
+	operatorClient v1helpers.OperatorClientWithFinalizers,
+	assetFunc resourceapply.AssetFunc,
+	shouldCreate, shouldDelete resourceapply.ConditionalFunction,
+	recorder events.Recorder,
+) *staticresourcecontroller.StaticResourceController {
+	return staticresourcecontroller.NewStaticResourceController(
+		name,
+		assetFunc,
+		[]string{},
+		(&resourceapply.ClientHolder{}).WithDynamicClient(dynamicClient),
+		operatorClient,
+		recorder,
+	).WithConditionalResources(
+		assetFunc,
+		monitoringAssets,
+		shouldCreate,
+		shouldDelete,
+	).WithIgnoreNotFoundOnCreate()
+}
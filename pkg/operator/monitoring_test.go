@@ -0,0 +1,83 @@
+package operator
+
+import (
+	"testing"
+
+	"github.com/openshift/library-go/pkg/operator/resource/resourceread"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestMonitoringAssets(t *testing.T) {
+	assetFunc := replaceNamespaceFunc(testOperatorNamespace)
+	expectedKinds := map[string]string{
+		"servicemonitor.yaml": "ServiceMonitor",
+		"prometheusrule.yaml": "PrometheusRule",
+	}
+	for _, file := range monitoringAssets {
+		manifest, err := assetFunc(file)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", file, err)
+		}
+		obj, err := resourceread.ReadGenericWithUnstructured(manifest)
+		if err != nil {
+			t.Fatalf("failed to decode %s: %v", file, err)
+		}
+		unstr, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			t.Fatalf("expected %s to decode as unstructured, got %T", file, obj)
+		}
+		if unstr.GetKind() != expectedKinds[file] {
+			t.Fatalf("expected %s to hold a %s, got %s", file, expectedKinds[file], unstr.GetKind())
+		}
+		if unstr.GetNamespace() != testOperatorNamespace {
+			t.Fatalf("expected %s to be in namespace %s, got %q", file, testOperatorNamespace, unstr.GetNamespace())
+		}
+	}
+}
+
+func TestNodeMetricsServiceMatchesDaemonSet(t *testing.T) {
+	assetFunc := replaceNamespaceFunc(testOperatorNamespace)
+	serviceManifest, err := assetFunc("node_metrics_service.yaml")
+	if err != nil {
+		t.Fatalf("failed to read node_metrics_service.yaml: %v", err)
+	}
+	service := resourceread.ReadServiceV1OrDie(serviceManifest)
+	daemonSetManifest, err := assetFunc("node.yaml")
+	if err != nil {
+		t.Fatalf("failed to read node.yaml: %v", err)
+	}
+	daemonSet := resourceread.ReadDaemonSetV1OrDie(daemonSetManifest)
+
+	for key, value := range service.Spec.Selector {
+		if daemonSet.Spec.Template.Labels[key] != value {
+			t.Fatalf("expected the DaemonSet pods to carry the Service selector label %s=%s", key, value)
+		}
+	}
+
+	proxy, err := findContainer(daemonSet, "csi-driver-kube-rbac-proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, port := range service.Spec.Ports {
+		found := false
+		for _, containerPort := range proxy.Ports {
+			if containerPort.Name == port.TargetPort.StrVal && containerPort.ContainerPort == port.Port {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("expected container %s to expose port %s (%d)", proxy.Name, port.TargetPort.StrVal, port.Port)
+		}
+	}
+
+	secretName := service.Annotations["service.beta.openshift.io/serving-cert-secret-name"]
+	found := false
+	for _, volume := range daemonSet.Spec.Template.Spec.Volumes {
+		if volume.Secret != nil && volume.Secret.SecretName == secretName {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected the DaemonSet to mount the serving certificate Secret %s", secretName)
+	}
+}
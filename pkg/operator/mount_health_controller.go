@@ -0,0 +1,302 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	applyoperatorv1 "github.com/openshift/client-go/operator/applyconfigurations/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/informers"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
+)
+
+const (
+	// secretsStoreMountsDegradedCondition reports how many secrets-store
+	// mounts are failing, per node and per provider.
+	secretsStoreMountsDegradedCondition = "SecretsStoreMountsDegraded"
+	// failedMountEventReason is the reason kubelet gives Pod events about
+	// volumes it could not set up.
+	failedMountEventReason = "FailedMount"
+	// failedMountEventFieldSelector restricts the Event informer of the mount
+	// health controller to failed mounts, so that not every Event in the
+	// cluster ends up in the operator's cache.
+	failedMountEventFieldSelector = "involvedObject.kind=Pod,reason=" + failedMountEventReason
+	// mountFailureWindow is how long a FailedMount event counts as a failing
+	// mount after kubelet last reported it.
+	mountFailureWindow = 10 * time.Minute
+	// mountFailureDegradedRatio is the share of failing mounts from which
+	// SecretsStoreMountsDegraded becomes True. Below it the counts are still
+	// reported, so that a single pod referencing a broken
+	// SecretProviderClass does not degrade the whole driver.
+	mountFailureDegradedRatio = 0.2
+	// maxReportedMountGroups caps how many nodes and providers are spelled
+	// out in the condition message.
+	maxReportedMountGroups = 5
+	// unknownProvider groups mounts whose provider cannot be determined.
+	unknownProvider = "unknown"
+)
+
+// providerInMountErrorRegexp extracts the provider from the driver's
+// NodePublishVolume errors, e.g. `error connecting to provider "vault"`.
+var providerInMountErrorRegexp = regexp.MustCompile(`provider "([^"]+)"`)
+
+// mountHealthController aggregates the SecretProviderClassPodStatuses the
+// driver writes for every successful mount and the FailedMount events
+// kubelet writes for every failed one, and reports the counts per node and
+// per provider in the SecretsStoreMountsDegraded condition of the
+// ClusterCSIDriver.
+//
+// Like the SecretProviderClass validation controller, it has to watch
+// objects in all namespaces. The Event informer is limited to FailedMount
+// events of Pods by a field selector.
+type mountHealthController struct {
+	name               string
+	operatorClient     v1helpers.OperatorClientWithFinalizers
+	spcLister          cache.GenericLister
+	spcPodStatusLister cache.GenericLister
+	eventLister        corev1listers.EventLister
+	clock              clock.PassiveClock
+}
+
+func newMountHealthController(
+	name string,
+	operatorClient v1helpers.OperatorClientWithFinalizers,
+	spcInformer informers.GenericInformer,
+	spcPodStatusInformer informers.GenericInformer,
+	eventInformer corev1informers.EventInformer,
+	clock clock.PassiveClock,
+	recorder events.Recorder,
+) factory.Controller {
+	c := &mountHealthController{
+		name:               name,
+		operatorClient:     operatorClient,
+		spcLister:          spcInformer.Lister(),
+		spcPodStatusLister: spcPodStatusInformer.Lister(),
+		eventLister:        eventInformer.Lister(),
+		clock:              clock,
+	}
+	return factory.New().WithInformers(
+		operatorClient.Informer(),
+		spcInformer.Informer(),
+		spcPodStatusInformer.Informer(),
+		eventInformer.Informer(),
+	).WithSync(
+		c.sync,
+	).ResyncEvery(
+		time.Minute,
+	).WithSyncDegradedOnError(
+		operatorClient,
+	).ToController(
+		name,
+		recorder.WithComponentSuffix("secrets-store-mount-health-controller"),
+	)
+}
+
+func (c *mountHealthController) sync(ctx context.Context, syncContext factory.SyncContext) error {
+	if getOperatorSyncState(c.operatorClient) != opv1.Managed {
+		return nil
+	}
+
+	var errs []error
+	providers := map[string]string{}
+	spcs, err := c.spcLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list SecretProviderClasses: %w", err)
+	}
+	for _, obj := range spcs {
+		spc, err := toSecretProviderClass(obj)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		providers[spc.Namespace+"/"+spc.Name] = spc.Spec.Provider
+	}
+
+	objs, err := c.spcPodStatusLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list SecretProviderClassPodStatuses: %w", err)
+	}
+	podStatuses := make([]*secretProviderClassPodStatus, 0, len(objs))
+	for _, obj := range objs {
+		podStatus, err := toSecretProviderClassPodStatus(obj)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		podStatuses = append(podStatuses, podStatus)
+	}
+
+	failedMountEvents, err := c.eventLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list events: %w", err)
+	}
+
+	health := aggregateMountHealth(podStatuses, providers, failedMountEvents, c.clock.Now().Add(-mountFailureWindow))
+	if err := c.operatorClient.ApplyOperatorStatus(ctx, c.name, applyoperatorv1.OperatorStatus().WithConditions(health.condition())); err != nil {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// mountCounts counts the mounts of one node, one provider or the whole
+// cluster.
+type mountCounts struct {
+	mounted int
+	failed  int
+}
+
+func (m mountCounts) total() int {
+	return m.mounted + m.failed
+}
+
+// mountHealth is the result of aggregateMountHealth.
+type mountHealth struct {
+	mountCounts
+	byNode     map[string]*mountCounts
+	byProvider map[string]*mountCounts
+}
+
+func (h *mountHealth) add(node, provider string, mounted bool) {
+	for _, counts := range []*mountCounts{&h.mountCounts, getMountCounts(h.byNode, node), getMountCounts(h.byProvider, provider)} {
+		if mounted {
+			counts.mounted++
+		} else {
+			counts.failed++
+		}
+	}
+}
+
+func getMountCounts(groups map[string]*mountCounts, key string) *mountCounts {
+	counts, ok := groups[key]
+	if !ok {
+		counts = &mountCounts{}
+		groups[key] = counts
+	}
+	return counts
+}
+
+// aggregateMountHealth counts every SecretProviderClassPodStatus as a mount,
+// failed when the driver reports it as not mounted, and every pod with a
+// secrets-store FailedMount event newer than since as a failed mount unless
+// the pod already has a SecretProviderClassPodStatus, which is counted
+// instead.
+//
+// providers maps namespace/name of every SecretProviderClass to its
+// provider.
+func aggregateMountHealth(podStatuses []*secretProviderClassPodStatus, providers map[string]string, failedMountEvents []*corev1.Event, since time.Time) *mountHealth {
+	health := &mountHealth{byNode: map[string]*mountCounts{}, byProvider: map[string]*mountCounts{}}
+
+	countedPods := map[string]bool{}
+	for _, podStatus := range podStatuses {
+		provider, ok := providers[podStatus.Namespace+"/"+podStatus.Status.SecretProviderClassName]
+		if !ok || provider == "" {
+			provider = unknownProvider
+		}
+		health.add(podStatus.NodeName, provider, podStatus.Status.Mounted)
+		countedPods[podStatus.Namespace+"/"+podStatus.Status.PodName] = true
+	}
+
+	for _, event := range failedMountEvents {
+		if event.Reason != failedMountEventReason || !isSecretsStoreMountFailure(event.Message) || getEventTime(event).Before(since) {
+			continue
+		}
+		pod := event.InvolvedObject.Namespace + "/" + event.InvolvedObject.Name
+		if countedPods[pod] {
+			continue
+		}
+		countedPods[pod] = true
+
+		provider := unknownProvider
+		if match := providerInMountErrorRegexp.FindStringSubmatch(event.Message); match != nil {
+			provider = match[1]
+		}
+		health.add(event.Source.Host, provider, false)
+	}
+	return health
+}
+
+// condition returns the SecretsStoreMountsDegraded condition for h.
+func (h *mountHealth) condition() *applyoperatorv1.OperatorConditionApplyConfiguration {
+	condition := applyoperatorv1.OperatorCondition().
+		WithType(secretsStoreMountsDegradedCondition).
+		WithStatus(opv1.ConditionFalse).
+		WithReason("AsExpected")
+	if h.failed == 0 {
+		return condition.WithMessage(fmt.Sprintf("%d secrets-store mounts, none failing", h.mounted))
+	}
+
+	message := fmt.Sprintf("%d of %d secrets-store mounts are failing; by node: %s; by provider: %s",
+		h.failed, h.total(), formatFailingMounts(h.byNode), formatFailingMounts(h.byProvider))
+	if float64(h.failed) < mountFailureDegradedRatio*float64(h.total()) {
+		return condition.WithMessage(message)
+	}
+	return condition.
+		WithStatus(opv1.ConditionTrue).
+		WithReason("MountsFailing").
+		WithMessage(message)
+}
+
+// formatFailingMounts formats the groups with failing mounts as
+// "name failed/total", most failures first, capped at
+// maxReportedMountGroups.
+func formatFailingMounts(groups map[string]*mountCounts) string {
+	var names []string
+	for name, counts := range groups {
+		if counts.failed > 0 {
+			names = append(names, name)
+		}
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if diff := groups[b].failed - groups[a].failed; diff != 0 {
+			return diff
+		}
+		return strings.Compare(a, b)
+	})
+
+	var parts []string
+	for _, name := range names[:min(len(names), maxReportedMountGroups)] {
+		displayName := name
+		if displayName == "" {
+			displayName = "<unknown>"
+		}
+		parts = append(parts, fmt.Sprintf("%s %d/%d", displayName, groups[name].failed, groups[name].total()))
+	}
+	if len(names) > maxReportedMountGroups {
+		parts = append(parts, fmt.Sprintf("%d more", len(names)-maxReportedMountGroups))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// isSecretsStoreMountFailure reports whether a FailedMount event message
+// was caused by the secrets-store driver rather than another volume of the
+// pod.
+func isSecretsStoreMountFailure(message string) bool {
+	return strings.Contains(message, "secrets store") || strings.Contains(message, providerName)
+}
+
+// getEventTime returns when an event was last observed.
+func getEventTime(event *corev1.Event) time.Time {
+	switch {
+	case event.Series != nil && !event.Series.LastObservedTime.IsZero():
+		return event.Series.LastObservedTime.Time
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
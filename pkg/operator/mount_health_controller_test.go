@@ -0,0 +1,181 @@
+package operator
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
+)
+
+// fakePassiveClock is a clock.PassiveClock frozen at now.
+type fakePassiveClock struct {
+	now time.Time
+}
+
+func (c fakePassiveClock) Now() time.Time                  { return c.now }
+func (c fakePassiveClock) Since(t time.Time) time.Duration { return c.now.Sub(t) }
+
+var testNow = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestSecretProviderClassPodStatus(namespace, pod, spc, node string, mounted bool) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "secrets-store.csi.x-k8s.io/v1",
+		"kind":       "SecretProviderClassPodStatus",
+		"metadata": map[string]interface{}{
+			"namespace": namespace,
+			"name":      pod + "-" + namespace + "-" + spc,
+			"labels":    map[string]interface{}{secretProviderClassPodStatusNodeLabel: node},
+		},
+		"status": map[string]interface{}{
+			"podName":                 pod,
+			"secretProviderClassName": spc,
+			"mounted":                 mounted,
+		},
+	}}
+}
+
+func newTestFailedMountEvent(namespace, pod, node, message string, age time.Duration) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: namespace, Name: pod + ".failedmount"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: namespace, Name: pod},
+		Reason:         failedMountEventReason,
+		Message:        message,
+		Source:         corev1.EventSource{Component: "kubelet", Host: node},
+		LastTimestamp:  metav1.NewTime(testNow.Add(-age)),
+	}
+}
+
+const testProviderMountError = `MountVolume.SetUp failed for volume "secrets" : rpc error: code = Unknown desc = failed to mount secrets store objects for pod app/%s, err: error connecting to provider "vault": provider not found`
+
+func TestMountHealthControllerSync(t *testing.T) {
+	cases := []struct {
+		name        string
+		spcs        []*unstructured.Unstructured
+		podStatuses []*unstructured.Unstructured
+		events      []*corev1.Event
+
+		wantStatus         opv1.ConditionStatus
+		wantMessageContain string
+	}{
+		{
+			name:               "no mounts",
+			wantStatus:         opv1.ConditionFalse,
+			wantMessageContain: "0 secrets-store mounts, none failing",
+		},
+		{
+			name: "all mounted",
+			spcs: []*unstructured.Unstructured{newTestSecretProviderClass("app", "db", map[string]interface{}{"provider": "vault"})},
+			podStatuses: []*unstructured.Unstructured{
+				newTestSecretProviderClassPodStatus("app", "db-0", "db", "node-a", true),
+				newTestSecretProviderClassPodStatus("app", "db-1", "db", "node-b", true),
+			},
+			wantStatus:         opv1.ConditionFalse,
+			wantMessageContain: "2 secrets-store mounts, none failing",
+		},
+		{
+			name: "half the mounts failing is degraded",
+			spcs: []*unstructured.Unstructured{newTestSecretProviderClass("app", "db", map[string]interface{}{"provider": "vault"})},
+			podStatuses: []*unstructured.Unstructured{
+				newTestSecretProviderClassPodStatus("app", "db-0", "db", "node-a", true),
+				newTestSecretProviderClassPodStatus("app", "db-1", "db", "node-b", false),
+			},
+			events: []*corev1.Event{
+				newTestFailedMountEvent("app", "db-2", "node-b", strings.ReplaceAll(testProviderMountError, "%s", "db-2"), time.Minute),
+				// Counted through its SecretProviderClassPodStatus already.
+				newTestFailedMountEvent("app", "db-1", "node-b", strings.ReplaceAll(testProviderMountError, "%s", "db-1"), time.Minute),
+			},
+			wantStatus:         opv1.ConditionTrue,
+			wantMessageContain: "2 of 3 secrets-store mounts are failing; by node: node-b 2/2; by provider: vault 2/3",
+		},
+		{
+			name: "few failures are reported without degrading",
+			spcs: []*unstructured.Unstructured{newTestSecretProviderClass("app", "db", map[string]interface{}{"provider": "aws"})},
+			podStatuses: []*unstructured.Unstructured{
+				newTestSecretProviderClassPodStatus("app", "db-0", "db", "node-a", true),
+				newTestSecretProviderClassPodStatus("app", "db-1", "db", "node-a", true),
+				newTestSecretProviderClassPodStatus("app", "db-2", "db", "node-a", true),
+				newTestSecretProviderClassPodStatus("app", "db-3", "db", "node-a", true),
+				newTestSecretProviderClassPodStatus("app", "db-4", "db", "node-a", true),
+			},
+			events: []*corev1.Event{
+				newTestFailedMountEvent("app", "web-0", "node-c", strings.ReplaceAll(testProviderMountError, "%s", "web-0"), time.Minute),
+			},
+			wantStatus:         opv1.ConditionFalse,
+			wantMessageContain: "1 of 6 secrets-store mounts are failing; by node: node-c 1/1; by provider: vault 1/1",
+		},
+		{
+			name: "old and unrelated failures are ignored",
+			events: []*corev1.Event{
+				newTestFailedMountEvent("app", "db-0", "node-a", strings.ReplaceAll(testProviderMountError, "%s", "db-0"), time.Hour),
+				newTestFailedMountEvent("app", "db-1", "node-a", `MountVolume.SetUp failed for volume "config" : configmap "config" not found`, time.Minute),
+			},
+			wantStatus:         opv1.ConditionFalse,
+			wantMessageContain: "0 secrets-store mounts, none failing",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			spcIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			for _, obj := range tc.spcs {
+				if err := spcIndexer.Add(obj); err != nil {
+					t.Fatalf("failed to add SecretProviderClass to indexer: %v", err)
+				}
+			}
+			podStatusIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			for _, obj := range tc.podStatuses {
+				if err := podStatusIndexer.Add(obj); err != nil {
+					t.Fatalf("failed to add SecretProviderClassPodStatus to indexer: %v", err)
+				}
+			}
+			eventIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			for _, event := range tc.events {
+				if err := eventIndexer.Add(event); err != nil {
+					t.Fatalf("failed to add Event to indexer: %v", err)
+				}
+			}
+			operatorClient := v1helpers.NewFakeOperatorClientWithObjectMeta(
+				&metav1.ObjectMeta{Name: providerName},
+				&opv1.OperatorSpec{ManagementState: opv1.Managed},
+				&opv1.OperatorStatus{},
+				nil,
+			)
+			c := &mountHealthController{
+				name:               "SecretsStoreMountHealthController",
+				operatorClient:     operatorClient,
+				spcLister:          cache.NewGenericLister(spcIndexer, secretProviderClassGVR.GroupResource()),
+				spcPodStatusLister: cache.NewGenericLister(podStatusIndexer, secretProviderClassPodStatusGVR.GroupResource()),
+				eventLister:        corev1listers.NewEventLister(eventIndexer),
+				clock:              fakePassiveClock{now: testNow},
+			}
+			syncContext := factory.NewSyncContext(c.name, events.NewInMemoryRecorder(c.name, clock.RealClock{}))
+
+			if err := c.sync(context.Background(), syncContext); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_, status, _, _ := operatorClient.GetOperatorState()
+			condition := v1helpers.FindOperatorCondition(status.Conditions, secretsStoreMountsDegradedCondition)
+			if condition == nil {
+				t.Fatalf("expected condition %s to be set", secretsStoreMountsDegradedCondition)
+			}
+			if condition.Status != tc.wantStatus {
+				t.Fatalf("expected condition status %s, got %s: %s", tc.wantStatus, condition.Status, condition.Message)
+			}
+			if !strings.Contains(condition.Message, tc.wantMessageContain) {
+				t.Fatalf("expected condition message to contain %q, got %q", tc.wantMessageContain, condition.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package operator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceread"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// namespacePolicyAssetName is the ValidatingAdmissionPolicy restricting
+	// the namespaces that may use the driver.
+	namespacePolicyAssetName = "admission/namespace_policy.yaml"
+	// namespacePolicyBindingAssetName enforces namespacePolicyAssetName.
+	namespacePolicyBindingAssetName = "admission/namespace_policy_binding.yaml"
+	// namespaceAllowedVariable is the namespacePolicyAssetName variable
+	// rendered from operatorConfig.NamespaceAdmission.
+	namespaceAllowedVariable = "namespaceAllowed"
+)
+
+// namespaceAdmissionAssets are managed by their own conditional static
+// resources controller, so that they can be created and deleted
+// independently of the driver's other static resources.
+var namespaceAdmissionAssets = []string{
+	namespacePolicyAssetName,
+	namespacePolicyBindingAssetName,
+}
+
+// withNamespaceAdmissionPolicyAsset wraps a base AssetFunc so that, for
+// namespacePolicyAssetName specifically, the returned bytes carry the
+// namespaceSelector of operatorConfig.NamespaceAdmission.
+func withNamespaceAdmissionPolicyAsset(
+	base resourceapply.AssetFunc,
+	configMapLister corev1listers.ConfigMapLister,
+	operatorNamespace string,
+) resourceapply.AssetFunc {
+	return func(name string) ([]byte, error) {
+		manifest, err := base(name)
+		if err != nil {
+			return nil, err
+		}
+		if name != namespacePolicyAssetName {
+			return manifest, nil
+		}
+
+		selector, err := getNamespaceAdmissionSelector(configMapLister, operatorNamespace)
+		if err != nil {
+			return nil, err
+		}
+		return renderNamespaceAdmissionPolicy(manifest, selector)
+	}
+}
+
+// renderNamespaceAdmissionPolicy overwrites the namespaceAllowedVariable of
+// the static policy manifest with the CEL translation of selector. A nil
+// selector, which only happens when the policy is about to be deleted,
+// allows all namespaces.
+func renderNamespaceAdmissionPolicy(manifest []byte, selector *metav1.LabelSelector) ([]byte, error) {
+	policy := resourceread.ReadValidatingAdmissionPolicyV1OrDie(manifest)
+	expression := "true"
+	if selector != nil {
+		expression = labelSelectorToCEL(selector)
+	}
+
+	found := false
+	for i := range policy.Spec.Variables {
+		if policy.Spec.Variables[i].Name == namespaceAllowedVariable {
+			policy.Spec.Variables[i].Expression = expression
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("variable %q not found in %s", namespaceAllowedVariable, namespacePolicyAssetName)
+	}
+	klog.V(4).Infof("resolved ValidatingAdmissionPolicy %q namespace expression: %s", policy.Name, expression)
+
+	return json.Marshal(policy)
+}
+
+// getNamespaceAdmissionSelector returns the validated namespaceSelector of
+// operatorConfig.NamespaceAdmission, or nil when the namespaces are not
+// restricted.
+func getNamespaceAdmissionSelector(configMapLister corev1listers.ConfigMapLister, operatorNamespace string) (*metav1.LabelSelector, error) {
+	config, err := getOperatorConfig(configMapLister, operatorNamespace)
+	if err != nil {
+		return nil, err
+	}
+	selector := config.NamespaceAdmission.NamespaceSelector
+	if selector == nil {
+		return nil, nil
+	}
+	// Label keys and values are restricted to a charset without quotes,
+	// which labelSelectorToCEL relies on.
+	if _, err := metav1.LabelSelectorAsSelector(selector); err != nil {
+		return nil, fmt.Errorf("invalid namespaceAdmission.namespaceSelector in ConfigMap %s: %w", operatorConfigMapName, err)
+	}
+	return selector, nil
+}
+
+// shouldCreateNamespaceAdmission and shouldDeleteNamespaceAdmission are the
+// conditions of the namespaceAdmissionAssets controller. An invalid operator
+// config counts as "create", so that withNamespaceAdmissionPolicyAsset
+// reports it and the policy in place, if any, is kept.
+func shouldCreateNamespaceAdmission(configMapLister corev1listers.ConfigMapLister, operatorNamespace string) bool {
+	selector, err := getNamespaceAdmissionSelector(configMapLister, operatorNamespace)
+	return err != nil || selector != nil
+}
+
+func shouldDeleteNamespaceAdmission(configMapLister corev1listers.ConfigMapLister, operatorNamespace string) bool {
+	selector, err := getNamespaceAdmissionSelector(configMapLister, operatorNamespace)
+	return err == nil && selector == nil
+}
+
+// labelSelectorToCEL translates selector into a CEL expression over the
+// policy's labels variable (the labels of the request's namespace), with the
+// semantics of metav1.LabelSelector: all requirements must match, and an
+// empty selector matches everything.
+func labelSelectorToCEL(selector *metav1.LabelSelector) string {
+	var terms []string
+	keys := make([]string, 0, len(selector.MatchLabels))
+	for key := range selector.MatchLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		terms = append(terms, fmt.Sprintf("('%s' in variables.labels && variables.labels['%s'] == '%s')", key, key, selector.MatchLabels[key]))
+	}
+
+	for _, requirement := range selector.MatchExpressions {
+		values := make([]string, 0, len(requirement.Values))
+		for _, value := range requirement.Values {
+			values = append(values, fmt.Sprintf("'%s'", value))
+		}
+		list := "[" + strings.Join(values, ", ") + "]"
+		switch requirement.Operator {
+		case metav1.LabelSelectorOpIn:
+			terms = append(terms, fmt.Sprintf("('%s' in variables.labels && variables.labels['%s'] in %s)", requirement.Key, requirement.Key, list))
+		case metav1.LabelSelectorOpNotIn:
+			terms = append(terms, fmt.Sprintf("!('%s' in variables.labels && variables.labels['%s'] in %s)", requirement.Key, requirement.Key, list))
+		case metav1.LabelSelectorOpExists:
+			terms = append(terms, fmt.Sprintf("('%s' in variables.labels)", requirement.Key))
+		case metav1.LabelSelectorOpDoesNotExist:
+			terms = append(terms, fmt.Sprintf("!('%s' in variables.labels)", requirement.Key))
+		}
+	}
+
+	if len(terms) == 0 {
+		return "true"
+	}
+	return strings.Join(terms, " && ")
+}
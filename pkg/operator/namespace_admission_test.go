@@ -0,0 +1,134 @@
+package operator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/openshift/library-go/pkg/operator/resource/resourceread"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLabelSelectorToCEL(t *testing.T) {
+	cases := []struct {
+		name     string
+		selector *metav1.LabelSelector
+		expected string
+	}{
+		{
+			name:     "empty selector matches everything",
+			selector: &metav1.LabelSelector{},
+			expected: "true",
+		},
+		{
+			name:     "matchLabels are sorted and ANDed",
+			selector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a", "env": "prod"}},
+			expected: "('env' in variables.labels && variables.labels['env'] == 'prod') && " +
+				"('team' in variables.labels && variables.labels['team'] == 'a')",
+		},
+		{
+			name: "all operators",
+			selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "team", Operator: metav1.LabelSelectorOpIn, Values: []string{"a", "b"}},
+				{Key: "tier", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"untrusted"}},
+				{Key: "secrets", Operator: metav1.LabelSelectorOpExists},
+				{Key: "sandbox", Operator: metav1.LabelSelectorOpDoesNotExist},
+			}},
+			expected: "('team' in variables.labels && variables.labels['team'] in ['a', 'b']) && " +
+				"!('tier' in variables.labels && variables.labels['tier'] in ['untrusted']) && " +
+				"('secrets' in variables.labels) && " +
+				"!('sandbox' in variables.labels)",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := labelSelectorToCEL(tc.selector); got != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestWithNamespaceAdmissionPolicyAsset(t *testing.T) {
+	cases := []struct {
+		name               string
+		configMap          *corev1.ConfigMap
+		expectedExpression string
+		expectedCreate     bool
+		expectedDelete     bool
+		wantErrContains    string
+	}{
+		{
+			name:               "no operator config allows all namespaces and deletes the policy",
+			expectedExpression: "true",
+			expectedDelete:     true,
+		},
+		{
+			name:               "namespaceSelector is rendered into the policy",
+			configMap:          newOperatorConfigMap("namespaceAdmission:\n  namespaceSelector:\n    matchLabels:\n      secrets-store: allowed\n"),
+			expectedExpression: "('secrets-store' in variables.labels && variables.labels['secrets-store'] == 'allowed')",
+			expectedCreate:     true,
+		},
+		{
+			name:            "invalid namespaceSelector is an error and keeps the policy",
+			configMap:       newOperatorConfigMap("namespaceAdmission:\n  namespaceSelector:\n    matchLabels:\n      team: \"a'b\"\n"),
+			wantErrContains: "invalid namespaceAdmission.namespaceSelector",
+			expectedCreate:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			lister := newTestConfigMapLister(t)
+			if tc.configMap != nil {
+				lister = newTestConfigMapLister(t, tc.configMap)
+			}
+			if got := shouldCreateNamespaceAdmission(lister, testOperatorNamespace); got != tc.expectedCreate {
+				t.Fatalf("expected shouldCreate to be %t, got %t", tc.expectedCreate, got)
+			}
+			if got := shouldDeleteNamespaceAdmission(lister, testOperatorNamespace); got != tc.expectedDelete {
+				t.Fatalf("expected shouldDelete to be %t, got %t", tc.expectedDelete, got)
+			}
+
+			assetFunc := withNamespaceAdmissionPolicyAsset(replaceNamespaceFunc(testOperatorNamespace), lister, testOperatorNamespace)
+			if _, err := assetFunc(namespacePolicyBindingAssetName); err != nil {
+				t.Fatalf("unexpected error reading %s: %v", namespacePolicyBindingAssetName, err)
+			}
+			manifest, err := assetFunc(namespacePolicyAssetName)
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErrContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			policy := resourceread.ReadValidatingAdmissionPolicyV1OrDie(manifest)
+			for _, variable := range policy.Spec.Variables {
+				if variable.Name == namespaceAllowedVariable && variable.Expression != tc.expectedExpression {
+					t.Fatalf("expected %s to be %q, got %q", namespaceAllowedVariable, tc.expectedExpression, variable.Expression)
+				}
+			}
+		})
+	}
+}
+
+func TestNamespaceAdmissionPolicyBindingMatchesPolicy(t *testing.T) {
+	assetFunc := replaceNamespaceFunc(testOperatorNamespace)
+	policyManifest, err := assetFunc(namespacePolicyAssetName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindingManifest, err := assetFunc(namespacePolicyBindingAssetName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := resourceread.ReadValidatingAdmissionPolicyV1OrDie(policyManifest)
+	binding := resourceread.ReadValidatingAdmissionPolicyBindingV1OrDie(bindingManifest)
+	if binding.Spec.PolicyName != policy.Name {
+		t.Fatalf("expected binding to reference policy %s, got %s", policy.Name, binding.Spec.PolicyName)
+	}
+}
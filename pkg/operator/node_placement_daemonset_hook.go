@@ -0,0 +1,200 @@
+package operator
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/csi/csidrivernodeservicecontroller"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// daemonSetAutoTolerationPrefix is the prefix of the node.kubernetes.io/*
+// taints the DaemonSet controller tolerates on its own (not-ready,
+// unreachable, unschedulable, the pressure taints, ...). They must not make
+// a node count as unschedulable for the driver.
+const daemonSetAutoTolerationPrefix = "node.kubernetes.io/"
+
+// withNodePlacementDaemonSetHook returns a DaemonSetHookFunc that applies
+// operatorConfig.NodePlacement to the node DaemonSet, or to a provider
+// DaemonSet, see providerController:
+//
+//   - nodeSelector is added to the kubernetes.io/os: linux selector of
+//     assets/node.yaml and of the provider DaemonSets;
+//   - tolerations, when set, replace the tolerate-everything default;
+//   - affinity, when set, is used as is.
+//
+// A placement that leaves the driver without any node is rejected with an
+// error, so that the DaemonSet is not updated and the node service
+// controller, or the provider controller, reports Degraded instead of
+// evicting the driver or the provider from every node.
+func withNodePlacementDaemonSetHook(configMapLister corev1listers.ConfigMapLister, nodeLister corev1listers.NodeLister, operatorNamespace string) csidrivernodeservicecontroller.DaemonSetHookFunc {
+	return func(_ *opv1.OperatorSpec, daemonSet *appsv1.DaemonSet) error {
+		config, err := getOperatorConfig(configMapLister, operatorNamespace)
+		if err != nil {
+			return err
+		}
+		placement := config.NodePlacement
+		if len(placement.NodeSelector) == 0 && placement.Tolerations == nil && placement.Affinity == nil {
+			return nil
+		}
+
+		podSpec := &daemonSet.Spec.Template.Spec
+		for key, value := range placement.NodeSelector {
+			if existing, ok := podSpec.NodeSelector[key]; ok && existing != value {
+				return fmt.Errorf("invalid nodePlacement.nodeSelector in ConfigMap %s: %s=%s conflicts with the driver's %s=%s", operatorConfigMapName, key, value, key, existing)
+			}
+		}
+		for key, value := range placement.NodeSelector {
+			if podSpec.NodeSelector == nil {
+				podSpec.NodeSelector = map[string]string{}
+			}
+			podSpec.NodeSelector[key] = value
+		}
+		if placement.Tolerations != nil {
+			podSpec.Tolerations = placement.Tolerations
+		}
+		if placement.Affinity != nil {
+			podSpec.Affinity = placement.Affinity
+		}
+
+		nodes, err := nodeLister.List(labels.Everything())
+		if err != nil {
+			return fmt.Errorf("failed to list nodes: %w", err)
+		}
+		// A cluster without nodes says nothing about the placement.
+		if len(nodes) == 0 {
+			return nil
+		}
+		eligible := 0
+		for _, node := range nodes {
+			ok, err := podSpecFitsNode(podSpec, node)
+			if err != nil {
+				return fmt.Errorf("invalid nodePlacement in ConfigMap %s: %w", operatorConfigMapName, err)
+			}
+			if ok {
+				eligible++
+			}
+		}
+		klog.V(4).Infof("resolved node placement for DaemonSet %s/%s: %d of %d nodes eligible", daemonSet.Namespace, daemonSet.Name, eligible, len(nodes))
+		if eligible == 0 {
+			return fmt.Errorf("nodePlacement in ConfigMap %s matches none of the %d nodes; keeping the DaemonSet %s/%s unchanged", operatorConfigMapName, len(nodes), daemonSet.Namespace, daemonSet.Name)
+		}
+		return nil
+	}
+}
+
+// podSpecFitsNode returns whether the DaemonSet controller would place a pod
+// with podSpec on node, as far as nodeSelector, required node affinity and
+// NoSchedule/NoExecute taints are concerned.
+func podSpecFitsNode(podSpec *corev1.PodSpec, node *corev1.Node) (bool, error) {
+	if !labels.SelectorFromSet(podSpec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false, nil
+	}
+
+	if affinity := podSpec.Affinity; affinity != nil && affinity.NodeAffinity != nil && affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		matches, err := nodeSelectorMatchesNode(affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution, node)
+		if err != nil || !matches {
+			return false, err
+		}
+	}
+
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule || strings.HasPrefix(taint.Key, daemonSetAutoTolerationPrefix) {
+			continue
+		}
+		tolerated := false
+		for j := range podSpec.Tolerations {
+			if podSpec.Tolerations[j].ToleratesTaint(klog.Background(), taint, true) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// nodeSelectorMatchesNode returns whether any of the terms of nodeSelector
+// matches node. Within a term, all requirements must match.
+func nodeSelectorMatchesNode(nodeSelector *corev1.NodeSelector, node *corev1.Node) (bool, error) {
+	for _, term := range nodeSelector.NodeSelectorTerms {
+		// A term without requirements matches no node.
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+		matches, err := nodeSelectorTermMatchesNode(term, node)
+		if err != nil {
+			return false, err
+		}
+		if matches {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func nodeSelectorTermMatchesNode(term corev1.NodeSelectorTerm, node *corev1.Node) (bool, error) {
+	selector := labels.NewSelector()
+	for _, expression := range term.MatchExpressions {
+		requirement, err := nodeSelectorRequirementAsLabelRequirement(expression)
+		if err != nil {
+			return false, err
+		}
+		selector = selector.Add(*requirement)
+	}
+	if !selector.Matches(labels.Set(node.Labels)) {
+		return false, nil
+	}
+
+	// Node names are not valid label values in general, so matchFields,
+	// which only supports metadata.name with In and NotIn, is matched by hand.
+	for _, field := range term.MatchFields {
+		if field.Key != "metadata.name" {
+			return false, fmt.Errorf("unsupported matchFields key %q", field.Key)
+		}
+		switch field.Operator {
+		case corev1.NodeSelectorOpIn:
+			if !slices.Contains(field.Values, node.Name) {
+				return false, nil
+			}
+		case corev1.NodeSelectorOpNotIn:
+			if slices.Contains(field.Values, node.Name) {
+				return false, nil
+			}
+		default:
+			return false, fmt.Errorf("unsupported matchFields operator %q", field.Operator)
+		}
+	}
+	return true, nil
+}
+
+func nodeSelectorRequirementAsLabelRequirement(requirement corev1.NodeSelectorRequirement) (*labels.Requirement, error) {
+	var op selection.Operator
+	switch requirement.Operator {
+	case corev1.NodeSelectorOpIn:
+		op = selection.In
+	case corev1.NodeSelectorOpNotIn:
+		op = selection.NotIn
+	case corev1.NodeSelectorOpExists:
+		op = selection.Exists
+	case corev1.NodeSelectorOpDoesNotExist:
+		op = selection.DoesNotExist
+	case corev1.NodeSelectorOpGt:
+		op = selection.GreaterThan
+	case corev1.NodeSelectorOpLt:
+		op = selection.LessThan
+	default:
+		return nil, fmt.Errorf("unsupported node selector operator %q", requirement.Operator)
+	}
+	return labels.NewRequirement(requirement.Key, op, requirement.Values)
+}
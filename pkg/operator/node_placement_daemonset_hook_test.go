@@ -0,0 +1,158 @@
+package operator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestNodeLister(t *testing.T, nodes ...*corev1.Node) corev1listers.NodeLister {
+	t.Helper()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, node := range nodes {
+		if err := indexer.Add(node); err != nil {
+			t.Fatalf("failed to add node to indexer: %v", err)
+		}
+	}
+	return corev1listers.NewNodeLister(indexer)
+}
+
+func newTestNode(name string, nodeLabels map[string]string, taints ...corev1.Taint) *corev1.Node {
+	allLabels := map[string]string{"kubernetes.io/os": "linux"}
+	for key, value := range nodeLabels {
+		allLabels[key] = value
+	}
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: allLabels},
+		Spec:       corev1.NodeSpec{Taints: taints},
+	}
+}
+
+func TestWithNodePlacementDaemonSetHook(t *testing.T) {
+	infraTaint := corev1.Taint{Key: "node-role.kubernetes.io/infra", Effect: corev1.TaintEffectNoSchedule}
+	nodes := []*corev1.Node{
+		newTestNode("worker-0", map[string]string{"node-role.kubernetes.io/worker": ""},
+			corev1.Taint{Key: "node.kubernetes.io/unschedulable", Effect: corev1.TaintEffectNoSchedule}),
+		newTestNode("infra-0", map[string]string{"node-role.kubernetes.io/infra": ""}, infraTaint),
+	}
+
+	cases := []struct {
+		name                 string
+		configMap            *corev1.ConfigMap
+		nodes                []*corev1.Node
+		expectedNodeSelector map[string]string
+		expectedTolerations  []corev1.Toleration
+		expectedAffinity     *corev1.Affinity
+		wantErrContains      string
+	}{
+		{
+			name:                 "no operator config keeps the manifest placement",
+			nodes:                nodes,
+			expectedNodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+			expectedTolerations:  []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+		},
+		{
+			name:                 "nodeSelector is added to the manifest selector",
+			configMap:            newOperatorConfigMap("nodePlacement:\n  nodeSelector:\n    node-role.kubernetes.io/worker: \"\"\n"),
+			nodes:                nodes,
+			expectedNodeSelector: map[string]string{"kubernetes.io/os": "linux", "node-role.kubernetes.io/worker": ""},
+			expectedTolerations:  []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+		},
+		{
+			name: "tolerations and affinity replace the manifest ones",
+			configMap: newOperatorConfigMap(`nodePlacement:
+  tolerations:
+  - key: node-role.kubernetes.io/infra
+    operator: Exists
+    effect: NoSchedule
+  affinity:
+    nodeAffinity:
+      requiredDuringSchedulingIgnoredDuringExecution:
+        nodeSelectorTerms:
+        - matchExpressions:
+          - key: node-role.kubernetes.io/infra
+            operator: Exists
+`),
+			nodes:                nodes,
+			expectedNodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+			expectedTolerations: []corev1.Toleration{
+				{Key: "node-role.kubernetes.io/infra", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+			},
+			expectedAffinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "node-role.kubernetes.io/infra", Operator: corev1.NodeSelectorOpExists}},
+				}}},
+			}},
+		},
+		{
+			name:            "placement matching no node is an error",
+			configMap:       newOperatorConfigMap("nodePlacement:\n  nodeSelector:\n    node-role.kubernetes.io/edge: \"\"\n"),
+			nodes:           nodes,
+			wantErrContains: "matches none of the 2 nodes",
+		},
+		{
+			name:            "placement not tolerating the only matching node's taint is an error",
+			configMap:       newOperatorConfigMap("nodePlacement:\n  nodeSelector:\n    node-role.kubernetes.io/infra: \"\"\n  tolerations: []\n"),
+			nodes:           nodes,
+			wantErrContains: "matches none of the 2 nodes",
+		},
+		{
+			name:            "matchFields selects nodes by name",
+			configMap:       newOperatorConfigMap("nodePlacement:\n  affinity:\n    nodeAffinity:\n      requiredDuringSchedulingIgnoredDuringExecution:\n        nodeSelectorTerms:\n        - matchFields:\n          - key: metadata.name\n            operator: In\n            values: [worker-1]\n"),
+			nodes:           nodes,
+			wantErrContains: "matches none of the 2 nodes",
+		},
+		{
+			name:                 "empty node cache does not block the placement",
+			configMap:            newOperatorConfigMap("nodePlacement:\n  nodeSelector:\n    node-role.kubernetes.io/edge: \"\"\n"),
+			expectedNodeSelector: map[string]string{"kubernetes.io/os": "linux", "node-role.kubernetes.io/edge": ""},
+			expectedTolerations:  []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+		},
+		{
+			name:            "nodeSelector conflicting with the manifest is an error",
+			configMap:       newOperatorConfigMap("nodePlacement:\n  nodeSelector:\n    kubernetes.io/os: windows\n"),
+			nodes:           nodes,
+			wantErrContains: "conflicts with the driver's kubernetes.io/os=linux",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			configMapLister := newTestConfigMapLister(t)
+			if tc.configMap != nil {
+				configMapLister = newTestConfigMapLister(t, tc.configMap)
+			}
+			hook := withNodePlacementDaemonSetHook(configMapLister, newTestNodeLister(t, tc.nodes...), testOperatorNamespace)
+
+			daemonSet := newTestDaemonSet()
+			podSpec := &daemonSet.Spec.Template.Spec
+			podSpec.NodeSelector = map[string]string{"kubernetes.io/os": "linux"}
+			podSpec.Tolerations = []corev1.Toleration{{Operator: corev1.TolerationOpExists}}
+			err := hook(&opv1.OperatorSpec{}, daemonSet)
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErrContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error from hook: %v", err)
+			}
+			if !reflect.DeepEqual(podSpec.NodeSelector, tc.expectedNodeSelector) {
+				t.Fatalf("expected nodeSelector %v, got %v", tc.expectedNodeSelector, podSpec.NodeSelector)
+			}
+			if !reflect.DeepEqual(podSpec.Tolerations, tc.expectedTolerations) {
+				t.Fatalf("expected tolerations %v, got %v", tc.expectedTolerations, podSpec.Tolerations)
+			}
+			if !reflect.DeepEqual(podSpec.Affinity, tc.expectedAffinity) {
+				t.Fatalf("expected affinity %v, got %v", tc.expectedAffinity, podSpec.Affinity)
+			}
+		})
+	}
+}
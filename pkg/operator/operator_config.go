@@ -0,0 +1,219 @@
+package operator
+
+import (
+	"fmt"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	// operatorConfigMapName is the ConfigMap in the operator namespace that
+	// carries operator settings the ClusterCSIDriver API has no field for.
+	operatorConfigMapName = "secrets-store-csi-driver-operator-config"
+	// operatorConfigKey is the key within operatorConfigMapName holding the
+	// YAML-encoded operatorConfig.
+	operatorConfigKey = "config.yaml"
+)
+
+// operatorConfig is the decoded content of operatorConfigMapName. Every
+// field is optional; the zero value means "no opinion" and keeps the
+// behavior the operator had before the field existed.
+type operatorConfig struct {
+	// Providers lists the CSI secret providers the operator deploys
+	// alongside the driver. Providers not listed are removed.
+	Providers []providerConfig `json:"providers,omitempty"`
+	// ExternalProviders names CSI secret providers installed on the nodes by
+	// other means than Providers. SecretProviderClasses may reference them
+	// without being reported as using an unregistered provider.
+	ExternalProviders []string `json:"externalProviders,omitempty"`
+	// ProviderHealthCheck configures the driver's periodic health checks of
+	// the providers.
+	ProviderHealthCheck providerHealthCheckConfig `json:"providerHealthCheck,omitempty"`
+	// SecretSync controls the driver's write access to Secrets, which it
+	// needs to sync mounted objects into Kubernetes Secrets.
+	SecretSync secretSyncConfig `json:"secretSync,omitempty"`
+	// NamespaceAdmission restricts the namespaces that may use the driver.
+	NamespaceAdmission namespaceAdmissionConfig `json:"namespaceAdmission,omitempty"`
+	// NodePlacement restricts the nodes the driver DaemonSet runs on.
+	NodePlacement nodePlacementConfig `json:"nodePlacement,omitempty"`
+	// Resources overrides the resources of the driver containers.
+	Resources driverResourcesConfig `json:"resources,omitempty"`
+	// RotationPolicies set the rotation interval of SecretProviderClasses
+	// by provider or by label, instead of the ClusterCSIDriver's global one.
+	RotationPolicies []rotationPolicy `json:"rotationPolicies,omitempty"`
+	// RotationSafety bounds the rotation interval the driver is rolled out
+	// with.
+	RotationSafety rotationSafetyConfig `json:"rotationSafety,omitempty"`
+	// CSIDriverDrift controls how out-of-band edits of the driver's
+	// CSIDriver object are handled.
+	CSIDriverDrift csiDriverDriftConfig `json:"csiDriverDrift,omitempty"`
+	// DriverLogLevels set the verbosity of the driver containers, instead of
+	// the ClusterCSIDriver's logLevel.
+	DriverLogLevels driverLogLevelsConfig `json:"driverLogLevels,omitempty"`
+	// DebugWindow raises the driver's verbosity on some nodes for a while.
+	DebugWindow *debugWindowConfig `json:"debugWindow,omitempty"`
+	// AdditionalTrustedCAs are merged into the cluster trusted CA bundle
+	// the providers and the driver mount, see trustedCABundleController.
+	AdditionalTrustedCAs []trustedCAConfigMapRef `json:"additionalTrustedCAs,omitempty"`
+}
+
+// providerHealthCheckConfig is the operatorConfig.ProviderHealthCheck
+// section. See getProviderHealthCheckConfig for how it is resolved.
+type providerHealthCheckConfig struct {
+	// Enabled turns the driver's provider health checks on or off.
+	Enabled *bool `json:"enabled,omitempty"`
+	// Interval is how often the driver checks the providers.
+	Interval metav1.Duration `json:"interval,omitempty"`
+}
+
+// secretSyncConfig is the operatorConfig.SecretSync section. Unlike the
+// other sections, its zero value is not the historical behavior: syncing
+// Secrets is an explicit opt-in, see secretSyncController.
+type secretSyncConfig struct {
+	// Enabled grants the driver write access to Secrets.
+	Enabled bool `json:"enabled,omitempty"`
+	// Namespaces restricts the write access to these namespaces. Empty
+	// means all namespaces.
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// namespaceAdmissionConfig is the operatorConfig.NamespaceAdmission section.
+type namespaceAdmissionConfig struct {
+	// NamespaceSelector selects the namespaces whose pods may mount
+	// secrets-store volumes and that may hold SecretProviderClasses. Nil
+	// means all namespaces, without any admission policy.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// nodePlacementConfig is the operatorConfig.NodePlacement section. See
+// withNodePlacementDaemonSetHook for how it is applied.
+type nodePlacementConfig struct {
+	// NodeSelector is added to the driver's kubernetes.io/os: linux selector.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations replace the driver's default of tolerating all taints.
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// Affinity is the driver pods' affinity.
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+}
+
+// driverResourcesConfig is the operatorConfig.Resources section. See
+// withResourcesDaemonSetHook for how it is applied.
+type driverResourcesConfig struct {
+	// Containers maps a container of the driver DaemonSet to the resources
+	// replacing the ones of assets/node.yaml.
+	Containers map[string]corev1.ResourceRequirements `json:"containers,omitempty"`
+	// AutoSize raises the csi-driver container's requests with the number
+	// of mounts per node.
+	AutoSize bool `json:"autoSize,omitempty"`
+	// PriorityClassName replaces the system-node-critical priority class of
+	// the driver pods.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+}
+
+// rotationPolicy is an entry of operatorConfig.RotationPolicies. See
+// withRotationPolicyDaemonSetHook for how the policies are applied.
+type rotationPolicy struct {
+	// Provider selects the SecretProviderClasses of this provider.
+	Provider string `json:"provider,omitempty"`
+	// SecretProviderClassSelector selects SecretProviderClasses by label.
+	SecretProviderClassSelector *metav1.LabelSelector `json:"secretProviderClassSelector,omitempty"`
+	// Interval is how often the selected SecretProviderClasses are rotated.
+	Interval metav1.Duration `json:"interval"`
+}
+
+// rotationSafetyConfig is the operatorConfig.RotationSafety section. Unset
+// fields take the defaults of getRotationSafetyBounds.
+type rotationSafetyConfig struct {
+	// MinInterval is the shortest allowed rotation interval.
+	MinInterval metav1.Duration `json:"minInterval,omitempty"`
+	// MaxInterval is the longest allowed rotation interval.
+	MaxInterval metav1.Duration `json:"maxInterval,omitempty"`
+	// MaxProviderCallsPerSecond caps the estimated rate of provider calls,
+	// one per mounted volume and rotation interval.
+	MaxProviderCallsPerSecond int32 `json:"maxProviderCallsPerSecond,omitempty"`
+}
+
+// csiDriverDriftConfig is the operatorConfig.CSIDriverDrift section. See
+// csiDriverDriftController for how drift is detected.
+type csiDriverDriftConfig struct {
+	// Strict reverts out-of-band edits of podInfoOnMount, fsGroupPolicy and
+	// volumeLifecycleModes instead of only reporting them.
+	Strict bool `json:"strict,omitempty"`
+	// RecreateImmutable lets strict mode revert edits the API server does
+	// not allow to update by deleting the CSIDriver, for it to be recreated
+	// from the manifest. Without it, such edits are only reported.
+	RecreateImmutable bool `json:"recreateImmutable,omitempty"`
+}
+
+// driverLogLevelsConfig is the operatorConfig.DriverLogLevels section. See
+// withDriverLogLevelsDaemonSetHook for how it is applied. An unset level
+// keeps the ClusterCSIDriver's logLevel.
+type driverLogLevelsConfig struct {
+	// Driver is the log level of the csi-driver container.
+	Driver opv1.LogLevel `json:"driver,omitempty"`
+	// Registrar is the log level of the csi-node-driver-registrar container.
+	Registrar opv1.LogLevel `json:"registrar,omitempty"`
+	// LivenessProbe is the log level of the csi-liveness-probe container.
+	LivenessProbe opv1.LogLevel `json:"livenessProbe,omitempty"`
+}
+
+// debugWindowConfig is the operatorConfig.DebugWindow section. See
+// debugWindowController for how it is applied.
+type debugWindowConfig struct {
+	// Nodes are the names of the nodes whose driver is raised to LogLevel.
+	Nodes []string `json:"nodes"`
+	// LogLevel is the log level of the csi-driver container on Nodes.
+	// Defaults to TraceAll.
+	LogLevel opv1.LogLevel `json:"logLevel,omitempty"`
+	// TTL is how long the window lasts from when the operator opens it.
+	TTL metav1.Duration `json:"ttl"`
+}
+
+// trustedCAConfigMapRef is an entry of operatorConfig.AdditionalTrustedCAs.
+type trustedCAConfigMapRef struct {
+	// Name is the ConfigMap in the operator namespace holding the CAs.
+	Name string `json:"name"`
+	// Key is the key of the PEM-encoded CAs. Defaults to ca-bundle.crt.
+	Key string `json:"key,omitempty"`
+}
+
+// providerConfig enables one of knownProviders.
+type providerConfig struct {
+	// Name is the provider's key in knownProviders (e.g. "aws", "vault").
+	Name string `json:"name"`
+	// Image is the provider image. It is required: the operator ships no
+	// default provider images.
+	Image string `json:"image,omitempty"`
+}
+
+// getOperatorConfig returns the operatorConfig stored in
+// operatorConfigMapName in namespace, or the zero value if the ConfigMap or
+// its key does not exist. Unknown fields are rejected so that a typo is
+// reported instead of being silently ignored.
+func getOperatorConfig(configMapLister corev1listers.ConfigMapLister, namespace string) (operatorConfig, error) {
+	configMap, err := configMapLister.ConfigMaps(namespace).Get(operatorConfigMapName)
+	if apierrors.IsNotFound(err) {
+		klog.V(4).Infof("ConfigMap %s/%s not found, assuming default operator configuration", namespace, operatorConfigMapName)
+		return operatorConfig{}, nil
+	}
+	if err != nil {
+		return operatorConfig{}, fmt.Errorf("failed to get ConfigMap %s/%s: %w", namespace, operatorConfigMapName, err)
+	}
+
+	content, ok := configMap.Data[operatorConfigKey]
+	if !ok {
+		return operatorConfig{}, nil
+	}
+
+	config := operatorConfig{}
+	if err := sigsyaml.UnmarshalStrict([]byte(content), &config); err != nil {
+		return operatorConfig{}, fmt.Errorf("failed to parse %q in ConfigMap %s/%s: %w", operatorConfigKey, namespace, operatorConfigMapName, err)
+	}
+	return config, nil
+}
@@ -0,0 +1,106 @@
+package operator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const testOperatorNamespace = "openshift-cluster-csi-drivers"
+
+// newTestConfigMapLister returns a ConfigMapLister serving configMaps.
+func newTestConfigMapLister(t *testing.T, configMaps ...*corev1.ConfigMap) corev1listers.ConfigMapLister {
+	t.Helper()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, configMap := range configMaps {
+		if err := indexer.Add(configMap); err != nil {
+			t.Fatalf("failed to add ConfigMap to indexer: %v", err)
+		}
+	}
+	return corev1listers.NewConfigMapLister(indexer)
+}
+
+// newOperatorConfigMap returns the operator config ConfigMap carrying content
+// under operatorConfigKey.
+func newOperatorConfigMap(content string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: operatorConfigMapName, Namespace: testOperatorNamespace},
+		Data:       map[string]string{operatorConfigKey: content},
+	}
+}
+
+func TestGetOperatorConfig(t *testing.T) {
+	cases := []struct {
+		name            string
+		configMap       *corev1.ConfigMap
+		expected        operatorConfig
+		wantErrContains string
+	}{
+		{
+			name:     "ConfigMap not found returns the zero value",
+			expected: operatorConfig{},
+		},
+		{
+			name: "ConfigMap without the config key returns the zero value",
+			configMap: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: operatorConfigMapName, Namespace: testOperatorNamespace},
+			},
+			expected: operatorConfig{},
+		},
+		{
+			name: "providers are decoded",
+			configMap: newOperatorConfigMap(`
+providers:
+- name: aws
+- name: vault
+  image: quay.io/example/vault-csi-provider:1.4.0
+`),
+			expected: operatorConfig{
+				Providers: []providerConfig{
+					{Name: "aws"},
+					{Name: "vault", Image: "quay.io/example/vault-csi-provider:1.4.0"},
+				},
+			},
+		},
+		{
+			name:      "external providers are decoded",
+			configMap: newOperatorConfigMap("externalProviders:\n- conjur\n"),
+			expected:  operatorConfig{ExternalProviders: []string{"conjur"}},
+		},
+		{
+			name:            "unknown fields are rejected",
+			configMap:       newOperatorConfigMap("provider:\n- name: aws\n"),
+			wantErrContains: "failed to parse",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var lister corev1listers.ConfigMapLister
+			if tc.configMap != nil {
+				lister = newTestConfigMapLister(t, tc.configMap)
+			} else {
+				lister = newTestConfigMapLister(t)
+			}
+
+			config, err := getOperatorConfig(lister, testOperatorNamespace)
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErrContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(config, tc.expected) {
+				t.Fatalf("expected config to be %+v, got %+v", tc.expected, config)
+			}
+		})
+	}
+}
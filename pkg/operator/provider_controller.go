@@ -0,0 +1,331 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	applyoperatorv1 "github.com/openshift/client-go/operator/applyconfigurations/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/management"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/resource/resourcemerge"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceread"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// providerImageKey is the image placeholder in providers/<name>/daemonset.yaml.
+	providerImageKey = "${PROVIDER_IMAGE}"
+	// providerDaemonSetAssetName is the DaemonSet manifest of every provider.
+	providerDaemonSetAssetName = "daemonset.yaml"
+)
+
+// secretsStoreProvider describes a CSI secret provider the operator knows how
+// to deploy. Its manifests live in assets/providers/<name>/.
+type secretsStoreProvider struct {
+	// staticFiles are the provider's ServiceAccount and RBAC manifests. They
+	// are applied before, and deleted together with, the provider DaemonSet.
+	staticFiles []string
+}
+
+// knownProviders maps providerConfig.Name to the provider it enables.
+var knownProviders = map[string]secretsStoreProvider{
+	"aws": {
+		staticFiles: []string{"serviceaccount.yaml", "role.yaml", "binding.yaml", "privileged_binding.yaml"},
+	},
+	"azure": {
+		staticFiles: []string{"serviceaccount.yaml", "privileged_binding.yaml"},
+	},
+	"gcp": {
+		staticFiles: []string{"serviceaccount.yaml", "role.yaml", "binding.yaml", "privileged_binding.yaml"},
+	},
+	"vault": {
+		staticFiles: []string{"serviceaccount.yaml", "role.yaml", "binding.yaml", "privileged_binding.yaml"},
+	},
+}
+
+// providerController deploys the CSI secret providers enabled in
+// operatorConfig.Providers and removes the ones that are not.
+//
+// It follows the same management-state semantics as the conditional static
+// resources controller (see getOperatorSyncState): providers are reconciled
+// while Managed, left alone while Unmanaged and all of them are deleted when
+// Removed or when the ClusterCSIDriver is being deleted. Like the driver's
+// node service, it holds a finalizer on the ClusterCSIDriver so the provider
+// DaemonSets are cleaned up before the ClusterCSIDriver goes away.
+//
+// Errors are reported as the <name>Degraded condition.
+type providerController struct {
+	name              string
+	operatorNamespace string
+	operatorClient    v1helpers.OperatorClientWithFinalizers
+	kubeClient        kubernetes.Interface
+	clients           *resourceapply.ClientHolder
+	resourceCache     resourceapply.ResourceCache
+	configMapLister   corev1listers.ConfigMapLister
+	daemonSetLister   appsv1listers.DaemonSetLister
+	saLister          corev1listers.ServiceAccountLister
+	nodeLister        corev1listers.NodeLister
+}
+
+func newProviderController(
+	name string,
+	operatorNamespace string,
+	operatorClient v1helpers.OperatorClientWithFinalizers,
+	kubeClient kubernetes.Interface,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	recorder events.Recorder,
+) factory.Controller {
+	namespacedInformers := kubeInformersForNamespaces.InformersFor(operatorNamespace)
+	configMapInformer := namespacedInformers.Core().V1().ConfigMaps()
+	daemonSetInformer := namespacedInformers.Apps().V1().DaemonSets()
+	saInformer := namespacedInformers.Core().V1().ServiceAccounts()
+	nodeInformer := kubeInformersForNamespaces.InformersFor("").Core().V1().Nodes()
+
+	c := &providerController{
+		name:              name,
+		operatorNamespace: operatorNamespace,
+		operatorClient:    operatorClient,
+		kubeClient:        kubeClient,
+		clients:           resourceapply.NewClientHolder().WithKubernetes(kubeClient),
+		resourceCache:     resourceapply.NewResourceCache(),
+		configMapLister:   configMapInformer.Lister(),
+		daemonSetLister:   daemonSetInformer.Lister(),
+		saLister:          saInformer.Lister(),
+		nodeLister:        nodeInformer.Lister(),
+	}
+	return factory.New().WithInformers(
+		operatorClient.Informer(),
+		configMapInformer.Informer(),
+		daemonSetInformer.Informer(),
+		saInformer.Informer(),
+		nodeInformer.Informer(),
+	).WithSync(
+		c.sync,
+	).ResyncEvery(
+		time.Minute,
+	).WithSyncDegradedOnError(
+		operatorClient,
+	).ToController(
+		name,
+		recorder.WithComponentSuffix("secrets-store-provider-controller"),
+	)
+}
+
+func (c *providerController) sync(ctx context.Context, syncContext factory.SyncContext) error {
+	switch getOperatorSyncState(c.operatorClient) {
+	case opv1.Managed:
+		return c.syncManaged(ctx, syncContext)
+	case opv1.Removed:
+		return c.syncRemoved(ctx, syncContext)
+	default:
+		return nil
+	}
+}
+
+func (c *providerController) syncManaged(ctx context.Context, syncContext factory.SyncContext) error {
+	config, err := getOperatorConfig(c.configMapLister, c.operatorNamespace)
+	if err != nil {
+		return err
+	}
+	enabled, err := getEnabledProviders(config)
+	if err != nil {
+		return err
+	}
+
+	_, opStatus, _, err := c.operatorClient.GetOperatorState()
+	if err != nil {
+		return err
+	}
+	if management.IsOperatorRemovable() {
+		if err := v1helpers.EnsureFinalizer(ctx, c.operatorClient, c.name); err != nil {
+			return err
+		}
+	}
+
+	status := applyoperatorv1.OperatorStatus()
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(knownProviders)) {
+		provider, ok := enabled[name]
+		if !ok {
+			errs = append(errs, c.deleteProvider(ctx, syncContext, name)...)
+			continue
+		}
+		daemonSet, err := c.applyProvider(ctx, syncContext, provider, opStatus)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		status = status.WithGenerations(&applyoperatorv1.GenerationStatusApplyConfiguration{
+			Group:          ptr.To("apps"),
+			Resource:       ptr.To("daemonsets"),
+			Namespace:      ptr.To(daemonSet.Namespace),
+			Name:           ptr.To(daemonSet.Name),
+			LastGeneration: ptr.To(daemonSet.Generation),
+		})
+	}
+
+	if err := c.operatorClient.ApplyOperatorStatus(ctx, c.name, status); err != nil {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (c *providerController) syncRemoved(ctx context.Context, syncContext factory.SyncContext) error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(knownProviders)) {
+		errs = append(errs, c.deleteProvider(ctx, syncContext, name)...)
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	// All removed, remove the finalizer as the last step
+	return v1helpers.RemoveFinalizer(ctx, c.operatorClient, c.name)
+}
+
+// applyProvider applies the ServiceAccount, RBAC and DaemonSet of provider,
+// placed like the driver by operatorConfig.NodePlacement, and returns the
+// DaemonSet as stored by the API server.
+func (c *providerController) applyProvider(ctx context.Context, syncContext factory.SyncContext, provider providerConfig, opStatus *opv1.OperatorStatus) (*appsv1.DaemonSet, error) {
+	known := knownProviders[provider.Name]
+	if provider.Image == "" {
+		return nil, fmt.Errorf("no image configured for provider %q: set providers[].image in ConfigMap %s", provider.Name, operatorConfigMapName)
+	}
+	assetFunc := c.providerAssetFunc(provider.Name, provider.Image)
+
+	var errs []error
+	for _, result := range resourceapply.ApplyDirectly(ctx, c.clients, syncContext.Recorder(), c.resourceCache, assetFunc, known.staticFiles...) {
+		if result.Error != nil {
+			errs = append(errs, fmt.Errorf("failed to apply %q for provider %q: %w", result.File, provider.Name, result.Error))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+
+	manifest, err := assetFunc(providerDaemonSetAssetName)
+	if err != nil {
+		return nil, err
+	}
+	required := resourceread.ReadDaemonSetV1OrDie(manifest)
+	// The driver reaches the providers through sockets on its node, so the
+	// providers run on the nodes the driver runs on.
+	if err := withNodePlacementDaemonSetHook(c.configMapLister, c.nodeLister, c.operatorNamespace)(nil, required); err != nil {
+		return nil, fmt.Errorf("failed to apply the node placement for provider %q: %w", provider.Name, err)
+	}
+	if err := injectTrustedCABundle(c.configMapLister, c.operatorNamespace, &required.Spec.Template, []string{providerContainerName}); err != nil {
+		return nil, fmt.Errorf("failed to inject the trusted CA bundle for provider %q: %w", provider.Name, err)
+	}
+	daemonSet, _, err := resourceapply.ApplyDaemonSet(
+		ctx,
+		c.kubeClient.AppsV1(),
+		syncContext.Recorder(),
+		required,
+		resourcemerge.ExpectedDaemonSetGeneration(required, opStatus.Generations),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply DaemonSet for provider %q: %w", provider.Name, err)
+	}
+	return daemonSet, nil
+}
+
+// deleteProvider deletes everything applyProvider creates for the provider
+// called name. It is a no-op when neither the provider's DaemonSet nor its
+// ServiceAccount is present in the informer caches, so that providers which
+// were never enabled do not cost a round of DELETE calls on every sync.
+func (c *providerController) deleteProvider(ctx context.Context, syncContext factory.SyncContext, name string) []error {
+	deployed, err := c.isProviderDeployed(name)
+	if err != nil {
+		return []error{err}
+	}
+	if !deployed {
+		return nil
+	}
+
+	klog.Infof("Removing secrets-store provider %q", name)
+	known := knownProviders[name]
+	files := append([]string{providerDaemonSetAssetName}, known.staticFiles...)
+	var errs []error
+	for _, result := range resourceapply.DeleteAll(ctx, c.clients, syncContext.Recorder(), c.providerAssetFunc(name, ""), files...) {
+		if result.Error != nil {
+			errs = append(errs, fmt.Errorf("failed to delete %q for provider %q: %w", result.File, name, result.Error))
+		}
+	}
+	return errs
+}
+
+// isProviderDeployed reports whether the DaemonSet or the ServiceAccount of
+// the provider called name exists in the operator namespace.
+func (c *providerController) isProviderDeployed(name string) (bool, error) {
+	objectName := providerObjectName(name)
+	_, err := c.daemonSetLister.DaemonSets(c.operatorNamespace).Get(objectName)
+	if err == nil {
+		return true, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to get DaemonSet %s/%s: %w", c.operatorNamespace, objectName, err)
+	}
+	_, err = c.saLister.ServiceAccounts(c.operatorNamespace).Get(objectName)
+	if err == nil {
+		return true, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to get ServiceAccount %s/%s: %w", c.operatorNamespace, objectName, err)
+	}
+	return false, nil
+}
+
+// providerAssetFunc returns an AssetFunc reading providers/<name>/<file> with
+// the operator namespace and image substituted.
+func (c *providerController) providerAssetFunc(name, image string) resourceapply.AssetFunc {
+	base := replaceNamespaceFunc(c.operatorNamespace)
+	return func(file string) ([]byte, error) {
+		manifest, err := base(providerAssetDir(name) + file)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.ReplaceAll(manifest, []byte(providerImageKey), []byte(image)), nil
+	}
+}
+
+// getEnabledProviders indexes config.Providers by name, rejecting names that
+// are not in knownProviders and providers listed more than once.
+func getEnabledProviders(config operatorConfig) (map[string]providerConfig, error) {
+	enabled := make(map[string]providerConfig, len(config.Providers))
+	for _, provider := range config.Providers {
+		if _, ok := knownProviders[provider.Name]; !ok {
+			return nil, fmt.Errorf("unknown provider %q, must be one of %v", provider.Name, slices.Sorted(maps.Keys(knownProviders)))
+		}
+		if _, ok := enabled[provider.Name]; ok {
+			return nil, fmt.Errorf("provider %q is listed more than once", provider.Name)
+		}
+		enabled[provider.Name] = provider
+	}
+	return enabled, nil
+}
+
+// providerAssetDir is the assets directory holding the manifests of the
+// provider called name.
+func providerAssetDir(name string) string {
+	return "providers/" + name + "/"
+}
+
+// providerObjectName is the name of the DaemonSet and ServiceAccount of the
+// provider called name.
+func providerObjectName(name string) string {
+	return "secrets-store-csi-driver-provider-" + name
+}
@@ -0,0 +1,237 @@
+package operator
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
+)
+
+// newTestProviderController returns a providerController backed by a fake
+// kube client and listers seeded with objects.
+func newTestProviderController(t *testing.T, state opv1.ManagementState, configMap *corev1.ConfigMap, objects ...runtime.Object) (*providerController, *fake.Clientset) {
+	t.Helper()
+	daemonSetIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	saIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	nodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, obj := range objects {
+		indexer := daemonSetIndexer
+		switch obj.(type) {
+		case *corev1.ServiceAccount:
+			indexer = saIndexer
+		case *corev1.Node:
+			indexer = nodeIndexer
+		}
+		if err := indexer.Add(obj); err != nil {
+			t.Fatalf("failed to add object to indexer: %v", err)
+		}
+	}
+	configMapLister := newTestConfigMapLister(t)
+	if configMap != nil {
+		configMapLister = newTestConfigMapLister(t, configMap)
+	}
+
+	kubeClient := fake.NewClientset(objects...)
+	operatorClient := v1helpers.NewFakeOperatorClientWithObjectMeta(
+		&metav1.ObjectMeta{Name: providerName},
+		&opv1.OperatorSpec{ManagementState: state},
+		&opv1.OperatorStatus{},
+		nil,
+	)
+	return &providerController{
+		name:              "SecretsStoreProviderController",
+		operatorNamespace: testOperatorNamespace,
+		operatorClient:    operatorClient,
+		kubeClient:        kubeClient,
+		clients:           resourceapply.NewClientHolder().WithKubernetes(kubeClient),
+		resourceCache:     resourceapply.NewResourceCache(),
+		configMapLister:   configMapLister,
+		daemonSetLister:   appsv1listers.NewDaemonSetLister(daemonSetIndexer),
+		saLister:          corev1listers.NewServiceAccountLister(saIndexer),
+		nodeLister:        corev1listers.NewNodeLister(nodeIndexer),
+	}, kubeClient
+}
+
+func newTestProviderDaemonSet(name string) *appsv1.DaemonSet {
+	return &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: providerObjectName(name), Namespace: testOperatorNamespace}}
+}
+
+func newTestProviderServiceAccount(name string) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: providerObjectName(name), Namespace: testOperatorNamespace}}
+}
+
+func TestProviderControllerSync(t *testing.T) {
+	cases := []struct {
+		name      string
+		state     opv1.ManagementState
+		configMap *corev1.ConfigMap
+		objects   []runtime.Object
+
+		wantErrContains string
+		// wantDeployed maps provider name to the expected DaemonSet image;
+		// an empty image means the provider must not be deployed.
+		wantDeployed     map[string]string
+		wantNodeSelector map[string]string
+	}{
+		{
+			name:         "no operator config deploys no providers",
+			state:        opv1.Managed,
+			wantDeployed: map[string]string{"aws": "", "azure": "", "gcp": "", "vault": ""},
+		},
+		{
+			name:         "enabled provider is deployed with its image",
+			state:        opv1.Managed,
+			configMap:    newOperatorConfigMap("providers:\n- name: aws\n  image: quay.io/example/aws-provider:config\n"),
+			wantDeployed: map[string]string{"aws": "quay.io/example/aws-provider:config", "vault": ""},
+		},
+		{
+			name:      "provider no longer listed is removed",
+			state:     opv1.Managed,
+			configMap: newOperatorConfigMap("providers: []\n"),
+			objects: []runtime.Object{
+				newTestProviderDaemonSet("gcp"),
+				newTestProviderServiceAccount("gcp"),
+			},
+			wantDeployed: map[string]string{"gcp": ""},
+		},
+		{
+			name:      "Removed deletes enabled providers",
+			state:     opv1.Removed,
+			configMap: newOperatorConfigMap("providers:\n- name: azure\n"),
+			objects: []runtime.Object{
+				newTestProviderDaemonSet("azure"),
+				newTestProviderServiceAccount("azure"),
+			},
+			wantDeployed: map[string]string{"azure": ""},
+		},
+		{
+			name:      "Unmanaged leaves deployed providers alone",
+			state:     opv1.Unmanaged,
+			configMap: newOperatorConfigMap("providers: []\n"),
+			objects: []runtime.Object{
+				newTestProviderDaemonSet("aws"),
+			},
+			wantDeployed: map[string]string{"aws": ""},
+		},
+		{
+			name:      "provider follows the node placement of the driver",
+			state:     opv1.Managed,
+			configMap: newOperatorConfigMap("providers:\n- name: aws\n  image: quay.io/example/aws-provider:config\nnodePlacement:\n  nodeSelector:\n    node-role.kubernetes.io/worker: \"\"\n"),
+			objects: []runtime.Object{
+				&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker", Labels: map[string]string{"kubernetes.io/os": "linux", "node-role.kubernetes.io/worker": ""}}},
+			},
+			wantDeployed:     map[string]string{"aws": "quay.io/example/aws-provider:config"},
+			wantNodeSelector: map[string]string{"kubernetes.io/os": "linux", "node-role.kubernetes.io/worker": ""},
+		},
+		{
+			name:      "node placement matching no node is an error",
+			state:     opv1.Managed,
+			configMap: newOperatorConfigMap("providers:\n- name: aws\n  image: quay.io/example/aws-provider:config\nnodePlacement:\n  nodeSelector:\n    node-role.kubernetes.io/infra: \"\"\n"),
+			objects: []runtime.Object{
+				&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker", Labels: map[string]string{"kubernetes.io/os": "linux", "node-role.kubernetes.io/worker": ""}}},
+			},
+			wantErrContains: "failed to apply the node placement for provider \"aws\"",
+			wantDeployed:    map[string]string{"aws": ""},
+		},
+		{
+			name:            "enabled provider without an image is an error",
+			state:           opv1.Managed,
+			configMap:       newOperatorConfigMap("providers:\n- name: gcp\n"),
+			wantErrContains: "no image configured for provider \"gcp\"",
+			wantDeployed:    map[string]string{"gcp": ""},
+		},
+		{
+			name:            "unknown provider is an error",
+			state:           opv1.Managed,
+			configMap:       newOperatorConfigMap("providers:\n- name: conjur\n"),
+			wantErrContains: "unknown provider \"conjur\"",
+		},
+		{
+			name:            "duplicate provider is an error",
+			state:           opv1.Managed,
+			configMap:       newOperatorConfigMap("providers:\n- name: aws\n- name: aws\n"),
+			wantErrContains: "listed more than once",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, kubeClient := newTestProviderController(t, tc.state, tc.configMap, tc.objects...)
+			syncContext := factory.NewSyncContext(c.name, events.NewInMemoryRecorder(c.name, clock.RealClock{}))
+
+			err := c.sync(context.Background(), syncContext)
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErrContains, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for name, wantImage := range tc.wantDeployed {
+				objectName := providerObjectName(name)
+				daemonSet, err := kubeClient.AppsV1().DaemonSets(testOperatorNamespace).Get(context.Background(), objectName, metav1.GetOptions{})
+				if wantImage == "" {
+					// Unmanaged must not touch what is already there.
+					if tc.state == opv1.Unmanaged {
+						if err != nil {
+							t.Fatalf("expected DaemonSet %s to be left alone, got %v", objectName, err)
+						}
+						continue
+					}
+					if !apierrors.IsNotFound(err) {
+						t.Fatalf("expected DaemonSet %s to be absent, got %v", objectName, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("expected DaemonSet %s to be deployed, got %v", objectName, err)
+				}
+				if got := daemonSet.Spec.Template.Spec.Containers[0].Image; got != wantImage {
+					t.Fatalf("expected DaemonSet %s image to be %q, got %q", objectName, wantImage, got)
+				}
+				if tc.wantNodeSelector != nil && !reflect.DeepEqual(daemonSet.Spec.Template.Spec.NodeSelector, tc.wantNodeSelector) {
+					t.Fatalf("expected DaemonSet %s node selector to be %v, got %v", objectName, tc.wantNodeSelector, daemonSet.Spec.Template.Spec.NodeSelector)
+				}
+				if got := daemonSet.Spec.Template.Spec.ServiceAccountName; got != objectName {
+					t.Fatalf("expected DaemonSet %s service account to be %q, got %q", objectName, objectName, got)
+				}
+				if _, err := kubeClient.CoreV1().ServiceAccounts(testOperatorNamespace).Get(context.Background(), objectName, metav1.GetOptions{}); err != nil {
+					t.Fatalf("expected ServiceAccount %s to be deployed, got %v", objectName, err)
+				}
+			}
+		})
+	}
+}
+
+func TestProviderAssetsExist(t *testing.T) {
+	c, _ := newTestProviderController(t, opv1.Managed, nil)
+	for name, provider := range knownProviders {
+		assetFunc := c.providerAssetFunc(name, "quay.io/example/provider:latest")
+		for _, file := range append([]string{providerDaemonSetAssetName}, provider.staticFiles...) {
+			manifest, err := assetFunc(file)
+			if err != nil {
+				t.Fatalf("failed to read %s for provider %q: %v", file, name, err)
+			}
+			if strings.Contains(string(manifest), namespaceKey) || strings.Contains(string(manifest), providerImageKey) {
+				t.Fatalf("expected all placeholders in %s for provider %q to be replaced", file, name)
+			}
+		}
+	}
+}
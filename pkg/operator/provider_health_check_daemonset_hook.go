@@ -0,0 +1,83 @@
+package operator
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/csi/csidrivernodeservicecontroller"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// providerHealthCheckArgPrefix is the csi-driver container's flag prefix that toggles provider health checks on/off.
+	providerHealthCheckArgPrefix = "--provider-health-check="
+	// providerHealthCheckIntervalArgPrefix is the csi-driver container's flag prefix for the provider health check interval.
+	providerHealthCheckIntervalArgPrefix = "--provider-health-check-interval="
+)
+
+// defaultProviderHealthCheckEnabled and defaultProviderHealthCheckInterval
+// match the values hardcoded in assets/node.yaml before the health checks
+// became configurable, and are returned whenever the administrator has
+// expressed no opinion, so existing clusters see no change on upgrade.
+const (
+	defaultProviderHealthCheckEnabled  = false
+	defaultProviderHealthCheckInterval = 2 * time.Minute
+)
+
+// withProviderHealthCheckDaemonSetHook returns a DaemonSetHookFunc that sets
+// the csi-driver container's providerHealthCheckArgPrefix and
+// providerHealthCheckIntervalArgPrefix args from the operator config.
+func withProviderHealthCheckDaemonSetHook(configMapLister corev1listers.ConfigMapLister, operatorNamespace string) csidrivernodeservicecontroller.DaemonSetHookFunc {
+	return func(_ *opv1.OperatorSpec, daemonSet *appsv1.DaemonSet) error {
+		config, err := getOperatorConfig(configMapLister, operatorNamespace)
+		if err != nil {
+			return err
+		}
+		enabled, interval, err := getProviderHealthCheckConfig(config.ProviderHealthCheck)
+		if err != nil {
+			return err
+		}
+		klog.V(4).Infof("resolved provider health check config for DaemonSet %s/%s: enabled=%t interval=%s", daemonSet.Namespace, daemonSet.Name, enabled, formatRotationInterval(interval))
+
+		container, err := findContainer(daemonSet, csiDriverContainerName)
+		if err != nil {
+			return err
+		}
+
+		container.Args = setArg(container.Args, providerHealthCheckArgPrefix, strconv.FormatBool(enabled))
+		// formatRotationInterval keeps the historical "2m" literal for the
+		// default interval, exactly as for --rotation-poll-interval.
+		container.Args = setArg(container.Args, providerHealthCheckIntervalArgPrefix, formatRotationInterval(interval))
+
+		return nil
+	}
+}
+
+// getProviderHealthCheckConfig computes the effective provider health check
+// enable flag and interval from the operator config.
+//
+//   - enabled unset: defaultProviderHealthCheckEnabled
+//   - interval unset (zero): defaultProviderHealthCheckInterval
+//   - interval negative: error
+//
+// The interval is passed to the driver even when the checks are disabled,
+// as the historical args did.
+func getProviderHealthCheckConfig(config providerHealthCheckConfig) (enabled bool, interval time.Duration, err error) {
+	enabled = defaultProviderHealthCheckEnabled
+	if config.Enabled != nil {
+		enabled = *config.Enabled
+	}
+
+	interval = config.Interval.Duration
+	switch {
+	case interval < 0:
+		return false, 0, fmt.Errorf("invalid providerHealthCheck.interval %s in ConfigMap %s: must not be negative", interval, operatorConfigMapName)
+	case interval == 0:
+		interval = defaultProviderHealthCheckInterval
+	}
+	return enabled, interval, nil
+}
@@ -0,0 +1,83 @@
+package operator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestWithProviderHealthCheckDaemonSetHook(t *testing.T) {
+	cases := []struct {
+		name            string
+		configMap       *corev1.ConfigMap
+		expectedArgs    []string
+		wantErrContains string
+	}{
+		{
+			name: "no operator config keeps the historical args",
+			expectedArgs: []string{
+				"--provider-health-check=false",
+				"--provider-health-check-interval=2m",
+			},
+		},
+		{
+			name:      "empty section keeps the historical args",
+			configMap: newOperatorConfigMap("providerHealthCheck: {}\n"),
+			expectedArgs: []string{
+				"--provider-health-check=false",
+				"--provider-health-check-interval=2m",
+			},
+		},
+		{
+			name:      "enabled with the default interval",
+			configMap: newOperatorConfigMap("providerHealthCheck:\n  enabled: true\n"),
+			expectedArgs: []string{
+				"--provider-health-check=true",
+				"--provider-health-check-interval=2m",
+			},
+		},
+		{
+			name:      "enabled with a custom interval",
+			configMap: newOperatorConfigMap("providerHealthCheck:\n  enabled: true\n  interval: 90s\n"),
+			expectedArgs: []string{
+				"--provider-health-check=true",
+				"--provider-health-check-interval=1m30s",
+			},
+		},
+		{
+			name:            "negative interval is an error",
+			configMap:       newOperatorConfigMap("providerHealthCheck:\n  interval: -1m\n"),
+			wantErrContains: "must not be negative",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			lister := newTestConfigMapLister(t)
+			if tc.configMap != nil {
+				lister = newTestConfigMapLister(t, tc.configMap)
+			}
+			hook := withProviderHealthCheckDaemonSetHook(lister, testOperatorNamespace)
+
+			daemonSet := newTestDaemonSet()
+			container := &daemonSet.Spec.Template.Spec.Containers[0]
+			container.Args = []string{"--provider-health-check=false", "--provider-health-check-interval=2m"}
+			err := hook(&opv1.OperatorSpec{}, daemonSet)
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErrContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error from hook: %v", err)
+			}
+			if !reflect.DeepEqual(container.Args, tc.expectedArgs) {
+				t.Fatalf("expected args to be %v, got %v", tc.expectedArgs, container.Args)
+			}
+		})
+	}
+}
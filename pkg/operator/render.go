@@ -0,0 +1,267 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	configv1 "github.com/openshift/api/config/v1"
+	opv1 "github.com/openshift/api/operator/v1"
+	operatorv1listers "github.com/openshift/client-go/operator/listers/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/csi/csidrivernodeservicecontroller"
+	"github.com/openshift/library-go/pkg/operator/loglevel"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceread"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	sscsitls "github.com/openshift/secrets-store-csi-driver-operator/pkg/tls"
+)
+
+const (
+	// driverDaemonSetAssetName is the node DaemonSet manifest.
+	driverDaemonSetAssetName = "node.yaml"
+	// driverDaemonSetName is the name of the DaemonSet of
+	// driverDaemonSetAssetName.
+	driverDaemonSetName = "secrets-store-csi-driver-node"
+	// DefaultOperatorNamespace is the namespace the operator is installed
+	// in by default.
+	DefaultOperatorNamespace = "openshift-cluster-csi-drivers"
+)
+
+// daemonSetImageEnvNames maps the image placeholders of node.yaml to the
+// operator environment variables the node service controller replaces them
+// with.
+var daemonSetImageEnvNames = map[string]string{
+	"${DRIVER_IMAGE}":                "DRIVER_IMAGE",
+	"${NODE_DRIVER_REGISTRAR_IMAGE}": "NODE_DRIVER_REGISTRAR_IMAGE",
+	"${LIVENESS_PROBE_IMAGE}":        "LIVENESS_PROBE_IMAGE",
+	"${KUBE_RBAC_PROXY_IMAGE}":       "KUBE_RBAC_PROXY_IMAGE",
+}
+
+// RenderOptions are the objects Render reads instead of the cluster's.
+type RenderOptions struct {
+	// OperatorNamespace is the namespace of the operator and the driver.
+	OperatorNamespace string
+	// ClusterCSIDriver is the secrets-store.csi.k8s.io ClusterCSIDriver.
+	ClusterCSIDriver *opv1.ClusterCSIDriver
+	// CSIDriver is the live CSIDriver, if any. Unmanaged tokenRequests are
+	// preserved from it.
+	CSIDriver *storagev1.CSIDriver
+	// APIServer is the cluster APIServer config, if any.
+	APIServer *configv1.APIServer
+	// OperatorConfig is the operatorConfigMapName ConfigMap, if any.
+	OperatorConfig *corev1.ConfigMap
+	// Authentication is the cluster Authentication config, if any.
+	Authentication *configv1.Authentication
+	// DaemonSet is the live driver DaemonSet, if any. Held back rotation
+	// intervals are taken from it.
+	DaemonSet *appsv1.DaemonSet
+	// SecretProviderClasses and SecretProviderClassPodStatuses are those of
+	// all namespaces. The rotation policies are resolved against the
+	// former, the rotation safety checks and resources count the latter.
+	SecretProviderClasses          []*unstructured.Unstructured
+	SecretProviderClassPodStatuses []*unstructured.Unstructured
+	// Nodes are the nodes the node placement is checked against.
+	Nodes []*corev1.Node
+	// APIServerUnknown and AuthenticationUnknown are set when APIServer and
+	// Authentication could not be read, as opposed to not existing. They
+	// are then rendered with their defaults, but diagnosed as unknown.
+	APIServerUnknown      bool
+	AuthenticationUnknown bool
+}
+
+// renderedObjects are the objects the operator would apply.
+type renderedObjects struct {
+	tlsProfile sscsitls.ResolvedProfile
+	// staticResources maps the staticResourceAssets to their manifests.
+	staticResources map[string][]byte
+	csiDriver       *storagev1.CSIDriver
+	daemonSet       *appsv1.DaemonSet
+}
+
+// Render returns, as a YAML stream, the driver's static resources and node
+// DaemonSet as the operator would apply them for opts. It runs the same
+// AssetFuncs and DaemonSetHookFuncs as RunOperator against in-memory
+// informers, so anything not in opts is taken as absent: without Nodes, for
+// instance, the node placement is not checked. Resources of optional
+// features managed by their own controllers (providers, secret sync,
+// namespace admission) are not rendered.
+func Render(ctx context.Context, opts RenderOptions) ([]byte, error) {
+	rendered, err := renderObjects(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "# TLS security profile: minTLSVersion=%s adherence=%q honored=%t\n",
+		rendered.tlsProfile.Spec.MinTLSVersion, rendered.tlsProfile.Adherence, rendered.tlsProfile.Honor)
+	if opts.APIServerUnknown {
+		fmt.Fprintf(out, "# APIServer %s is unknown, the default TLS security profile is assumed\n", sscsitls.APIServerName)
+	}
+	for _, file := range staticResourceAssets {
+		if err := writeRenderedManifest(out, file, rendered.staticResources[file]); err != nil {
+			return nil, err
+		}
+	}
+	manifest, err := sigsyaml.Marshal(rendered.daemonSet)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeRenderedManifest(out, driverDaemonSetAssetName, manifest); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// renderObjects renders the objects of Render.
+func renderObjects(ctx context.Context, opts RenderOptions) (*renderedObjects, error) {
+	if opts.ClusterCSIDriver == nil {
+		return nil, fmt.Errorf("a ClusterCSIDriver is required")
+	}
+	if opts.ClusterCSIDriver.Name != providerName {
+		return nil, fmt.Errorf("expected ClusterCSIDriver %q, got %q", providerName, opts.ClusterCSIDriver.Name)
+	}
+	if opts.CSIDriver != nil && opts.CSIDriver.Name != providerName {
+		return nil, fmt.Errorf("expected CSIDriver %q, got %q", providerName, opts.CSIDriver.Name)
+	}
+	resolvedTLS, err := sscsitls.ResolveFromAPIServer(opts.APIServer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve the TLS security profile: %w", err)
+	}
+
+	var objects []runtime.Object
+	if opts.CSIDriver != nil {
+		objects = append(objects, opts.CSIDriver)
+	}
+	if opts.OperatorConfig != nil {
+		configMap := opts.OperatorConfig.DeepCopy()
+		configMap.Namespace = opts.OperatorNamespace
+		objects = append(objects, configMap)
+	}
+	if opts.DaemonSet != nil {
+		objects = append(objects, opts.DaemonSet)
+	}
+	for _, node := range opts.Nodes {
+		objects = append(objects, node)
+	}
+	kubeInformersForNamespaces := v1helpers.NewKubeInformersForNamespaces(fake.NewClientset(objects...), opts.OperatorNamespace, "")
+	configMapInformer := kubeInformersForNamespaces.InformersFor(opts.OperatorNamespace).Core().V1().ConfigMaps()
+	csiDriverLister := kubeInformersForNamespaces.InformersFor("").Storage().V1().CSIDrivers().Lister()
+
+	clusterCSIDriverIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := clusterCSIDriverIndexer.Add(opts.ClusterCSIDriver); err != nil {
+		return nil, err
+	}
+	clusterCSIDriverLister := operatorv1listers.NewClusterCSIDriverLister(clusterCSIDriverIndexer)
+	var spcObjects []runtime.Object
+	for _, spc := range opts.SecretProviderClasses {
+		spcObjects = append(spcObjects, spc)
+	}
+	for _, podStatus := range opts.SecretProviderClassPodStatuses {
+		spcObjects = append(spcObjects, podStatus)
+	}
+	spcInformers := dynamicinformer.NewDynamicSharedInformerFactory(dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		secretProviderClassGVR:          "SecretProviderClassList",
+		secretProviderClassPodStatusGVR: "SecretProviderClassPodStatusList",
+	}, spcObjects...), 0)
+
+	hooks := newDaemonSetHooks(
+		opts.OperatorNamespace,
+		clusterCSIDriverLister,
+		configMapInformer,
+		spcInformers.ForResource(secretProviderClassGVR),
+		spcInformers.ForResource(secretProviderClassPodStatusGVR),
+		kubeInformersForNamespaces.InformersFor(opts.OperatorNamespace).Apps().V1().DaemonSets().Lister(),
+		kubeInformersForNamespaces.InformersFor("").Core().V1().Nodes(),
+		func() sscsitls.ResolvedProfile { return resolvedTLS },
+	)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	kubeInformersForNamespaces.Start(ctx.Done())
+	for namespace, synced := range kubeInformersForNamespaces.WaitForCacheSync(ctx.Done()) {
+		for informerType, ok := range synced {
+			if !ok {
+				return nil, fmt.Errorf("failed to sync the %v informer of namespace %q", informerType, namespace)
+			}
+		}
+	}
+	spcInformers.Start(ctx.Done())
+	for gvr, ok := range spcInformers.WaitForCacheSync(ctx.Done()) {
+		if !ok {
+			return nil, fmt.Errorf("failed to sync the %s informer", gvr.Resource)
+		}
+	}
+
+	rendered := &renderedObjects{
+		tlsProfile:      resolvedTLS,
+		staticResources: map[string][]byte{},
+	}
+	assetFunc := withSecretsStoreCSIDriverAsset(
+		replaceNamespaceFunc(opts.OperatorNamespace),
+		clusterCSIDriverLister,
+		csiDriverLister,
+		providerName,
+	)
+	for _, file := range staticResourceAssets {
+		manifest, err := assetFunc(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %q: %w", file, err)
+		}
+		rendered.staticResources[file] = manifest
+	}
+	rendered.csiDriver = resourceread.ReadCSIDriverV1OrDie(rendered.staticResources[csidriverAssetName])
+
+	rendered.daemonSet, err = renderDaemonSet(opts.OperatorNamespace, &opts.ClusterCSIDriver.Spec.OperatorSpec, hooks)
+	if err != nil {
+		return nil, err
+	}
+	return rendered, nil
+}
+
+// renderDaemonSet renders node.yaml the way the node service controller
+// does: placeholders replaced, then hooks applied in order.
+func renderDaemonSet(operatorNamespace string, spec *opv1.OperatorSpec, hooks []csidrivernodeservicecontroller.DaemonSetHookFunc) (*appsv1.DaemonSet, error) {
+	manifest, err := replaceNamespaceFunc(operatorNamespace)(driverDaemonSetAssetName)
+	if err != nil {
+		return nil, err
+	}
+	pairs := []string{"${LOG_LEVEL}", strconv.Itoa(loglevel.LogLevelToVerbosity(spec.LogLevel))}
+	for placeholder, envName := range daemonSetImageEnvNames {
+		if image := os.Getenv(envName); image != "" {
+			pairs = append(pairs, placeholder, image)
+		}
+	}
+	daemonSet := resourceread.ReadDaemonSetV1OrDie([]byte(strings.NewReplacer(pairs...).Replace(string(manifest))))
+	for i, hook := range hooks {
+		if err := hook(spec, daemonSet); err != nil {
+			return nil, fmt.Errorf("error running hook function (index=%d): %w", i, err)
+		}
+	}
+	return daemonSet, nil
+}
+
+// writeRenderedManifest appends manifest, YAML or JSON, to out as a YAML
+// document.
+func writeRenderedManifest(out *bytes.Buffer, file string, manifest []byte) error {
+	document, err := sigsyaml.JSONToYAML(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to convert %q to YAML: %w", file, err)
+	}
+	fmt.Fprintf(out, "---\n# Source: %s\n", file)
+	out.Write(document)
+	return nil
+}
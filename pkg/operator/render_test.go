@@ -0,0 +1,84 @@
+package operator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRender(t *testing.T) {
+	cases := []struct {
+		name            string
+		opts            RenderOptions
+		wantContains    []string
+		wantErrContains string
+	}{
+		{
+			name: "defaults",
+			opts: RenderOptions{
+				ClusterCSIDriver: &opv1.ClusterCSIDriver{ObjectMeta: metav1.ObjectMeta{Name: providerName}},
+			},
+			wantContains: []string{
+				"# Source: csidriver.yaml",
+				"requiresRepublish: true",
+				"# Source: network-policy/allow-ingress-to-metrics-operand.yaml",
+				"namespace: " + testOperatorNamespace,
+				"- --rotation-poll-interval=2m",
+			},
+		},
+		{
+			name: "hooks and operator config are applied",
+			opts: RenderOptions{
+				ClusterCSIDriver: newTestRotationDriver(300),
+				OperatorConfig:   newOperatorConfigMap("nodePlacement:\n  nodeSelector:\n    node-role.kubernetes.io/worker: \"\"\n"),
+			},
+			wantContains: []string{
+				"- --rotation-poll-interval=5m",
+				"node-role.kubernetes.io/worker: \"\"",
+			},
+		},
+		{
+			name: "unmanaged tokenRequests are taken from the CSIDriver",
+			opts: RenderOptions{
+				ClusterCSIDriver: &opv1.ClusterCSIDriver{ObjectMeta: metav1.ObjectMeta{Name: providerName}},
+				CSIDriver: &storagev1.CSIDriver{
+					ObjectMeta: metav1.ObjectMeta{Name: providerName},
+					Spec:       storagev1.CSIDriverSpec{TokenRequests: []storagev1.TokenRequest{{Audience: "vault"}}},
+				},
+			},
+			wantContains: []string{"- audience: vault"},
+		},
+		{
+			name: "wrong ClusterCSIDriver",
+			opts: RenderOptions{
+				ClusterCSIDriver: &opv1.ClusterCSIDriver{ObjectMeta: metav1.ObjectMeta{Name: "ebs.csi.aws.com"}},
+			},
+			wantErrContains: `expected ClusterCSIDriver "secrets-store.csi.k8s.io", got "ebs.csi.aws.com"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.OperatorNamespace = testOperatorNamespace
+			out, err := Render(context.Background(), tc.opts)
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErrContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, want := range tc.wantContains {
+				if !strings.Contains(string(out), want) {
+					t.Errorf("expected output to contain %q, got:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
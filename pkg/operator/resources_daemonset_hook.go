@@ -0,0 +1,167 @@
+package operator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/csi/csidrivernodeservicecontroller"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// resourceConfigurableContainers are the containers of assets/node.yaml
+// whose resources may be overridden in operatorConfig.Resources.
+var resourceConfigurableContainers = sets.New(
+	csiDriverContainerName,
+	"csi-node-driver-registrar",
+	"csi-liveness-probe",
+)
+
+// Auto-sizing adds autoSizeStepMemory and autoSizeStepCPU to the csi-driver
+// container's requests for every step of autoSizeMountsPerStep mounts on the
+// busiest node. The number of steps only grows in powers of two, so that the
+// requests, and with them the DaemonSet, change only when the number of
+// mounts doubles rather than on every new pod.
+const autoSizeMountsPerStep = 500
+
+var (
+	autoSizeStepMemory = resource.MustParse("50Mi")
+	autoSizeStepCPU    = resource.MustParse("10m")
+)
+
+// withResourcesDaemonSetHook returns a DaemonSetHookFunc that applies
+// operatorConfig.Resources to the node DaemonSet: priorityClassName replaces
+// the priority class of assets/node.yaml, per-container overrides replace its
+// requests and limits, then, with autoSize, the csi-driver container's
+// requests are raised according to the number of
+// SecretProviderClassPodStatus objects, i.e. mounts, on the busiest node.
+func withResourcesDaemonSetHook(configMapLister corev1listers.ConfigMapLister, spcPodStatusLister cache.GenericLister, operatorNamespace string) csidrivernodeservicecontroller.DaemonSetHookFunc {
+	return func(_ *opv1.OperatorSpec, daemonSet *appsv1.DaemonSet) error {
+		config, err := getOperatorConfig(configMapLister, operatorNamespace)
+		if err != nil {
+			return err
+		}
+		if err := validateResourcesConfig(config.Resources); err != nil {
+			return err
+		}
+		if config.Resources.PriorityClassName != "" {
+			daemonSet.Spec.Template.Spec.PriorityClassName = config.Resources.PriorityClassName
+		}
+
+		names := make([]string, 0, len(config.Resources.Containers))
+		for name := range config.Resources.Containers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			container, err := findContainer(daemonSet, name)
+			if err != nil {
+				return err
+			}
+			container.Resources = config.Resources.Containers[name]
+			klog.V(4).Infof("resolved resources of container %s in DaemonSet %s/%s: %v", name, daemonSet.Namespace, daemonSet.Name, container.Resources)
+		}
+
+		if !config.Resources.AutoSize {
+			return nil
+		}
+		mounts, err := getBusiestNodeMountCount(spcPodStatusLister)
+		if err != nil {
+			return err
+		}
+		container, err := findContainer(daemonSet, csiDriverContainerName)
+		if err != nil {
+			return err
+		}
+		autoSizeRequests(&container.Resources, mounts)
+		klog.V(4).Infof("auto-sized requests of container %s in DaemonSet %s/%s for %d mounts: %v", csiDriverContainerName, daemonSet.Namespace, daemonSet.Name, mounts, container.Resources.Requests)
+		return nil
+	}
+}
+
+// validateResourcesConfig rejects overrides for containers that cannot be
+// overridden, requests above their limits and priority class names that are
+// not valid object names, which the API server would reject with a less
+// helpful message. Whether the priority class exists is not checked: pods of
+// a missing one are rejected by the API server, which the DaemonSet status
+// reports.
+func validateResourcesConfig(config driverResourcesConfig) error {
+	if config.PriorityClassName != "" {
+		if problems := validation.IsDNS1123Subdomain(config.PriorityClassName); len(problems) > 0 {
+			return fmt.Errorf("invalid resources.priorityClassName in ConfigMap %s: %s", operatorConfigMapName, strings.Join(problems, "; "))
+		}
+	}
+	for name, requirements := range config.Containers {
+		if !resourceConfigurableContainers.Has(name) {
+			return fmt.Errorf("invalid resources.containers in ConfigMap %s: unknown container %q, expected one of %v", operatorConfigMapName, name, sets.List(resourceConfigurableContainers))
+		}
+		for resourceName, request := range requirements.Requests {
+			if limit, ok := requirements.Limits[resourceName]; ok && request.Cmp(limit) > 0 {
+				return fmt.Errorf("invalid resources.containers in ConfigMap %s: %s request %s of container %q exceeds its limit %s", operatorConfigMapName, resourceName, request.String(), name, limit.String())
+			}
+		}
+	}
+	return nil
+}
+
+// getBusiestNodeMountCount returns the largest number of
+// SecretProviderClassPodStatus objects on a single node. The driver runs one
+// pod per node, so that node is the one its requests must fit.
+func getBusiestNodeMountCount(spcPodStatusLister cache.GenericLister) (int, error) {
+	objs, err := spcPodStatusLister.List(labels.Everything())
+	if err != nil {
+		return 0, fmt.Errorf("failed to list SecretProviderClassPodStatuses: %w", err)
+	}
+	perNode := map[string]int{}
+	busiest := 0
+	for _, obj := range objs {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return 0, err
+		}
+		node := accessor.GetLabels()[secretProviderClassPodStatusNodeLabel]
+		perNode[node]++
+		busiest = max(busiest, perNode[node])
+	}
+	return busiest, nil
+}
+
+// autoSizeRequests raises the memory and CPU requests of requirements by
+// one autoSizeStepMemory and autoSizeStepCPU per step for mounts, capped at
+// the limits, if any.
+func autoSizeRequests(requirements *corev1.ResourceRequirements, mounts int) {
+	steps := int64(0)
+	for s := int64(1); int64(mounts) >= s*autoSizeMountsPerStep; s *= 2 {
+		steps = s
+	}
+	if steps == 0 {
+		return
+	}
+
+	if requirements.Requests == nil {
+		requirements.Requests = corev1.ResourceList{}
+	}
+	for resourceName, step := range map[corev1.ResourceName]resource.Quantity{
+		corev1.ResourceMemory: autoSizeStepMemory,
+		corev1.ResourceCPU:    autoSizeStepCPU,
+	} {
+		request := requirements.Requests[resourceName].DeepCopy()
+		increment := step.DeepCopy()
+		increment.Mul(steps)
+		request.Add(increment)
+		if limit, ok := requirements.Limits[resourceName]; ok && request.Cmp(limit) > 0 {
+			request = limit.DeepCopy()
+		}
+		requirements.Requests[resourceName] = request
+	}
+}
@@ -0,0 +1,172 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestResources(memory, cpu string) corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{Requests: corev1.ResourceList{
+		corev1.ResourceMemory: resource.MustParse(memory),
+		corev1.ResourceCPU:    resource.MustParse(cpu),
+	}}
+}
+
+func TestWithResourcesDaemonSetHook(t *testing.T) {
+	defaultResources := newTestResources("50Mi", "10m")
+
+	cases := []struct {
+		name string
+		// mountsPerNode is the number of SecretProviderClassPodStatuses to
+		// create on each node.
+		mountsPerNode         map[string]int
+		configMap             *corev1.ConfigMap
+		expected              map[string]corev1.ResourceRequirements
+		wantPriorityClassName string
+		wantErrContains       string
+	}{
+		{
+			name: "no operator config keeps the manifest resources",
+			expected: map[string]corev1.ResourceRequirements{
+				csiDriverContainerName:      defaultResources,
+				"csi-node-driver-registrar": defaultResources,
+			},
+		},
+		{
+			name: "container override replaces requests and limits",
+			configMap: newOperatorConfigMap(`resources:
+  containers:
+    csi-driver:
+      requests:
+        memory: 200Mi
+        cpu: 50m
+      limits:
+        memory: 1Gi
+`),
+			expected: map[string]corev1.ResourceRequirements{
+				csiDriverContainerName: {
+					Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("200Mi"), corev1.ResourceCPU: resource.MustParse("50m")},
+					Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+				},
+				"csi-node-driver-registrar": defaultResources,
+			},
+		},
+		{
+			name:          "autoSize below one step keeps the requests",
+			configMap:     newOperatorConfigMap("resources:\n  autoSize: true\n"),
+			mountsPerNode: map[string]int{"node-a": 499},
+			expected: map[string]corev1.ResourceRequirements{
+				csiDriverContainerName: defaultResources,
+			},
+		},
+		{
+			name:          "autoSize scales with the busiest node in powers of two",
+			configMap:     newOperatorConfigMap("resources:\n  autoSize: true\n"),
+			mountsPerNode: map[string]int{"node-a": 1500, "node-b": 600},
+			expected: map[string]corev1.ResourceRequirements{
+				// 1500 mounts are 2 steps: 50Mi + 2*50Mi, 10m + 2*10m.
+				csiDriverContainerName:      newTestResources("150Mi", "30m"),
+				"csi-node-driver-registrar": defaultResources,
+			},
+		},
+		{
+			name: "autoSize is capped at the limits",
+			configMap: newOperatorConfigMap(`resources:
+  autoSize: true
+  containers:
+    csi-driver:
+      requests:
+        memory: 50Mi
+        cpu: 10m
+      limits:
+        memory: 80Mi
+`),
+			mountsPerNode: map[string]int{"node-a": 500},
+			expected: map[string]corev1.ResourceRequirements{
+				csiDriverContainerName: {
+					Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("80Mi"), corev1.ResourceCPU: resource.MustParse("20m")},
+					Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("80Mi")},
+				},
+			},
+		},
+		{
+			name:                  "priorityClassName replaces the priority class",
+			configMap:             newOperatorConfigMap("resources:\n  priorityClassName: secrets-store-critical\n"),
+			expected:              map[string]corev1.ResourceRequirements{csiDriverContainerName: defaultResources},
+			wantPriorityClassName: "secrets-store-critical",
+		},
+		{
+			name:            "invalid priorityClassName is an error",
+			configMap:       newOperatorConfigMap("resources:\n  priorityClassName: Not_Valid\n"),
+			wantErrContains: "invalid resources.priorityClassName",
+		},
+		{
+			name:            "unknown container is an error",
+			configMap:       newOperatorConfigMap("resources:\n  containers:\n    csi-driver-kube-rbac-proxy: {}\n"),
+			wantErrContains: "unknown container \"csi-driver-kube-rbac-proxy\"",
+		},
+		{
+			name:            "request above limit is an error",
+			configMap:       newOperatorConfigMap("resources:\n  containers:\n    csi-liveness-probe:\n      requests:\n        cpu: 100m\n      limits:\n        cpu: 50m\n"),
+			wantErrContains: "exceeds its limit",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			configMapLister := newTestConfigMapLister(t)
+			if tc.configMap != nil {
+				configMapLister = newTestConfigMapLister(t, tc.configMap)
+			}
+			podStatusIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			for node, mounts := range tc.mountsPerNode {
+				for i := 0; i < mounts; i++ {
+					if err := podStatusIndexer.Add(newTestSecretProviderClassPodStatus("ns", fmt.Sprintf("pod-%s-%d", node, i), "spc", node, true)); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			hook := withResourcesDaemonSetHook(configMapLister, cache.NewGenericLister(podStatusIndexer, secretProviderClassPodStatusGVR.GroupResource()), testOperatorNamespace)
+
+			daemonSet := newTestDaemonSet()
+			daemonSet.Spec.Template.Spec.PriorityClassName = "system-node-critical"
+			daemonSet.Spec.Template.Spec.Containers[0].Resources = *defaultResources.DeepCopy()
+			for _, name := range []string{"csi-node-driver-registrar", "csi-liveness-probe"} {
+				daemonSet.Spec.Template.Spec.Containers = append(daemonSet.Spec.Template.Spec.Containers, corev1.Container{Name: name, Resources: *defaultResources.DeepCopy()})
+			}
+			err := hook(&opv1.OperatorSpec{}, daemonSet)
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErrContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error from hook: %v", err)
+			}
+			wantPriorityClassName := tc.wantPriorityClassName
+			if wantPriorityClassName == "" {
+				wantPriorityClassName = "system-node-critical"
+			}
+			if got := daemonSet.Spec.Template.Spec.PriorityClassName; got != wantPriorityClassName {
+				t.Fatalf("expected priorityClassName %q, got %q", wantPriorityClassName, got)
+			}
+			for name, expected := range tc.expected {
+				container, err := findContainer(daemonSet, name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !equality.Semantic.DeepEqual(container.Resources, expected) {
+					t.Fatalf("expected container %s resources %v, got %v", name, expected, container.Resources)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package operator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	operatorv1listers "github.com/openshift/client-go/operator/listers/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/csi/csidrivernodeservicecontroller"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// withRotationPolicyDaemonSetHook returns a DaemonSetHookFunc that resolves
+// operatorConfig.RotationPolicies against the SecretProviderClasses in the
+// cluster and sets the csi-driver container's rotationPollIntervalArgPrefix
+// arg accordingly. It must run after withSecretRotationDaemonSetHook, whose
+// interval it overrides.
+//
+// The driver polls all mounts at a single interval, so a policy is honored
+// by choosing that interval: the shortest one any SecretProviderClass in
+// the cluster asks for. A cluster whose classes all use a rate-limited
+// backend thus polls at that backend's slower cadence, while in a mixed
+// cluster the slower policies cannot be honored; rotationSafetyController
+// reports them in the SecretsStoreRotationPoliciesUnhonored condition. Without
+// policies, or with rotation disabled, the interval resolved from the
+// ClusterCSIDriver is kept.
+func withRotationPolicyDaemonSetHook(
+	clusterCSIDriverLister operatorv1listers.ClusterCSIDriverLister,
+	driverName string,
+	configMapLister corev1listers.ConfigMapLister,
+	spcLister cache.GenericLister,
+	operatorNamespace string,
+) csidrivernodeservicecontroller.DaemonSetHookFunc {
+	return func(_ *opv1.OperatorSpec, daemonSet *appsv1.DaemonSet) error {
+		config, err := getOperatorConfig(configMapLister, operatorNamespace)
+		if err != nil {
+			return err
+		}
+		if err := validateRotationPolicies(config.RotationPolicies); err != nil {
+			return err
+		}
+		if len(config.RotationPolicies) == 0 {
+			return nil
+		}
+
+		enabled, interval, unhonored, err := getEffectiveRotationConfig(clusterCSIDriverLister, driverName, config, spcLister)
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			return nil
+		}
+		if len(unhonored) > 0 {
+			klog.V(2).Infof("rotation policies polled every %s instead of their interval, because other SecretProviderClasses need a shorter one: %s", formatRotationInterval(interval), strings.Join(unhonored, ", "))
+		}
+		klog.V(4).Infof("resolved rotation policies for DaemonSet %s/%s: pollInterval=%s", daemonSet.Namespace, daemonSet.Name, formatRotationInterval(interval))
+
+		container, err := findContainer(daemonSet, csiDriverContainerName)
+		if err != nil {
+			return err
+		}
+		container.Args = setArg(container.Args, rotationPollIntervalArgPrefix, formatRotationInterval(interval))
+		return nil
+	}
+}
+
+// getEffectiveRotationConfig returns the rotation enable flag and poll
+// interval the driver gets from the ClusterCSIDriver and, when rotation is
+// enabled, the rotation policies of config, along with the policies that
+// cannot be honored. config.RotationPolicies must be valid.
+func getEffectiveRotationConfig(
+	clusterCSIDriverLister operatorv1listers.ClusterCSIDriverLister,
+	driverName string,
+	config operatorConfig,
+	spcLister cache.GenericLister,
+) (enabled bool, interval time.Duration, unhonored []string, err error) {
+	driverConfig, err := getClusterCSIDriverConfig(clusterCSIDriverLister, driverName)
+	if err != nil {
+		return false, 0, nil, err
+	}
+	enabled, interval = getSecretRotationConfig(driverConfig)
+	if !enabled || len(config.RotationPolicies) == 0 {
+		return enabled, interval, nil, nil
+	}
+
+	objs, err := spcLister.List(labels.Everything())
+	if err != nil {
+		return false, 0, nil, fmt.Errorf("failed to list SecretProviderClasses: %w", err)
+	}
+	var spcs []*secretProviderClass
+	for _, obj := range objs {
+		spc, err := toSecretProviderClass(obj)
+		if err != nil {
+			return false, 0, nil, err
+		}
+		spcs = append(spcs, spc)
+	}
+	interval, unhonored = resolveRotationInterval(config.RotationPolicies, interval, spcs)
+	return enabled, interval, unhonored, nil
+}
+
+// validateRotationPolicies checks that every policy selects its
+// SecretProviderClasses in exactly one way and has a positive interval.
+func validateRotationPolicies(policies []rotationPolicy) error {
+	for i, policy := range policies {
+		if (policy.Provider == "") == (policy.SecretProviderClassSelector == nil) {
+			return fmt.Errorf("invalid rotationPolicies[%d] in ConfigMap %s: exactly one of provider and secretProviderClassSelector must be set", i, operatorConfigMapName)
+		}
+		if policy.SecretProviderClassSelector != nil {
+			if _, err := metav1.LabelSelectorAsSelector(policy.SecretProviderClassSelector); err != nil {
+				return fmt.Errorf("invalid rotationPolicies[%d].secretProviderClassSelector in ConfigMap %s: %w", i, operatorConfigMapName, err)
+			}
+		}
+		if policy.Interval.Duration <= 0 {
+			return fmt.Errorf("invalid rotationPolicies[%d].interval in ConfigMap %s: must be positive", i, operatorConfigMapName)
+		}
+	}
+	return nil
+}
+
+// getRotationPolicyInterval returns the interval and index of the first of
+// policies matching spc, or defaultInterval and -1 if none does. policies
+// must be valid.
+func getRotationPolicyInterval(policies []rotationPolicy, defaultInterval time.Duration, spc *secretProviderClass) (time.Duration, int) {
+	for i, policy := range policies {
+		if policy.Provider != "" {
+			if policy.Provider == spc.Spec.Provider {
+				return policy.Interval.Duration, i
+			}
+			continue
+		}
+		selector, _ := metav1.LabelSelectorAsSelector(policy.SecretProviderClassSelector)
+		if selector.Matches(labels.Set(spc.Labels)) {
+			return policy.Interval.Duration, i
+		}
+	}
+	return defaultInterval, -1
+}
+
+// resolveRotationInterval returns the driver poll interval honoring the
+// policies of spcs as closely as possible, i.e. the shortest interval any of
+// them needs, and the policies that are in use but get polled faster than
+// they ask for. With no SecretProviderClass at all, defaultInterval is kept.
+func resolveRotationInterval(policies []rotationPolicy, defaultInterval time.Duration, spcs []*secretProviderClass) (time.Duration, []string) {
+	if len(spcs) == 0 {
+		return defaultInterval, nil
+	}
+
+	var interval time.Duration
+	used := map[int]time.Duration{}
+	for _, spc := range spcs {
+		spcInterval, index := getRotationPolicyInterval(policies, defaultInterval, spc)
+		if interval == 0 || spcInterval < interval {
+			interval = spcInterval
+		}
+		if index >= 0 {
+			used[index] = spcInterval
+		}
+	}
+
+	var unhonored []string
+	for index, policyInterval := range used {
+		if policyInterval > interval {
+			unhonored = append(unhonored, policies[index].String())
+		}
+	}
+	sort.Strings(unhonored)
+	return interval, unhonored
+}
+
+// String describes the policy for logs.
+func (p rotationPolicy) String() string {
+	if p.Provider != "" {
+		return fmt.Sprintf("provider %s (%s)", p.Provider, formatRotationInterval(p.Interval.Duration))
+	}
+	return fmt.Sprintf("secretProviderClassSelector %s (%s)", metav1.FormatLabelSelector(p.SecretProviderClassSelector), formatRotationInterval(p.Interval.Duration))
+}
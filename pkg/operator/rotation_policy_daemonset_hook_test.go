@@ -0,0 +1,151 @@
+package operator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestLabeledSecretProviderClass(name, provider string, spcLabels map[string]string) *unstructured.Unstructured {
+	spc := newTestSecretProviderClass("app", name, map[string]interface{}{"provider": provider})
+	spc.SetLabels(spcLabels)
+	return spc
+}
+
+func TestWithRotationPolicyDaemonSetHook(t *testing.T) {
+	rotationDisabled := &opv1.ClusterCSIDriver{
+		ObjectMeta: metav1.ObjectMeta{Name: providerName},
+		Spec: opv1.ClusterCSIDriverSpec{
+			DriverConfig: opv1.CSIDriverConfigSpec{
+				DriverType: opv1.SecretsStoreDriverType,
+				SecretsStore: opv1.SecretsStoreCSIDriverConfigSpec{
+					SecretRotation: opv1.SecretsStoreSecretRotation{Type: opv1.SecretRotationNone},
+				},
+			},
+		},
+	}
+	policies := newOperatorConfigMap(`rotationPolicies:
+- provider: aws
+  interval: 10m
+- secretProviderClassSelector:
+    matchLabels:
+      rotation: slow
+  interval: 30m
+`)
+
+	cases := []struct {
+		name            string
+		driver          *opv1.ClusterCSIDriver
+		configMap       *corev1.ConfigMap
+		spcs            []*unstructured.Unstructured
+		expectedArgs    []string
+		wantErrContains string
+	}{
+		{
+			name:         "no policies keep the global interval",
+			spcs:         []*unstructured.Unstructured{newTestLabeledSecretProviderClass("db", "aws", nil)},
+			expectedArgs: []string{"--enable-secret-rotation=true", "--rotation-poll-interval=2m"},
+		},
+		{
+			name:         "policies without SecretProviderClasses keep the global interval",
+			configMap:    policies,
+			expectedArgs: []string{"--enable-secret-rotation=true", "--rotation-poll-interval=2m"},
+		},
+		{
+			name:      "all classes under one policy use its interval",
+			configMap: policies,
+			spcs: []*unstructured.Unstructured{
+				newTestLabeledSecretProviderClass("db", "aws", nil),
+				newTestLabeledSecretProviderClass("cache", "aws", nil),
+			},
+			expectedArgs: []string{"--enable-secret-rotation=true", "--rotation-poll-interval=10m"},
+		},
+		{
+			name:      "label policy applies and the shortest interval wins",
+			configMap: policies,
+			spcs: []*unstructured.Unstructured{
+				newTestLabeledSecretProviderClass("db", "aws", nil),
+				newTestLabeledSecretProviderClass("reports", "azure", map[string]string{"rotation": "slow"}),
+			},
+			expectedArgs: []string{"--enable-secret-rotation=true", "--rotation-poll-interval=10m"},
+		},
+		{
+			name:      "first matching policy wins",
+			configMap: policies,
+			spcs: []*unstructured.Unstructured{
+				newTestLabeledSecretProviderClass("db", "aws", map[string]string{"rotation": "slow"}),
+			},
+			expectedArgs: []string{"--enable-secret-rotation=true", "--rotation-poll-interval=10m"},
+		},
+		{
+			name:      "class without policy keeps the global interval in the mix",
+			configMap: policies,
+			spcs: []*unstructured.Unstructured{
+				newTestLabeledSecretProviderClass("db", "aws", nil),
+				newTestLabeledSecretProviderClass("config", "vault", nil),
+			},
+			expectedArgs: []string{"--enable-secret-rotation=true", "--rotation-poll-interval=2m"},
+		},
+		{
+			name:         "rotation disabled ignores policies",
+			driver:       rotationDisabled,
+			configMap:    policies,
+			spcs:         []*unstructured.Unstructured{newTestLabeledSecretProviderClass("db", "aws", nil)},
+			expectedArgs: []string{"--enable-secret-rotation=true", "--rotation-poll-interval=2m"},
+		},
+		{
+			name:            "policy with provider and selector is an error",
+			configMap:       newOperatorConfigMap("rotationPolicies:\n- provider: aws\n  secretProviderClassSelector: {}\n  interval: 1m\n"),
+			wantErrContains: "exactly one of provider and secretProviderClassSelector",
+		},
+		{
+			name:            "policy without interval is an error",
+			configMap:       newOperatorConfigMap("rotationPolicies:\n- provider: aws\n"),
+			wantErrContains: "must be positive",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			configMapLister := newTestConfigMapLister(t)
+			if tc.configMap != nil {
+				configMapLister = newTestConfigMapLister(t, tc.configMap)
+			}
+			spcIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			for _, spc := range tc.spcs {
+				if err := spcIndexer.Add(spc); err != nil {
+					t.Fatal(err)
+				}
+			}
+			hook := withRotationPolicyDaemonSetHook(
+				newFakeClusterCSIDriverLister(t, tc.driver),
+				providerName,
+				configMapLister,
+				cache.NewGenericLister(spcIndexer, secretProviderClassGVR.GroupResource()),
+				testOperatorNamespace,
+			)
+
+			daemonSet := newTestDaemonSet()
+			err := hook(&opv1.OperatorSpec{}, daemonSet)
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErrContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error from hook: %v", err)
+			}
+			gotArgs := daemonSet.Spec.Template.Spec.Containers[0].Args
+			if !reflect.DeepEqual(gotArgs, tc.expectedArgs) {
+				t.Fatalf("expected args to be %v, got %v", tc.expectedArgs, gotArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	applyoperatorv1 "github.com/openshift/client-go/operator/applyconfigurations/operator/v1"
+	operatorv1listers "github.com/openshift/client-go/operator/listers/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// rotationSafetyDegradedCondition reports a rotation interval outside
+	// the configured bounds, which the driver is then not rolled out with.
+	rotationSafetyDegradedCondition = "SecretsStoreRotationSafetyDegraded"
+	// rotationPoliciesUnhonoredCondition reports the rotation policies in
+	// use that the driver polls faster than they ask for, because its
+	// single poll interval is the shortest one any SecretProviderClass
+	// needs. It is informational and does not degrade the operator.
+	rotationPoliciesUnhonoredCondition = "SecretsStoreRotationPoliciesUnhonored"
+
+	// defaultMinRotationInterval and defaultMaxRotationInterval are the
+	// bounds used when operatorConfig.RotationSafety does not set them. They
+	// are loose enough for the historical 2m default, and catch intervals of
+	// a few seconds. The call rate is only checked against a configured
+	// maximum: no default suits both small and large clusters.
+	defaultMinRotationInterval = 10 * time.Second
+	defaultMaxRotationInterval = 24 * time.Hour
+)
+
+// rotationSafetyBounds are the resolved operatorConfig.RotationSafety.
+type rotationSafetyBounds struct {
+	minInterval time.Duration
+	maxInterval time.Duration
+	// maxCallsPerSecond is 0 when the call rate is not checked.
+	maxCallsPerSecond int32
+}
+
+// getRotationSafetyBounds resolves config, filling in the defaults.
+func getRotationSafetyBounds(config rotationSafetyConfig) (rotationSafetyBounds, error) {
+	bounds := rotationSafetyBounds{
+		minInterval:       defaultMinRotationInterval,
+		maxInterval:       defaultMaxRotationInterval,
+		maxCallsPerSecond: config.MaxProviderCallsPerSecond,
+	}
+	if config.MinInterval.Duration < 0 || config.MaxInterval.Duration < 0 || config.MaxProviderCallsPerSecond < 0 {
+		return rotationSafetyBounds{}, fmt.Errorf("invalid rotationSafety in ConfigMap %s: values must not be negative", operatorConfigMapName)
+	}
+	if config.MinInterval.Duration > 0 {
+		bounds.minInterval = config.MinInterval.Duration
+	}
+	if config.MaxInterval.Duration > 0 {
+		bounds.maxInterval = config.MaxInterval.Duration
+	}
+	if bounds.minInterval > bounds.maxInterval {
+		return rotationSafetyBounds{}, fmt.Errorf("invalid rotationSafety in ConfigMap %s: minInterval %s is above maxInterval %s", operatorConfigMapName, bounds.minInterval, bounds.maxInterval)
+	}
+	return bounds, nil
+}
+
+// estimateProviderCallsPerSecond estimates the provider API calls the driver
+// makes when polling mounts every interval: at least one per mount and
+// poll, more for SecretProviderClasses with several objects.
+func estimateProviderCallsPerSecond(mounts int, interval time.Duration) float64 {
+	return float64(mounts) / interval.Seconds()
+}
+
+// checkRotationSafety returns why polling mounts every interval is unsafe
+// under bounds, or "" if it is safe.
+func checkRotationSafety(interval time.Duration, mounts int, bounds rotationSafetyBounds) string {
+	switch {
+	case interval < bounds.minInterval:
+		return fmt.Sprintf("rotation interval %s is below the minimum of %s", formatRotationInterval(interval), formatRotationInterval(bounds.minInterval))
+	case interval > bounds.maxInterval:
+		return fmt.Sprintf("rotation interval %s is above the maximum of %s", formatRotationInterval(interval), formatRotationInterval(bounds.maxInterval))
+	}
+	if rate := estimateProviderCallsPerSecond(mounts, interval); bounds.maxCallsPerSecond > 0 && rate > float64(bounds.maxCallsPerSecond) {
+		return fmt.Sprintf("rotation interval %s for %d mounted volumes means about %d provider calls per second, above the maximum of %d",
+			formatRotationInterval(interval), mounts, int64(math.Ceil(rate)), bounds.maxCallsPerSecond)
+	}
+	return ""
+}
+
+// countMountedVolumes returns the number of SecretProviderClassPodStatuses
+// of mounted volumes, i.e. the volumes the driver polls on rotation.
+func countMountedVolumes(spcPodStatusLister cache.GenericLister) (int, error) {
+	objs, err := spcPodStatusLister.List(labels.Everything())
+	if err != nil {
+		return 0, fmt.Errorf("failed to list SecretProviderClassPodStatuses: %w", err)
+	}
+	mounts := 0
+	for _, obj := range objs {
+		podStatus, err := toSecretProviderClassPodStatus(obj)
+		if err != nil {
+			return 0, err
+		}
+		if podStatus.Status.Mounted {
+			mounts++
+		}
+	}
+	return mounts, nil
+}
+
+// rotationSafetyController checks the rotation interval the driver gets,
+// from the ClusterCSIDriver and operatorConfig.RotationPolicies, against
+// operatorConfig.RotationSafety and reports the result in the
+// SecretsStoreRotationSafetyDegraded condition. The interval itself is held
+// back by withRotationSafetyDaemonSetHook, whose decision it reports from
+// the live driver DaemonSet. The rotation policies that the
+// interval does not honor are reported in the
+// SecretsStoreRotationPoliciesUnhonored condition.
+type rotationSafetyController struct {
+	name                   string
+	operatorNamespace      string
+	driverName             string
+	operatorClient         v1helpers.OperatorClientWithFinalizers
+	clusterCSIDriverLister operatorv1listers.ClusterCSIDriverLister
+	configMapLister        corev1listers.ConfigMapLister
+	spcLister              cache.GenericLister
+	spcPodStatusLister     cache.GenericLister
+	daemonSetLister        appsv1listers.DaemonSetLister
+}
+
+func newRotationSafetyController(
+	name string,
+	operatorNamespace string,
+	driverName string,
+	operatorClient v1helpers.OperatorClientWithFinalizers,
+	clusterCSIDriverLister operatorv1listers.ClusterCSIDriverLister,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	spcInformer informers.GenericInformer,
+	spcPodStatusInformer informers.GenericInformer,
+	recorder events.Recorder,
+) factory.Controller {
+	namespacedInformers := kubeInformersForNamespaces.InformersFor(operatorNamespace)
+	configMapInformer := namespacedInformers.Core().V1().ConfigMaps()
+	daemonSetInformer := namespacedInformers.Apps().V1().DaemonSets()
+	c := &rotationSafetyController{
+		name:                   name,
+		operatorNamespace:      operatorNamespace,
+		driverName:             driverName,
+		operatorClient:         operatorClient,
+		clusterCSIDriverLister: clusterCSIDriverLister,
+		configMapLister:        configMapInformer.Lister(),
+		spcLister:              spcInformer.Lister(),
+		spcPodStatusLister:     spcPodStatusInformer.Lister(),
+		daemonSetLister:        daemonSetInformer.Lister(),
+	}
+	return factory.New().WithInformers(
+		operatorClient.Informer(),
+		configMapInformer.Informer(),
+		daemonSetInformer.Informer(),
+		spcInformer.Informer(),
+		spcPodStatusInformer.Informer(),
+	).WithSync(
+		c.sync,
+	).ResyncEvery(
+		time.Minute,
+	).WithSyncDegradedOnError(
+		operatorClient,
+	).ToController(
+		name,
+		recorder.WithComponentSuffix("secrets-store-rotation-safety-controller"),
+	)
+}
+
+func (c *rotationSafetyController) sync(ctx context.Context, syncContext factory.SyncContext) error {
+	if getOperatorSyncState(c.operatorClient) != opv1.Managed {
+		return nil
+	}
+
+	config, err := getOperatorConfig(c.configMapLister, c.operatorNamespace)
+	if err != nil {
+		return err
+	}
+	bounds, err := getRotationSafetyBounds(config.RotationSafety)
+	if err != nil {
+		return err
+	}
+	if err := validateRotationPolicies(config.RotationPolicies); err != nil {
+		return err
+	}
+	enabled, interval, unhonored, err := getEffectiveRotationConfig(c.clusterCSIDriverLister, c.driverName, config, c.spcLister)
+	if err != nil {
+		return err
+	}
+
+	condition := applyoperatorv1.OperatorCondition().
+		WithType(rotationSafetyDegradedCondition).
+		WithStatus(opv1.ConditionFalse).
+		WithReason("AsExpected")
+	if !enabled {
+		condition = condition.WithMessage("secret rotation is disabled")
+	} else {
+		mounts, err := countMountedVolumes(c.spcPodStatusLister)
+		if err != nil {
+			return err
+		}
+		current, err := getLiveRotationInterval(c.daemonSetLister, c.operatorNamespace, driverDaemonSetName)
+		if err != nil {
+			return err
+		}
+		if safe, reason := getSafeRotationInterval(interval, current, mounts, bounds); reason != "" {
+			message := reason + "; the driver keeps its current rotation interval"
+			if safe == interval {
+				message = fmt.Sprintf("%s; it is rolled out anyway, as it lowers the provider call rate of the current %s", reason, formatRotationInterval(current))
+			}
+			condition = condition.
+				WithStatus(opv1.ConditionTrue).
+				WithReason("UnsafeRotationInterval").
+				WithMessage(message)
+		} else {
+			condition = condition.WithMessage(fmt.Sprintf("rotation interval %s for %d mounted volumes means about %d provider calls per second",
+				formatRotationInterval(interval), mounts, int64(math.Ceil(estimateProviderCallsPerSecond(mounts, interval)))))
+		}
+	}
+
+	policiesCondition := applyoperatorv1.OperatorCondition().
+		WithType(rotationPoliciesUnhonoredCondition).
+		WithStatus(opv1.ConditionFalse).
+		WithReason("AsExpected")
+	if len(unhonored) > 0 {
+		policiesCondition = policiesCondition.
+			WithStatus(opv1.ConditionTrue).
+			WithReason("ShorterIntervalNeeded").
+			WithMessage(fmt.Sprintf("rotation policies polled every %s instead of their interval, because other SecretProviderClasses need a shorter one: %s",
+				formatRotationInterval(interval), strings.Join(unhonored, ", ")))
+	}
+	return c.operatorClient.ApplyOperatorStatus(ctx, c.name, applyoperatorv1.OperatorStatus().WithConditions(condition, policiesCondition))
+}
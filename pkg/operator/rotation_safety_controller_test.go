@@ -0,0 +1,285 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
+)
+
+// newTestRotationDaemonSet returns the driver DaemonSet polling every
+// interval.
+func newTestRotationDaemonSet(interval string) *appsv1.DaemonSet {
+	daemonSet := newTestDaemonSet()
+	daemonSet.Spec.Template.Spec.Containers[0].Args = []string{"--enable-secret-rotation=true", "--rotation-poll-interval=" + interval}
+	return daemonSet
+}
+
+// newTestRotationDriver returns a ClusterCSIDriver with rotation enabled
+// every minimumRefreshAge seconds.
+func newTestRotationDriver(minimumRefreshAge int32) *opv1.ClusterCSIDriver {
+	return &opv1.ClusterCSIDriver{
+		ObjectMeta: metav1.ObjectMeta{Name: providerName},
+		Spec: opv1.ClusterCSIDriverSpec{
+			DriverConfig: opv1.CSIDriverConfigSpec{
+				DriverType: opv1.SecretsStoreDriverType,
+				SecretsStore: opv1.SecretsStoreCSIDriverConfigSpec{
+					SecretRotation: opv1.SecretsStoreSecretRotation{
+						Type:   opv1.SecretRotationCustom,
+						Custom: opv1.CustomSecretRotation{MinimumRefreshAge: minimumRefreshAge},
+					},
+				},
+			},
+		},
+	}
+}
+
+// newTestMountedVolumesLister returns a SecretProviderClassPodStatus lister
+// holding mounts mounted volumes.
+func newTestMountedVolumesLister(t *testing.T, mounts int) cache.GenericLister {
+	t.Helper()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for i := 0; i < mounts; i++ {
+		if err := indexer.Add(newTestSecretProviderClassPodStatus("app", fmt.Sprintf("pod-%d", i), "db", "node-a", true)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Not mounted, not polled.
+	if err := indexer.Add(newTestSecretProviderClassPodStatus("app", "pending", "db", "node-a", false)); err != nil {
+		t.Fatal(err)
+	}
+	return cache.NewGenericLister(indexer, secretProviderClassPodStatusGVR.GroupResource())
+}
+
+func TestGetRotationSafetyBounds(t *testing.T) {
+	cases := []struct {
+		name            string
+		config          rotationSafetyConfig
+		expected        rotationSafetyBounds
+		wantErrContains string
+	}{
+		{
+			name:     "zero value takes the defaults and does not check the call rate",
+			expected: rotationSafetyBounds{minInterval: defaultMinRotationInterval, maxInterval: defaultMaxRotationInterval, maxCallsPerSecond: 0},
+		},
+		{
+			name: "set values override the defaults",
+			config: rotationSafetyConfig{
+				MinInterval:               metav1.Duration{Duration: 5 * time.Minute},
+				MaxProviderCallsPerSecond: 20,
+			},
+			expected: rotationSafetyBounds{minInterval: 5 * time.Minute, maxInterval: defaultMaxRotationInterval, maxCallsPerSecond: 20},
+		},
+		{
+			name:            "negative value is an error",
+			config:          rotationSafetyConfig{MaxProviderCallsPerSecond: -1},
+			wantErrContains: "must not be negative",
+		},
+		{
+			name:            "minimum above maximum is an error",
+			config:          rotationSafetyConfig{MinInterval: metav1.Duration{Duration: 2 * time.Minute}, MaxInterval: metav1.Duration{Duration: time.Minute}},
+			wantErrContains: "is above maxInterval",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			bounds, err := getRotationSafetyBounds(tc.config)
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErrContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if bounds != tc.expected {
+				t.Fatalf("expected bounds %+v, got %+v", tc.expected, bounds)
+			}
+		})
+	}
+}
+
+func TestRotationSafetyControllerSync(t *testing.T) {
+	cases := []struct {
+		name               string
+		driver             *opv1.ClusterCSIDriver
+		configMap          *corev1.ConfigMap
+		spcs               []*unstructured.Unstructured
+		live               *appsv1.DaemonSet
+		mounts             int
+		wantStatus         opv1.ConditionStatus
+		wantMessageContain string
+		wantUnhonored      string
+		wantErrContains    string
+	}{
+		{
+			name:               "default interval is safe",
+			mounts:             120,
+			wantStatus:         opv1.ConditionFalse,
+			wantMessageContain: "rotation interval 2m for 120 mounted volumes means about 1 provider calls per second",
+		},
+		{
+			name:               "rotation disabled is safe",
+			driver:             rotationDisabledDriver(),
+			mounts:             120,
+			wantStatus:         opv1.ConditionFalse,
+			wantMessageContain: "secret rotation is disabled",
+		},
+		{
+			name:               "interval below the minimum",
+			driver:             newTestRotationDriver(1),
+			wantStatus:         opv1.ConditionTrue,
+			wantMessageContain: "rotation interval 1s is below the minimum of 10s",
+		},
+		{
+			name:               "interval above a configured maximum",
+			driver:             newTestRotationDriver(7200),
+			configMap:          newOperatorConfigMap("rotationSafety:\n  maxInterval: 1h\n"),
+			wantStatus:         opv1.ConditionTrue,
+			wantMessageContain: "rotation interval 120m is above the maximum of 60m",
+		},
+		{
+			name:               "call rate above the maximum",
+			driver:             newTestRotationDriver(30),
+			configMap:          newOperatorConfigMap("rotationSafety:\n  maxProviderCallsPerSecond: 5\n"),
+			mounts:             300,
+			wantStatus:         opv1.ConditionTrue,
+			wantMessageContain: "300 mounted volumes means about 10 provider calls per second, above the maximum of 5; the driver keeps its current rotation interval",
+		},
+		{
+			name:               "longer interval above the call rate is rolled out",
+			driver:             newTestRotationDriver(600),
+			configMap:          newOperatorConfigMap("rotationSafety:\n  maxProviderCallsPerSecond: 1\n"),
+			live:               newTestRotationDaemonSet("2m"),
+			mounts:             1200,
+			wantStatus:         opv1.ConditionTrue,
+			wantMessageContain: "above the maximum of 1; it is rolled out anyway, as it lowers the provider call rate of the current 2m",
+		},
+		{
+			name:               "call rate is not checked without a configured maximum",
+			driver:             newTestRotationDriver(30),
+			mounts:             30000,
+			wantStatus:         opv1.ConditionFalse,
+			wantMessageContain: "rotation interval 30s for 30000 mounted volumes means about 1000 provider calls per second",
+		},
+		{
+			name: "policies needing a longer interval are reported",
+			configMap: newOperatorConfigMap(`rotationPolicies:
+- provider: aws
+  interval: 10m
+- provider: vault
+  interval: 30m
+`),
+			spcs: []*unstructured.Unstructured{
+				newTestLabeledSecretProviderClass("db", "aws", nil),
+				newTestLabeledSecretProviderClass("reports", "vault", nil),
+			},
+			wantStatus:         opv1.ConditionFalse,
+			wantMessageContain: "rotation interval 10m",
+			wantUnhonored:      "polled every 10m instead of their interval, because other SecretProviderClasses need a shorter one: provider vault (30m)",
+		},
+		{
+			name:            "invalid bounds are an error",
+			configMap:       newOperatorConfigMap("rotationSafety:\n  minInterval: -1s\n"),
+			wantErrContains: "must not be negative",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			configMapLister := newTestConfigMapLister(t)
+			if tc.configMap != nil {
+				configMapLister = newTestConfigMapLister(t, tc.configMap)
+			}
+			spcIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			for _, spc := range tc.spcs {
+				if err := spcIndexer.Add(spc); err != nil {
+					t.Fatal(err)
+				}
+			}
+			daemonSetIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			if tc.live != nil {
+				if err := daemonSetIndexer.Add(tc.live); err != nil {
+					t.Fatal(err)
+				}
+			}
+			operatorClient := v1helpers.NewFakeOperatorClientWithObjectMeta(
+				&metav1.ObjectMeta{Name: providerName},
+				&opv1.OperatorSpec{ManagementState: opv1.Managed},
+				&opv1.OperatorStatus{},
+				nil,
+			)
+			c := &rotationSafetyController{
+				name:                   "SecretsStoreRotationSafetyController",
+				operatorNamespace:      testOperatorNamespace,
+				driverName:             providerName,
+				operatorClient:         operatorClient,
+				clusterCSIDriverLister: newFakeClusterCSIDriverLister(t, tc.driver),
+				configMapLister:        configMapLister,
+				spcLister:              cache.NewGenericLister(spcIndexer, secretProviderClassGVR.GroupResource()),
+				spcPodStatusLister:     newTestMountedVolumesLister(t, tc.mounts),
+				daemonSetLister:        appsv1listers.NewDaemonSetLister(daemonSetIndexer),
+			}
+			syncContext := factory.NewSyncContext(c.name, events.NewInMemoryRecorder(c.name, clock.RealClock{}))
+
+			err := c.sync(context.Background(), syncContext)
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErrContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_, status, _, _ := operatorClient.GetOperatorState()
+			condition := v1helpers.FindOperatorCondition(status.Conditions, rotationSafetyDegradedCondition)
+			if condition == nil {
+				t.Fatalf("expected condition %s to be set", rotationSafetyDegradedCondition)
+			}
+			if condition.Status != tc.wantStatus {
+				t.Fatalf("expected condition status %s, got %s: %s", tc.wantStatus, condition.Status, condition.Message)
+			}
+			if !strings.Contains(condition.Message, tc.wantMessageContain) {
+				t.Fatalf("expected condition message to contain %q, got %q", tc.wantMessageContain, condition.Message)
+			}
+
+			policiesCondition := v1helpers.FindOperatorCondition(status.Conditions, rotationPoliciesUnhonoredCondition)
+			if policiesCondition == nil {
+				t.Fatalf("expected condition %s to be set", rotationPoliciesUnhonoredCondition)
+			}
+			wantPoliciesStatus := opv1.ConditionFalse
+			if tc.wantUnhonored != "" {
+				wantPoliciesStatus = opv1.ConditionTrue
+			}
+			if policiesCondition.Status != wantPoliciesStatus {
+				t.Fatalf("expected condition %s status %s, got %s: %s", rotationPoliciesUnhonoredCondition, wantPoliciesStatus, policiesCondition.Status, policiesCondition.Message)
+			}
+			if !strings.Contains(policiesCondition.Message, tc.wantUnhonored) {
+				t.Fatalf("expected condition %s message to contain %q, got %q", rotationPoliciesUnhonoredCondition, tc.wantUnhonored, policiesCondition.Message)
+			}
+		})
+	}
+}
+
+func rotationDisabledDriver() *opv1.ClusterCSIDriver {
+	driver := newTestRotationDriver(0)
+	driver.Spec.DriverConfig.SecretsStore.SecretRotation.Type = opv1.SecretRotationNone
+	return driver
+}
@@ -0,0 +1,125 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/csi/csidrivernodeservicecontroller"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// withRotationSafetyDaemonSetHook returns a DaemonSetHookFunc that checks
+// the csi-driver container's rotation interval, as set by the hooks before
+// it, against operatorConfig.RotationSafety. An unsafe interval is replaced
+// by the one of the live DaemonSet, or by defaultRotationInterval if there
+// is none yet, so that it is never rolled out to the nodes; only a longer
+// interval failing the call rate is rolled out, see getSafeRotationInterval.
+// The rotationSafetyController reports why. It must run after all hooks
+// setting rotationPollIntervalArgPrefix.
+func withRotationSafetyDaemonSetHook(
+	configMapLister corev1listers.ConfigMapLister,
+	spcPodStatusLister cache.GenericLister,
+	daemonSetLister appsv1listers.DaemonSetLister,
+	operatorNamespace string,
+) csidrivernodeservicecontroller.DaemonSetHookFunc {
+	return func(_ *opv1.OperatorSpec, daemonSet *appsv1.DaemonSet) error {
+		config, err := getOperatorConfig(configMapLister, operatorNamespace)
+		if err != nil {
+			return err
+		}
+		bounds, err := getRotationSafetyBounds(config.RotationSafety)
+		if err != nil {
+			return err
+		}
+
+		container, err := findContainer(daemonSet, csiDriverContainerName)
+		if err != nil {
+			return err
+		}
+		if enabled, _ := getArg(container.Args, enableRotationArgPrefix); enabled != "true" {
+			return nil
+		}
+		value, _ := getArg(container.Args, rotationPollIntervalArgPrefix)
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s%s in DaemonSet %s/%s: %w", rotationPollIntervalArgPrefix, value, daemonSet.Namespace, daemonSet.Name, err)
+		}
+
+		mounts, err := countMountedVolumes(spcPodStatusLister)
+		if err != nil {
+			return err
+		}
+		current, err := getLiveRotationInterval(daemonSetLister, daemonSet.Namespace, daemonSet.Name)
+		if err != nil {
+			return err
+		}
+		safe, reason := getSafeRotationInterval(interval, current, mounts, bounds)
+		if safe != interval {
+			klog.Warningf("Not rolling out DaemonSet %s/%s with an unsafe rotation interval, keeping %s: %s", daemonSet.Namespace, daemonSet.Name, formatRotationInterval(safe), reason)
+			container.Args = setArg(container.Args, rotationPollIntervalArgPrefix, formatRotationInterval(safe))
+		}
+		return nil
+	}
+}
+
+// getLiveRotationInterval returns the rotation interval the csi-driver
+// container of the live DaemonSet namespace/name polls with, or
+// defaultRotationInterval if there is none yet.
+func getLiveRotationInterval(daemonSetLister appsv1listers.DaemonSetLister, namespace, name string) (time.Duration, error) {
+	live, err := daemonSetLister.DaemonSets(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return defaultRotationInterval, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get DaemonSet %s/%s: %w", namespace, name, err)
+	}
+	container, err := findContainer(live, csiDriverContainerName)
+	if err != nil {
+		return defaultRotationInterval, nil
+	}
+	value, ok := getArg(container.Args, rotationPollIntervalArgPrefix)
+	if !ok {
+		return defaultRotationInterval, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s%s in DaemonSet %s/%s: %w", rotationPollIntervalArgPrefix, value, namespace, name, err)
+	}
+	return interval, nil
+}
+
+// getSafeRotationInterval returns the interval the driver is rolled out
+// with when interval is resolved and it polls every current, and why
+// interval is unsafe, or "" if it is safe. An unsafe interval is held back
+// for current, unless it only fails the call rate check while being longer
+// than current: it then lowers the call rate and is rolled out.
+func getSafeRotationInterval(interval, current time.Duration, mounts int, bounds rotationSafetyBounds) (time.Duration, string) {
+	reason := checkRotationSafety(interval, mounts, bounds)
+	if reason == "" {
+		return interval, ""
+	}
+	intervalBounds := bounds
+	intervalBounds.maxCallsPerSecond = 0
+	if interval > current && checkRotationSafety(interval, mounts, intervalBounds) == "" {
+		return interval, reason
+	}
+	return current, reason
+}
+
+// getArg returns the value of the element of args starting with prefix, and
+// whether there is one.
+func getArg(args []string, prefix string) (string, bool) {
+	for _, arg := range args {
+		if value, ok := strings.CutPrefix(arg, prefix); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,97 @@
+package operator
+
+import (
+	"reflect"
+	"testing"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestWithRotationSafetyDaemonSetHook(t *testing.T) {
+	liveDaemonSet := newTestRotationDaemonSet("5m")
+
+	cases := []struct {
+		name         string
+		configMap    *corev1.ConfigMap
+		live         *appsv1.DaemonSet
+		mounts       int
+		args         []string
+		expectedArgs []string
+	}{
+		{
+			name:         "safe interval is rolled out",
+			live:         liveDaemonSet,
+			args:         []string{"--enable-secret-rotation=true", "--rotation-poll-interval=1m"},
+			expectedArgs: []string{"--enable-secret-rotation=true", "--rotation-poll-interval=1m"},
+		},
+		{
+			name:         "unsafe interval keeps the live one",
+			live:         liveDaemonSet,
+			args:         []string{"--enable-secret-rotation=true", "--rotation-poll-interval=1s"},
+			expectedArgs: []string{"--enable-secret-rotation=true", "--rotation-poll-interval=5m"},
+		},
+		{
+			name:         "unsafe interval without a live DaemonSet falls back to the default",
+			args:         []string{"--enable-secret-rotation=true", "--rotation-poll-interval=1s"},
+			expectedArgs: []string{"--enable-secret-rotation=true", "--rotation-poll-interval=2m"},
+		},
+		{
+			name:         "call rate above the maximum keeps the live interval",
+			configMap:    newOperatorConfigMap("rotationSafety:\n  maxProviderCallsPerSecond: 1\n"),
+			live:         liveDaemonSet,
+			mounts:       120,
+			args:         []string{"--enable-secret-rotation=true", "--rotation-poll-interval=1m"},
+			expectedArgs: []string{"--enable-secret-rotation=true", "--rotation-poll-interval=5m"},
+		},
+		{
+			name:         "longer interval above the call rate is rolled out",
+			configMap:    newOperatorConfigMap("rotationSafety:\n  maxProviderCallsPerSecond: 1\n"),
+			live:         liveDaemonSet,
+			mounts:       1200,
+			args:         []string{"--enable-secret-rotation=true", "--rotation-poll-interval=10m"},
+			expectedArgs: []string{"--enable-secret-rotation=true", "--rotation-poll-interval=10m"},
+		},
+		{
+			name:         "call rate is not checked without a configured maximum",
+			live:         liveDaemonSet,
+			mounts:       30000,
+			args:         []string{"--enable-secret-rotation=true", "--rotation-poll-interval=30s"},
+			expectedArgs: []string{"--enable-secret-rotation=true", "--rotation-poll-interval=30s"},
+		},
+		{
+			name:         "disabled rotation is not checked",
+			args:         []string{"--enable-secret-rotation=false", "--rotation-poll-interval=1s"},
+			expectedArgs: []string{"--enable-secret-rotation=false", "--rotation-poll-interval=1s"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			configMapLister := newTestConfigMapLister(t)
+			if tc.configMap != nil {
+				configMapLister = newTestConfigMapLister(t, tc.configMap)
+			}
+			daemonSetIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			if tc.live != nil {
+				if err := daemonSetIndexer.Add(tc.live); err != nil {
+					t.Fatal(err)
+				}
+			}
+			hook := withRotationSafetyDaemonSetHook(configMapLister, newTestMountedVolumesLister(t, tc.mounts), appsv1listers.NewDaemonSetLister(daemonSetIndexer), testOperatorNamespace)
+
+			daemonSet := newTestDaemonSet()
+			daemonSet.Spec.Template.Spec.Containers[0].Args = tc.args
+			if err := hook(&opv1.OperatorSpec{}, daemonSet); err != nil {
+				t.Fatalf("unexpected error from hook: %v", err)
+			}
+			gotArgs := daemonSet.Spec.Template.Spec.Containers[0].Args
+			if !reflect.DeepEqual(gotArgs, tc.expectedArgs) {
+				t.Fatalf("expected args to be %v, got %v", tc.expectedArgs, gotArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/management"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	rbacv1informers "k8s.io/client-go/informers/rbac/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	rbacv1listers "k8s.io/client-go/listers/rbac/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// secretSyncRoleAssetName is the ClusterRole granting the node SA write
+	// access to Secrets.
+	secretSyncRoleAssetName = "rbac/secret_sync_role.yaml"
+	// secretSyncBindingAssetName binds secretSyncRoleAssetName cluster-wide.
+	secretSyncBindingAssetName = "rbac/secret_sync_binding.yaml"
+	// secretSyncNamespacedBindingAssetName binds secretSyncRoleAssetName in
+	// the namespace substituted for secretSyncNamespaceKey.
+	secretSyncNamespacedBindingAssetName = "rbac/secret_sync_namespaced_binding.yaml"
+	// secretSyncNamespaceKey is the namespace placeholder in
+	// secretSyncNamespacedBindingAssetName.
+	secretSyncNamespaceKey = "${SYNC_NAMESPACE}"
+	// secretSyncLabel marks the RoleBindings created from
+	// secretSyncNamespacedBindingAssetName, so that the ones of namespaces
+	// removed from the allowlist can be found again. The RoleBinding informer
+	// of the controller watches only the RoleBindings with this label.
+	secretSyncLabel = "secrets-store.csi.k8s.io/secret-sync"
+
+	secretSyncRoleName    = "secretproviderclasses-secret-sync-role"
+	secretSyncBindingName = "secretproviderclasses-secret-sync-rolebinding"
+)
+
+// secretSyncController grants the driver write access to Secrets, which it
+// needs to sync mounted objects into Kubernetes Secrets (the secretObjects
+// of a SecretProviderClass), only when operatorConfig.SecretSync enables it:
+//
+//   - disabled: the node SA can read Secrets, but not write them;
+//   - enabled without namespaces: the node SA can write Secrets in all
+//     namespaces, as it always could before the setting existed;
+//   - enabled with namespaces: the node SA can write Secrets in those
+//     namespaces only, through one RoleBinding per namespace.
+//
+// Like providerController, it holds a finalizer on the ClusterCSIDriver and
+// deletes everything it created when the ClusterCSIDriver is Removed.
+type secretSyncController struct {
+	name                     string
+	operatorNamespace        string
+	operatorClient           v1helpers.OperatorClientWithFinalizers
+	kubeClient               kubernetes.Interface
+	clients                  *resourceapply.ClientHolder
+	resourceCache            resourceapply.ResourceCache
+	configMapLister          corev1listers.ConfigMapLister
+	clusterRoleLister        rbacv1listers.ClusterRoleLister
+	clusterRoleBindingLister rbacv1listers.ClusterRoleBindingLister
+	roleBindingLister        rbacv1listers.RoleBindingLister
+}
+
+func newSecretSyncController(
+	name string,
+	operatorNamespace string,
+	operatorClient v1helpers.OperatorClientWithFinalizers,
+	kubeClient kubernetes.Interface,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	roleBindingInformer rbacv1informers.RoleBindingInformer,
+	recorder events.Recorder,
+) factory.Controller {
+	configMapInformer := kubeInformersForNamespaces.InformersFor(operatorNamespace).Core().V1().ConfigMaps()
+	clusterRoleInformer := kubeInformersForNamespaces.InformersFor("").Rbac().V1().ClusterRoles()
+	clusterRoleBindingInformer := kubeInformersForNamespaces.InformersFor("").Rbac().V1().ClusterRoleBindings()
+
+	c := &secretSyncController{
+		name:                     name,
+		operatorNamespace:        operatorNamespace,
+		operatorClient:           operatorClient,
+		kubeClient:               kubeClient,
+		clients:                  resourceapply.NewClientHolder().WithKubernetes(kubeClient),
+		resourceCache:            resourceapply.NewResourceCache(),
+		configMapLister:          configMapInformer.Lister(),
+		clusterRoleLister:        clusterRoleInformer.Lister(),
+		clusterRoleBindingLister: clusterRoleBindingInformer.Lister(),
+		roleBindingLister:        roleBindingInformer.Lister(),
+	}
+	return factory.New().WithInformers(
+		operatorClient.Informer(),
+		configMapInformer.Informer(),
+		clusterRoleInformer.Informer(),
+		clusterRoleBindingInformer.Informer(),
+		roleBindingInformer.Informer(),
+	).WithSync(
+		c.sync,
+	).ResyncEvery(
+		time.Minute,
+	).WithSyncDegradedOnError(
+		operatorClient,
+	).ToController(
+		name,
+		recorder.WithComponentSuffix("secrets-store-secret-sync-controller"),
+	)
+}
+
+func (c *secretSyncController) sync(ctx context.Context, syncContext factory.SyncContext) error {
+	switch getOperatorSyncState(c.operatorClient) {
+	case opv1.Managed:
+		return c.syncManaged(ctx, syncContext)
+	case opv1.Removed:
+		return c.syncRemoved(ctx, syncContext)
+	default:
+		return nil
+	}
+}
+
+func (c *secretSyncController) syncManaged(ctx context.Context, syncContext factory.SyncContext) error {
+	config, err := getOperatorConfig(c.configMapLister, c.operatorNamespace)
+	if err != nil {
+		return err
+	}
+	if err := validateSecretSyncConfig(config.SecretSync); err != nil {
+		return err
+	}
+	if management.IsOperatorRemovable() {
+		if err := v1helpers.EnsureFinalizer(ctx, c.operatorClient, c.name); err != nil {
+			return err
+		}
+	}
+
+	namespaces := sets.New(config.SecretSync.Namespaces...)
+	var errs []error
+	switch {
+	case !config.SecretSync.Enabled:
+		errs = append(errs, c.deleteClusterRBAC(ctx, syncContext, secretSyncBindingAssetName, secretSyncRoleAssetName)...)
+		errs = append(errs, c.deleteStaleNamespacedBindings(ctx, syncContext, nil)...)
+	case namespaces.Len() == 0:
+		errs = append(errs, c.apply(ctx, syncContext, c.assetFunc(""), secretSyncRoleAssetName, secretSyncBindingAssetName)...)
+		errs = append(errs, c.deleteStaleNamespacedBindings(ctx, syncContext, nil)...)
+	default:
+		errs = append(errs, c.apply(ctx, syncContext, c.assetFunc(""), secretSyncRoleAssetName)...)
+		errs = append(errs, c.deleteClusterRBAC(ctx, syncContext, secretSyncBindingAssetName)...)
+		for _, namespace := range sets.List(namespaces) {
+			errs = append(errs, c.apply(ctx, syncContext, c.assetFunc(namespace), secretSyncNamespacedBindingAssetName)...)
+		}
+		errs = append(errs, c.deleteStaleNamespacedBindings(ctx, syncContext, namespaces)...)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (c *secretSyncController) syncRemoved(ctx context.Context, syncContext factory.SyncContext) error {
+	var errs []error
+	errs = append(errs, c.deleteStaleNamespacedBindings(ctx, syncContext, nil)...)
+	errs = append(errs, c.deleteClusterRBAC(ctx, syncContext, secretSyncBindingAssetName, secretSyncRoleAssetName)...)
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	// All removed, remove the finalizer as the last step
+	return v1helpers.RemoveFinalizer(ctx, c.operatorClient, c.name)
+}
+
+// apply applies files rendered by assetFunc.
+func (c *secretSyncController) apply(ctx context.Context, syncContext factory.SyncContext, assetFunc resourceapply.AssetFunc, files ...string) []error {
+	var errs []error
+	for _, result := range resourceapply.ApplyDirectly(ctx, c.clients, syncContext.Recorder(), c.resourceCache, assetFunc, files...) {
+		if result.Error != nil {
+			errs = append(errs, fmt.Errorf("failed to apply %q: %w", result.File, result.Error))
+		}
+	}
+	return errs
+}
+
+// deleteClusterRBAC deletes the cluster-scoped files that are present in the
+// informer caches, so that a disabled feature does not cost a round of
+// DELETE calls on every sync.
+func (c *secretSyncController) deleteClusterRBAC(ctx context.Context, syncContext factory.SyncContext, files ...string) []error {
+	var present []string
+	for _, file := range files {
+		var err error
+		switch file {
+		case secretSyncRoleAssetName:
+			_, err = c.clusterRoleLister.Get(secretSyncRoleName)
+		case secretSyncBindingAssetName:
+			_, err = c.clusterRoleBindingLister.Get(secretSyncBindingName)
+		}
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return []error{fmt.Errorf("failed to get %q: %w", file, err)}
+		}
+		present = append(present, file)
+	}
+
+	var errs []error
+	for _, result := range resourceapply.DeleteAll(ctx, c.clients, syncContext.Recorder(), c.assetFunc(""), present...) {
+		if result.Error != nil {
+			errs = append(errs, fmt.Errorf("failed to delete %q: %w", result.File, result.Error))
+		}
+	}
+	return errs
+}
+
+// deleteStaleNamespacedBindings deletes the RoleBindings created from
+// secretSyncNamespacedBindingAssetName in all namespaces except keep. The
+// RoleBindings live in arbitrary namespaces, so they are found by
+// secretSyncLabel in the cache of the cluster-wide informer that watches
+// only the labeled ones.
+func (c *secretSyncController) deleteStaleNamespacedBindings(ctx context.Context, syncContext factory.SyncContext, keep sets.Set[string]) []error {
+	bindings, err := c.roleBindingLister.List(labels.SelectorFromSet(labels.Set{secretSyncLabel: "true"}))
+	if err != nil {
+		return []error{fmt.Errorf("failed to list RoleBindings labeled %s: %w", secretSyncLabel, err)}
+	}
+
+	var errs []error
+	for _, binding := range bindings {
+		if keep.Has(binding.Namespace) {
+			continue
+		}
+		klog.Infof("Removing Secret write access of the driver in namespace %s", binding.Namespace)
+		for _, result := range resourceapply.DeleteAll(ctx, c.clients, syncContext.Recorder(), c.assetFunc(binding.Namespace), secretSyncNamespacedBindingAssetName) {
+			if result.Error != nil {
+				errs = append(errs, fmt.Errorf("failed to delete %q in namespace %s: %w", result.File, binding.Namespace, result.Error))
+			}
+		}
+	}
+	return errs
+}
+
+// assetFunc returns an AssetFunc with the operator namespace and, for
+// secretSyncNamespacedBindingAssetName, syncNamespace substituted.
+func (c *secretSyncController) assetFunc(syncNamespace string) resourceapply.AssetFunc {
+	base := replaceNamespaceFunc(c.operatorNamespace)
+	return func(file string) ([]byte, error) {
+		manifest, err := base(file)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.ReplaceAll(manifest, []byte(secretSyncNamespaceKey), []byte(syncNamespace)), nil
+	}
+}
+
+// validateSecretSyncConfig rejects a namespace allowlist that would have no
+// effect, so that an administrator who forgot enabled: true is told so.
+func validateSecretSyncConfig(config secretSyncConfig) error {
+	if !config.Enabled && len(config.Namespaces) > 0 {
+		return fmt.Errorf("secretSync.namespaces is set in ConfigMap %s, but secretSync.enabled is not true", operatorConfigMapName)
+	}
+	if slices.Contains(config.Namespaces, "") {
+		return fmt.Errorf("secretSync.namespaces in ConfigMap %s must not contain an empty namespace", operatorConfigMapName)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package operator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+	rbacv1listers "k8s.io/client-go/listers/rbac/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
+)
+
+// newTestSecretSyncController returns a secretSyncController backed by a
+// fake kube client and listers seeded with objects.
+func newTestSecretSyncController(t *testing.T, state opv1.ManagementState, configMap *corev1.ConfigMap, objects ...runtime.Object) (*secretSyncController, *fake.Clientset) {
+	t.Helper()
+	clusterRoleIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	clusterRoleBindingIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	roleBindingIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, obj := range objects {
+		var err error
+		switch obj.(type) {
+		case *rbacv1.ClusterRole:
+			err = clusterRoleIndexer.Add(obj)
+		case *rbacv1.ClusterRoleBinding:
+			err = clusterRoleBindingIndexer.Add(obj)
+		case *rbacv1.RoleBinding:
+			err = roleBindingIndexer.Add(obj)
+		}
+		if err != nil {
+			t.Fatalf("failed to add object to indexer: %v", err)
+		}
+	}
+	configMapLister := newTestConfigMapLister(t)
+	if configMap != nil {
+		configMapLister = newTestConfigMapLister(t, configMap)
+	}
+
+	kubeClient := fake.NewClientset(objects...)
+	operatorClient := v1helpers.NewFakeOperatorClientWithObjectMeta(
+		&metav1.ObjectMeta{Name: providerName},
+		&opv1.OperatorSpec{ManagementState: state},
+		&opv1.OperatorStatus{},
+		nil,
+	)
+	return &secretSyncController{
+		name:                     "SecretsStoreSecretSyncController",
+		operatorNamespace:        testOperatorNamespace,
+		operatorClient:           operatorClient,
+		kubeClient:               kubeClient,
+		clients:                  resourceapply.NewClientHolder().WithKubernetes(kubeClient),
+		resourceCache:            resourceapply.NewResourceCache(),
+		configMapLister:          configMapLister,
+		clusterRoleLister:        rbacv1listers.NewClusterRoleLister(clusterRoleIndexer),
+		clusterRoleBindingLister: rbacv1listers.NewClusterRoleBindingLister(clusterRoleBindingIndexer),
+		roleBindingLister:        rbacv1listers.NewRoleBindingLister(roleBindingIndexer),
+	}, kubeClient
+}
+
+func newTestSecretSyncClusterRBAC() []runtime.Object {
+	return []runtime.Object{
+		&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: secretSyncRoleName}},
+		&rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: secretSyncBindingName}},
+	}
+}
+
+func newTestSecretSyncRoleBinding(namespace string) *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{
+		Name:      secretSyncBindingName,
+		Namespace: namespace,
+		Labels:    map[string]string{secretSyncLabel: "true"},
+	}}
+}
+
+func TestSecretSyncControllerSync(t *testing.T) {
+	cases := []struct {
+		name      string
+		state     opv1.ManagementState
+		configMap *corev1.ConfigMap
+		objects   []runtime.Object
+
+		wantErrContains       string
+		wantClusterRole       bool
+		wantClusterBinding    bool
+		wantBindingNamespaces []string
+	}{
+		{
+			name:  "no operator config grants no Secret write access",
+			state: opv1.Managed,
+		},
+		{
+			name:    "disabling removes previously granted access",
+			state:   opv1.Managed,
+			objects: append(newTestSecretSyncClusterRBAC(), newTestSecretSyncRoleBinding("team-a")),
+		},
+		{
+			name:               "enabled without namespaces grants access cluster-wide",
+			state:              opv1.Managed,
+			configMap:          newOperatorConfigMap("secretSync:\n  enabled: true\n"),
+			objects:            []runtime.Object{newTestSecretSyncRoleBinding("team-a")},
+			wantClusterRole:    true,
+			wantClusterBinding: true,
+		},
+		{
+			name:                  "enabled with namespaces grants access in those namespaces only",
+			state:                 opv1.Managed,
+			configMap:             newOperatorConfigMap("secretSync:\n  enabled: true\n  namespaces: [team-b, team-c]\n"),
+			objects:               append(newTestSecretSyncClusterRBAC(), newTestSecretSyncRoleBinding("team-a"), newTestSecretSyncRoleBinding("team-b")),
+			wantClusterRole:       true,
+			wantBindingNamespaces: []string{"team-b", "team-c"},
+		},
+		{
+			name:      "Removed deletes everything",
+			state:     opv1.Removed,
+			configMap: newOperatorConfigMap("secretSync:\n  enabled: true\n  namespaces: [team-a]\n"),
+			objects:   append(newTestSecretSyncClusterRBAC(), newTestSecretSyncRoleBinding("team-a")),
+		},
+		{
+			name:               "Unmanaged leaves granted access alone",
+			state:              opv1.Unmanaged,
+			objects:            newTestSecretSyncClusterRBAC(),
+			wantClusterRole:    true,
+			wantClusterBinding: true,
+		},
+		{
+			name:               "namespaces without enabled is an error",
+			state:              opv1.Managed,
+			configMap:          newOperatorConfigMap("secretSync:\n  namespaces: [team-a]\n"),
+			objects:            newTestSecretSyncClusterRBAC(),
+			wantErrContains:    "secretSync.enabled is not true",
+			wantClusterRole:    true,
+			wantClusterBinding: true,
+		},
+		{
+			name:            "empty namespace is an error",
+			state:           opv1.Managed,
+			configMap:       newOperatorConfigMap("secretSync:\n  enabled: true\n  namespaces: [\"\"]\n"),
+			wantErrContains: "must not contain an empty namespace",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, kubeClient := newTestSecretSyncController(t, tc.state, tc.configMap, tc.objects...)
+			syncContext := factory.NewSyncContext(c.name, events.NewInMemoryRecorder(c.name, clock.RealClock{}))
+
+			err := c.sync(context.Background(), syncContext)
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErrContains, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			clusterRole, err := kubeClient.RbacV1().ClusterRoles().Get(context.Background(), secretSyncRoleName, metav1.GetOptions{})
+			if tc.wantClusterRole != (err == nil) {
+				t.Fatalf("expected ClusterRole %s present=%v, got %v", secretSyncRoleName, tc.wantClusterRole, err)
+			}
+			if err != nil && !apierrors.IsNotFound(err) {
+				t.Fatalf("unexpected error getting ClusterRole: %v", err)
+			}
+			if clusterRole != nil && len(clusterRole.Rules) > 0 && !sets.New(clusterRole.Rules[0].Resources...).Has("secrets") {
+				t.Fatalf("expected ClusterRole %s to grant access to secrets, got %v", secretSyncRoleName, clusterRole.Rules)
+			}
+
+			_, err = kubeClient.RbacV1().ClusterRoleBindings().Get(context.Background(), secretSyncBindingName, metav1.GetOptions{})
+			if tc.wantClusterBinding != (err == nil) {
+				t.Fatalf("expected ClusterRoleBinding %s present=%v, got %v", secretSyncBindingName, tc.wantClusterBinding, err)
+			}
+
+			bindings, err := kubeClient.RbacV1().RoleBindings(metav1.NamespaceAll).List(context.Background(), metav1.ListOptions{})
+			if err != nil {
+				t.Fatalf("failed to list RoleBindings: %v", err)
+			}
+			gotNamespaces := sets.New[string]()
+			for _, binding := range bindings.Items {
+				gotNamespaces.Insert(binding.Namespace)
+				if binding.RoleRef.Kind != "" && binding.RoleRef.Name != secretSyncRoleName {
+					t.Fatalf("expected RoleBinding %s/%s to reference %s, got %s", binding.Namespace, binding.Name, secretSyncRoleName, binding.RoleRef.Name)
+				}
+			}
+			if !gotNamespaces.Equal(sets.New(tc.wantBindingNamespaces...)) {
+				t.Fatalf("expected RoleBindings in namespaces %v, got %v", tc.wantBindingNamespaces, sets.List(gotNamespaces))
+			}
+		})
+	}
+}
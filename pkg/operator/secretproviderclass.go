@@ -0,0 +1,166 @@
+package operator
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// secretProviderClassGVR is the resource of the SecretProviderClass CRD
+// shipped in config/manifests/stable.
+var secretProviderClassGVR = schema.GroupVersionResource{
+	Group:    "secrets-store.csi.x-k8s.io",
+	Version:  "v1",
+	Resource: "secretproviderclasses",
+}
+
+// secretProviderClass is the subset of a secrets-store.csi.x-k8s.io/v1
+// SecretProviderClass the operator reads. The CRD has no Go types vendored
+// here, so objects are converted from the dynamic informer's unstructured
+// cache with toSecretProviderClass.
+type secretProviderClass struct {
+	Namespace string
+	Name      string
+	Labels    map[string]string
+	Spec      secretProviderClassSpec
+}
+
+type secretProviderClassSpec struct {
+	Provider      string            `json:"provider,omitempty"`
+	Parameters    map[string]string `json:"parameters,omitempty"`
+	SecretObjects []secretObject    `json:"secretObjects,omitempty"`
+}
+
+type secretObject struct {
+	SecretName string             `json:"secretName,omitempty"`
+	Type       string             `json:"type,omitempty"`
+	Data       []secretObjectData `json:"data,omitempty"`
+}
+
+type secretObjectData struct {
+	ObjectName string `json:"objectName,omitempty"`
+	Key        string `json:"key,omitempty"`
+}
+
+// toSecretProviderClass converts an *unstructured.Unstructured
+// SecretProviderClass, as returned by the dynamic informer's cache, into a
+// secretProviderClass.
+func toSecretProviderClass(obj runtime.Object) (*secretProviderClass, error) {
+	unstr, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T for SecretProviderClass", obj)
+	}
+	spc := &secretProviderClass{Namespace: unstr.GetNamespace(), Name: unstr.GetName(), Labels: unstr.GetLabels()}
+	spec, _, err := unstructured.NestedMap(unstr.Object, "spec")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read spec of SecretProviderClass %s/%s: %w", spc.Namespace, spc.Name, err)
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(spec, &spc.Spec); err != nil {
+		return nil, fmt.Errorf("unable to convert SecretProviderClass %s/%s: %w", spc.Namespace, spc.Name, err)
+	}
+	return spc, nil
+}
+
+// providerObject is one entry of the "objects" parameter understood by the
+// AWS, Azure and Vault providers.
+type providerObject struct {
+	ObjectName  string `json:"objectName,omitempty"`
+	ObjectAlias string `json:"objectAlias,omitempty"`
+}
+
+// getMountedObjectNames returns the file name every entry of the "objects"
+// parameter is mounted as: objectAlias when set, objectName otherwise.
+//
+// Providers encode the parameter in one of two shapes, both accepted here:
+//
+//   - Azure (and the upstream e2e provider): a YAML map with an "array" of
+//     strings, each string itself a YAML document holding one object.
+//   - AWS and Vault: a YAML list of objects.
+//
+// A missing or empty "objects" parameter returns nil; providers such as GCP
+// use a different parameter and are not inspected.
+func getMountedObjectNames(parameters map[string]string) ([]string, error) {
+	content := parameters["objects"]
+	if content == "" {
+		return nil, nil
+	}
+
+	var objects []providerObject
+	wrapped := struct {
+		Array []string `json:"array"`
+	}{}
+	if err := sigsyaml.Unmarshal([]byte(content), &wrapped); err == nil && len(wrapped.Array) > 0 {
+		for i, entry := range wrapped.Array {
+			object := providerObject{}
+			if err := sigsyaml.Unmarshal([]byte(entry), &object); err != nil {
+				return nil, fmt.Errorf("failed to parse parameters.objects array[%d]: %w", i, err)
+			}
+			objects = append(objects, object)
+		}
+	} else if err := sigsyaml.Unmarshal([]byte(content), &objects); err != nil {
+		return nil, fmt.Errorf("failed to parse parameters.objects: %w", err)
+	}
+
+	names := make([]string, 0, len(objects))
+	for _, object := range objects {
+		name := object.ObjectAlias
+		if name == "" {
+			name = object.ObjectName
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// secretProviderClassPodStatusGVR is the resource of the
+// SecretProviderClassPodStatus CRD shipped in config/manifests/stable. The
+// driver creates one object per pod and SecretProviderClass it mounts.
+var secretProviderClassPodStatusGVR = schema.GroupVersionResource{
+	Group:    "secrets-store.csi.x-k8s.io",
+	Version:  "v1",
+	Resource: "secretproviderclasspodstatuses",
+}
+
+// secretProviderClassPodStatusNodeLabel is set by the driver on every
+// SecretProviderClassPodStatus to the node the pod runs on.
+const secretProviderClassPodStatusNodeLabel = "internal.secrets-store.csi.k8s.io/node-name"
+
+// secretProviderClassPodStatus is the subset of a secrets-store.csi.x-k8s.io/v1
+// SecretProviderClassPodStatus the operator reads.
+type secretProviderClassPodStatus struct {
+	Namespace string
+	Name      string
+	NodeName  string
+	Status    secretProviderClassPodStatusStatus
+}
+
+type secretProviderClassPodStatusStatus struct {
+	PodName                 string `json:"podName,omitempty"`
+	SecretProviderClassName string `json:"secretProviderClassName,omitempty"`
+	Mounted                 bool   `json:"mounted,omitempty"`
+}
+
+// toSecretProviderClassPodStatus converts an *unstructured.Unstructured
+// SecretProviderClassPodStatus into a secretProviderClassPodStatus.
+func toSecretProviderClassPodStatus(obj runtime.Object) (*secretProviderClassPodStatus, error) {
+	unstr, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T for SecretProviderClassPodStatus", obj)
+	}
+	podStatus := &secretProviderClassPodStatus{
+		Namespace: unstr.GetNamespace(),
+		Name:      unstr.GetName(),
+		NodeName:  unstr.GetLabels()[secretProviderClassPodStatusNodeLabel],
+	}
+	status, _, err := unstructured.NestedMap(unstr.Object, "status")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read status of SecretProviderClassPodStatus %s/%s: %w", podStatus.Namespace, podStatus.Name, err)
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(status, &podStatus.Status); err != nil {
+		return nil, fmt.Errorf("unable to convert SecretProviderClassPodStatus %s/%s: %w", podStatus.Namespace, podStatus.Name, err)
+	}
+	return podStatus, nil
+}
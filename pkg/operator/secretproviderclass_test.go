@@ -0,0 +1,126 @@
+package operator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// newTestSecretProviderClass returns an unstructured SecretProviderClass with
+// the given spec, as served by the dynamic informer.
+func newTestSecretProviderClass(namespace, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "secrets-store.csi.x-k8s.io/v1",
+		"kind":       "SecretProviderClass",
+		"metadata": map[string]interface{}{
+			"namespace": namespace,
+			"name":      name,
+		},
+		"spec": spec,
+	}}
+}
+
+func TestToSecretProviderClass(t *testing.T) {
+	obj := newTestSecretProviderClass("app", "db", map[string]interface{}{
+		"provider":   "vault",
+		"parameters": map[string]interface{}{"roleName": "db"},
+		"secretObjects": []interface{}{
+			map[string]interface{}{
+				"secretName": "db-credentials",
+				"type":       "Opaque",
+				"labels":     map[string]interface{}{"app": "db"},
+				"data": []interface{}{
+					map[string]interface{}{"objectName": "password", "key": "password"},
+				},
+			},
+		},
+	})
+
+	spc, err := toSecretProviderClass(obj)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &secretProviderClass{
+		Namespace: "app",
+		Name:      "db",
+		Spec: secretProviderClassSpec{
+			Provider:   "vault",
+			Parameters: map[string]string{"roleName": "db"},
+			SecretObjects: []secretObject{{
+				SecretName: "db-credentials",
+				Type:       "Opaque",
+				Data:       []secretObjectData{{ObjectName: "password", Key: "password"}},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(spc, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, spc)
+	}
+}
+
+func TestGetMountedObjectNames(t *testing.T) {
+	cases := []struct {
+		name            string
+		parameters      map[string]string
+		expected        []string
+		wantErrContains string
+	}{
+		{
+			name:       "no objects parameter",
+			parameters: map[string]string{"secrets": "- resourceName: projects/1/secrets/a/versions/latest\n"},
+		},
+		{
+			name: "array of YAML documents",
+			parameters: map[string]string{"objects": `
+array:
+  - |
+    objectName: secret1
+    objectType: secret
+  - |
+    objectName: secret2
+    objectAlias: alias2
+`},
+			expected: []string{"secret1", "alias2"},
+		},
+		{
+			name: "list of objects",
+			parameters: map[string]string{"objects": `
+- objectName: secret1
+  secretPath: secret/data/app
+- objectName: arn:aws:secretsmanager:us-east-1:123:secret:app
+  objectAlias: app
+`},
+			expected: []string{"secret1", "app"},
+		},
+		{
+			name:            "unparsable objects",
+			parameters:      map[string]string{"objects": "objectName: [secret1"},
+			wantErrContains: "failed to parse parameters.objects",
+		},
+		{
+			name:            "unparsable array entry",
+			parameters:      map[string]string{"objects": "array:\n  - \"objectName: [secret1\"\n"},
+			wantErrContains: "array[0]",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			names, err := getMountedObjectNames(tc.parameters)
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErrContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(names) != len(tc.expected) || (len(names) > 0 && !reflect.DeepEqual(names, tc.expected)) {
+				t.Fatalf("expected names %v, got %v", tc.expected, names)
+			}
+		})
+	}
+}
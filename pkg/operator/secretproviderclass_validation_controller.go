@@ -0,0 +1,297 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	applyoperatorv1 "github.com/openshift/client-go/operator/applyconfigurations/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// secretProviderClassesInvalidCondition summarizes the
+	// SecretProviderClasses found invalid by the validation controller. It
+	// does not end with Degraded: invalid user objects do not degrade the
+	// operator.
+	secretProviderClassesInvalidCondition = "SecretProviderClassesInvalid"
+	// invalidSecretProviderClassReason is the reason of both the condition
+	// and the per-object events.
+	invalidSecretProviderClassReason = "InvalidSecretProviderClass"
+	// maxReportedSecretProviderClasses caps how many invalid objects are
+	// spelled out in the condition message; the events carry the rest.
+	maxReportedSecretProviderClasses = 5
+)
+
+// secretProviderClassValidationController checks every SecretProviderClass
+// in the cluster for mistakes the CRD schema cannot catch and that would
+// otherwise only show up as a failed mount on some node:
+//
+//   - a provider that is not registered on any node,
+//   - malformed secretObjects (missing names, types, data or keys, or
+//     duplicates that make the synced Secret ambiguous),
+//   - objects of the "objects" parameter mounted under the same file name,
+//   - secretObjects the driver may not sync, because operatorConfig.SecretSync
+//     is not enabled or does not list the namespace.
+//
+// The result is summarized in the SecretProviderClassesInvalid condition of
+// the ClusterCSIDriver, which also says when the registration of providers
+// is not checked, and every invalid object gets a Warning event in its own
+// namespace whenever its list of problems changes.
+//
+// Unlike the rest of the operator (see ADR-0003), this controller watches a
+// resource in all namespaces: SecretProviderClasses are created next to the
+// workloads that use them. They are small and there are usually few of them.
+type secretProviderClassValidationController struct {
+	name              string
+	operatorNamespace string
+	operatorClient    v1helpers.OperatorClientWithFinalizers
+	spcLister         cache.GenericLister
+	configMapLister   corev1listers.ConfigMapLister
+	daemonSetLister   appsv1listers.DaemonSetLister
+	eventRecorder     record.EventRecorder
+
+	// reported maps namespace/name of every invalid SecretProviderClass to
+	// the problems last sent as an event, so that an unchanged object is not
+	// reported again on every resync. It is only accessed from sync, which
+	// the factory never runs concurrently.
+	reported map[string]string
+}
+
+func newSecretProviderClassValidationController(
+	name string,
+	operatorNamespace string,
+	operatorClient v1helpers.OperatorClientWithFinalizers,
+	spcInformer informers.GenericInformer,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	eventRecorder record.EventRecorder,
+	recorder events.Recorder,
+) factory.Controller {
+	namespacedInformers := kubeInformersForNamespaces.InformersFor(operatorNamespace)
+	configMapInformer := namespacedInformers.Core().V1().ConfigMaps()
+	daemonSetInformer := namespacedInformers.Apps().V1().DaemonSets()
+
+	c := &secretProviderClassValidationController{
+		name:              name,
+		operatorNamespace: operatorNamespace,
+		operatorClient:    operatorClient,
+		spcLister:         spcInformer.Lister(),
+		configMapLister:   configMapInformer.Lister(),
+		daemonSetLister:   daemonSetInformer.Lister(),
+		eventRecorder:     eventRecorder,
+		reported:          map[string]string{},
+	}
+	return factory.New().WithInformers(
+		operatorClient.Informer(),
+		spcInformer.Informer(),
+		configMapInformer.Informer(),
+		daemonSetInformer.Informer(),
+	).WithSync(
+		c.sync,
+	).ResyncEvery(
+		time.Minute,
+	).WithSyncDegradedOnError(
+		operatorClient,
+	).ToController(
+		name,
+		recorder.WithComponentSuffix("secret-provider-class-validation-controller"),
+	)
+}
+
+func (c *secretProviderClassValidationController) sync(ctx context.Context, syncContext factory.SyncContext) error {
+	if getOperatorSyncState(c.operatorClient) != opv1.Managed {
+		return nil
+	}
+
+	config, err := getOperatorConfig(c.configMapLister, c.operatorNamespace)
+	if err != nil {
+		return err
+	}
+	registered, err := c.getRegisteredProviders(config)
+	if err != nil {
+		return err
+	}
+	objs, err := c.spcLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list SecretProviderClasses: %w", err)
+	}
+
+	var errs []error
+	var invalid []string
+	seen := sets.New[string]()
+	for _, obj := range objs {
+		spc, err := toSecretProviderClass(obj)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		key := spc.Namespace + "/" + spc.Name
+		seen.Insert(key)
+
+		problems := validateSecretProviderClass(spc, registered)
+		if problem := checkSecretObjectsSync(spc, config.SecretSync); problem != "" {
+			problems = append(problems, problem)
+		}
+		if len(problems) == 0 {
+			delete(c.reported, key)
+			continue
+		}
+		message := strings.Join(problems, "; ")
+		invalid = append(invalid, key+": "+message)
+		if c.reported[key] != message {
+			c.eventRecorder.Event(obj, corev1.EventTypeWarning, invalidSecretProviderClassReason, message)
+			c.reported[key] = message
+		}
+	}
+	for key := range c.reported {
+		if !seen.Has(key) {
+			delete(c.reported, key)
+		}
+	}
+
+	condition := applyoperatorv1.OperatorCondition().
+		WithType(secretProviderClassesInvalidCondition).
+		WithStatus(opv1.ConditionFalse).
+		WithReason("AsExpected")
+	message := fmt.Sprintf("0 of %d SecretProviderClasses are invalid", len(objs))
+	if len(invalid) > 0 {
+		slices.Sort(invalid)
+		message = fmt.Sprintf("%d of %d SecretProviderClasses are invalid: %s", len(invalid), len(objs), strings.Join(invalid[:min(len(invalid), maxReportedSecretProviderClasses)], ", "))
+		if len(invalid) > maxReportedSecretProviderClasses {
+			message += fmt.Sprintf(" and %d more", len(invalid)-maxReportedSecretProviderClasses)
+		}
+		condition = condition.
+			WithStatus(opv1.ConditionTrue).
+			WithReason(invalidSecretProviderClassReason)
+	}
+	if registered == nil {
+		message += "; providers are not checked for registration, as neither providers nor externalProviders are configured"
+	}
+	condition = condition.WithMessage(message)
+	if err := c.operatorClient.ApplyOperatorStatus(ctx, c.name, applyoperatorv1.OperatorStatus().WithConditions(condition)); err != nil {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// getRegisteredProviders returns the providers SecretProviderClasses may
+// reference: the operator-deployed providers with at least one available
+// DaemonSet pod, plus operatorConfig.ExternalProviders. It returns nil when
+// the operator config lists neither, because providers installed by hand
+// are invisible to the operator and every provider must then be assumed
+// registered.
+func (c *secretProviderClassValidationController) getRegisteredProviders(config operatorConfig) (sets.Set[string], error) {
+	enabled, err := getEnabledProviders(config)
+	if err != nil {
+		return nil, err
+	}
+	if len(enabled) == 0 && len(config.ExternalProviders) == 0 {
+		return nil, nil
+	}
+
+	registered := sets.New(config.ExternalProviders...)
+	for name := range enabled {
+		objectName := providerObjectName(name)
+		daemonSet, err := c.daemonSetLister.DaemonSets(c.operatorNamespace).Get(objectName)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get DaemonSet %s/%s: %w", c.operatorNamespace, objectName, err)
+		}
+		if daemonSet.Status.NumberAvailable > 0 {
+			registered.Insert(name)
+		}
+	}
+	return registered, nil
+}
+
+// validateSecretProviderClass returns the problems found in spc, in a stable
+// order. registered is the set of providers spc may reference; a nil set
+// skips that check.
+func validateSecretProviderClass(spc *secretProviderClass, registered sets.Set[string]) []string {
+	var problems []string
+
+	switch {
+	case spc.Spec.Provider == "":
+		problems = append(problems, "spec.provider is empty")
+	case registered != nil && !registered.Has(spc.Spec.Provider):
+		problems = append(problems, fmt.Sprintf("provider %q is not registered on any node", spc.Spec.Provider))
+	}
+
+	objectNames, err := getMountedObjectNames(spc.Spec.Parameters)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	mounted := sets.New[string]()
+	for _, name := range objectNames {
+		if mounted.Has(name) {
+			problems = append(problems, fmt.Sprintf("objectName %q is mounted more than once", name))
+		}
+		mounted.Insert(name)
+	}
+
+	secretNames := sets.New[string]()
+	for i, secretObject := range spc.Spec.SecretObjects {
+		field := fmt.Sprintf("secretObjects[%d]", i)
+		switch {
+		case secretObject.SecretName == "":
+			problems = append(problems, field+".secretName is empty")
+		case secretNames.Has(secretObject.SecretName):
+			problems = append(problems, fmt.Sprintf("%s.secretName %q is used more than once", field, secretObject.SecretName))
+		}
+		secretNames.Insert(secretObject.SecretName)
+		if secretObject.Type == "" {
+			problems = append(problems, field+".type is empty")
+		}
+		if len(secretObject.Data) == 0 {
+			problems = append(problems, field+".data is empty")
+		}
+
+		keys := sets.New[string]()
+		for j, data := range secretObject.Data {
+			dataField := fmt.Sprintf("%s.data[%d]", field, j)
+			if data.ObjectName == "" {
+				problems = append(problems, dataField+".objectName is empty")
+			}
+			switch {
+			case data.Key == "":
+				problems = append(problems, dataField+".key is empty")
+			case keys.Has(data.Key):
+				problems = append(problems, fmt.Sprintf("%s.key %q is used more than once", dataField, data.Key))
+			}
+			keys.Insert(data.Key)
+		}
+	}
+	return problems
+}
+
+// checkSecretObjectsSync returns why the driver may not sync the
+// secretObjects of spc into Secrets under secretSync, or "" if it may or
+// spc has none.
+func checkSecretObjectsSync(spc *secretProviderClass, secretSync secretSyncConfig) string {
+	switch {
+	case len(spc.Spec.SecretObjects) == 0:
+		return ""
+	case !secretSync.Enabled:
+		return fmt.Sprintf("secretObjects are not synced, as secretSync.enabled is not true in ConfigMap %s", operatorConfigMapName)
+	case len(secretSync.Namespaces) > 0 && !slices.Contains(secretSync.Namespaces, spc.Namespace):
+		return fmt.Sprintf("secretObjects are not synced, as namespace %q is not in secretSync.namespaces of ConfigMap %s", spc.Namespace, operatorConfigMapName)
+	}
+	return ""
+}
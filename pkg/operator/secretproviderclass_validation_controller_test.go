@@ -0,0 +1,312 @@
+package operator
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+)
+
+func TestValidateSecretProviderClass(t *testing.T) {
+	cases := []struct {
+		name       string
+		spec       secretProviderClassSpec
+		registered sets.Set[string]
+		expected   []string
+	}{
+		{
+			name: "valid",
+			spec: secretProviderClassSpec{
+				Provider:   "vault",
+				Parameters: map[string]string{"objects": "- objectName: a\n- objectName: b\n"},
+				SecretObjects: []secretObject{{
+					SecretName: "app",
+					Type:       "Opaque",
+					Data:       []secretObjectData{{ObjectName: "a", Key: "a"}, {ObjectName: "b", Key: "b"}},
+				}},
+			},
+			registered: sets.New("vault"),
+		},
+		{
+			name:     "empty provider",
+			spec:     secretProviderClassSpec{},
+			expected: []string{"spec.provider is empty"},
+		},
+		{
+			name:     "unknown registered providers accept any provider",
+			spec:     secretProviderClassSpec{Provider: "conjur"},
+			expected: nil,
+		},
+		{
+			name:       "provider not registered",
+			spec:       secretProviderClassSpec{Provider: "conjur"},
+			registered: sets.New("vault"),
+			expected:   []string{`provider "conjur" is not registered on any node`},
+		},
+		{
+			name: "duplicate objectName",
+			spec: secretProviderClassSpec{
+				Provider:   "azure",
+				Parameters: map[string]string{"objects": "array:\n  - |\n    objectName: a\n  - |\n    objectName: b\n    objectAlias: a\n"},
+			},
+			expected: []string{`objectName "a" is mounted more than once`},
+		},
+		{
+			name: "malformed secretObjects",
+			spec: secretProviderClassSpec{
+				Provider: "aws",
+				SecretObjects: []secretObject{
+					{SecretName: "app", Type: "Opaque", Data: []secretObjectData{{ObjectName: "a", Key: "a"}, {Key: "a"}}},
+					{SecretName: "app"},
+					{Type: "Opaque", Data: []secretObjectData{{ObjectName: "a"}}},
+				},
+			},
+			expected: []string{
+				"secretObjects[0].data[1].objectName is empty",
+				`secretObjects[0].data[1].key "a" is used more than once`,
+				`secretObjects[1].secretName "app" is used more than once`,
+				"secretObjects[1].type is empty",
+				"secretObjects[1].data is empty",
+				"secretObjects[2].secretName is empty",
+				"secretObjects[2].data[0].key is empty",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			spc := &secretProviderClass{Namespace: "app", Name: "spc", Spec: tc.spec}
+			problems := validateSecretProviderClass(spc, tc.registered)
+			if !reflect.DeepEqual(problems, tc.expected) {
+				t.Fatalf("expected problems %q, got %q", tc.expected, problems)
+			}
+		})
+	}
+}
+
+func TestCheckSecretObjectsSync(t *testing.T) {
+	secretObjects := []secretObject{{SecretName: "app", Type: "Opaque", Data: []secretObjectData{{ObjectName: "a", Key: "a"}}}}
+	cases := []struct {
+		name          string
+		secretObjects []secretObject
+		secretSync    secretSyncConfig
+		expected      string
+	}{
+		{
+			name: "no secretObjects",
+		},
+		{
+			name:          "secretSync disabled",
+			secretObjects: secretObjects,
+			expected:      "secretObjects are not synced, as secretSync.enabled is not true in ConfigMap " + operatorConfigMapName,
+		},
+		{
+			name:          "secretSync enabled in all namespaces",
+			secretObjects: secretObjects,
+			secretSync:    secretSyncConfig{Enabled: true},
+		},
+		{
+			name:          "namespace in secretSync.namespaces",
+			secretObjects: secretObjects,
+			secretSync:    secretSyncConfig{Enabled: true, Namespaces: []string{"other", "app"}},
+		},
+		{
+			name:          "namespace outside secretSync.namespaces",
+			secretObjects: secretObjects,
+			secretSync:    secretSyncConfig{Enabled: true, Namespaces: []string{"other"}},
+			expected:      `secretObjects are not synced, as namespace "app" is not in secretSync.namespaces of ConfigMap ` + operatorConfigMapName,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			spc := &secretProviderClass{Namespace: "app", Name: "spc", Spec: secretProviderClassSpec{Provider: "aws", SecretObjects: tc.secretObjects}}
+			if problem := checkSecretObjectsSync(spc, tc.secretSync); problem != tc.expected {
+				t.Fatalf("expected problem %q, got %q", tc.expected, problem)
+			}
+		})
+	}
+}
+
+func TestSecretProviderClassValidationControllerSync(t *testing.T) {
+	syncedSpec := map[string]interface{}{
+		"provider": "e2e-provider",
+		"secretObjects": []interface{}{
+			map[string]interface{}{
+				"secretName": "app",
+				"type":       "Opaque",
+				"data":       []interface{}{map[string]interface{}{"objectName": "a", "key": "a"}},
+			},
+		},
+	}
+
+	cases := []struct {
+		name       string
+		configMap  *corev1.ConfigMap
+		daemonSets []*appsv1.DaemonSet
+		spcs       []*unstructured.Unstructured
+
+		wantStatus            opv1.ConditionStatus
+		wantMessageContain    string
+		wantMessageNotContain string
+		wantEvents            int
+	}{
+		{
+			name:               "no SecretProviderClasses",
+			wantStatus:         opv1.ConditionFalse,
+			wantMessageContain: "0 of 0 SecretProviderClasses are invalid",
+		},
+		{
+			name: "valid SecretProviderClass without provider opinion",
+			spcs: []*unstructured.Unstructured{
+				newTestSecretProviderClass("app", "valid", map[string]interface{}{"provider": "e2e-provider"}),
+			},
+			wantStatus:         opv1.ConditionFalse,
+			wantMessageContain: "0 of 1 SecretProviderClasses are invalid; providers are not checked for registration, as neither providers nor externalProviders are configured",
+		},
+		{
+			name:      "external provider is registered",
+			configMap: newOperatorConfigMap("externalProviders:\n- e2e-provider\n"),
+			spcs: []*unstructured.Unstructured{
+				newTestSecretProviderClass("app", "valid", map[string]interface{}{"provider": "e2e-provider"}),
+			},
+			wantStatus:            opv1.ConditionFalse,
+			wantMessageContain:    "0 of 1 SecretProviderClasses are invalid",
+			wantMessageNotContain: "not checked for registration",
+		},
+		{
+			name:      "deployed provider without available pods is not registered",
+			configMap: newOperatorConfigMap("providers:\n- name: vault\n- name: aws\n"),
+			daemonSets: []*appsv1.DaemonSet{
+				newTestProviderDaemonSetWithAvailable("vault", 0),
+				newTestProviderDaemonSetWithAvailable("aws", 3),
+			},
+			spcs: []*unstructured.Unstructured{
+				newTestSecretProviderClass("app", "aws", map[string]interface{}{"provider": "aws"}),
+				newTestSecretProviderClass("app", "vault", map[string]interface{}{"provider": "vault"}),
+			},
+			wantStatus:         opv1.ConditionTrue,
+			wantMessageContain: `1 of 2 SecretProviderClasses are invalid: app/vault: provider "vault" is not registered on any node`,
+			wantEvents:         1,
+		},
+		{
+			name: "secretObjects without secretSync are invalid",
+			spcs: []*unstructured.Unstructured{
+				newTestSecretProviderClass("app", "synced", syncedSpec),
+			},
+			wantStatus:         opv1.ConditionTrue,
+			wantMessageContain: "1 of 1 SecretProviderClasses are invalid: app/synced: secretObjects are not synced, as secretSync.enabled is not true",
+			wantEvents:         1,
+		},
+		{
+			name:      "secretObjects outside secretSync.namespaces are invalid",
+			configMap: newOperatorConfigMap("secretSync:\n  enabled: true\n  namespaces:\n  - app\n"),
+			spcs: []*unstructured.Unstructured{
+				newTestSecretProviderClass("app", "synced", syncedSpec),
+				newTestSecretProviderClass("other", "synced", syncedSpec),
+			},
+			wantStatus:         opv1.ConditionTrue,
+			wantMessageContain: `1 of 2 SecretProviderClasses are invalid: other/synced: secretObjects are not synced, as namespace "other" is not in secretSync.namespaces`,
+			wantEvents:         1,
+		},
+		{
+			name: "invalid objects are capped in the message",
+			spcs: []*unstructured.Unstructured{
+				newTestSecretProviderClass("a", "1", map[string]interface{}{}),
+				newTestSecretProviderClass("a", "2", map[string]interface{}{}),
+				newTestSecretProviderClass("a", "3", map[string]interface{}{}),
+				newTestSecretProviderClass("a", "4", map[string]interface{}{}),
+				newTestSecretProviderClass("a", "5", map[string]interface{}{}),
+				newTestSecretProviderClass("a", "6", map[string]interface{}{}),
+				newTestSecretProviderClass("a", "7", map[string]interface{}{}),
+			},
+			wantStatus:         opv1.ConditionTrue,
+			wantMessageContain: "a/5: spec.provider is empty and 2 more; providers are not checked for registration",
+			wantEvents:         7,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			spcIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			for _, spc := range tc.spcs {
+				if err := spcIndexer.Add(spc); err != nil {
+					t.Fatalf("failed to add SecretProviderClass to indexer: %v", err)
+				}
+			}
+			daemonSetIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			for _, daemonSet := range tc.daemonSets {
+				if err := daemonSetIndexer.Add(daemonSet); err != nil {
+					t.Fatalf("failed to add DaemonSet to indexer: %v", err)
+				}
+			}
+			configMapLister := newTestConfigMapLister(t)
+			if tc.configMap != nil {
+				configMapLister = newTestConfigMapLister(t, tc.configMap)
+			}
+			operatorClient := v1helpers.NewFakeOperatorClientWithObjectMeta(
+				&metav1.ObjectMeta{Name: providerName},
+				&opv1.OperatorSpec{ManagementState: opv1.Managed},
+				&opv1.OperatorStatus{},
+				nil,
+			)
+			eventRecorder := record.NewFakeRecorder(len(tc.spcs) * 2)
+			c := &secretProviderClassValidationController{
+				name:              "SecretProviderClassValidationController",
+				operatorNamespace: testOperatorNamespace,
+				operatorClient:    operatorClient,
+				spcLister:         cache.NewGenericLister(spcIndexer, secretProviderClassGVR.GroupResource()),
+				configMapLister:   configMapLister,
+				daemonSetLister:   appsv1listers.NewDaemonSetLister(daemonSetIndexer),
+				eventRecorder:     eventRecorder,
+				reported:          map[string]string{},
+			}
+			syncContext := factory.NewSyncContext(c.name, events.NewInMemoryRecorder(c.name, clock.RealClock{}))
+
+			// The second sync must not repeat the events of the first one.
+			for range 2 {
+				if err := c.sync(context.Background(), syncContext); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			_, status, _, _ := operatorClient.GetOperatorState()
+			condition := v1helpers.FindOperatorCondition(status.Conditions, secretProviderClassesInvalidCondition)
+			if condition == nil {
+				t.Fatalf("expected condition %s to be set", secretProviderClassesInvalidCondition)
+			}
+			if condition.Status != tc.wantStatus {
+				t.Fatalf("expected condition status %s, got %s: %s", tc.wantStatus, condition.Status, condition.Message)
+			}
+			if !strings.Contains(condition.Message, tc.wantMessageContain) {
+				t.Fatalf("expected condition message to contain %q, got %q", tc.wantMessageContain, condition.Message)
+			}
+			if tc.wantMessageNotContain != "" && strings.Contains(condition.Message, tc.wantMessageNotContain) {
+				t.Fatalf("expected condition message not to contain %q, got %q", tc.wantMessageNotContain, condition.Message)
+			}
+			if got := len(eventRecorder.Events); got != tc.wantEvents {
+				t.Fatalf("expected %d events, got %d", tc.wantEvents, got)
+			}
+		})
+	}
+}
+
+func newTestProviderDaemonSetWithAvailable(name string, available int32) *appsv1.DaemonSet {
+	daemonSet := newTestProviderDaemonSet(name)
+	daemonSet.Status.NumberAvailable = available
+	return daemonSet
+}
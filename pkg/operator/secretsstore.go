@@ -113,3 +113,45 @@ func getEffectiveTokenRequests(driverConfig opv1.CSIDriverConfigSpec, existing [
 		return existing
 	}
 }
+
+// describeSecretRotationConfig explains which branch of
+// getSecretRotationConfig driverConfig takes. Keep the two in sync.
+func describeSecretRotationConfig(driverConfig opv1.CSIDriverConfigSpec) string {
+	if driverConfig.DriverType != opv1.SecretsStoreDriverType {
+		return fmt.Sprintf("driverType is %q, not %q: defaults apply", driverConfig.DriverType, opv1.SecretsStoreDriverType)
+	}
+	rotation := driverConfig.SecretsStore.SecretRotation
+	switch rotation.Type {
+	case opv1.SecretRotationNone:
+		return "secretRotation.type is None: rotation is disabled"
+	case opv1.SecretRotationCustom:
+		if rotation.Custom.MinimumRefreshAge > 0 {
+			return fmt.Sprintf("secretRotation.type is Custom with minimumRefreshAge %ds", rotation.Custom.MinimumRefreshAge)
+		}
+		return "secretRotation.type is Custom without minimumRefreshAge: the default interval applies"
+	case "":
+		return "secretRotation.type is not set: defaults apply"
+	default:
+		return fmt.Sprintf("secretRotation.type %q is unknown: defaults apply", rotation.Type)
+	}
+}
+
+// describeTokenRequestsConfig explains which branch of
+// getEffectiveTokenRequests driverConfig takes. Keep the two in sync.
+func describeTokenRequestsConfig(driverConfig opv1.CSIDriverConfigSpec) string {
+	if driverConfig.DriverType != opv1.SecretsStoreDriverType {
+		return fmt.Sprintf("driverType is %q, not %q: the CSIDriver's tokenRequests are preserved", driverConfig.DriverType, opv1.SecretsStoreDriverType)
+	}
+	tokenRequests := driverConfig.SecretsStore.TokenRequests
+	switch tokenRequests.Type {
+	case opv1.TokenRequestsManaged:
+		if tokenRequests.Managed.Audiences == nil {
+			return "tokenRequests.type is Managed without audiences: the CSIDriver's tokenRequests are preserved"
+		}
+		return fmt.Sprintf("tokenRequests.type is Managed with %d audiences", len(*tokenRequests.Managed.Audiences))
+	case opv1.TokenRequestsUnmanaged:
+		return "tokenRequests.type is Unmanaged: the CSIDriver's tokenRequests are preserved"
+	default:
+		return "tokenRequests.type is not set: the CSIDriver's tokenRequests are preserved"
+	}
+}
@@ -0,0 +1,533 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	opv1 "github.com/openshift/api/operator/v1"
+	operatorv1alpha1 "github.com/openshift/api/operator/v1alpha1"
+	configfake "github.com/openshift/client-go/config/clientset/versioned/fake"
+	applyoperatorv1 "github.com/openshift/client-go/operator/applyconfigurations/operator/v1"
+	"github.com/openshift/library-go/pkg/apiserver/jsonpatch"
+	"github.com/openshift/library-go/pkg/config/configdefaults"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourcemerge"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/utils/clock"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+
+	sscsitls "github.com/openshift/secrets-store-csi-driver-operator/pkg/tls"
+)
+
+const (
+	// simulationTimeout bounds how long a simulation waits for the
+	// controllers to reach an expected state.
+	simulationTimeout = 30 * time.Second
+	// simulationResyncAnnotation is bumped on the ClusterCSIDriver to make
+	// the controllers sync again, see simulation.resync.
+	simulationResyncAnnotation = "simulation.secrets-store.csi.k8s.io/resync"
+)
+
+// simulationStep is a step of a simulation scenario: do changes the
+// simulated cluster, then want must eventually hold.
+type simulationStep struct {
+	name string
+	do   func(t *testing.T, s *simulation)
+	want []simulationCheck
+}
+
+// simulationCheck returns an error as long as the simulated cluster is not
+// in the expected state.
+type simulationCheck func(s *simulation) error
+
+// simulation runs the controllers of RunOperator, through runOperator,
+// against fake kube, dynamic and config clientsets and a fake clock, so that
+// scenarios of the e2e suite can run offline. The controllers run for real,
+// in their own goroutines: expectations are polled until they hold.
+//
+// Resyncs still follow the real clock. Steps that change something no
+// informer watches, like the clock or the TLS profile, call resync.
+type simulation struct {
+	namespace       string
+	clock           *clocktesting.FakeClock
+	kubeClient      *kubefake.Clientset
+	dynamicClient   *dynamicfake.FakeDynamicClient
+	configClient    *configfake.Clientset
+	operatorClient  *simulatedOperatorClient
+	servingConfig   *sscsitls.DynamicServingConfig
+	complianceAudit *sscsitls.ComplianceAudit
+}
+
+// newSimulation starts the controllers of RunOperator for clusterCSIDriver,
+// with kubeObjects and configObjects in the fake clientsets and tlsProfile
+// as the resolved cluster TLS profile. They stop with the test.
+func newSimulation(t *testing.T, clusterCSIDriver *opv1.ClusterCSIDriver, kubeObjects, configObjects []runtime.Object, tlsProfile sscsitls.ResolvedProfile) *simulation {
+	t.Helper()
+
+	clusterCSIDriver = clusterCSIDriver.DeepCopy()
+	clusterCSIDriver.ResourceVersion = "1"
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(clusterCSIDriver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unstructuredClusterCSIDriver := &unstructured.Unstructured{Object: content}
+	unstructuredClusterCSIDriver.SetGroupVersionKind(opv1.SchemeGroupVersion.WithKind("ClusterCSIDriver"))
+
+	servingConfig, err := sscsitls.NewDynamicServingConfig(tlsProfile, configv1.HTTPServingInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &simulation{
+		namespace:     testOperatorNamespace,
+		clock:         clocktesting.NewFakeClock(testNow),
+		kubeClient:    kubefake.NewClientset(kubeObjects...),
+		configClient:  configfake.NewClientset(configObjects...),
+		servingConfig: servingConfig,
+		dynamicClient: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+			clusterCSIDriverGVR:             "ClusterCSIDriverList",
+			secretProviderClassGVR:          "SecretProviderClassList",
+			secretProviderClassPodStatusGVR: "SecretProviderClassPodStatusList",
+		}, unstructuredClusterCSIDriver),
+		complianceAudit: &sscsitls.ComplianceAudit{},
+	}
+	operatorInformers := dynamicinformer.NewDynamicSharedInformerFactory(s.dynamicClient, resync)
+	s.operatorClient = &simulatedOperatorClient{
+		clock:    s.clock,
+		client:   s.dynamicClient.Resource(clusterCSIDriverGVR),
+		informer: operatorInformers.ForResource(clusterCSIDriverGVR),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.serveMetrics(t, ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := runOperator(ctx, s.namespace, operatorClients{
+			kubeClient:        s.kubeClient,
+			dynamicClient:     s.dynamicClient,
+			configClient:      s.configClient,
+			operatorClient:    s.operatorClient,
+			operatorInformers: operatorInformers,
+			eventRecorder:     events.NewInMemoryRecorder(operatorName, s.clock),
+			clock:             s.clock,
+		}, s.servingConfig, s.complianceAudit)
+		if err != nil {
+			t.Errorf("runOperator failed: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return s
+}
+
+// serveMetrics serves the operator's metrics server with s.servingConfig on
+// a loopback port until ctx is done, as main does, for the TLS compliance
+// controller to handshake with.
+func (s *simulation) serveMetrics(t *testing.T, ctx context.Context) {
+	t.Helper()
+	certPEM, keyPEM, err := certutil.GenerateSelfSignedCertKey("localhost", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	servingInfo := configv1.HTTPServingInfo{}
+	// A bind port of 0 disables serving, pick a free one.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	servingInfo.BindAddress = listener.Addr().String()
+	if err := listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+	servingInfo.CertFile = filepath.Join(dir, "tls.crt")
+	servingInfo.KeyFile = filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(servingInfo.CertFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(servingInfo.KeyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	configdefaults.SetRecommendedHTTPServingInfoDefaults(&servingInfo)
+
+	server, err := sscsitls.NewMetricsServer(ctx, operatorName, servingInfo,
+		operatorv1alpha1.DelegatedAuthentication{Disabled: true}, operatorv1alpha1.DelegatedAuthorization{Disabled: true},
+		"", nil, nil, version.Info{}, s.complianceAudit)
+	if err != nil {
+		t.Fatalf("failed to build the metrics server: %v", err)
+	}
+	if err := sscsitls.Serve(ctx, server, s.servingConfig); err != nil {
+		t.Fatalf("failed to serve the metrics server: %v", err)
+	}
+}
+
+// run runs steps in order.
+func (s *simulation) run(t *testing.T, steps []simulationStep) {
+	t.Helper()
+	for _, step := range steps {
+		if step.do != nil {
+			step.do(t, s)
+		}
+		for _, check := range step.want {
+			s.eventually(t, step.name, check)
+		}
+	}
+}
+
+// eventually waits until check holds.
+func (s *simulation) eventually(t *testing.T, step string, check simulationCheck) {
+	t.Helper()
+	var lastErr error
+	err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, simulationTimeout, true, func(context.Context) (bool, error) {
+		lastErr = check(s)
+		return lastErr == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("step %q: %v", step, lastErr)
+	}
+}
+
+// updateClusterCSIDriver applies mutate to the ClusterCSIDriver.
+func (s *simulation) updateClusterCSIDriver(t *testing.T, mutate func(*opv1.ClusterCSIDriver)) {
+	t.Helper()
+	if err := s.operatorClient.update(context.Background(), false, mutate); err != nil {
+		t.Fatalf("failed to update ClusterCSIDriver: %v", err)
+	}
+}
+
+// resync makes the controllers watching the ClusterCSIDriver, nearly all of
+// them, sync again.
+func (s *simulation) resync(t *testing.T) {
+	t.Helper()
+	s.updateClusterCSIDriver(t, func(driver *opv1.ClusterCSIDriver) {
+		resyncs, _ := strconv.Atoi(driver.Annotations[simulationResyncAnnotation])
+		metav1.SetMetaDataAnnotation(&driver.ObjectMeta, simulationResyncAnnotation, strconv.Itoa(resyncs+1))
+	})
+}
+
+// advance steps the fake clock by d and resyncs.
+func (s *simulation) advance(t *testing.T, d time.Duration) {
+	t.Helper()
+	s.clock.Step(d)
+	s.resync(t)
+}
+
+// setTLSProfile makes resolved the cluster TLS profile, as
+// RunTLSProfileWatcher would, and resyncs.
+func (s *simulation) setTLSProfile(t *testing.T, resolved sscsitls.ResolvedProfile) {
+	t.Helper()
+	if err := s.servingConfig.Update(resolved); err != nil {
+		t.Fatal(err)
+	}
+	s.resync(t)
+}
+
+// applyOperatorConfig creates or replaces the operator config ConfigMap with
+// config.
+func (s *simulation) applyOperatorConfig(t *testing.T, config string) {
+	t.Helper()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: operatorConfigMapName, Namespace: s.namespace},
+		Data:       map[string]string{operatorConfigKey: config},
+	}
+	configMaps := s.kubeClient.CoreV1().ConfigMaps(s.namespace)
+	_, err := configMaps.Update(context.Background(), configMap, metav1.UpdateOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = configMaps.Create(context.Background(), configMap, metav1.CreateOptions{})
+	}
+	if err != nil {
+		t.Fatalf("failed to apply ConfigMap %s: %v", operatorConfigMapName, err)
+	}
+}
+
+// wantContainerArgs checks that container of DaemonSet name has args.
+func wantContainerArgs(name, container string, args ...string) simulationCheck {
+	return func(s *simulation) error {
+		daemonSet, err := s.kubeClient.AppsV1().DaemonSets(s.namespace).Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		c, err := findContainer(daemonSet, container)
+		if err != nil {
+			return err
+		}
+		for _, arg := range args {
+			if !containsString(c.Args, arg) {
+				return fmt.Errorf("DaemonSet %s container %s: expected arg %q in %v", name, container, arg, c.Args)
+			}
+		}
+		return nil
+	}
+}
+
+// wantCSIDriver checks the CSIDriver of the driver.
+func wantCSIDriver(check func(*storagev1.CSIDriver) error) simulationCheck {
+	return func(s *simulation) error {
+		csiDriver, err := s.kubeClient.StorageV1().CSIDrivers().Get(context.Background(), providerName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		return check(csiDriver)
+	}
+}
+
+// wantCondition checks the status and reason of the condition conditionType
+// of the ClusterCSIDriver.
+func wantCondition(conditionType string, status opv1.ConditionStatus, reason string) simulationCheck {
+	return func(s *simulation) error {
+		_, operatorStatus, _, err := s.operatorClient.GetOperatorStateWithQuorum(context.Background())
+		if err != nil {
+			return err
+		}
+		condition := v1helpers.FindOperatorCondition(operatorStatus.Conditions, conditionType)
+		if condition == nil {
+			return fmt.Errorf("condition %s is not set", conditionType)
+		}
+		if condition.Status != status || condition.Reason != reason {
+			return fmt.Errorf("expected condition %s %s/%s, got %s/%s: %s", conditionType, status, reason, condition.Status, condition.Reason, condition.Message)
+		}
+		return nil
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// simulatedOperatorClient is the operator client of the ClusterCSIDriver of
+// a simulation. The generic operator client applies the status with
+// server-side apply, which the fake dynamic client cannot merge, so this one
+// merges the applied conditions and generations by their keys instead, like
+// the API server would, but without tracking field managers. Writes bump the
+// resourceVersion, which the fake dynamic client does not.
+type simulatedOperatorClient struct {
+	clock    clock.PassiveClock
+	client   dynamic.ResourceInterface
+	informer informers.GenericInformer
+
+	// mu serializes the writes, so that resourceVersions are not reused.
+	mu sync.Mutex
+}
+
+var _ v1helpers.OperatorClientWithFinalizers = &simulatedOperatorClient{}
+
+func (c *simulatedOperatorClient) Informer() cache.SharedIndexInformer {
+	return c.informer.Informer()
+}
+
+func (c *simulatedOperatorClient) GetObjectMeta() (*metav1.ObjectMeta, error) {
+	driver, err := c.cached()
+	if err != nil {
+		return nil, err
+	}
+	return &driver.ObjectMeta, nil
+}
+
+func (c *simulatedOperatorClient) GetOperatorState() (*opv1.OperatorSpec, *opv1.OperatorStatus, string, error) {
+	driver, err := c.cached()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return &driver.Spec.OperatorSpec, &driver.Status.OperatorStatus, driver.ResourceVersion, nil
+}
+
+func (c *simulatedOperatorClient) GetOperatorStateWithQuorum(ctx context.Context) (*opv1.OperatorSpec, *opv1.OperatorStatus, string, error) {
+	driver, err := c.live(ctx)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return &driver.Spec.OperatorSpec, &driver.Status.OperatorStatus, driver.ResourceVersion, nil
+}
+
+func (c *simulatedOperatorClient) UpdateOperatorSpec(ctx context.Context, resourceVersion string, spec *opv1.OperatorSpec) (*opv1.OperatorSpec, string, error) {
+	var updated *opv1.ClusterCSIDriver
+	err := c.update(ctx, false, func(driver *opv1.ClusterCSIDriver) {
+		driver.Spec.OperatorSpec = *spec
+		updated = driver
+	}, resourceVersion)
+	if err != nil {
+		return nil, "", err
+	}
+	return &updated.Spec.OperatorSpec, updated.ResourceVersion, nil
+}
+
+func (c *simulatedOperatorClient) UpdateOperatorStatus(ctx context.Context, resourceVersion string, status *opv1.OperatorStatus) (*opv1.OperatorStatus, error) {
+	var updated *opv1.ClusterCSIDriver
+	err := c.update(ctx, true, func(driver *opv1.ClusterCSIDriver) {
+		driver.Status.OperatorStatus = *status
+		updated = driver
+	}, resourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	return &updated.Status.OperatorStatus, nil
+}
+
+func (c *simulatedOperatorClient) ApplyOperatorSpec(context.Context, string, *applyoperatorv1.OperatorSpecApplyConfiguration) error {
+	return fmt.Errorf("ApplyOperatorSpec is not simulated")
+}
+
+func (c *simulatedOperatorClient) ApplyOperatorStatus(ctx context.Context, _ string, desired *applyoperatorv1.OperatorStatusApplyConfiguration) error {
+	return c.update(ctx, true, func(driver *opv1.ClusterCSIDriver) {
+		status := &driver.Status.OperatorStatus
+		var existing []applyoperatorv1.OperatorConditionApplyConfiguration
+		for _, condition := range status.Conditions {
+			existing = append(existing, *applyoperatorv1.OperatorCondition().
+				WithType(condition.Type).
+				WithStatus(condition.Status).
+				WithLastTransitionTime(condition.LastTransitionTime))
+		}
+		conditions := append([]applyoperatorv1.OperatorConditionApplyConfiguration{}, desired.Conditions...)
+		v1helpers.SetApplyConditionsLastTransitionTime(c.clock, &conditions, existing)
+		for _, condition := range conditions {
+			applied := opv1.OperatorCondition{
+				Type:               ptr.Deref(condition.Type, ""),
+				Status:             ptr.Deref(condition.Status, ""),
+				Reason:             ptr.Deref(condition.Reason, ""),
+				Message:            ptr.Deref(condition.Message, ""),
+				LastTransitionTime: ptr.Deref(condition.LastTransitionTime, metav1.Time{}),
+			}
+			if existing := v1helpers.FindOperatorCondition(status.Conditions, applied.Type); existing != nil {
+				*existing = applied
+			} else {
+				status.Conditions = append(status.Conditions, applied)
+			}
+		}
+		for _, generation := range desired.Generations {
+			applied := opv1.GenerationStatus{
+				Group:          ptr.Deref(generation.Group, ""),
+				Resource:       ptr.Deref(generation.Resource, ""),
+				Namespace:      ptr.Deref(generation.Namespace, ""),
+				Name:           ptr.Deref(generation.Name, ""),
+				LastGeneration: ptr.Deref(generation.LastGeneration, 0),
+				Hash:           ptr.Deref(generation.Hash, ""),
+			}
+			if existing := resourcemerge.GenerationFor(status.Generations, schema.GroupResource{Group: applied.Group, Resource: applied.Resource}, applied.Namespace, applied.Name); existing != nil {
+				*existing = applied
+			} else {
+				status.Generations = append(status.Generations, applied)
+			}
+		}
+		if desired.ObservedGeneration != nil {
+			status.ObservedGeneration = *desired.ObservedGeneration
+		}
+		if desired.Version != nil {
+			status.Version = *desired.Version
+		}
+		if desired.ReadyReplicas != nil {
+			status.ReadyReplicas = *desired.ReadyReplicas
+		}
+	})
+}
+
+func (c *simulatedOperatorClient) PatchOperatorStatus(context.Context, *jsonpatch.PatchSet) error {
+	return fmt.Errorf("PatchOperatorStatus is not simulated")
+}
+
+func (c *simulatedOperatorClient) EnsureFinalizer(ctx context.Context, finalizer string) error {
+	return c.update(ctx, false, func(driver *opv1.ClusterCSIDriver) {
+		if !containsString(driver.Finalizers, finalizer) {
+			driver.Finalizers = append(driver.Finalizers, finalizer)
+		}
+	})
+}
+
+func (c *simulatedOperatorClient) RemoveFinalizer(ctx context.Context, finalizer string) error {
+	return c.update(ctx, false, func(driver *opv1.ClusterCSIDriver) {
+		var finalizers []string
+		for _, f := range driver.Finalizers {
+			if f != finalizer {
+				finalizers = append(finalizers, f)
+			}
+		}
+		driver.Finalizers = finalizers
+	})
+}
+
+// cached returns the ClusterCSIDriver from the informer.
+func (c *simulatedOperatorClient) cached() (*opv1.ClusterCSIDriver, error) {
+	obj, err := c.informer.Lister().Get(providerName)
+	if err != nil {
+		return nil, err
+	}
+	return toClusterCSIDriver(obj)
+}
+
+// live returns the ClusterCSIDriver from the fake dynamic client.
+func (c *simulatedOperatorClient) live(ctx context.Context) (*opv1.ClusterCSIDriver, error) {
+	obj, err := c.client.Get(ctx, providerName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return toClusterCSIDriver(obj)
+}
+
+// update applies mutate to the live ClusterCSIDriver, or to its status, and
+// bumps its resourceVersion. It fails with a conflict when the live
+// resourceVersion is not resourceVersion, if given. Nothing is written when
+// mutate changes nothing.
+func (c *simulatedOperatorClient) update(ctx context.Context, status bool, mutate func(*opv1.ClusterCSIDriver), resourceVersion ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	driver, err := c.live(ctx)
+	if err != nil {
+		return err
+	}
+	if len(resourceVersion) > 0 && resourceVersion[0] != driver.ResourceVersion {
+		return apierrors.NewConflict(clusterCSIDriverGVR.GroupResource(), providerName, fmt.Errorf("resourceVersion %s is not the live %s", resourceVersion[0], driver.ResourceVersion))
+	}
+	original := driver.DeepCopy()
+	mutate(driver)
+	if reflect.DeepEqual(original, driver) {
+		return nil
+	}
+	rv, _ := strconv.Atoi(driver.ResourceVersion)
+	driver.ResourceVersion = strconv.Itoa(rv + 1)
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(driver)
+	if err != nil {
+		return err
+	}
+	obj := &unstructured.Unstructured{Object: content}
+	obj.SetGroupVersionKind(opv1.SchemeGroupVersion.WithKind("ClusterCSIDriver"))
+	if status {
+		_, err = c.client.UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+	} else {
+		_, err = c.client.Update(ctx, obj, metav1.UpdateOptions{})
+	}
+	return err
+}
@@ -4,15 +4,24 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"os"
 	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	apiserver "k8s.io/apiserver/pkg/server"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	corev1informers "k8s.io/client-go/informers/core/v1"
 	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/clock"
 
@@ -20,9 +29,12 @@ import (
 	configclient "github.com/openshift/client-go/config/clientset/versioned"
 	configinformers "github.com/openshift/client-go/config/informers/externalversions"
 	applyoperatorv1 "github.com/openshift/client-go/operator/applyconfigurations/operator/v1"
+	operatorv1listers "github.com/openshift/client-go/operator/listers/operator/v1"
 	"github.com/openshift/library-go/pkg/controller/controllercmd"
+	"github.com/openshift/library-go/pkg/controller/factory"
 	"github.com/openshift/library-go/pkg/operator/csi/csicontrollerset"
 	"github.com/openshift/library-go/pkg/operator/csi/csidrivernodeservicecontroller"
+	"github.com/openshift/library-go/pkg/operator/events"
 	goc "github.com/openshift/library-go/pkg/operator/genericoperatorclient"
 	"github.com/openshift/library-go/pkg/operator/management"
 	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
@@ -40,57 +52,32 @@ const (
 	resync             = 20 * time.Minute
 )
 
-// RunOperator wires up and runs all operator controllers. resolvedTLS is the
-// cluster TLS security profile already applied to the operator's own
-// HTTPServingInfo at startup (see cmd/secrets-store-csi-driver-operator);
-// it is threaded through here so the SecurityProfileWatcher can diff live
-// changes against it.
+// RunOperator wires up and runs all operator controllers. servingConfig holds
+// the cluster TLS security profile the operator's metrics server negotiates
+// with (see cmd/secrets-store-csi-driver-operator), kept up to date by
+// RunTLSProfileWatcher in every replica. The TLS compliance reports are
+// published to complianceAudit, which the metrics server serves.
 func RunOperator(
 	ctx context.Context,
 	controllerConfig *controllercmd.ControllerContext,
-	resolvedTLS sscsitls.ResolvedProfile,
+	servingConfig *sscsitls.DynamicServingConfig,
+	complianceAudit *sscsitls.ComplianceAudit,
 ) error {
-	operatorNamespace := controllerConfig.OperatorNamespace
-
-	// Create core clientset and informers
+	// Create core clientset
 	kubeClient := kubeclient.NewForConfigOrDie(rest.AddUserAgent(controllerConfig.KubeConfig, operatorName))
-	kubeInformersForNamespaces := v1helpers.NewKubeInformersForNamespaces(kubeClient, operatorNamespace, "")
-	configMapInformer := kubeInformersForNamespaces.InformersFor(operatorNamespace).Core().V1().ConfigMaps()
 
-	// Create config clientset and informer. This is used to get the cluster ID
-	// and to watch apiserver TLS profile / adherence changes.
+	// Create config clientset. This is used to get the cluster ID.
 	configClient, err := configclient.NewForConfig(rest.AddUserAgent(controllerConfig.KubeConfig, operatorName))
 	if err != nil {
 		return fmt.Errorf("failed to create config client: %w", err)
 	}
-	configInformers := configinformers.NewSharedInformerFactory(configClient, resync)
-
-	tlsWatcher := &sscsitls.SecurityProfileWatcher{
-		InitialTLSProfileSpec:     resolvedTLS.Spec,
-		InitialTLSAdherencePolicy: resolvedTLS.Adherence,
-		OnChange: func() {
-			// HTTPS cannot be reconfigured in place. RequestShutdown follows the
-			// same SIGTERM path Controllercmd already wires (graceful unwind);
-			// os.Exit(0) is only a fallback if the signal handler is missing.
-			klog.Info("TLS security profile or adherence changed; requesting graceful operator restart")
-			if !apiserver.RequestShutdown() {
-				klog.Warning("failed to request a graceful shutdown, exiting directly")
-				os.Exit(0)
-			}
-		},
-	}
-	if err := tlsWatcher.Start(configInformers.Config().V1().APIServers()); err != nil {
-		return fmt.Errorf("failed to start TLS security profile watcher: %w", err)
-	}
 
 	// Create GenericOperatorclient. This is used by the library-go controllers created down below
-	gvr := opv1.SchemeGroupVersion.WithResource("clustercsidrivers")
-	gvk := opv1.SchemeGroupVersion.WithKind("ClusterCSIDriver")
-	operatorClient, dynamicInformers, err := goc.NewClusterScopedOperatorClientWithConfigName(
+	operatorClient, operatorInformers, err := goc.NewClusterScopedOperatorClientWithConfigName(
 		clock.RealClock{},
 		controllerConfig.KubeConfig,
-		gvr,
-		gvk,
+		clusterCSIDriverGVR,
+		opv1.SchemeGroupVersion.WithKind("ClusterCSIDriver"),
 		providerName,
 		extractOperatorSpec,
 		extractOperatorStatus,
@@ -104,18 +91,75 @@ func RunOperator(
 		return err
 	}
 
+	return runOperator(ctx, controllerConfig.OperatorNamespace, operatorClients{
+		kubeClient:        kubeClient,
+		dynamicClient:     dynamicClient,
+		configClient:      configClient,
+		operatorClient:    operatorClient,
+		operatorInformers: operatorInformers,
+		eventRecorder:     controllerConfig.EventRecorder,
+		clock:             clock.RealClock{},
+	}, servingConfig, complianceAudit)
+}
+
+// clusterCSIDriverGVR is the resource of the ClusterCSIDriver of the
+// operatorClient.
+var clusterCSIDriverGVR = opv1.SchemeGroupVersion.WithResource("clustercsidrivers")
+
+// operatorClients are what runOperator runs the operator controllers
+// against. RunOperator builds them for the cluster; tests build them from
+// fake clientsets, see newSimulation.
+type operatorClients struct {
+	kubeClient    kubeclient.Interface
+	dynamicClient dynamic.Interface
+	configClient  configclient.Interface
+	// operatorClient is the client of the ClusterCSIDriver and
+	// operatorInformers the factory of its informer.
+	operatorClient    v1helpers.OperatorClientWithFinalizers
+	operatorInformers dynamicinformer.DynamicSharedInformerFactory
+	eventRecorder     events.Recorder
+	// clock is the clock of the controllers that act on time, like the
+	// debug window's TTL.
+	clock clock.PassiveClock
+}
+
+// runOperator runs all operator controllers of RunOperator against clients
+// until ctx is done.
+func runOperator(
+	ctx context.Context,
+	operatorNamespace string,
+	clients operatorClients,
+	servingConfig *sscsitls.DynamicServingConfig,
+	complianceAudit *sscsitls.ComplianceAudit,
+) error {
+	kubeClient := clients.kubeClient
+	dynamicClient := clients.dynamicClient
+	operatorClient := clients.operatorClient
+	eventRecorder := clients.eventRecorder
+
+	// Create core informers
+	kubeInformersForNamespaces := v1helpers.NewKubeInformersForNamespaces(kubeClient, operatorNamespace, "")
+	configMapInformer := kubeInformersForNamespaces.InformersFor(operatorNamespace).Core().V1().ConfigMaps()
+
+	// Create config informers. This is used to get the cluster ID.
+	configInformers := configinformers.NewSharedInformerFactory(clients.configClient, resync)
+
 	// ClusterCSIDriver lister to read driverConfig.secretsStore configuration.
 	// This reuses the dynamic informer/cache above (same GVR) instead of
 	// standing up a second, independent informer/watch for the same
 	// singleton ClusterCSIDriver object.
-	clusterCSIDriverLister := newDynamicClusterCSIDriverLister(dynamicInformers.ForResource(gvr).Lister())
+	clusterCSIDriverLister := newDynamicClusterCSIDriverLister(clients.operatorInformers.ForResource(clusterCSIDriverGVR).Lister())
 
 	// csiDriverInformer is the storage.k8s.io/v1 CSIDriver informer
 	csiDriverInformer := kubeInformersForNamespaces.InformersFor("").Storage().V1().CSIDrivers()
 
+	// SecretProviderClasses and their pod statuses live in user namespaces,
+	// so they get their own cluster-wide informer factory.
+	spcInformers := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, resync)
+
 	csiControllerSet := csicontrollerset.NewCSIControllerSet(
 		operatorClient,
-		controllerConfig.EventRecorder,
+		eventRecorder,
 	).WithLogLevelController().WithManagementStateController(
 		operandName,
 		true, // Set this operator as removable
@@ -124,62 +168,341 @@ func RunOperator(
 		kubeClient,
 		dynamicClient,
 		kubeInformersForNamespaces,
-		withSecretsStoreCSIDriverAsset(
+		withCSIDriverConfigMetrics(withSecretsStoreCSIDriverAsset(
 			replaceNamespaceFunc(operatorNamespace),
 			clusterCSIDriverLister,
 			csiDriverInformer.Lister(),
 			providerName,
-		),
-		[]string{
-			"node_sa.yaml",
-			"csidriver.yaml",
-			"cabundle_cm.yaml",
-			"rbac/privileged_role.yaml",
-			"rbac/node_privileged_binding.yaml",
-			"rbac/secretproviderclasses_role.yaml",
-			"rbac/secretproviderclasses_binding.yaml",
-			"network-policy/allow-ingress-to-metrics-operand.yaml",
-		},
+		)),
+		staticResourceAssets,
 		func() bool {
 			return getOperatorSyncState(operatorClient) == opv1.Managed
 		},
 		func() bool {
 			return getOperatorSyncState(operatorClient) == opv1.Removed
 		},
+	).WithConditionalStaticResourcesController(
+		"SecretsStoreNamespaceAdmissionStaticResourcesController",
+		kubeClient,
+		dynamicClient,
+		kubeInformersForNamespaces,
+		withNamespaceAdmissionPolicyAsset(
+			replaceNamespaceFunc(operatorNamespace),
+			configMapInformer.Lister(),
+			operatorNamespace,
+		),
+		namespaceAdmissionAssets,
+		func() bool {
+			return getOperatorSyncState(operatorClient) == opv1.Managed &&
+				shouldCreateNamespaceAdmission(configMapInformer.Lister(), operatorNamespace)
+		},
+		func() bool {
+			switch getOperatorSyncState(operatorClient) {
+			case opv1.Removed:
+				return true
+			case opv1.Managed:
+				return shouldDeleteNamespaceAdmission(configMapInformer.Lister(), operatorNamespace)
+			default:
+				return false
+			}
+		},
 	).WithCSIConfigObserverController(
 		"SecretsStoreDriverCSIConfigObserverController",
 		configInformers,
 	).WithCSIDriverNodeService(
 		"SecretsStoreDriverNodeServiceController",
 		replaceNamespaceFunc(operatorNamespace),
-		"node.yaml",
+		driverDaemonSetAssetName,
 		kubeClient,
 		kubeInformersForNamespaces.InformersFor(operatorNamespace),
-		nil,
-		csidrivernodeservicecontroller.WithCABundleDaemonSetHook(
+		// Resync the DaemonSet when the operator config ConfigMap or any
+		// of the objects the DaemonSet hooks read change.
+		[]factory.Informer{
+			configMapInformer.Informer(),
+			spcInformers.ForResource(secretProviderClassGVR).Informer(),
+			spcInformers.ForResource(secretProviderClassPodStatusGVR).Informer(),
+			kubeInformersForNamespaces.InformersFor("").Core().V1().Nodes().Informer(),
+		},
+		// Only the DaemonSet applied here is recorded, not the rendered ones.
+		append(newDaemonSetHooks(
 			operatorNamespace,
-			trustedCAConfigMap,
+			clusterCSIDriverLister,
 			configMapInformer,
-		),
-		withSecretRotationDaemonSetHook(
+			spcInformers.ForResource(secretProviderClassGVR),
+			spcInformers.ForResource(secretProviderClassPodStatusGVR),
+			kubeInformersForNamespaces.InformersFor(operatorNamespace).Apps().V1().DaemonSets().Lister(),
+			kubeInformersForNamespaces.InformersFor("").Core().V1().Nodes(),
+			servingConfig.Current,
+		), withSecretRotationConfigMetrics())...,
+	)
+
+	monitoringController := newMonitoringController(
+		"SecretsStoreMonitoringController",
+		dynamicClient,
+		operatorClient,
+		replaceNamespaceFunc(operatorNamespace),
+		func() bool {
+			return getOperatorSyncState(operatorClient) == opv1.Managed
+		},
+		func() bool {
+			return getOperatorSyncState(operatorClient) == opv1.Removed
+		},
+		eventRecorder,
+	)
+
+	// The RoleBindings granting Secret write access live in the namespaces of
+	// the allowlist. Watch just those, see secretSyncLabel.
+	secretSyncBindingInformers := informers.NewSharedInformerFactoryWithOptions(kubeClient, resync,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = secretSyncLabel + "=true"
+		}),
+	)
+
+	secretSyncController := newSecretSyncController(
+		"SecretsStoreSecretSyncController",
+		operatorNamespace,
+		operatorClient,
+		kubeClient,
+		kubeInformersForNamespaces,
+		secretSyncBindingInformers.Rbac().V1().RoleBindings(),
+		eventRecorder,
+	)
+
+	providerController := newProviderController(
+		"SecretsStoreProviderController",
+		operatorNamespace,
+		operatorClient,
+		kubeClient,
+		kubeInformersForNamespaces,
+		eventRecorder,
+	)
+
+	rotationSafetyController := newRotationSafetyController(
+		"SecretsStoreRotationSafetyController",
+		operatorNamespace,
+		providerName,
+		operatorClient,
+		clusterCSIDriverLister,
+		kubeInformersForNamespaces,
+		spcInformers.ForResource(secretProviderClassGVR),
+		spcInformers.ForResource(secretProviderClassPodStatusGVR),
+		eventRecorder,
+	)
+
+	csiDriverDriftController := newCSIDriverDriftController(
+		"SecretsStoreCSIDriverDriftController",
+		operatorNamespace,
+		providerName,
+		operatorClient,
+		kubeClient,
+		withSecretsStoreCSIDriverAsset(
+			replaceNamespaceFunc(operatorNamespace),
 			clusterCSIDriverLister,
+			csiDriverInformer.Lister(),
 			providerName,
 		),
+		kubeInformersForNamespaces,
+		eventRecorder,
+	)
+
+	tokenRequestsController := newTokenRequestsController(
+		"SecretsStoreTokenRequestsController",
+		operatorNamespace,
+		providerName,
+		operatorClient,
+		clusterCSIDriverLister,
+		configInformers.Config().V1().Authentications(),
+		kubeInformersForNamespaces,
+		eventRecorder,
+	)
+
+	debugWindowController := newDebugWindowController(
+		"SecretsStoreDebugWindowController",
+		operatorNamespace,
+		operatorClient,
+		kubeClient,
+		kubeInformersForNamespaces,
+		clients.clock,
+		eventRecorder,
+	)
+
+	trustedCABundleController := newTrustedCABundleController(
+		"SecretsStoreTrustedCABundleController",
+		operatorNamespace,
+		operatorClient,
+		kubeClient,
+		kubeInformersForNamespaces,
+		eventRecorder,
+	)
+
+	// Events about SecretProviderClasses are recorded in their namespaces
+	// rather than against the operator Deployment.
+	eventBroadcaster := record.NewBroadcaster(record.WithContext(ctx))
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	defer eventBroadcaster.Shutdown()
+
+	spcValidationController := newSecretProviderClassValidationController(
+		"SecretProviderClassValidationController",
+		operatorNamespace,
+		operatorClient,
+		spcInformers.ForResource(secretProviderClassGVR),
+		kubeInformersForNamespaces,
+		eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: operatorName}),
+		eventRecorder,
+	)
+
+	// Kubelet reports failed mounts only as Pod events. Watch just those,
+	// see failedMountEventFieldSelector.
+	failedMountEventInformers := informers.NewSharedInformerFactoryWithOptions(kubeClient, resync,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = failedMountEventFieldSelector
+		}),
+	)
+
+	mountHealthController := newMountHealthController(
+		"SecretsStoreMountHealthController",
+		operatorClient,
+		spcInformers.ForResource(secretProviderClassGVR),
+		spcInformers.ForResource(secretProviderClassPodStatusGVR),
+		failedMountEventInformers.Core().V1().Events(),
+		clients.clock,
+		eventRecorder,
+	)
+
+	tlsComplianceController := newTLSComplianceController(
+		"SecretsStoreTLSComplianceController",
+		operatorNamespace,
+		operatorClient,
+		kubeInformersForNamespaces.InformersFor(operatorNamespace).Apps().V1().DaemonSets(),
+		servingConfig,
+		complianceAudit,
+		clients.clock,
+		eventRecorder,
 	)
 
 	klog.Info("Starting the informers")
 	go kubeInformersForNamespaces.Start(ctx.Done())
-	go dynamicInformers.Start(ctx.Done())
+	go clients.operatorInformers.Start(ctx.Done())
 	go configInformers.Start(ctx.Done())
+	go spcInformers.Start(ctx.Done())
+	go failedMountEventInformers.Start(ctx.Done())
+	go secretSyncBindingInformers.Start(ctx.Done())
 
 	klog.Info("Starting controllerset")
 	go csiControllerSet.Run(ctx, 1)
+	go monitoringController.Run(ctx, 1)
+	go providerController.Run(ctx, 1)
+	go secretSyncController.Run(ctx, 1)
+	go spcValidationController.Run(ctx, 1)
+	go mountHealthController.Run(ctx, 1)
+	go rotationSafetyController.Run(ctx, 1)
+	go csiDriverDriftController.Run(ctx, 1)
+	go tokenRequestsController.Run(ctx, 1)
+	go debugWindowController.Run(ctx, 1)
+	go trustedCABundleController.Run(ctx, 1)
+	go tlsComplianceController.Run(ctx, 1)
 
 	<-ctx.Done()
 
 	return nil
 }
 
+// staticResourceAssets are the driver's static resources, applied by the
+// SecretsStoreConditionalStaticResourcesController.
+var staticResourceAssets = []string{
+	"node_sa.yaml",
+	csidriverAssetName,
+	"cabundle_cm.yaml",
+	"node_metrics_service.yaml",
+	"rbac/privileged_role.yaml",
+	"rbac/node_privileged_binding.yaml",
+	"rbac/secretproviderclasses_role.yaml",
+	"rbac/secretproviderclasses_binding.yaml",
+	"rbac/kube_rbac_proxy_role.yaml",
+	"rbac/node_kube_rbac_proxy_binding.yaml",
+	"rbac/prometheus_role.yaml",
+	"rbac/prometheus_rolebinding.yaml",
+	"network-policy/allow-ingress-to-metrics-operand.yaml",
+}
+
+// newDaemonSetHooks returns the DaemonSetHookFuncs applied to node.yaml, in
+// order.
+func newDaemonSetHooks(
+	operatorNamespace string,
+	clusterCSIDriverLister operatorv1listers.ClusterCSIDriverLister,
+	configMapInformer corev1informers.ConfigMapInformer,
+	spcInformer informers.GenericInformer,
+	spcPodStatusInformer informers.GenericInformer,
+	daemonSetLister appsv1listers.DaemonSetLister,
+	nodeInformer corev1informers.NodeInformer,
+	currentTLSProfile func() sscsitls.ResolvedProfile,
+) []csidrivernodeservicecontroller.DaemonSetHookFunc {
+	return []csidrivernodeservicecontroller.DaemonSetHookFunc{
+		withDaemonSetHookMetrics("ca-bundle", withTrustedCABundleDaemonSetHook(
+			operatorNamespace,
+			configMapInformer,
+		)),
+		withDaemonSetHookMetrics("secret-rotation", withSecretRotationDaemonSetHook(
+			clusterCSIDriverLister,
+			providerName,
+		)),
+		// Must run after the secret-rotation hook, see withRotationPolicyDaemonSetHook.
+		withDaemonSetHookMetrics("rotation-policy", withCacheSyncDaemonSetHook(withRotationPolicyDaemonSetHook(
+			clusterCSIDriverLister,
+			providerName,
+			configMapInformer.Lister(),
+			spcInformer.Lister(),
+			operatorNamespace,
+		), spcInformer.Informer())),
+		// Must run after all hooks setting the rotation interval.
+		withDaemonSetHookMetrics("rotation-safety", withCacheSyncDaemonSetHook(withRotationSafetyDaemonSetHook(
+			configMapInformer.Lister(),
+			spcPodStatusInformer.Lister(),
+			daemonSetLister,
+			operatorNamespace,
+		), spcPodStatusInformer.Informer())),
+		withDaemonSetHookMetrics("provider-health-check", withProviderHealthCheckDaemonSetHook(
+			configMapInformer.Lister(),
+			operatorNamespace,
+		)),
+		withDaemonSetHookMetrics("node-placement", withCacheSyncDaemonSetHook(withNodePlacementDaemonSetHook(
+			configMapInformer.Lister(),
+			nodeInformer.Lister(),
+			operatorNamespace,
+		), nodeInformer.Informer())),
+		// Must run after the node-placement hook, see withDebugWindowDaemonSetHook.
+		withDaemonSetHookMetrics("debug-window", withDebugWindowDaemonSetHook(
+			daemonSetLister,
+			operatorNamespace,
+		)),
+		withDaemonSetHookMetrics("driver-log-levels", withDriverLogLevelsDaemonSetHook(
+			configMapInformer.Lister(),
+			operatorNamespace,
+		)),
+		withDaemonSetHookMetrics("resources", withCacheSyncDaemonSetHook(withResourcesDaemonSetHook(
+			configMapInformer.Lister(),
+			spcPodStatusInformer.Lister(),
+			operatorNamespace,
+		), spcPodStatusInformer.Informer())),
+		withDaemonSetHookMetrics("tls-profile", withTLSProfileDaemonSetHook(currentTLSProfile)),
+	}
+}
+
+// withCacheSyncDaemonSetHook wraps hook so that it fails until all of
+// informers have synced. Hooks reading SecretProviderClasses, their pod
+// statuses or nodes would otherwise take an empty cache for an empty cluster
+// after a restart, and roll out a DaemonSet that the next sync reverts.
+func withCacheSyncDaemonSetHook(hook csidrivernodeservicecontroller.DaemonSetHookFunc, informers ...cache.SharedIndexInformer) csidrivernodeservicecontroller.DaemonSetHookFunc {
+	return func(opSpec *opv1.OperatorSpec, daemonSet *appsv1.DaemonSet) error {
+		for _, informer := range informers {
+			if !informer.HasSynced() {
+				return fmt.Errorf("waiting for the informer caches to sync")
+			}
+		}
+		return hook(opSpec, daemonSet)
+	}
+}
+
 func replaceNamespaceFunc(namespace string) resourceapply.AssetFunc {
 	return func(name string) ([]byte, error) {
 		content, err := assets.ReadFile(name)
@@ -1,11 +1,23 @@
 package operator
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
+	"time"
 
+	configv1 "github.com/openshift/api/config/v1"
 	opv1 "github.com/openshift/api/operator/v1"
 	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+
+	sscsitls "github.com/openshift/secrets-store-csi-driver-operator/pkg/tls"
 )
 
 type FakeOperator struct {
@@ -70,3 +82,236 @@ func TestGetOperatorSyncState(t *testing.T) {
 		})
 	}
 }
+
+// fakeSyncedInformer is a SharedIndexInformer that only reports whether it
+// has synced.
+type fakeSyncedInformer struct {
+	cache.SharedIndexInformer
+	synced bool
+}
+
+func (i fakeSyncedInformer) HasSynced() bool { return i.synced }
+
+func TestWithCacheSyncDaemonSetHook(t *testing.T) {
+	cases := []struct {
+		name          string
+		synced        []bool
+		expectCalled  bool
+		expectedError bool
+	}{
+		{
+			name:         "all caches synced",
+			synced:       []bool{true, true},
+			expectCalled: true,
+		},
+		{
+			name:          "a cache not synced yet",
+			synced:        []bool{true, false},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var informers []cache.SharedIndexInformer
+			for _, synced := range tc.synced {
+				informers = append(informers, fakeSyncedInformer{synced: synced})
+			}
+			called := false
+			hook := withCacheSyncDaemonSetHook(func(_ *opv1.OperatorSpec, _ *appsv1.DaemonSet) error {
+				called = true
+				return nil
+			}, informers...)
+
+			err := hook(&opv1.OperatorSpec{}, newTestDaemonSet())
+			if (err != nil) != tc.expectedError {
+				t.Fatalf("expected error %t, got %v", tc.expectedError, err)
+			}
+			if called != tc.expectCalled {
+				t.Errorf("expected the hook to be called %t, got %t", tc.expectCalled, called)
+			}
+		})
+	}
+}
+
+func TestRunOperatorSimulation(t *testing.T) {
+	strictIntermediate := sscsitls.ResolvedProfile{
+		Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+		Spec:      *configv1.TLSProfiles[configv1.TLSProfileIntermediateType],
+		Honor:     true,
+	}
+	strictModern := sscsitls.ResolvedProfile{
+		Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+		Spec:      *configv1.TLSProfiles[configv1.TLSProfileModernType],
+		Honor:     true,
+	}
+	audience := "sts.amazonaws.com"
+
+	wantRequiresRepublish := func(want bool) simulationCheck {
+		return wantCSIDriver(func(csiDriver *storagev1.CSIDriver) error {
+			if got := ptr.Deref(csiDriver.Spec.RequiresRepublish, false); got != want {
+				return fmt.Errorf("expected requiresRepublish %t, got %t", want, got)
+			}
+			return nil
+		})
+	}
+	wantTokenRequests := func(want []storagev1.TokenRequest) simulationCheck {
+		return wantCSIDriver(func(csiDriver *storagev1.CSIDriver) error {
+			if !reflect.DeepEqual(csiDriver.Spec.TokenRequests, want) {
+				return fmt.Errorf("expected tokenRequests %v, got %v", want, csiDriver.Spec.TokenRequests)
+			}
+			return nil
+		})
+	}
+
+	cases := []struct {
+		name         string
+		driverConfig opv1.SecretsStoreCSIDriverConfigSpec
+		kubeObjects  []runtime.Object
+		tlsProfile   sscsitls.ResolvedProfile
+		steps        []simulationStep
+	}{
+		{
+			name:       "secret rotation is disabled and customized",
+			tlsProfile: strictIntermediate,
+			steps: []simulationStep{
+				{
+					name: "defaults",
+					want: []simulationCheck{
+						wantContainerArgs(driverDaemonSetName, csiDriverContainerName, "--enable-secret-rotation=true", "--rotation-poll-interval=2m"),
+						wantRequiresRepublish(true),
+					},
+				},
+				{
+					name: "rotation disabled",
+					do: func(t *testing.T, s *simulation) {
+						s.updateClusterCSIDriver(t, func(driver *opv1.ClusterCSIDriver) {
+							driver.Spec.DriverConfig.SecretsStore.SecretRotation = opv1.SecretsStoreSecretRotation{Type: opv1.SecretRotationNone}
+						})
+					},
+					want: []simulationCheck{
+						wantContainerArgs(driverDaemonSetName, csiDriverContainerName, "--enable-secret-rotation=false"),
+						wantRequiresRepublish(false),
+					},
+				},
+				{
+					name: "custom rotation interval",
+					do: func(t *testing.T, s *simulation) {
+						s.updateClusterCSIDriver(t, func(driver *opv1.ClusterCSIDriver) {
+							driver.Spec.DriverConfig.SecretsStore.SecretRotation = opv1.SecretsStoreSecretRotation{
+								Type:   opv1.SecretRotationCustom,
+								Custom: opv1.CustomSecretRotation{MinimumRefreshAge: 600},
+							}
+						})
+					},
+					want: []simulationCheck{
+						wantContainerArgs(driverDaemonSetName, csiDriverContainerName, "--enable-secret-rotation=true", "--rotation-poll-interval=10m"),
+						wantRequiresRepublish(true),
+					},
+				},
+			},
+		},
+		{
+			name:       "managed tokenRequests are set and cleared",
+			tlsProfile: strictIntermediate,
+			steps: []simulationStep{
+				{
+					name: "managed audience",
+					do: func(t *testing.T, s *simulation) {
+						s.updateClusterCSIDriver(t, func(driver *opv1.ClusterCSIDriver) {
+							driver.Spec.DriverConfig.SecretsStore.TokenRequests = opv1.SecretsStoreTokenRequests{
+								Type: opv1.TokenRequestsManaged,
+								Managed: opv1.ManagedTokenRequests{
+									Audiences: &[]opv1.SecretsStoreTokenRequest{{Audience: &audience, ExpirationSeconds: 3600}},
+								},
+							}
+						})
+					},
+					want: []simulationCheck{
+						wantTokenRequests([]storagev1.TokenRequest{{Audience: audience, ExpirationSeconds: ptr.To(int64(3600))}}),
+						wantCondition(tokenRequestsWarningCondition, opv1.ConditionFalse, "AsExpected"),
+					},
+				},
+				{
+					name: "managed without audiences",
+					do: func(t *testing.T, s *simulation) {
+						s.updateClusterCSIDriver(t, func(driver *opv1.ClusterCSIDriver) {
+							driver.Spec.DriverConfig.SecretsStore.TokenRequests.Managed.Audiences = &[]opv1.SecretsStoreTokenRequest{}
+						})
+					},
+					want: []simulationCheck{
+						wantTokenRequests(nil),
+					},
+				},
+			},
+		},
+		{
+			name:       "TLS profile change is rolled out to the driver metrics",
+			tlsProfile: strictIntermediate,
+			steps: []simulationStep{
+				{
+					name: "intermediate",
+					want: []simulationCheck{
+						wantContainerArgs(driverDaemonSetName, csiDriverKubeRBACProxyContainerName, tlsMinVersionArgPrefix+"VersionTLS12"),
+						wantCondition(tlsComplianceDegradedCondition, opv1.ConditionFalse, "AsExpected"),
+					},
+				},
+				{
+					name: "modern",
+					do: func(t *testing.T, s *simulation) {
+						s.setTLSProfile(t, strictModern)
+					},
+					want: []simulationCheck{
+						wantContainerArgs(driverDaemonSetName, csiDriverKubeRBACProxyContainerName, tlsMinVersionArgPrefix+"VersionTLS13"),
+						wantCondition(tlsComplianceDegradedCondition, opv1.ConditionFalse, "AsExpected"),
+					},
+				},
+			},
+		},
+		{
+			name: "debug window expires",
+			kubeObjects: []runtime.Object{
+				&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}},
+			},
+			tlsProfile: strictIntermediate,
+			steps: []simulationStep{
+				{
+					name: "open",
+					do: func(t *testing.T, s *simulation) {
+						s.applyOperatorConfig(t, testDebugWindowConfig)
+					},
+					want: []simulationCheck{
+						wantCondition(driverDebugWindowCondition, opv1.ConditionTrue, "DebugWindowActive"),
+					},
+				},
+				{
+					name: "half of the TTL later",
+					do: func(t *testing.T, s *simulation) {
+						s.advance(t, 30*time.Minute)
+					},
+					want: []simulationCheck{
+						wantCondition(driverDebugWindowCondition, opv1.ConditionTrue, "DebugWindowActive"),
+					},
+				},
+				{
+					name: "past the TTL",
+					do: func(t *testing.T, s *simulation) {
+						s.advance(t, 31*time.Minute)
+					},
+					want: []simulationCheck{
+						wantCondition(driverDebugWindowCondition, opv1.ConditionFalse, "DebugWindowExpired"),
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clusterCSIDriver := secretsStoreDriverConfig(tc.driverConfig)
+			clusterCSIDriver.Spec.ManagementState = opv1.Managed
+			s := newSimulation(t, clusterCSIDriver, tc.kubeObjects, nil, tc.tlsProfile)
+			s.run(t, tc.steps)
+		})
+	}
+}
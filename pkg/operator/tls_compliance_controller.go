@@ -0,0 +1,179 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	applyoperatorv1 "github.com/openshift/client-go/operator/applyconfigurations/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	appsv1informers "k8s.io/client-go/informers/apps/v1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/utils/clock"
+
+	sscsitls "github.com/openshift/secrets-store-csi-driver-operator/pkg/tls"
+)
+
+const (
+	// tlsComplianceDegradedCondition reports whether the TLS endpoints the
+	// operator configures serve the honored cluster TLS security profile.
+	tlsComplianceDegradedCondition = "SecretsStoreTLSComplianceDegraded"
+	// operatorMetricsEndpoint and driverMetricsEndpoint name the audited
+	// endpoints in the ComplianceReport.
+	operatorMetricsEndpoint = "operator-metrics"
+	driverMetricsEndpoint   = "driver-metrics"
+)
+
+// tlsComplianceController audits the TLS settings of the operator's metrics
+// server and of the kube-rbac-proxy serving the driver metrics against the
+// cluster TLS security profile. It publishes the report to audit, which
+// the operator's metrics server serves at sscsitls.ComplianceAuditPath, and
+// sums it up in the SecretsStoreTLSComplianceDegraded condition of the
+// ClusterCSIDriver.
+//
+// The operator metrics endpoint is audited by handshaking with the server of
+// this replica, see sscsitls.ProbeTLSSettings. The driver metrics endpoint is
+// audited from the args of the live driver DaemonSet, the pods may still be
+// rolling out. Like the other controllers, it runs in the leader replica
+// only: the metrics servers of standby replicas serve 503 at
+// sscsitls.ComplianceAuditPath.
+type tlsComplianceController struct {
+	name              string
+	operatorNamespace string
+	operatorClient    v1helpers.OperatorClientWithFinalizers
+	daemonSetLister   appsv1listers.DaemonSetLister
+	servingConfig     *sscsitls.DynamicServingConfig
+	audit             *sscsitls.ComplianceAudit
+	clock             clock.PassiveClock
+	// probeOperatorMetrics returns the minimum TLS version and the cipher
+	// suites the operator metrics endpoint negotiates.
+	probeOperatorMetrics func(ctx context.Context) (minTLSVersion string, cipherSuites []string, err error)
+}
+
+func newTLSComplianceController(
+	name string,
+	operatorNamespace string,
+	operatorClient v1helpers.OperatorClientWithFinalizers,
+	daemonSetInformer appsv1informers.DaemonSetInformer,
+	servingConfig *sscsitls.DynamicServingConfig,
+	audit *sscsitls.ComplianceAudit,
+	clock clock.PassiveClock,
+	recorder events.Recorder,
+) factory.Controller {
+	c := &tlsComplianceController{
+		name:              name,
+		operatorNamespace: operatorNamespace,
+		operatorClient:    operatorClient,
+		daemonSetLister:   daemonSetInformer.Lister(),
+		servingConfig:     servingConfig,
+		audit:             audit,
+		clock:             clock,
+	}
+	c.probeOperatorMetrics = c.probeServingConfig
+	// The profile is not watched, the servingConfig is updated in place by
+	// the SecurityProfileWatcher: the resync picks its changes up.
+	return factory.New().WithInformers(
+		operatorClient.Informer(),
+		daemonSetInformer.Informer(),
+	).WithSync(
+		c.sync,
+	).ResyncEvery(
+		time.Minute,
+	).WithSyncDegradedOnError(
+		operatorClient,
+	).ToController(
+		name,
+		recorder.WithComponentSuffix("secrets-store-tls-compliance-controller"),
+	)
+}
+
+func (c *tlsComplianceController) sync(ctx context.Context, syncContext factory.SyncContext) error {
+	if getOperatorSyncState(c.operatorClient) != opv1.Managed {
+		return nil
+	}
+
+	report := sscsitls.NewComplianceReport(c.servingConfig.Current(), c.clock.Now())
+	minTLSVersion, cipherSuites, err := c.probeOperatorMetrics(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to probe the TLS settings of the operator metrics endpoint: %w", err)
+	}
+	report.AddProbedEndpoint(operatorMetricsEndpoint, minTLSVersion, cipherSuites)
+
+	daemonSet, err := c.daemonSetLister.DaemonSets(c.operatorNamespace).Get(driverDaemonSetName)
+	switch {
+	case apierrors.IsNotFound(err):
+		// Not created yet, there is no endpoint to audit.
+	case err != nil:
+		return err
+	default:
+		container, err := findContainer(daemonSet, csiDriverKubeRBACProxyContainerName)
+		if err != nil {
+			return err
+		}
+		minTLSVersion, cipherSuites := getKubeRBACProxyTLSSettings(container.Args)
+		report.AddEndpoint(driverMetricsEndpoint, minTLSVersion, cipherSuites)
+	}
+
+	c.audit.Set(report)
+	return c.operatorClient.ApplyOperatorStatus(ctx, c.name, applyoperatorv1.OperatorStatus().WithConditions(tlsComplianceCondition(report)))
+}
+
+// probeServingConfig handshakes with the metrics server serving
+// c.servingConfig in this replica.
+func (c *tlsComplianceController) probeServingConfig(ctx context.Context) (string, []string, error) {
+	address := c.servingConfig.Address()
+	if address == "" {
+		return "", nil, fmt.Errorf("the metrics server does not listen yet")
+	}
+	address, err := sscsitls.LoopbackAddress(address)
+	if err != nil {
+		return "", nil, err
+	}
+	return sscsitls.ProbeTLSSettings(ctx, address)
+}
+
+// getKubeRBACProxyTLSSettings returns the minimum TLS version and the cipher
+// suites kube-rbac-proxy serves with according to args.
+func getKubeRBACProxyTLSSettings(args []string) (minTLSVersion string, cipherSuites []string) {
+	// The default of kube-rbac-proxy.
+	minTLSVersion = "VersionTLS12"
+	if value, ok := getArg(args, tlsMinVersionArgPrefix); ok {
+		minTLSVersion = value
+	}
+	if value, ok := getArg(args, tlsCipherSuitesArgPrefix); ok && value != "" {
+		cipherSuites = strings.Split(value, ",")
+	}
+	return minTLSVersion, cipherSuites
+}
+
+// tlsComplianceCondition sums report up. Ciphers dropped because Go's
+// crypto/tls does not support them are reported without degrading.
+func tlsComplianceCondition(report *sscsitls.ComplianceReport) *applyoperatorv1.OperatorConditionApplyConfiguration {
+	condition := applyoperatorv1.OperatorCondition().
+		WithType(tlsComplianceDegradedCondition).
+		WithStatus(opv1.ConditionFalse).
+		WithReason("AsExpected")
+	if !report.Honored {
+		return condition.
+			WithReason("ProfileNotHonored").
+			WithMessage(fmt.Sprintf("TLS adherence policy %q does not require the cluster TLS profile", report.Adherence))
+	}
+
+	message := fmt.Sprintf("%d of %d endpoints serve the cluster TLS profile", len(report.Endpoints)-len(report.NonCompliantEndpoints()), len(report.Endpoints))
+	if len(report.DroppedCiphers) > 0 {
+		message += fmt.Sprintf("; %d of %d ciphers unsupported by Go's crypto/tls were dropped: %s",
+			len(report.DroppedCiphers), len(report.RequestedCiphers), strings.Join(report.DroppedCiphers, ", "))
+	}
+	if nonCompliant := report.NonCompliantEndpoints(); len(nonCompliant) > 0 {
+		return condition.
+			WithStatus(opv1.ConditionTrue).
+			WithReason("EndpointsNotCompliant").
+			WithMessage(fmt.Sprintf("%s; not compliant: %s", message, strings.Join(nonCompliant, ", ")))
+	}
+	return condition.WithMessage(message)
+}
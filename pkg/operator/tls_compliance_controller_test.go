@@ -0,0 +1,231 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	configv1 "github.com/openshift/api/config/v1"
+	opv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
+
+	sscsitls "github.com/openshift/secrets-store-csi-driver-operator/pkg/tls"
+)
+
+func TestTLSComplianceControllerSync(t *testing.T) {
+	strictIntermediate := sscsitls.ResolvedProfile{
+		Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+		Spec:      *configv1.TLSProfiles[configv1.TLSProfileIntermediateType],
+		Honor:     true,
+	}
+	strictCustom := sscsitls.ResolvedProfile{
+		Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+		Spec: configv1.TLSProfileSpec{
+			Ciphers:       []string{"ECDHE-RSA-AES128-GCM-SHA256", "DHE-RSA-AES128-GCM-SHA256"},
+			MinTLSVersion: configv1.VersionTLS12,
+		},
+		Honor: true,
+	}
+	legacyModern := sscsitls.ResolvedProfile{
+		Adherence: configv1.TLSAdherencePolicyLegacyAdheringComponentsOnly,
+		Spec:      *configv1.TLSProfiles[configv1.TLSProfileModernType],
+	}
+
+	// newDaemonSet returns the driver DaemonSet with the kube-rbac-proxy
+	// configured for profile by the tls-profile hook.
+	newDaemonSet := func(t *testing.T, profile sscsitls.ResolvedProfile) *appsv1.DaemonSet {
+		daemonSet := newTestDaemonSet()
+		daemonSet.Spec.Template.Spec.Containers = []corev1.Container{
+			{Name: csiDriverKubeRBACProxyContainerName, Args: []string{"--secure-listen-address=0.0.0.0:9095"}},
+		}
+		hook := withTLSProfileDaemonSetHook(func() sscsitls.ResolvedProfile { return profile })
+		if err := hook(&opv1.OperatorSpec{}, daemonSet); err != nil {
+			t.Fatal(err)
+		}
+		return daemonSet
+	}
+
+	cases := []struct {
+		name      string
+		profile   sscsitls.ResolvedProfile
+		daemonSet func(t *testing.T) *appsv1.DaemonSet
+		// probe replaces the handshakes with the operator metrics
+		// endpoint, it negotiates the served settings when nil.
+		probe           func(ctx context.Context) (string, []string, error)
+		wantErr         bool
+		wantEndpoints   map[string]bool
+		wantDropped     []string
+		wantStatus      opv1.ConditionStatus
+		wantReason      string
+		wantMsgContains string
+	}{
+		{
+			name:            "all endpoints comply",
+			profile:         strictIntermediate,
+			daemonSet:       func(t *testing.T) *appsv1.DaemonSet { return newDaemonSet(t, strictIntermediate) },
+			wantEndpoints:   map[string]bool{operatorMetricsEndpoint: true, driverMetricsEndpoint: true},
+			wantStatus:      opv1.ConditionFalse,
+			wantReason:      "AsExpected",
+			wantMsgContains: "2 of 2 endpoints serve the cluster TLS profile",
+		},
+		{
+			name:            "no DaemonSet yet audits the operator only",
+			profile:         strictIntermediate,
+			wantEndpoints:   map[string]bool{operatorMetricsEndpoint: true},
+			wantStatus:      opv1.ConditionFalse,
+			wantReason:      "AsExpected",
+			wantMsgContains: "1 of 1 endpoints serve the cluster TLS profile",
+		},
+		{
+			name:            "dropped ciphers are reported without degrading",
+			profile:         strictCustom,
+			daemonSet:       func(t *testing.T) *appsv1.DaemonSet { return newDaemonSet(t, strictCustom) },
+			wantEndpoints:   map[string]bool{operatorMetricsEndpoint: true, driverMetricsEndpoint: true},
+			wantDropped:     []string{"DHE-RSA-AES128-GCM-SHA256"},
+			wantStatus:      opv1.ConditionFalse,
+			wantReason:      "AsExpected",
+			wantMsgContains: "1 of 2 ciphers unsupported by Go's crypto/tls were dropped: DHE-RSA-AES128-GCM-SHA256",
+		},
+		{
+			name:    "driver metrics not rolled out with the profile degrade",
+			profile: strictIntermediate,
+			daemonSet: func(t *testing.T) *appsv1.DaemonSet {
+				return newDaemonSet(t, legacyModern)
+			},
+			wantEndpoints:   map[string]bool{operatorMetricsEndpoint: true, driverMetricsEndpoint: false},
+			wantStatus:      opv1.ConditionTrue,
+			wantReason:      "EndpointsNotCompliant",
+			wantMsgContains: "not compliant: driver-metrics",
+		},
+		{
+			name:    "operator metrics negotiating ciphers outside the profile degrade",
+			profile: strictIntermediate,
+			probe: func(ctx context.Context) (string, []string, error) {
+				return "VersionTLS12", []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_RSA_WITH_AES_128_CBC_SHA", "TLS_AES_128_GCM_SHA256"}, nil
+			},
+			daemonSet:       func(t *testing.T) *appsv1.DaemonSet { return newDaemonSet(t, strictIntermediate) },
+			wantEndpoints:   map[string]bool{operatorMetricsEndpoint: false, driverMetricsEndpoint: true},
+			wantStatus:      opv1.ConditionTrue,
+			wantReason:      "EndpointsNotCompliant",
+			wantMsgContains: "not compliant: operator-metrics",
+		},
+		{
+			name:    "failed probe is an error",
+			profile: strictIntermediate,
+			probe: func(ctx context.Context) (string, []string, error) {
+				return "", nil, errors.New("connection refused")
+			},
+			wantErr: true,
+		},
+		{
+			name:            "profile not honored",
+			profile:         legacyModern,
+			daemonSet:       func(t *testing.T) *appsv1.DaemonSet { return newDaemonSet(t, legacyModern) },
+			wantEndpoints:   map[string]bool{operatorMetricsEndpoint: true, driverMetricsEndpoint: true},
+			wantStatus:      opv1.ConditionFalse,
+			wantReason:      "ProfileNotHonored",
+			wantMsgContains: `TLS adherence policy "LegacyAdheringComponentsOnly" does not require the cluster TLS profile`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			daemonSetIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			if tc.daemonSet != nil {
+				if err := daemonSetIndexer.Add(tc.daemonSet(t)); err != nil {
+					t.Fatalf("failed to add DaemonSet to indexer: %v", err)
+				}
+			}
+			servingConfig, err := sscsitls.NewDynamicServingConfig(tc.profile, configv1.HTTPServingInfo{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			probe := tc.probe
+			if probe == nil {
+				probe = func(ctx context.Context) (string, []string, error) {
+					if minTLSVersion, cipherSuites, ok := servingConfig.ServedSettings(); ok {
+						return minTLSVersion, cipherSuites, nil
+					}
+					// The defaults of the server.
+					return "VersionTLS12", nil, nil
+				}
+			}
+			operatorClient := v1helpers.NewFakeOperatorClientWithObjectMeta(
+				&metav1.ObjectMeta{Name: providerName},
+				&opv1.OperatorSpec{ManagementState: opv1.Managed},
+				&opv1.OperatorStatus{},
+				nil,
+			)
+			c := &tlsComplianceController{
+				name:              "SecretsStoreTLSComplianceController",
+				operatorNamespace: testOperatorNamespace,
+				operatorClient:    operatorClient,
+				daemonSetLister:   appsv1listers.NewDaemonSetLister(daemonSetIndexer),
+				servingConfig:     servingConfig,
+				audit:             &sscsitls.ComplianceAudit{},
+				clock:             fakePassiveClock{now: testNow},
+
+				probeOperatorMetrics: probe,
+			}
+			syncContext := factory.NewSyncContext(c.name, events.NewInMemoryRecorder(c.name, clock.RealClock{}))
+
+			err = c.sync(context.Background(), syncContext)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if c.audit.Get() != nil {
+					t.Error("expected no compliance report")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			report := c.audit.Get()
+			if report == nil {
+				t.Fatal("expected a compliance report")
+			}
+			if !report.Time.Equal(testNow) {
+				t.Errorf("expected report time %v, got %v", testNow, report.Time)
+			}
+			gotEndpoints := map[string]bool{}
+			for _, endpoint := range report.Endpoints {
+				gotEndpoints[endpoint.Name] = endpoint.Compliant
+			}
+			if len(gotEndpoints) != len(tc.wantEndpoints) {
+				t.Errorf("expected endpoints %v, got %v", tc.wantEndpoints, gotEndpoints)
+			}
+			for name, compliant := range tc.wantEndpoints {
+				if got, ok := gotEndpoints[name]; !ok || got != compliant {
+					t.Errorf("expected endpoint %s compliant=%t, got %v", name, compliant, report.Endpoints)
+				}
+			}
+			if strings.Join(report.DroppedCiphers, ",") != strings.Join(tc.wantDropped, ",") {
+				t.Errorf("expected dropped ciphers %v, got %v", tc.wantDropped, report.DroppedCiphers)
+			}
+
+			_, status, _, _ := operatorClient.GetOperatorState()
+			condition := v1helpers.FindOperatorCondition(status.Conditions, tlsComplianceDegradedCondition)
+			if condition == nil {
+				t.Fatalf("expected condition %s to be set", tlsComplianceDegradedCondition)
+			}
+			if condition.Status != tc.wantStatus || condition.Reason != tc.wantReason {
+				t.Fatalf("expected condition %s/%s, got %s/%s: %s", tc.wantStatus, tc.wantReason, condition.Status, condition.Reason, condition.Message)
+			}
+			if !strings.Contains(condition.Message, tc.wantMsgContains) {
+				t.Fatalf("expected condition message to contain %q, got %q", tc.wantMsgContains, condition.Message)
+			}
+		})
+	}
+}
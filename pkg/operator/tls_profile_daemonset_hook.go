@@ -0,0 +1,58 @@
+package operator
+
+import (
+	"strings"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/csi/csidrivernodeservicecontroller"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/klog/v2"
+
+	sscsitls "github.com/openshift/secrets-store-csi-driver-operator/pkg/tls"
+)
+
+const (
+	// csiDriverKubeRBACProxyContainerName is the sidecar of the driver
+	// DaemonSet serving the driver metrics over TLS.
+	csiDriverKubeRBACProxyContainerName = "csi-driver-kube-rbac-proxy"
+	// tlsMinVersionArgPrefix and tlsCipherSuitesArgPrefix are the
+	// kube-rbac-proxy flag prefixes for its minimum TLS version and its
+	// comma-separated IANA cipher suites.
+	tlsMinVersionArgPrefix   = "--tls-min-version="
+	tlsCipherSuitesArgPrefix = "--tls-cipher-suites="
+)
+
+// withTLSProfileDaemonSetHook returns a DaemonSetHookFunc that sets the
+// tlsMinVersionArgPrefix and tlsCipherSuitesArgPrefix args of the
+// csi-driver-kube-rbac-proxy container from the cluster TLS security profile
+// returned by currentTLSProfile, when it is honored. Otherwise kube-rbac-proxy
+// keeps its own defaults.
+//
+// The driver serves its metrics over plain HTTP on 127.0.0.1 only, behind
+// kube-rbac-proxy. The healthz endpoints of the liveness probe and registrar
+// are plain HTTP probed by the kubelet and have no TLS settings.
+func withTLSProfileDaemonSetHook(currentTLSProfile func() sscsitls.ResolvedProfile) csidrivernodeservicecontroller.DaemonSetHookFunc {
+	return func(_ *opv1.OperatorSpec, daemonSet *appsv1.DaemonSet) error {
+		resolved := currentTLSProfile()
+		if !resolved.Honor {
+			return nil
+		}
+		cipherSuites, err := resolved.IANACipherSuites()
+		if err != nil {
+			return err
+		}
+		klog.V(4).Infof("resolved TLS settings for DaemonSet %s/%s: minTLSVersion=%s cipherSuites=%v",
+			daemonSet.Namespace, daemonSet.Name, resolved.Spec.MinTLSVersion, cipherSuites)
+
+		container, err := findContainer(daemonSet, csiDriverKubeRBACProxyContainerName)
+		if err != nil {
+			return err
+		}
+		container.Args = setArg(container.Args, tlsMinVersionArgPrefix, string(resolved.Spec.MinTLSVersion))
+		// A profile without ciphers leaves the kube-rbac-proxy defaults.
+		if len(cipherSuites) > 0 {
+			container.Args = setArg(container.Args, tlsCipherSuitesArgPrefix, strings.Join(cipherSuites, ","))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,97 @@
+package operator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	configv1 "github.com/openshift/api/config/v1"
+	opv1 "github.com/openshift/api/operator/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	sscsitls "github.com/openshift/secrets-store-csi-driver-operator/pkg/tls"
+)
+
+func TestWithTLSProfileDaemonSetHook(t *testing.T) {
+	baseArgs := []string{"--secure-listen-address=0.0.0.0:9095", "--upstream=http://127.0.0.1:8095/"}
+
+	cases := []struct {
+		name            string
+		resolved        sscsitls.ResolvedProfile
+		expectedArgs    []string
+		wantErrContains string
+	}{
+		{
+			name: "profile not honored keeps the kube-rbac-proxy defaults",
+			resolved: sscsitls.ResolvedProfile{
+				Adherence: configv1.TLSAdherencePolicyLegacyAdheringComponentsOnly,
+				Spec:      *configv1.TLSProfiles[configv1.TLSProfileModernType],
+			},
+			expectedArgs: baseArgs,
+		},
+		{
+			name: "honored profile sets the min TLS version and cipher suites",
+			resolved: sscsitls.ResolvedProfile{
+				Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+				Spec: configv1.TLSProfileSpec{
+					Ciphers:       []string{"ECDHE-RSA-AES128-GCM-SHA256", "ECDHE-ECDSA-AES256-GCM-SHA384"},
+					MinTLSVersion: configv1.VersionTLS12,
+				},
+				Honor: true,
+			},
+			expectedArgs: append(append([]string{}, baseArgs...),
+				"--tls-min-version=VersionTLS12",
+				"--tls-cipher-suites=TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+			),
+		},
+		{
+			name: "honored profile without ciphers sets the min TLS version only",
+			resolved: sscsitls.ResolvedProfile{
+				Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+				Spec:      configv1.TLSProfileSpec{MinTLSVersion: configv1.VersionTLS13},
+				Honor:     true,
+			},
+			expectedArgs: append(append([]string{}, baseArgs...), "--tls-min-version=VersionTLS13"),
+		},
+		{
+			name: "honored profile without a supported cipher is an error",
+			resolved: sscsitls.ResolvedProfile{
+				Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+				Spec: configv1.TLSProfileSpec{
+					Ciphers:       []string{"DHE-RSA-AES128-GCM-SHA256"},
+					MinTLSVersion: configv1.VersionTLS12,
+				},
+				Honor: true,
+			},
+			wantErrContains: "unsupported by Go's crypto/tls",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hook := withTLSProfileDaemonSetHook(func() sscsitls.ResolvedProfile { return tc.resolved })
+
+			daemonSet := newTestDaemonSet()
+			daemonSet.Spec.Template.Spec.Containers = []corev1.Container{
+				{Name: csiDriverContainerName, Args: []string{"--metrics-addr=127.0.0.1:8095"}},
+				{Name: csiDriverKubeRBACProxyContainerName, Args: append([]string{}, baseArgs...)},
+			}
+			err := hook(&opv1.OperatorSpec{}, daemonSet)
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErrContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error from hook: %v", err)
+			}
+			if args := daemonSet.Spec.Template.Spec.Containers[0].Args; !reflect.DeepEqual(args, []string{"--metrics-addr=127.0.0.1:8095"}) {
+				t.Errorf("expected args of %s to be unchanged, got %v", csiDriverContainerName, args)
+			}
+			if args := daemonSet.Spec.Template.Spec.Containers[1].Args; !reflect.DeepEqual(args, tc.expectedArgs) {
+				t.Errorf("expected args of %s to be %v, got %v", csiDriverKubeRBACProxyContainerName, tc.expectedArgs, args)
+			}
+		})
+	}
+}
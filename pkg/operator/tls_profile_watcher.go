@@ -0,0 +1,74 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	configclient "github.com/openshift/client-go/config/clientset/versioned"
+	configinformers "github.com/openshift/client-go/config/informers/externalversions"
+	libgoclient "github.com/openshift/library-go/pkg/config/client"
+	apiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	sscsitls "github.com/openshift/secrets-store-csi-driver-operator/pkg/tls"
+)
+
+// RunTLSProfileWatcher watches the cluster TLS security profile until ctx is
+// done and applies its changes to servingConfig in place. It runs in every
+// replica, outside of leader election, since every replica serves metrics.
+//
+// A profile that cannot be applied restarts the replica through a
+// sscsitls.RestartCoordinator: standby replicas restart first and the leader,
+// as reported by isLeader, hands over last. The restart is canceled when the
+// profile can be applied again before it happens.
+func RunTLSProfileWatcher(
+	ctx context.Context,
+	kubeConfigFile string,
+	servingConfig *sscsitls.DynamicServingConfig,
+	isLeader func() bool,
+) error {
+	restConfig, err := libgoclient.GetKubeConfigOrInClusterConfig(kubeConfigFile, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build kubeconfig: %w", err)
+	}
+	configClient, err := configclient.NewForConfig(rest.AddUserAgent(restConfig, operatorName))
+	if err != nil {
+		return fmt.Errorf("failed to create config client: %w", err)
+	}
+	configInformers := configinformers.NewSharedInformerFactory(configClient, resync)
+
+	restarts := sscsitls.NewRestartCoordinator(isLeader, func() {
+		// RequestShutdown follows the same SIGTERM path Controllercmd already
+		// wires (graceful unwind, releasing the leader lease); os.Exit(0) is
+		// only a fallback if the signal handler is missing.
+		klog.Info("TLS security profile could not be applied; requesting graceful operator restart")
+		if !apiserver.RequestShutdown() {
+			klog.Warning("failed to request a graceful shutdown, exiting directly")
+			os.Exit(0)
+		}
+	})
+
+	resolvedTLS := servingConfig.Current()
+	recordTLSProfile(resolvedTLS)
+	tlsWatcher := &sscsitls.SecurityProfileWatcher{
+		InitialTLSProfileSpec:     resolvedTLS.Spec,
+		InitialTLSAdherencePolicy: resolvedTLS.Adherence,
+		OnChange: func(resolved sscsitls.ResolvedProfile) error {
+			if err := servingConfig.Update(resolved); err != nil {
+				return err
+			}
+			recordTLSProfile(resolved)
+			return nil
+		},
+		OnFailure: func(error) { restarts.RequestRestart() },
+		OnRecover: restarts.Cancel,
+	}
+	if err := tlsWatcher.Start(configInformers.Config().V1().APIServers()); err != nil {
+		return fmt.Errorf("failed to start TLS security profile watcher: %w", err)
+	}
+
+	go configInformers.Start(ctx.Done())
+	return nil
+}
@@ -0,0 +1,217 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	configv1informers "github.com/openshift/client-go/config/informers/externalversions/config/v1"
+	configv1listers "github.com/openshift/client-go/config/listers/config/v1"
+	applyoperatorv1 "github.com/openshift/client-go/operator/applyconfigurations/operator/v1"
+	operatorv1listers "github.com/openshift/client-go/operator/listers/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	// tokenRequestsWarningCondition reports managed tokenRequests that are
+	// applied to the CSIDriver but are likely not what the providers need.
+	// It does not end with Degraded: the API server admitted them.
+	tokenRequestsWarningCondition = "SecretsStoreTokenRequestsWarning"
+
+	// authenticationName is the cluster Authentication config.
+	authenticationName = "cluster"
+	// defaultAPIServerAudience is the audience of the API server when the
+	// Authentication config sets no serviceAccountIssuer.
+	defaultAPIServerAudience = "https://kubernetes.default.svc"
+)
+
+// providerAudienceConvention is the audience a provider's cloud expects in
+// the service account tokens it exchanges.
+type providerAudienceConvention struct {
+	// description is shown when no requested audience matches.
+	description string
+	matches     func(audience string) bool
+}
+
+// knownProviderAudiences maps knownProviders to their audience conventions.
+// Vault has none: the audience is whatever its Kubernetes auth role says.
+var knownProviderAudiences = map[string]providerAudienceConvention{
+	"aws": {
+		description: `"sts.amazonaws.com"`,
+		matches:     func(audience string) bool { return audience == "sts.amazonaws.com" },
+	},
+	"azure": {
+		description: `"api://AzureADTokenExchange"`,
+		matches:     func(audience string) bool { return audience == "api://AzureADTokenExchange" },
+	},
+	"gcp": {
+		description: `a workload identity pool ("<project>.svc.id.goog" or "//iam.googleapis.com/...")`,
+		matches: func(audience string) bool {
+			return strings.HasSuffix(audience, ".svc.id.goog") || strings.HasPrefix(audience, "//iam.googleapis.com/")
+		},
+	},
+}
+
+// isManagedTokenRequests returns whether getEffectiveTokenRequests takes the
+// tokenRequests from driverConfig rather than from the live CSIDriver.
+func isManagedTokenRequests(driverConfig opv1.CSIDriverConfigSpec) bool {
+	tokenRequests := driverConfig.SecretsStore.TokenRequests
+	return driverConfig.DriverType == opv1.SecretsStoreDriverType &&
+		tokenRequests.Type == opv1.TokenRequestsManaged &&
+		tokenRequests.Managed.Audiences != nil
+}
+
+// getServiceAccountIssuer returns the serviceAccountIssuer of the cluster
+// Authentication config, or "" for the default issuer.
+func getServiceAccountIssuer(authenticationLister configv1listers.AuthenticationLister) (string, error) {
+	authentication, err := authenticationLister.Get(authenticationName)
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get Authentication %q: %w", authenticationName, err)
+	}
+	return authentication.Spec.ServiceAccountIssuer, nil
+}
+
+// checkTokenRequestAudiences returns the audiences of tokenRequests that
+// are the cluster API server's: empty, which stands for its default
+// audiences, https://kubernetes.default.svc or issuer. Their tokens let the
+// providers call the cluster API as the pod. They are not rejected: Vault's
+// Kubernetes auth, for one, is commonly set up to review such tokens.
+func checkTokenRequestAudiences(tokenRequests []storagev1.TokenRequest, issuer string) []string {
+	apiServerAudiences := sets.New(defaultAPIServerAudience)
+	if issuer != "" {
+		apiServerAudiences.Insert(issuer)
+	}
+
+	var warnings []string
+	for _, request := range tokenRequests {
+		switch {
+		case request.Audience == "":
+			warnings = append(warnings, "an empty audience requests tokens for the default audiences of the cluster API server")
+		case apiServerAudiences.Has(request.Audience):
+			warnings = append(warnings, fmt.Sprintf("audience %q is the cluster API server's", request.Audience))
+		}
+	}
+	return warnings
+}
+
+// checkTokenRequestConventions returns the deployed providers whose
+// audience convention no tokenRequest follows. These are not rejected: a
+// provider may be set up with a custom audience.
+func checkTokenRequestConventions(tokenRequests []storagev1.TokenRequest, providers []providerConfig) []string {
+	var warnings []string
+	for _, provider := range providers {
+		convention, ok := knownProviderAudiences[provider.Name]
+		if !ok {
+			continue
+		}
+		found := false
+		for _, request := range tokenRequests {
+			if convention.matches(request.Audience) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			warnings = append(warnings, fmt.Sprintf("provider %s usually needs audience %s, which is not requested", provider.Name, convention.description))
+		}
+	}
+	return warnings
+}
+
+// tokenRequestsController checks the managed tokenRequests of the
+// ClusterCSIDriver and reports what it finds in the
+// SecretsStoreTokenRequestsWarning condition. The tokenRequests are applied
+// to the CSIDriver either way.
+type tokenRequestsController struct {
+	name                   string
+	operatorNamespace      string
+	driverName             string
+	operatorClient         v1helpers.OperatorClientWithFinalizers
+	clusterCSIDriverLister operatorv1listers.ClusterCSIDriverLister
+	authenticationLister   configv1listers.AuthenticationLister
+	configMapLister        corev1listers.ConfigMapLister
+}
+
+func newTokenRequestsController(
+	name string,
+	operatorNamespace string,
+	driverName string,
+	operatorClient v1helpers.OperatorClientWithFinalizers,
+	clusterCSIDriverLister operatorv1listers.ClusterCSIDriverLister,
+	authenticationInformer configv1informers.AuthenticationInformer,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	recorder events.Recorder,
+) factory.Controller {
+	configMapInformer := kubeInformersForNamespaces.InformersFor(operatorNamespace).Core().V1().ConfigMaps()
+	c := &tokenRequestsController{
+		name:                   name,
+		operatorNamespace:      operatorNamespace,
+		driverName:             driverName,
+		operatorClient:         operatorClient,
+		clusterCSIDriverLister: clusterCSIDriverLister,
+		authenticationLister:   authenticationInformer.Lister(),
+		configMapLister:        configMapInformer.Lister(),
+	}
+	return factory.New().WithInformers(
+		operatorClient.Informer(),
+		authenticationInformer.Informer(),
+		configMapInformer.Informer(),
+	).WithSync(
+		c.sync,
+	).ResyncEvery(
+		time.Minute,
+	).WithSyncDegradedOnError(
+		operatorClient,
+	).ToController(
+		name,
+		recorder.WithComponentSuffix("secrets-store-token-requests-controller"),
+	)
+}
+
+func (c *tokenRequestsController) sync(ctx context.Context, syncContext factory.SyncContext) error {
+	if getOperatorSyncState(c.operatorClient) != opv1.Managed {
+		return nil
+	}
+
+	driverConfig, err := getClusterCSIDriverConfig(c.clusterCSIDriverLister, c.driverName)
+	if err != nil {
+		return err
+	}
+	condition := applyoperatorv1.OperatorCondition().
+		WithType(tokenRequestsWarningCondition).
+		WithStatus(opv1.ConditionFalse).
+		WithReason("AsExpected")
+	if !isManagedTokenRequests(driverConfig) {
+		condition = condition.WithMessage("tokenRequests are not managed by the operator")
+		return c.operatorClient.ApplyOperatorStatus(ctx, c.name, applyoperatorv1.OperatorStatus().WithConditions(condition))
+	}
+
+	config, err := getOperatorConfig(c.configMapLister, c.operatorNamespace)
+	if err != nil {
+		return err
+	}
+	issuer, err := getServiceAccountIssuer(c.authenticationLister)
+	if err != nil {
+		return err
+	}
+	tokenRequests := getEffectiveTokenRequests(driverConfig, nil)
+	warnings := append(checkTokenRequestAudiences(tokenRequests, issuer), checkTokenRequestConventions(tokenRequests, config.Providers)...)
+	if len(warnings) > 0 {
+		condition = condition.
+			WithStatus(opv1.ConditionTrue).
+			WithReason("UnexpectedAudiences").
+			WithMessage(strings.Join(warnings, "; "))
+	}
+	return c.operatorClient.ApplyOperatorStatus(ctx, c.name, applyoperatorv1.OperatorStatus().WithConditions(condition))
+}
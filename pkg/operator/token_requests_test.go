@@ -0,0 +1,206 @@
+package operator
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	configv1 "github.com/openshift/api/config/v1"
+	opv1 "github.com/openshift/api/operator/v1"
+	configv1listers "github.com/openshift/client-go/config/listers/config/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
+	"k8s.io/utils/ptr"
+)
+
+// newTestAuthenticationLister returns a lister holding the cluster
+// Authentication config with serviceAccountIssuer issuer.
+func newTestAuthenticationLister(t *testing.T, issuer string) configv1listers.AuthenticationLister {
+	t.Helper()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(&configv1.Authentication{
+		ObjectMeta: metav1.ObjectMeta{Name: authenticationName},
+		Spec:       configv1.AuthenticationSpec{ServiceAccountIssuer: issuer},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return configv1listers.NewAuthenticationLister(indexer)
+}
+
+// newTestManagedTokenRequestsDriver returns a ClusterCSIDriver managing
+// tokenRequests for audiences, each with expirationSeconds.
+func newTestManagedTokenRequestsDriver(expirationSeconds int32, audiences ...string) *opv1.ClusterCSIDriver {
+	requests := []opv1.SecretsStoreTokenRequest{}
+	for _, audience := range audiences {
+		requests = append(requests, opv1.SecretsStoreTokenRequest{Audience: ptr.To(audience), ExpirationSeconds: expirationSeconds})
+	}
+	return secretsStoreDriverConfig(opv1.SecretsStoreCSIDriverConfigSpec{
+		TokenRequests: opv1.SecretsStoreTokenRequests{
+			Type:    opv1.TokenRequestsManaged,
+			Managed: opv1.ManagedTokenRequests{Audiences: &requests},
+		},
+	})
+}
+
+func TestCheckTokenRequestAudiences(t *testing.T) {
+	cases := []struct {
+		name          string
+		tokenRequests []storagev1.TokenRequest
+		issuer        string
+		expected      []string
+	}{
+		{
+			name: "provider audiences",
+			tokenRequests: []storagev1.TokenRequest{
+				{Audience: "sts.amazonaws.com", ExpirationSeconds: ptr.To(int64(3600))},
+				{Audience: "vault"},
+			},
+		},
+		{
+			name:          "empty audience",
+			tokenRequests: []storagev1.TokenRequest{{Audience: ""}},
+			expected:      []string{"an empty audience requests tokens for the default audiences of the cluster API server"},
+		},
+		{
+			name:          "default API server audience",
+			tokenRequests: []storagev1.TokenRequest{{Audience: defaultAPIServerAudience}},
+			expected:      []string{`audience "https://kubernetes.default.svc" is the cluster API server's`},
+		},
+		{
+			name:          "custom issuer",
+			tokenRequests: []storagev1.TokenRequest{{Audience: "https://oidc.example.com"}},
+			issuer:        "https://oidc.example.com",
+			expected:      []string{`audience "https://oidc.example.com" is the cluster API server's`},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			warnings := checkTokenRequestAudiences(tc.tokenRequests, tc.issuer)
+			if !reflect.DeepEqual(warnings, tc.expected) {
+				t.Fatalf("expected %q, got %q", tc.expected, warnings)
+			}
+		})
+	}
+}
+
+func TestCheckTokenRequestConventions(t *testing.T) {
+	cases := []struct {
+		name          string
+		tokenRequests []storagev1.TokenRequest
+		providers     []providerConfig
+		expected      []string
+	}{
+		{
+			name:          "conventions followed",
+			tokenRequests: []storagev1.TokenRequest{{Audience: "sts.amazonaws.com"}, {Audience: "my-project.svc.id.goog"}},
+			providers:     []providerConfig{{Name: "aws"}, {Name: "gcp"}, {Name: "vault"}},
+		},
+		{
+			name:          "convention not followed",
+			tokenRequests: []storagev1.TokenRequest{{Audience: "vault"}},
+			providers:     []providerConfig{{Name: "azure"}},
+			expected:      []string{`provider azure usually needs audience "api://AzureADTokenExchange", which is not requested`},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			warnings := checkTokenRequestConventions(tc.tokenRequests, tc.providers)
+			if !reflect.DeepEqual(warnings, tc.expected) {
+				t.Fatalf("expected %q, got %q", tc.expected, warnings)
+			}
+		})
+	}
+}
+
+func TestTokenRequestsControllerSync(t *testing.T) {
+	cases := []struct {
+		name               string
+		driver             *opv1.ClusterCSIDriver
+		configMap          *corev1.ConfigMap
+		issuer             string
+		wantStatus         opv1.ConditionStatus
+		wantMessageContain string
+	}{
+		{
+			name:               "unmanaged",
+			wantStatus:         opv1.ConditionFalse,
+			wantMessageContain: "tokenRequests are not managed by the operator",
+		},
+		{
+			name:       "valid",
+			driver:     newTestManagedTokenRequestsDriver(3600, "sts.amazonaws.com"),
+			configMap:  newOperatorConfigMap("providers:\n- name: aws\n"),
+			wantStatus: opv1.ConditionFalse,
+		},
+		{
+			name:               "convention not followed is a warning",
+			driver:             newTestManagedTokenRequestsDriver(3600, "vault"),
+			configMap:          newOperatorConfigMap("providers:\n- name: aws\n"),
+			wantStatus:         opv1.ConditionTrue,
+			wantMessageContain: `provider aws usually needs audience "sts.amazonaws.com"`,
+		},
+		{
+			name:               "issuer audience is a warning",
+			driver:             newTestManagedTokenRequestsDriver(0, "https://oidc.example.com"),
+			issuer:             "https://oidc.example.com",
+			wantStatus:         opv1.ConditionTrue,
+			wantMessageContain: `audience "https://oidc.example.com" is the cluster API server's`,
+		},
+		{
+			name:               "empty audience is a warning",
+			driver:             newTestManagedTokenRequestsDriver(3600, ""),
+			wantStatus:         opv1.ConditionTrue,
+			wantMessageContain: "an empty audience requests tokens for the default audiences of the cluster API server",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			configMapLister := newTestConfigMapLister(t)
+			if tc.configMap != nil {
+				configMapLister = newTestConfigMapLister(t, tc.configMap)
+			}
+			operatorClient := v1helpers.NewFakeOperatorClientWithObjectMeta(
+				&metav1.ObjectMeta{Name: providerName},
+				&opv1.OperatorSpec{ManagementState: opv1.Managed},
+				&opv1.OperatorStatus{},
+				nil,
+			)
+			c := &tokenRequestsController{
+				name:                   "SecretsStoreTokenRequestsController",
+				operatorNamespace:      testOperatorNamespace,
+				driverName:             providerName,
+				operatorClient:         operatorClient,
+				clusterCSIDriverLister: newFakeClusterCSIDriverLister(t, tc.driver),
+				authenticationLister:   newTestAuthenticationLister(t, tc.issuer),
+				configMapLister:        configMapLister,
+			}
+			syncContext := factory.NewSyncContext(c.name, events.NewInMemoryRecorder(c.name, clock.RealClock{}))
+
+			if err := c.sync(context.Background(), syncContext); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_, status, _, _ := operatorClient.GetOperatorState()
+			condition := v1helpers.FindOperatorCondition(status.Conditions, tokenRequestsWarningCondition)
+			if condition == nil {
+				t.Fatalf("expected condition %s to be set", tokenRequestsWarningCondition)
+			}
+			if condition.Status != tc.wantStatus {
+				t.Fatalf("expected condition status %s, got %s: %s", tc.wantStatus, condition.Status, condition.Message)
+			}
+			if !strings.Contains(condition.Message, tc.wantMessageContain) {
+				t.Fatalf("expected condition message to contain %q, got %q", tc.wantMessageContain, condition.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	opv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/csi/csidrivernodeservicecontroller"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// mergedTrustedCAConfigMap holds the bundle of trustedCAConfigMap merged
+	// with the CAs of operatorConfig.AdditionalTrustedCAs. Unlike
+	// trustedCAConfigMap, whose data belongs to the network operator, it is
+	// written by the operator only.
+	mergedTrustedCAConfigMap = "secrets-store-csi-driver-merged-ca-bundle"
+	// caBundleKey is the key of the bundles of trustedCAConfigMap and
+	// mergedTrustedCAConfigMap, and the default key of the additional CA
+	// ConfigMaps.
+	caBundleKey = "ca-bundle.crt"
+	// trustedCABundleHashAnnotation is the hash of the merged bundle the pods
+	// of a DaemonSet mount. It changes, and the DaemonSet rolls out, only
+	// when the certificates of the bundle do.
+	trustedCABundleHashAnnotation = "operator.openshift.io/trusted-ca-bundle-hash"
+	// injectProxyCABundleAnnotation lists the containers of the driver
+	// DaemonSet the trusted CA bundle is mounted into, as read by
+	// csidrivernodeservicecontroller.WithCABundleDaemonSetHook.
+	injectProxyCABundleAnnotation = "config.openshift.io/inject-proxy-cabundle"
+	// providerContainerName is the container of the provider DaemonSets,
+	// see assets/providers/<name>/daemonset.yaml.
+	providerContainerName = "provider"
+)
+
+// validateAdditionalTrustedCAs returns an error if refs, the
+// operatorConfig.AdditionalTrustedCAs, name a ConfigMap twice, none at all,
+// or one the operator writes itself.
+func validateAdditionalTrustedCAs(refs []trustedCAConfigMapRef) error {
+	seen := sets.New[string]()
+	for i, ref := range refs {
+		switch ref.Name {
+		case "":
+			return fmt.Errorf("invalid additionalTrustedCAs[%d] in ConfigMap %s: name must not be empty", i, operatorConfigMapName)
+		case operatorConfigMapName, trustedCAConfigMap, mergedTrustedCAConfigMap:
+			return fmt.Errorf("invalid additionalTrustedCAs[%d] in ConfigMap %s: ConfigMap %s is managed by the operator", i, operatorConfigMapName, ref.Name)
+		}
+		key := ref.Name + "/" + getTrustedCAKey(ref)
+		if seen.Has(key) {
+			return fmt.Errorf("invalid additionalTrustedCAs[%d] in ConfigMap %s: key %q of ConfigMap %s is listed more than once", i, operatorConfigMapName, getTrustedCAKey(ref), ref.Name)
+		}
+		seen.Insert(key)
+	}
+	return nil
+}
+
+// getTrustedCAKey returns the key of ref holding its CAs.
+func getTrustedCAKey(ref trustedCAConfigMapRef) string {
+	if ref.Key == "" {
+		return caBundleKey
+	}
+	return ref.Key
+}
+
+// mergeCABundles returns the certificates of bundles, in order and without
+// duplicates, PEM-encoded the same way whatever the formatting of bundles,
+// so that the result changes only when the certificates do. sources names
+// bundles in errors.
+func mergeCABundles(sources []string, bundles [][]byte) ([]byte, error) {
+	var merged bytes.Buffer
+	seen := sets.New[string]()
+	for i, bundle := range bundles {
+		found := 0
+		for rest := bundle; ; {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				return nil, fmt.Errorf("%s holds a PEM block of type %q, only CERTIFICATE is allowed", sources[i], block.Type)
+			}
+			if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+				return nil, fmt.Errorf("%s holds an invalid certificate: %w", sources[i], err)
+			}
+			found++
+			if seen.Has(string(block.Bytes)) {
+				continue
+			}
+			seen.Insert(string(block.Bytes))
+			if err := pem.Encode(&merged, &pem.Block{Type: "CERTIFICATE", Bytes: block.Bytes}); err != nil {
+				return nil, err
+			}
+		}
+		if found == 0 {
+			return nil, fmt.Errorf("%s holds no PEM certificate", sources[i])
+		}
+	}
+	return merged.Bytes(), nil
+}
+
+// getMergedTrustedCABundle returns the bundle of trustedCAConfigMap
+// followed by the CAs of refs, see mergeCABundles. ok is false while the
+// network operator has not injected the cluster bundle yet: the merged
+// bundle replaces the system trust store of the pods mounting it and must
+// not lack the cluster's CAs.
+func getMergedTrustedCABundle(configMapLister corev1listers.ConfigMapLister, operatorNamespace string, refs []trustedCAConfigMapRef) (bundle []byte, ok bool, err error) {
+	clusterCA, err := configMapLister.ConfigMaps(operatorNamespace).Get(trustedCAConfigMap)
+	if apierrors.IsNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get ConfigMap %s/%s: %w", operatorNamespace, trustedCAConfigMap, err)
+	}
+	if clusterCA.Data[caBundleKey] == "" {
+		return nil, false, nil
+	}
+
+	sources := []string{fmt.Sprintf("key %q of ConfigMap %s", caBundleKey, trustedCAConfigMap)}
+	bundles := [][]byte{[]byte(clusterCA.Data[caBundleKey])}
+	for _, ref := range refs {
+		key := getTrustedCAKey(ref)
+		configMap, err := configMapLister.ConfigMaps(operatorNamespace).Get(ref.Name)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get additional trusted CA ConfigMap %s/%s: %w", operatorNamespace, ref.Name, err)
+		}
+		content, found := configMap.Data[key]
+		if !found {
+			return nil, false, fmt.Errorf("additional trusted CA ConfigMap %s/%s has no key %q", operatorNamespace, ref.Name, key)
+		}
+		sources = append(sources, fmt.Sprintf("key %q of ConfigMap %s", key, ref.Name))
+		bundles = append(bundles, []byte(content))
+	}
+	bundle, err = mergeCABundles(sources, bundles)
+	if err != nil {
+		return nil, false, err
+	}
+	return bundle, true, nil
+}
+
+// injectMergedTrustedCABundle mounts mergedTrustedCAConfigMap into the
+// containers of template called containerNames, and sets
+// trustedCABundleHashAnnotation, when operatorConfig.AdditionalTrustedCAs is
+// set and trustedCABundleController has written the merged bundle. It
+// returns whether it did.
+func injectMergedTrustedCABundle(configMapLister corev1listers.ConfigMapLister, operatorNamespace string, template *corev1.PodTemplateSpec, containerNames []string) (bool, error) {
+	config, err := getOperatorConfig(configMapLister, operatorNamespace)
+	if err != nil {
+		return false, err
+	}
+	if len(config.AdditionalTrustedCAs) == 0 {
+		return false, nil
+	}
+	merged, err := configMapLister.ConfigMaps(operatorNamespace).Get(mergedTrustedCAConfigMap)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get ConfigMap %s/%s: %w", operatorNamespace, mergedTrustedCAConfigMap, err)
+	}
+	bundle, ok := merged.Data[caBundleKey]
+	if !ok {
+		return false, nil
+	}
+
+	if err := injectCABundleConfigMap(template, mergedTrustedCAConfigMap, bundle, containerNames); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// injectTrustedCABundle mounts the merged bundle into the containers of
+// template called containerNames, see injectMergedTrustedCABundle, or else
+// the cluster bundle of trustedCAConfigMap, once the network operator has
+// injected it. This is what withTrustedCABundleDaemonSetHook does for the
+// driver, for the DaemonSets no hook runs on.
+func injectTrustedCABundle(configMapLister corev1listers.ConfigMapLister, operatorNamespace string, template *corev1.PodTemplateSpec, containerNames []string) error {
+	injected, err := injectMergedTrustedCABundle(configMapLister, operatorNamespace, template, containerNames)
+	if err != nil || injected {
+		return err
+	}
+	clusterCA, err := configMapLister.ConfigMaps(operatorNamespace).Get(trustedCAConfigMap)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get ConfigMap %s/%s: %w", operatorNamespace, trustedCAConfigMap, err)
+	}
+	bundle, ok := clusterCA.Data[caBundleKey]
+	if !ok {
+		return nil
+	}
+	return injectCABundleConfigMap(template, trustedCAConfigMap, bundle, containerNames)
+}
+
+// injectCABundleConfigMap mounts configMapName, holding bundle, into the
+// containers of template called containerNames, and sets
+// trustedCABundleHashAnnotation to the hash of bundle.
+func injectCABundleConfigMap(template *corev1.PodTemplateSpec, configMapName, bundle string, containerNames []string) error {
+	if err := v1helpers.InjectTrustedCAIntoContainers(&template.Spec, configMapName, containerNames); err != nil {
+		return err
+	}
+	hash := sha256.Sum256([]byte(bundle))
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[trustedCABundleHashAnnotation] = hex.EncodeToString(hash[:])
+	return nil
+}
+
+// withTrustedCABundleDaemonSetHook returns a DaemonSetHookFunc that mounts
+// the merged bundle of mergedTrustedCAConfigMap into the containers of the
+// driver DaemonSet listed in injectProxyCABundleAnnotation. Without
+// operatorConfig.AdditionalTrustedCAs, or until the merged bundle is
+// written, it mounts trustedCAConfigMap as
+// csidrivernodeservicecontroller.WithCABundleDaemonSetHook does.
+func withTrustedCABundleDaemonSetHook(operatorNamespace string, configMapInformer corev1informers.ConfigMapInformer) csidrivernodeservicecontroller.DaemonSetHookFunc {
+	clusterCABundleHook := csidrivernodeservicecontroller.WithCABundleDaemonSetHook(operatorNamespace, trustedCAConfigMap, configMapInformer)
+	return func(spec *opv1.OperatorSpec, daemonSet *appsv1.DaemonSet) error {
+		containerNames := strings.Split(daemonSet.Annotations[injectProxyCABundleAnnotation], ",")
+		injected, err := injectMergedTrustedCABundle(configMapInformer.Lister(), operatorNamespace, &daemonSet.Spec.Template, containerNames)
+		if err != nil {
+			return err
+		}
+		if injected {
+			return nil
+		}
+		return clusterCABundleHook(spec, daemonSet)
+	}
+}
+
+// trustedCABundleController writes mergedTrustedCAConfigMap, the cluster
+// trusted CA bundle of trustedCAConfigMap merged with the CAs of the
+// ConfigMaps listed in operatorConfig.AdditionalTrustedCAs, so that the
+// providers can reach secret backends serving certificates of a private CA.
+// It watches all of them. The merged ConfigMap, and the hash annotation of
+// the DaemonSets mounting it, change only when its certificates do: editing
+// the formatting, order or duplicates of a source bundle rolls nothing out.
+// It is deleted when no additional CA is configured and when the operator
+// is Removed.
+type trustedCABundleController struct {
+	name              string
+	operatorNamespace string
+	operatorClient    v1helpers.OperatorClientWithFinalizers
+	kubeClient        kubernetes.Interface
+	configMapLister   corev1listers.ConfigMapLister
+}
+
+func newTrustedCABundleController(
+	name string,
+	operatorNamespace string,
+	operatorClient v1helpers.OperatorClientWithFinalizers,
+	kubeClient kubernetes.Interface,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	recorder events.Recorder,
+) factory.Controller {
+	configMapInformer := kubeInformersForNamespaces.InformersFor(operatorNamespace).Core().V1().ConfigMaps()
+	c := &trustedCABundleController{
+		name:              name,
+		operatorNamespace: operatorNamespace,
+		operatorClient:    operatorClient,
+		kubeClient:        kubeClient,
+		configMapLister:   configMapInformer.Lister(),
+	}
+	return factory.New().WithInformers(
+		operatorClient.Informer(),
+		configMapInformer.Informer(),
+	).WithSync(
+		c.sync,
+	).ResyncEvery(
+		time.Minute,
+	).WithSyncDegradedOnError(
+		operatorClient,
+	).ToController(
+		name,
+		recorder.WithComponentSuffix("secrets-store-trusted-ca-bundle-controller"),
+	)
+}
+
+func (c *trustedCABundleController) sync(ctx context.Context, syncContext factory.SyncContext) error {
+	switch getOperatorSyncState(c.operatorClient) {
+	case opv1.Managed:
+		return c.syncManaged(ctx, syncContext)
+	case opv1.Removed:
+		return c.deleteMergedBundle(ctx, syncContext)
+	default:
+		return nil
+	}
+}
+
+func (c *trustedCABundleController) syncManaged(ctx context.Context, syncContext factory.SyncContext) error {
+	config, err := getOperatorConfig(c.configMapLister, c.operatorNamespace)
+	if err != nil {
+		return err
+	}
+	if err := validateAdditionalTrustedCAs(config.AdditionalTrustedCAs); err != nil {
+		return err
+	}
+	if len(config.AdditionalTrustedCAs) == 0 {
+		return c.deleteMergedBundle(ctx, syncContext)
+	}
+
+	bundle, ok, err := getMergedTrustedCABundle(c.configMapLister, c.operatorNamespace, config.AdditionalTrustedCAs)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		klog.V(2).Infof("Waiting for the cluster trusted CA bundle to be injected into ConfigMap %s/%s", c.operatorNamespace, trustedCAConfigMap)
+		return nil
+	}
+	_, _, err = resourceapply.ApplyConfigMap(ctx, c.kubeClient.CoreV1(), syncContext.Recorder(), &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      mergedTrustedCAConfigMap,
+			Namespace: c.operatorNamespace,
+		},
+		Data: map[string]string{caBundleKey: string(bundle)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply ConfigMap %s/%s: %w", c.operatorNamespace, mergedTrustedCAConfigMap, err)
+	}
+	return nil
+}
+
+// deleteMergedBundle deletes mergedTrustedCAConfigMap if it is present in
+// the informer cache.
+func (c *trustedCABundleController) deleteMergedBundle(ctx context.Context, syncContext factory.SyncContext) error {
+	_, err := c.configMapLister.ConfigMaps(c.operatorNamespace).Get(mergedTrustedCAConfigMap)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get ConfigMap %s/%s: %w", c.operatorNamespace, mergedTrustedCAConfigMap, err)
+	}
+	_, _, err = resourceapply.DeleteConfigMap(ctx, c.kubeClient.CoreV1(), syncContext.Recorder(), &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: mergedTrustedCAConfigMap, Namespace: c.operatorNamespace},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete ConfigMap %s/%s: %w", c.operatorNamespace, mergedTrustedCAConfigMap, err)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package tls
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	libgocrypto "github.com/openshift/library-go/pkg/crypto"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// ComplianceAuditPath is the path of the operator's metrics server that
+// serves the last ComplianceReport as JSON.
+const ComplianceAuditPath = "/debug/tls-compliance"
+
+// ComplianceReport records how the cluster TLS security profile was applied:
+// which of its ciphers Go's crypto/tls accepted or dropped, and whether the
+// TLS endpoints the operator configures comply with it.
+type ComplianceReport struct {
+	// Time is when the report was made.
+	Time time.Time `json:"time"`
+	// Adherence is the raw tlsAdherence value from the APIServer.
+	Adherence configv1.TLSAdherencePolicy `json:"adherence"`
+	// Honored is true when the adherence policy requires the operator to
+	// apply the profile. Endpoints always comply otherwise.
+	Honored bool `json:"honored"`
+	// MinTLSVersion is the minimum TLS version of the profile.
+	MinTLSVersion string `json:"minTLSVersion"`
+	// RequestedCiphers are the OpenSSL names of the ciphers of the profile.
+	RequestedCiphers []string `json:"requestedCiphers"`
+	// AcceptedCiphers are the IANA names of the requested ciphers that Go's
+	// crypto/tls supports.
+	AcceptedCiphers []string `json:"acceptedCiphers"`
+	// DroppedCiphers are the OpenSSL names of the requested ciphers that Go's
+	// crypto/tls does not support.
+	DroppedCiphers []string `json:"droppedCiphers"`
+	// Endpoints are the audited endpoints.
+	Endpoints []EndpointCompliance `json:"endpoints"`
+}
+
+// EndpointCompliance records whether an endpoint serves the TLS settings of
+// the profile.
+type EndpointCompliance struct {
+	// Name identifies the endpoint.
+	Name string `json:"name"`
+	// MinTLSVersion is the minimum TLS version the endpoint serves with.
+	MinTLSVersion string `json:"minTLSVersion,omitempty"`
+	// CipherSuites are the IANA names of the cipher suites the endpoint
+	// serves with. Empty means the defaults of the endpoint.
+	CipherSuites []string `json:"cipherSuites,omitempty"`
+	// Compliant is true when the endpoint serves the settings of an honored
+	// profile, or when the profile is not honored.
+	Compliant bool `json:"compliant"`
+	// Reason explains Compliant.
+	Reason string `json:"reason"`
+}
+
+// NewComplianceReport returns the report of resolved, without endpoints.
+func NewComplianceReport(resolved ResolvedProfile, now time.Time) *ComplianceReport {
+	report := &ComplianceReport{
+		Time:             now,
+		Adherence:        resolved.Adherence,
+		Honored:          resolved.Honor,
+		MinTLSVersion:    string(resolved.Spec.MinTLSVersion),
+		RequestedCiphers: append([]string{}, resolved.Spec.Ciphers...),
+		AcceptedCiphers:  []string{},
+		DroppedCiphers:   []string{},
+		Endpoints:        []EndpointCompliance{},
+	}
+	for _, cipher := range resolved.Spec.Ciphers {
+		if ianaCiphers := libgocrypto.OpenSSLToIANACipherSuites([]string{cipher}); len(ianaCiphers) > 0 {
+			report.AcceptedCiphers = append(report.AcceptedCiphers, ianaCiphers...)
+		} else {
+			report.DroppedCiphers = append(report.DroppedCiphers, cipher)
+		}
+	}
+	return report
+}
+
+// AddEndpoint audits an endpoint serving minTLSVersion and the IANA
+// cipherSuites, empty for its defaults, and adds it to r.
+func (r *ComplianceReport) AddEndpoint(name, minTLSVersion string, cipherSuites []string) {
+	endpoint := EndpointCompliance{
+		Name:          name,
+		MinTLSVersion: minTLSVersion,
+		CipherSuites:  cipherSuites,
+		Compliant:     true,
+	}
+	switch {
+	case !r.Honored:
+		endpoint.Reason = fmt.Sprintf("TLS adherence policy %q does not require the cluster TLS profile", r.Adherence)
+	case minTLSVersion != r.MinTLSVersion:
+		endpoint.Compliant = false
+		endpoint.Reason = fmt.Sprintf("minimum TLS version is %q, the profile requires %q", minTLSVersion, r.MinTLSVersion)
+	case len(r.AcceptedCiphers) > 0 && !sets.New(cipherSuites...).Equal(sets.New(r.AcceptedCiphers...)):
+		endpoint.Compliant = false
+		endpoint.Reason = "cipher suites differ from the accepted ciphers of the profile"
+	default:
+		endpoint.Reason = "serves the cluster TLS profile"
+	}
+	r.Endpoints = append(r.Endpoints, endpoint)
+}
+
+// AddProbedEndpoint audits an endpoint that negotiated minTLSVersion and
+// the IANA cipherSuites, see ProbeTLSSettings, and adds it to r. Unlike the
+// configured settings of AddEndpoint, the negotiated cipher suites leave out
+// the ones the serving certificate cannot be used with, so they comply when
+// they are accepted ciphers of the profile, rather than all of them. TLS 1.3
+// cipher suites are not compared: Go's crypto/tls serves all of them.
+func (r *ComplianceReport) AddProbedEndpoint(name, minTLSVersion string, cipherSuites []string) {
+	endpoint := EndpointCompliance{
+		Name:          name,
+		MinTLSVersion: minTLSVersion,
+		CipherSuites:  cipherSuites,
+		Compliant:     true,
+	}
+	tls12CipherSuites := sets.New(cipherSuites...).Delete(tls13CipherSuiteNames...)
+	switch {
+	case !r.Honored:
+		endpoint.Reason = fmt.Sprintf("TLS adherence policy %q does not require the cluster TLS profile", r.Adherence)
+	case minTLSVersion != r.MinTLSVersion:
+		endpoint.Compliant = false
+		endpoint.Reason = fmt.Sprintf("negotiates TLS version %q, the profile requires at least %q", minTLSVersion, r.MinTLSVersion)
+	case len(r.AcceptedCiphers) > 0 && !sets.New(r.AcceptedCiphers...).IsSuperset(tls12CipherSuites):
+		endpoint.Compliant = false
+		endpoint.Reason = fmt.Sprintf("negotiates cipher suites outside the accepted ciphers of the profile: %s",
+			strings.Join(sets.List(tls12CipherSuites.Difference(sets.New(r.AcceptedCiphers...))), ", "))
+	default:
+		endpoint.Reason = "negotiates the cluster TLS profile"
+	}
+	r.Endpoints = append(r.Endpoints, endpoint)
+}
+
+// tls13CipherSuiteNames are the IANA names of the TLS 1.3 cipher suites.
+var tls13CipherSuiteNames = []string{
+	tls.CipherSuiteName(tls.TLS_AES_128_GCM_SHA256),
+	tls.CipherSuiteName(tls.TLS_AES_256_GCM_SHA384),
+	tls.CipherSuiteName(tls.TLS_CHACHA20_POLY1305_SHA256),
+}
+
+// NonCompliantEndpoints returns the names of the endpoints of r that do not
+// comply.
+func (r *ComplianceReport) NonCompliantEndpoints() []string {
+	var names []string
+	for _, endpoint := range r.Endpoints {
+		if !endpoint.Compliant {
+			names = append(names, endpoint.Name)
+		}
+	}
+	return names
+}
+
+// ComplianceAudit holds the last ComplianceReport and serves it as JSON.
+type ComplianceAudit struct {
+	mu     sync.RWMutex
+	report *ComplianceReport
+}
+
+// Set makes report the last ComplianceReport.
+func (a *ComplianceAudit) Set(report *ComplianceReport) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.report = report
+}
+
+// Get returns the last ComplianceReport, nil until the first Set.
+func (a *ComplianceAudit) Get() *ComplianceReport {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.report
+}
+
+// ServeHTTP serves the last ComplianceReport as JSON, or 503 until there is
+// one. Only the leader replica audits, so a standby replica always serves
+// 503.
+func (a *ComplianceAudit) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	report := a.Get()
+	if report == nil {
+		http.Error(w, "no TLS compliance audit yet, the audit runs in the leader replica only", http.StatusServiceUnavailable)
+		return
+	}
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(append(content, '\n')); err != nil {
+		klog.V(4).Infof("failed to write the TLS compliance audit: %v", err)
+	}
+}
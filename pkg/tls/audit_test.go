@@ -0,0 +1,184 @@
+package tls
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+)
+
+func TestComplianceReportAddEndpoint(t *testing.T) {
+	strict := ResolvedProfile{
+		Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+		Spec: configv1.TLSProfileSpec{
+			Ciphers:       []string{"ECDHE-RSA-AES128-GCM-SHA256", "ECDHE-RSA-AES256-GCM-SHA384", "DHE-RSA-AES128-GCM-SHA256"},
+			MinTLSVersion: configv1.VersionTLS12,
+		},
+		Honor: true,
+	}
+	accepted := []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}
+
+	tests := []struct {
+		name          string
+		resolved      ResolvedProfile
+		minTLSVersion string
+		cipherSuites  []string
+		wantCompliant bool
+	}{
+		{
+			name:          "accepted ciphers in any order comply",
+			resolved:      strict,
+			minTLSVersion: "VersionTLS12",
+			cipherSuites:  []string{accepted[1], accepted[0]},
+			wantCompliant: true,
+		},
+		{
+			name:          "other min TLS version does not comply",
+			resolved:      strict,
+			minTLSVersion: "VersionTLS10",
+			cipherSuites:  accepted,
+		},
+		{
+			name:          "default ciphers do not comply",
+			resolved:      strict,
+			minTLSVersion: "VersionTLS12",
+		},
+		{
+			name:          "extra cipher does not comply",
+			resolved:      strict,
+			minTLSVersion: "VersionTLS12",
+			cipherSuites:  append([]string{"TLS_RSA_WITH_AES_128_CBC_SHA"}, accepted...),
+		},
+		{
+			name: "anything complies with a profile that is not honored",
+			resolved: ResolvedProfile{
+				Adherence: configv1.TLSAdherencePolicyLegacyAdheringComponentsOnly,
+				Spec:      strict.Spec,
+			},
+			wantCompliant: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := NewComplianceReport(tt.resolved, time.Time{})
+			if !reflect.DeepEqual(report.AcceptedCiphers, accepted) {
+				t.Errorf("AcceptedCiphers = %v, want %v", report.AcceptedCiphers, accepted)
+			}
+			if want := []string{"DHE-RSA-AES128-GCM-SHA256"}; !reflect.DeepEqual(report.DroppedCiphers, want) {
+				t.Errorf("DroppedCiphers = %v, want %v", report.DroppedCiphers, want)
+			}
+
+			report.AddEndpoint("test", tt.minTLSVersion, tt.cipherSuites)
+			if got := report.Endpoints[0].Compliant; got != tt.wantCompliant {
+				t.Errorf("Compliant = %t, want %t: %s", got, tt.wantCompliant, report.Endpoints[0].Reason)
+			}
+			if wantNonCompliant := !tt.wantCompliant; (len(report.NonCompliantEndpoints()) == 1) != wantNonCompliant {
+				t.Errorf("NonCompliantEndpoints() = %v", report.NonCompliantEndpoints())
+			}
+		})
+	}
+}
+
+func TestComplianceReportAddProbedEndpoint(t *testing.T) {
+	strict := ResolvedProfile{
+		Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+		Spec: configv1.TLSProfileSpec{
+			Ciphers:       []string{"ECDHE-ECDSA-AES128-GCM-SHA256", "ECDHE-RSA-AES128-GCM-SHA256"},
+			MinTLSVersion: configv1.VersionTLS12,
+		},
+		Honor: true,
+	}
+
+	tests := []struct {
+		name          string
+		resolved      ResolvedProfile
+		minTLSVersion string
+		cipherSuites  []string
+		wantCompliant bool
+	}{
+		{
+			name:          "accepted ciphers the certificate can be used with comply",
+			resolved:      strict,
+			minTLSVersion: "VersionTLS12",
+			cipherSuites:  []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+			wantCompliant: true,
+		},
+		{
+			name:          "TLS 1.3 cipher suites are not compared",
+			resolved:      strict,
+			minTLSVersion: "VersionTLS12",
+			cipherSuites:  []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_AES_256_GCM_SHA384"},
+			wantCompliant: true,
+		},
+		{
+			name:          "other min TLS version does not comply",
+			resolved:      strict,
+			minTLSVersion: "VersionTLS10",
+			cipherSuites:  []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+		},
+		{
+			name:          "cipher outside the profile does not comply",
+			resolved:      strict,
+			minTLSVersion: "VersionTLS12",
+			cipherSuites:  []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_RSA_WITH_AES_128_CBC_SHA"},
+		},
+		{
+			name: "anything complies with a profile that is not honored",
+			resolved: ResolvedProfile{
+				Adherence: configv1.TLSAdherencePolicyLegacyAdheringComponentsOnly,
+				Spec:      strict.Spec,
+			},
+			minTLSVersion: "VersionTLS10",
+			wantCompliant: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := NewComplianceReport(tt.resolved, time.Time{})
+			report.AddProbedEndpoint("test", tt.minTLSVersion, tt.cipherSuites)
+			if got := report.Endpoints[0].Compliant; got != tt.wantCompliant {
+				t.Errorf("Compliant = %t, want %t: %s", got, tt.wantCompliant, report.Endpoints[0].Reason)
+			}
+		})
+	}
+}
+
+func TestComplianceAuditServeHTTP(t *testing.T) {
+	audit := &ComplianceAudit{}
+
+	recorder := httptest.NewRecorder()
+	audit.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, ComplianceAuditPath, nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("status before the first report = %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+
+	report := NewComplianceReport(ResolvedProfile{
+		Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+		Spec:      *configv1.TLSProfiles[configv1.TLSProfileIntermediateType],
+		Honor:     true,
+	}, time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC))
+	report.AddEndpoint("test", "VersionTLS12", report.AcceptedCiphers)
+	audit.Set(report)
+
+	recorder = httptest.NewRecorder()
+	audit.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, ComplianceAuditPath, nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+	var got ComplianceReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to unmarshal the served report: %v", err)
+	}
+	if !reflect.DeepEqual(&got, report) {
+		t.Errorf("served report = %#v, want %#v", got, *report)
+	}
+}
@@ -0,0 +1,162 @@
+package tls
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	configv1 "github.com/openshift/api/config/v1"
+	libgocrypto "github.com/openshift/library-go/pkg/crypto"
+	"k8s.io/klog/v2"
+)
+
+// DynamicServingConfig holds the TLS settings the operator's HTTPS metrics
+// server negotiates new connections with. Update replaces them while the
+// server runs; connections already established keep the settings they were
+// negotiated with.
+type DynamicServingConfig struct {
+	current atomic.Pointer[servingSettings]
+	// address is the address the server listens on, see Address.
+	address atomic.Pointer[string]
+	// configured are the TLS settings of the operator config, see
+	// ReadConfigServingInfo. An honored profile must not conflict with them,
+	// as MergeConfigFile checks at startup.
+	configured configv1.HTTPServingInfo
+}
+
+// servingSettings are the TLS settings of a ResolvedProfile. They override
+// the server's own settings only when the profile is honored.
+type servingSettings struct {
+	resolved     ResolvedProfile
+	override     bool
+	minVersion   uint16
+	cipherSuites []uint16
+}
+
+// NewDynamicServingConfig returns a DynamicServingConfig serving resolved.
+// configured are the TLS settings the operator config sets, which resolved
+// and later updates must not conflict with.
+func NewDynamicServingConfig(resolved ResolvedProfile, configured configv1.HTTPServingInfo) (*DynamicServingConfig, error) {
+	d := &DynamicServingConfig{configured: configured}
+	if err := d.Update(resolved); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Update makes new connections negotiate the settings of resolved. On error
+// the previous settings stay in effect. An honored profile that conflicts
+// with the TLS settings of the operator config is an error, like it is for
+// MergeConfigFile at startup, rather than silently overriding them.
+func (d *DynamicServingConfig) Update(resolved ResolvedProfile) error {
+	settings, err := newServingSettings(resolved)
+	if err != nil {
+		return err
+	}
+	if settings.override {
+		cipherSuites, err := resolved.IANACipherSuites()
+		if err != nil {
+			return err
+		}
+		required := configv1.HTTPServingInfo{}
+		required.MinTLSVersion = string(resolved.Spec.MinTLSVersion)
+		required.CipherSuites = cipherSuites
+		if conflicts := servingInfoConflicts(d.configured, required); len(conflicts) > 0 {
+			return fmt.Errorf("--config conflicts with the cluster TLS security profile: %s", strings.Join(conflicts, "; "))
+		}
+	}
+	d.current.Store(settings)
+	if !settings.override {
+		klog.Infof("TLS adherence policy is %q; serving the TLS settings of the operator config", resolved.Adherence)
+		return nil
+	}
+	klog.Infof("Serving TLS settings: minTLSVersion=%s, cipherSuites=%v, adherence=%q",
+		libgocrypto.TLSVersionToNameOrDie(settings.minVersion), libgocrypto.CipherSuitesToNamesOrDie(settings.cipherSuites), resolved.Adherence)
+	return nil
+}
+
+// Current returns the ResolvedProfile new connections are negotiated with.
+func (d *DynamicServingConfig) Current() ResolvedProfile {
+	return d.current.Load().resolved
+}
+
+// Address returns the address the server Serve serves with the settings
+// listens on, or "" until it listens.
+func (d *DynamicServingConfig) Address() string {
+	if address := d.address.Load(); address != nil {
+		return *address
+	}
+	return ""
+}
+
+// ServedSettings returns the names of the minimum TLS version and cipher
+// suites new connections are negotiated with, when they are those of an
+// honored profile. ok is false otherwise, the server then negotiates its own
+// settings.
+func (d *DynamicServingConfig) ServedSettings() (minTLSVersion string, cipherSuites []string, ok bool) {
+	settings := d.current.Load()
+	if !settings.override {
+		return "", nil, false
+	}
+	return libgocrypto.TLSVersionToNameOrDie(settings.minVersion), libgocrypto.CipherSuitesToNamesOrDie(settings.cipherSuites), true
+}
+
+// WrapGetConfigForClient returns a tls.Config GetConfigForClient callback
+// that applies the current settings to the config returned by next, which
+// provides everything else, like the serving certificates. Under a profile
+// that is not honored, the config of next is returned as is.
+func (d *DynamicServingConfig) WrapGetConfigForClient(next func(*tls.ClientHelloInfo) (*tls.Config, error)) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(clientHello *tls.ClientHelloInfo) (*tls.Config, error) {
+		config, err := next(clientHello)
+		if err != nil || config == nil {
+			return config, err
+		}
+		settings := d.current.Load()
+		if !settings.override {
+			return config, nil
+		}
+		config = config.Clone()
+		config.MinVersion = settings.minVersion
+		config.CipherSuites = settings.cipherSuites
+		return config, nil
+	}
+}
+
+// newServingSettings returns the settings of resolved: the ones of its Spec
+// when honored, none otherwise, leaving the Controllercmd defaults or the
+// operator config in effect, as ApplyToServingInfo does at startup. Like
+// ApplyToServingInfo, it errors when every cipher of an honored profile is
+// unsupported by Go's crypto/tls.
+func newServingSettings(resolved ResolvedProfile) (*servingSettings, error) {
+	settings := &servingSettings{resolved: resolved}
+	if !resolved.Honor {
+		return settings, nil
+	}
+
+	minVersion, err := libgocrypto.TLSVersion(string(resolved.Spec.MinTLSVersion))
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply cluster TLS profile: %w", err)
+	}
+	var cipherSuites []uint16
+	for _, name := range libgocrypto.OpenSSLToIANACipherSuites(resolved.Spec.Ciphers) {
+		cipherSuite, err := libgocrypto.CipherSuite(name)
+		if err != nil {
+			klog.V(4).Infof("skipping cipher suite %q unsupported by Go's crypto/tls", name)
+			continue
+		}
+		cipherSuites = append(cipherSuites, cipherSuite)
+	}
+	if len(resolved.Spec.Ciphers) > 0 && len(cipherSuites) == 0 {
+		return nil, fmt.Errorf("failed to apply cluster TLS profile: all %d cipher(s) are unsupported by Go's crypto/tls: %v",
+			len(resolved.Spec.Ciphers), resolved.Spec.Ciphers)
+	}
+	if len(cipherSuites) == 0 {
+		cipherSuites = libgocrypto.DefaultCiphers()
+	}
+
+	settings.override = true
+	settings.minVersion = minVersion
+	settings.cipherSuites = cipherSuites
+	return settings, nil
+}
@@ -0,0 +1,373 @@
+package tls
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	operatorv1alpha1 "github.com/openshift/api/operator/v1alpha1"
+	"github.com/openshift/library-go/pkg/config/configdefaults"
+	libgocrypto "github.com/openshift/library-go/pkg/crypto"
+	"k8s.io/apimachinery/pkg/version"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	certutil "k8s.io/client-go/util/cert"
+)
+
+func TestNewServingSettings(t *testing.T) {
+	intermediate := *configv1.TLSProfiles[configv1.TLSProfileIntermediateType]
+
+	tests := []struct {
+		name             string
+		resolved         ResolvedProfile
+		wantOverride     bool
+		wantMinVersion   uint16
+		wantCipherSuites []uint16
+		wantErr          bool
+	}{
+		{
+			name: "Legacy adherence overrides nothing",
+			resolved: ResolvedProfile{
+				Adherence: configv1.TLSAdherencePolicyLegacyAdheringComponentsOnly,
+				Spec:      *configv1.TLSProfiles[configv1.TLSProfileModernType],
+			},
+		},
+		{
+			name: "honored profile",
+			resolved: ResolvedProfile{
+				Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+				Spec: configv1.TLSProfileSpec{
+					Ciphers:       []string{"ECDHE-RSA-AES128-GCM-SHA256", "ECDHE-ECDSA-AES256-GCM-SHA384"},
+					MinTLSVersion: configv1.VersionTLS12,
+				},
+				Honor: true,
+			},
+			wantOverride:   true,
+			wantMinVersion: tls.VersionTLS12,
+			wantCipherSuites: []uint16{
+				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			},
+		},
+		{
+			name: "unsupported ciphers are skipped",
+			resolved: ResolvedProfile{
+				Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+				Spec: configv1.TLSProfileSpec{
+					Ciphers:       []string{"DHE-RSA-AES128-GCM-SHA256", "ECDHE-RSA-AES128-GCM-SHA256"},
+					MinTLSVersion: configv1.VersionTLS12,
+				},
+				Honor: true,
+			},
+			wantOverride:     true,
+			wantMinVersion:   tls.VersionTLS12,
+			wantCipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		},
+		{
+			name: "no ciphers keeps the default ciphers",
+			resolved: ResolvedProfile{
+				Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+				Spec:      configv1.TLSProfileSpec{MinTLSVersion: configv1.VersionTLS13},
+				Honor:     true,
+			},
+			wantOverride:     true,
+			wantMinVersion:   tls.VersionTLS13,
+			wantCipherSuites: libgocrypto.DefaultCiphers(),
+		},
+		{
+			name: "all ciphers unsupported errors",
+			resolved: ResolvedProfile{
+				Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+				Spec: configv1.TLSProfileSpec{
+					Ciphers:       []string{"DHE-RSA-AES128-GCM-SHA256"},
+					MinTLSVersion: configv1.VersionTLS12,
+				},
+				Honor: true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown min TLS version errors",
+			resolved: ResolvedProfile{
+				Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+				Spec: configv1.TLSProfileSpec{
+					Ciphers:       intermediate.Ciphers,
+					MinTLSVersion: "VersionTLS99",
+				},
+				Honor: true,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newServingSettings(tt.resolved)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newServingSettings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.override != tt.wantOverride {
+				t.Errorf("override = %v, want %v", got.override, tt.wantOverride)
+			}
+			if got.minVersion != tt.wantMinVersion {
+				t.Errorf("minVersion = %x, want %x", got.minVersion, tt.wantMinVersion)
+			}
+			if !reflect.DeepEqual(got.cipherSuites, tt.wantCipherSuites) {
+				t.Errorf("cipherSuites = %v, want %v", got.cipherSuites, tt.wantCipherSuites)
+			}
+		})
+	}
+}
+
+func TestDynamicServingConfigUpdate(t *testing.T) {
+	intermediate := ResolvedProfile{
+		Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+		Spec:      *configv1.TLSProfiles[configv1.TLSProfileIntermediateType],
+		Honor:     true,
+	}
+	modern := ResolvedProfile{
+		Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+		Spec:      *configv1.TLSProfiles[configv1.TLSProfileModernType],
+		Honor:     true,
+	}
+	legacy := ResolvedProfile{
+		Adherence: configv1.TLSAdherencePolicyLegacyAdheringComponentsOnly,
+		Spec:      *configv1.TLSProfiles[configv1.TLSProfileModernType],
+	}
+	unsupported := ResolvedProfile{
+		Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+		Spec: configv1.TLSProfileSpec{
+			Ciphers:       []string{"DHE-RSA-AES128-GCM-SHA256"},
+			MinTLSVersion: configv1.VersionTLS12,
+		},
+		Honor: true,
+	}
+
+	tests := []struct {
+		name           string
+		configured     configv1.HTTPServingInfo
+		updates        []ResolvedProfile
+		wantCurrent    ResolvedProfile
+		wantMinVersion uint16
+		wantErr        bool
+	}{
+		{
+			name:           "update applies the profile",
+			updates:        []ResolvedProfile{modern},
+			wantCurrent:    modern,
+			wantMinVersion: tls.VersionTLS13,
+		},
+		{
+			name:           "update to a profile that is not honored keeps the server's settings",
+			updates:        []ResolvedProfile{modern, legacy},
+			wantCurrent:    legacy,
+			wantMinVersion: tls.VersionTLS10,
+		},
+		{
+			name:           "update conflicting with the operator config keeps the previous profile",
+			configured:     configv1.HTTPServingInfo{ServingInfo: configv1.ServingInfo{MinTLSVersion: "VersionTLS12"}},
+			updates:        []ResolvedProfile{modern},
+			wantCurrent:    intermediate,
+			wantMinVersion: tls.VersionTLS12,
+			wantErr:        true,
+		},
+		{
+			name:           "update to a profile that is not honored does not conflict",
+			configured:     configv1.HTTPServingInfo{ServingInfo: configv1.ServingInfo{MinTLSVersion: "VersionTLS12"}},
+			updates:        []ResolvedProfile{legacy},
+			wantCurrent:    legacy,
+			wantMinVersion: tls.VersionTLS10,
+		},
+		{
+			name:           "failed update keeps the previous profile",
+			updates:        []ResolvedProfile{unsupported},
+			wantCurrent:    intermediate,
+			wantMinVersion: tls.VersionTLS12,
+			wantErr:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDynamicServingConfig(intermediate, tt.configured)
+			if err != nil {
+				t.Fatalf("NewDynamicServingConfig() error = %v", err)
+			}
+			for _, update := range tt.updates {
+				err = d.Update(update)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Update() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := d.Current(); !reflect.DeepEqual(got, tt.wantCurrent) {
+				t.Errorf("Current() = %#v, want %#v", got, tt.wantCurrent)
+			}
+
+			base := &tls.Config{MinVersion: tls.VersionTLS10}
+			getConfig := d.WrapGetConfigForClient(func(*tls.ClientHelloInfo) (*tls.Config, error) { return base, nil })
+			got, err := getConfig(&tls.ClientHelloInfo{})
+			if err != nil {
+				t.Fatalf("GetConfigForClient() error = %v", err)
+			}
+			if got.MinVersion != tt.wantMinVersion {
+				t.Errorf("GetConfigForClient() MinVersion = %x, want %x", got.MinVersion, tt.wantMinVersion)
+			}
+			if base.MinVersion != tls.VersionTLS10 {
+				t.Errorf("GetConfigForClient() modified the config of next")
+			}
+		})
+	}
+}
+
+// newTestMetricsServer returns the metrics server ServeMetrics builds, with
+// a self-signed serving certificate and delegated authentication and
+// authorization disabled, as they need a cluster.
+func newTestMetricsServer(t *testing.T, ctx context.Context) *genericapiserver.GenericAPIServer {
+	t.Helper()
+	certPEM, keyPEM, err := certutil.GenerateSelfSignedCertKey("localhost", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	servingInfo := configv1.HTTPServingInfo{}
+	servingInfo.CertFile = filepath.Join(dir, "tls.crt")
+	servingInfo.KeyFile = filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(servingInfo.CertFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(servingInfo.KeyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The server config requires a port, pick a free one.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	servingInfo.BindAddress = listener.Addr().String()
+	if err := listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+	configdefaults.SetRecommendedHTTPServingInfoDefaults(&servingInfo)
+
+	server, err := NewMetricsServer(ctx, "test", servingInfo,
+		operatorv1alpha1.DelegatedAuthentication{Disabled: true}, operatorv1alpha1.DelegatedAuthorization{Disabled: true},
+		"", nil, nil, version.Info{}, &ComplianceAudit{})
+	if err != nil {
+		t.Fatalf("NewMetricsServer() error = %v", err)
+	}
+	return server
+}
+
+func TestServeReloadsProfile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := newTestMetricsServer(t, ctx)
+
+	d, err := NewDynamicServingConfig(ResolvedProfile{
+		Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+		Spec:      *configv1.TLSProfiles[configv1.TLSProfileIntermediateType],
+		Honor:     true,
+	}, configv1.HTTPServingInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Serve(ctx, server, d); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+	if got, want := d.Address(), server.SecureServingInfo.Listener.Addr().String(); got != want {
+		t.Errorf("Address() = %q, want %q", got, want)
+	}
+
+	dialTLS12 := func() error {
+		conn, err := tls.Dial("tcp", d.Address(), &tls.Config{
+			InsecureSkipVerify: true,
+			MaxVersion:         tls.VersionTLS12,
+		})
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	if err := dialTLS12(); err != nil {
+		t.Fatalf("TLS 1.2 handshake under the Intermediate profile failed: %v", err)
+	}
+	if err := d.Update(ResolvedProfile{
+		Adherence: configv1.TLSAdherencePolicyStrictAllComponents,
+		Spec:      *configv1.TLSProfiles[configv1.TLSProfileModernType],
+		Honor:     true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dialTLS12(); err == nil {
+		t.Fatalf("TLS 1.2 handshake under the Modern profile succeeded, want the server to require TLS 1.3")
+	}
+}
+
+// TestServeServesLikeSecureServing checks that Serve serves the metrics
+// server as Controllercmd serves it, through NonBlockingRunWithContext.
+func TestServeServesLikeSecureServing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	want := newTestMetricsServer(t, ctx)
+	if _, _, err := want.PrepareRun().NonBlockingRunWithContext(ctx, time.Second); err != nil {
+		t.Fatalf("NonBlockingRunWithContext() error = %v", err)
+	}
+	got := newTestMetricsServer(t, ctx)
+	d, err := NewDynamicServingConfig(ResolvedProfile{Adherence: configv1.TLSAdherencePolicyLegacyAdheringComponentsOnly}, configv1.HTTPServingInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Serve(ctx, got, d); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+
+	type response struct {
+		statusCode int
+		proto      string
+		body       string
+	}
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	get := func(address, path string) response {
+		t.Helper()
+		resp, err := client.Get("https://" + address + path)
+		if err != nil {
+			t.Fatalf("GET %s error = %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response{statusCode: resp.StatusCode, proto: resp.Proto, body: string(body)}
+	}
+
+	for _, path := range []string{"/healthz", "/readyz", "/livez", "/healthz/log", "/debug/pprof/", "/not-found"} {
+		wantResponse := get(want.SecureServingInfo.Listener.Addr().String(), path)
+		if gotResponse := get(d.Address(), path); !reflect.DeepEqual(gotResponse, wantResponse) {
+			t.Errorf("GET %s = %+v, want %+v", path, gotResponse, wantResponse)
+		}
+	}
+	// Metrics and the compliance audit change between requests, compare
+	// the status only.
+	for _, path := range []string{"/metrics", ComplianceAuditPath} {
+		wantResponse := get(want.SecureServingInfo.Listener.Addr().String(), path)
+		if gotResponse := get(d.Address(), path); gotResponse.statusCode != wantResponse.statusCode || gotResponse.proto != wantResponse.proto {
+			t.Errorf("GET %s = %d %s, want %d %s", path, gotResponse.statusCode, gotResponse.proto, wantResponse.statusCode, wantResponse.proto)
+		}
+	}
+}
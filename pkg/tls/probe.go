@@ -0,0 +1,93 @@
+package tls
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	libgocrypto "github.com/openshift/library-go/pkg/crypto"
+)
+
+// probeTimeout bounds every handshake of ProbeTLSSettings.
+const probeTimeout = 5 * time.Second
+
+// probeVersions are the TLS versions ProbeTLSSettings tries, lowest first.
+var probeVersions = []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13}
+
+// ProbeTLSSettings returns the minimum TLS version and the IANA names of the
+// cipher suites the server at address negotiates, found by handshaking with
+// it once per version and once per cipher suite of Go's crypto/tls. The
+// cipher suites are the ones of TLS 1.2 and lower, plus the one negotiated
+// in TLS 1.3, if the server serves it: TLS 1.3 clients cannot offer a single
+// suite. Cipher suites the serving certificate cannot be used with, like
+// ECDSA ones with an RSA certificate, are never negotiated. The server's
+// certificate is not verified.
+func ProbeTLSSettings(ctx context.Context, address string) (minTLSVersion string, cipherSuites []string, err error) {
+	var versions []uint16
+	var tls13CipherSuite uint16
+	for _, version := range probeVersions {
+		state, err := probeHandshake(ctx, address, &tls.Config{MinVersion: version, MaxVersion: version})
+		if err != nil {
+			continue
+		}
+		versions = append(versions, version)
+		if version == tls.VersionTLS13 {
+			tls13CipherSuite = state.CipherSuite
+		}
+	}
+	if len(versions) == 0 {
+		return "", nil, fmt.Errorf("no TLS handshake with %s succeeded", address)
+	}
+	minTLSVersion = libgocrypto.TLSVersionToNameOrDie(versions[0])
+
+	// Every suite is tried once, with the highest version below TLS 1.3
+	// that both it and the server support.
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		for _, version := range slices.Backward(versions) {
+			if version == tls.VersionTLS13 || !slices.Contains(suite.SupportedVersions, version) {
+				continue
+			}
+			if _, err := probeHandshake(ctx, address, &tls.Config{MinVersion: version, MaxVersion: version, CipherSuites: []uint16{suite.ID}}); err == nil {
+				cipherSuites = append(cipherSuites, suite.Name)
+			}
+			break
+		}
+	}
+	if tls13CipherSuite != 0 {
+		cipherSuites = append(cipherSuites, tls.CipherSuiteName(tls13CipherSuite))
+	}
+	return minTLSVersion, cipherSuites, nil
+}
+
+// probeHandshake handshakes with the server at address using config and
+// returns the negotiated connection state.
+func probeHandshake(ctx context.Context, address string, config *tls.Config) (tls.ConnectionState, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	config.InsecureSkipVerify = true
+	dialer := &tls.Dialer{Config: config}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+	return conn.(*tls.Conn).ConnectionState(), nil
+}
+
+// LoopbackAddress returns the address to reach a server listening on
+// address from the same host: the loopback address when it listens on all
+// addresses, address itself otherwise.
+func LoopbackAddress(address string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,115 @@
+package tls
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	certutil "k8s.io/client-go/util/cert"
+)
+
+func TestProbeTLSSettings(t *testing.T) {
+	certPEM, keyPEM, err := certutil.GenerateSelfSignedCertKey("localhost", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name             string
+		config           *tls.Config
+		wantMinVersion   string
+		wantCipherSuites []string
+		wantTLS13        bool
+	}{
+		{
+			name: "TLS 1.2 with the configured cipher suites the certificate can be used with",
+			config: &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				MaxVersion: tls.VersionTLS12,
+				CipherSuites: []uint16{
+					tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+					tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+					tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+				},
+			},
+			wantMinVersion:   "VersionTLS12",
+			wantCipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+		},
+		{
+			name: "TLS 1.3 adds the negotiated cipher suite",
+			config: &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+			},
+			wantMinVersion:   "VersionTLS12",
+			wantCipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+			wantTLS13:        true,
+		},
+		{
+			name:           "TLS 1.3 only",
+			config:         &tls.Config{MinVersion: tls.VersionTLS13},
+			wantMinVersion: "VersionTLS13",
+			wantTLS13:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.NotFoundHandler())
+			server.TLS = tt.config
+			server.TLS.Certificates = []tls.Certificate{cert}
+			server.StartTLS()
+			defer server.Close()
+
+			minTLSVersion, cipherSuites, err := ProbeTLSSettings(context.Background(), server.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if minTLSVersion != tt.wantMinVersion {
+				t.Errorf("minTLSVersion = %q, want %q", minTLSVersion, tt.wantMinVersion)
+			}
+			if tt.wantTLS13 {
+				if len(cipherSuites) == 0 || !slices.Contains(tls13CipherSuiteNames, cipherSuites[len(cipherSuites)-1]) {
+					t.Fatalf("cipherSuites = %v, want a TLS 1.3 cipher suite last", cipherSuites)
+				}
+				cipherSuites = cipherSuites[:len(cipherSuites)-1]
+			}
+			if !slices.Equal(cipherSuites, tt.wantCipherSuites) {
+				t.Errorf("cipherSuites = %v, want %v", cipherSuites, tt.wantCipherSuites)
+			}
+		})
+	}
+}
+
+func TestLoopbackAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+		wantErr bool
+	}{
+		{address: "[::]:8443", want: "localhost:8443"},
+		{address: "0.0.0.0:8443", want: "localhost:8443"},
+		{address: ":8443", want: "localhost:8443"},
+		{address: "10.0.0.1:8443", want: "10.0.0.1:8443"},
+		{address: "8443", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			got, err := LoopbackAddress(tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoopbackAddress() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("LoopbackAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
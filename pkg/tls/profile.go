@@ -115,14 +115,9 @@ func ApplyToServingInfo(servingInfo *configv1.HTTPServingInfo, resolved Resolved
 		return nil
 	}
 
-	cipherSuites := libgocrypto.OpenSSLToIANACipherSuites(resolved.Spec.Ciphers)
-	if len(resolved.Spec.Ciphers) > 0 && len(cipherSuites) == 0 {
-		// Every configured cipher was unsupported by Go's crypto/tls and
-		// silently dropped by OpenSSLToIANACipherSuites (logged only at
-		// klog V(4)). Failing here prevents Controllercmd default ciphers
-		// from being used in place of the cluster policy.
-		return fmt.Errorf("failed to apply cluster TLS profile: all %d cipher(s) are unsupported by Go's crypto/tls: %v",
-			len(resolved.Spec.Ciphers), resolved.Spec.Ciphers)
+	cipherSuites, err := resolved.IANACipherSuites()
+	if err != nil {
+		return err
 	}
 
 	servingInfo.MinTLSVersion = string(resolved.Spec.MinTLSVersion)
@@ -131,3 +126,19 @@ func ApplyToServingInfo(servingInfo *configv1.HTTPServingInfo, resolved Resolved
 		servingInfo.MinTLSVersion, servingInfo.CipherSuites)
 	return nil
 }
+
+// IANACipherSuites returns the IANA names of the ciphers of r's Spec that Go's
+// crypto/tls supports. When the Spec lists ciphers but all of them are
+// dropped, an error is returned so that a component's defaults are not used
+// in place of the cluster policy.
+func (r ResolvedProfile) IANACipherSuites() ([]string, error) {
+	cipherSuites := libgocrypto.OpenSSLToIANACipherSuites(r.Spec.Ciphers)
+	if len(r.Spec.Ciphers) > 0 && len(cipherSuites) == 0 {
+		// Every configured cipher was unsupported by Go's crypto/tls and
+		// silently dropped by OpenSSLToIANACipherSuites (logged only at
+		// klog V(4)).
+		return nil, fmt.Errorf("failed to apply cluster TLS profile: all %d cipher(s) are unsupported by Go's crypto/tls: %v",
+			len(r.Spec.Ciphers), r.Spec.Ciphers)
+	}
+	return cipherSuites, nil
+}
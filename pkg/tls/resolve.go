@@ -4,12 +4,16 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
+	configv1 "github.com/openshift/api/config/v1"
 	operatorv1alpha1 "github.com/openshift/api/operator/v1alpha1"
 	configclient "github.com/openshift/client-go/config/clientset/versioned"
 	libgoclient "github.com/openshift/library-go/pkg/config/client"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
@@ -66,10 +70,10 @@ func ResolveFromCluster(ctx context.Context, kubeConfigFile, userAgent string) (
 }
 
 // WriteConfigFile generates a GenericOperatorConfig carrying resolved's TLS
-// settings, writes it to a uniquely-named temp file (the "*" in the pattern
-// keeps the .yaml extension), and returns its path for the caller to point
-// --config at. Returns "" without creating a file when resolved isn't honored,
-// since ServingInfo would not carry anything worth persisting.
+// settings, writes it to a uniquely-named temp file, and returns its path for
+// the caller to point --config at. Returns "" without creating a file when
+// resolved isn't honored, since ServingInfo would not carry anything worth
+// persisting.
 func WriteConfigFile(resolved ResolvedProfile) (string, error) {
 	if !resolved.Honor {
 		return "", nil
@@ -86,6 +90,119 @@ func WriteConfigFile(resolved ResolvedProfile) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal operator config: %w", err)
 	}
+	return writeTempConfigFile(content)
+}
+
+// MergeConfigFile merges resolved's TLS settings into the ServingInfo of the
+// GenericOperatorConfig in configFile, writes the result to a uniquely-named
+// temp file and returns its path for the caller to point --config at;
+// configFile itself is left untouched. Everything else in configFile, like
+// leader election tuning or serving cert paths, is kept as is.
+//
+// A minTLSVersion or cipherSuites that configFile sets to anything but what
+// resolved requires is a conflict: all of them are reported in the returned
+// error rather than silently overridden. Like WriteConfigFile, it returns ""
+// when resolved isn't honored, leaving configFile's own TLS settings in
+// effect.
+func MergeConfigFile(configFile string, resolved ResolvedProfile) (string, error) {
+	if !resolved.Honor {
+		return "", nil
+	}
+
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read --config %q: %w", configFile, err)
+	}
+	config := map[string]interface{}{}
+	if err := sigsyaml.Unmarshal(content, &config); err != nil {
+		return "", fmt.Errorf("failed to parse --config %q: %w", configFile, err)
+	}
+
+	required := configv1.HTTPServingInfo{}
+	if err := ApplyToServingInfo(&required, resolved); err != nil {
+		return "", err
+	}
+	configured, err := servingInfoTLSSettings(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse --config %q: %w", configFile, err)
+	}
+	if conflicts := servingInfoConflicts(configured, required); len(conflicts) > 0 {
+		return "", fmt.Errorf("--config %q conflicts with the cluster TLS security profile: %s",
+			configFile, strings.Join(conflicts, "; "))
+	}
+
+	if err := unstructured.SetNestedField(config, required.MinTLSVersion, "servingInfo", "minTLSVersion"); err != nil {
+		return "", fmt.Errorf("failed to merge --config %q: %w", configFile, err)
+	}
+	if err := unstructured.SetNestedStringSlice(config, required.CipherSuites, "servingInfo", "cipherSuites"); err != nil {
+		return "", fmt.Errorf("failed to merge --config %q: %w", configFile, err)
+	}
+	merged, err := sigsyaml.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal operator config: %w", err)
+	}
+	klog.Infof("Merged cluster TLS profile into --config %q", configFile)
+	return writeTempConfigFile(merged)
+}
+
+// ReadConfigServingInfo returns the ServingInfo TLS settings, minTLSVersion
+// and cipherSuites, that configFile sets. Those of a DynamicServingConfig
+// must not conflict with them, see NewDynamicServingConfig. An empty
+// configFile sets none.
+func ReadConfigServingInfo(configFile string) (configv1.HTTPServingInfo, error) {
+	if configFile == "" {
+		return configv1.HTTPServingInfo{}, nil
+	}
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		return configv1.HTTPServingInfo{}, fmt.Errorf("failed to read --config %q: %w", configFile, err)
+	}
+	config := map[string]interface{}{}
+	if err := sigsyaml.Unmarshal(content, &config); err != nil {
+		return configv1.HTTPServingInfo{}, fmt.Errorf("failed to parse --config %q: %w", configFile, err)
+	}
+	configured, err := servingInfoTLSSettings(config)
+	if err != nil {
+		return configv1.HTTPServingInfo{}, fmt.Errorf("failed to parse --config %q: %w", configFile, err)
+	}
+	return configured, nil
+}
+
+// servingInfoTLSSettings returns the ServingInfo TLS settings of config.
+func servingInfoTLSSettings(config map[string]interface{}) (configv1.HTTPServingInfo, error) {
+	configured := configv1.HTTPServingInfo{}
+	minTLSVersion, _, err := unstructured.NestedString(config, "servingInfo", "minTLSVersion")
+	if err != nil {
+		return configured, err
+	}
+	cipherSuites, _, err := unstructured.NestedStringSlice(config, "servingInfo", "cipherSuites")
+	if err != nil {
+		return configured, err
+	}
+	configured.MinTLSVersion = minTLSVersion
+	configured.CipherSuites = cipherSuites
+	return configured, nil
+}
+
+// servingInfoConflicts returns a description of every TLS setting of
+// configured that is set to anything but the one of required. The order of
+// cipher suites is not significant, Go's crypto/tls ignores it.
+func servingInfoConflicts(configured, required configv1.HTTPServingInfo) []string {
+	var conflicts []string
+	if configured.MinTLSVersion != "" && configured.MinTLSVersion != required.MinTLSVersion {
+		conflicts = append(conflicts, fmt.Sprintf("servingInfo.minTLSVersion is %q, the profile requires %q",
+			configured.MinTLSVersion, required.MinTLSVersion))
+	}
+	if len(configured.CipherSuites) > 0 && !sets.New(configured.CipherSuites...).Equal(sets.New(required.CipherSuites...)) {
+		conflicts = append(conflicts, fmt.Sprintf("servingInfo.cipherSuites is %v, the profile requires %v",
+			configured.CipherSuites, required.CipherSuites))
+	}
+	return conflicts
+}
+
+// writeTempConfigFile writes content to a uniquely-named temp file (the "*"
+// in the pattern keeps the .yaml extension) and returns its path.
+func writeTempConfigFile(content []byte) (string, error) {
 	tmpFile, err := os.CreateTemp("", "sscsi-operator-config-*.yaml")
 	if err != nil {
 		return "", fmt.Errorf("failed to create temp config file: %w", err)
@@ -2,10 +2,15 @@ package tls
 
 import (
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	configv1 "github.com/openshift/api/config/v1"
 	operatorv1alpha1 "github.com/openshift/api/operator/v1alpha1"
+	libgocrypto "github.com/openshift/library-go/pkg/crypto"
 	sigsyaml "sigs.k8s.io/yaml"
 )
 
@@ -89,3 +94,139 @@ func TestWriteConfigFile(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeConfigFile(t *testing.T) {
+	intermediate := *configv1.TLSProfiles[configv1.TLSProfileIntermediateType]
+	intermediateCiphers := libgocrypto.OpenSSLToIANACipherSuites(intermediate.Ciphers)
+	reversedCiphers := make([]string, 0, len(intermediateCiphers))
+	for i := len(intermediateCiphers) - 1; i >= 0; i-- {
+		reversedCiphers = append(reversedCiphers, intermediateCiphers[i])
+	}
+
+	const userConfig = `apiVersion: operator.openshift.io/v1alpha1
+kind: GenericOperatorConfig
+leaderElection:
+  leaseDuration: 137s
+servingInfo:
+  certFile: /etc/serving/tls.crt
+  keyFile: /etc/serving/tls.key
+`
+
+	tests := []struct {
+		name          string
+		content       string
+		resolved      ResolvedProfile
+		wantEmptyPath bool
+		wantErr       []string
+	}{
+		{
+			name:          "not honoring leaves the config as is",
+			content:       userConfig + "  minTLSVersion: VersionTLS10\n",
+			resolved:      ResolvedProfile{Honor: false, Spec: intermediate},
+			wantEmptyPath: true,
+		},
+		{
+			name:     "honoring merges the TLS settings into the config",
+			content:  userConfig,
+			resolved: ResolvedProfile{Honor: true, Spec: intermediate},
+		},
+		{
+			name: "honoring accepts matching TLS settings in any cipher order",
+			content: userConfig + "  minTLSVersion: VersionTLS12\n  cipherSuites:\n" +
+				"  - " + strings.Join(reversedCiphers, "\n  - ") + "\n",
+			resolved: ResolvedProfile{Honor: true, Spec: intermediate},
+		},
+		{
+			name:          "conflicting minTLSVersion errors",
+			content:       userConfig + "  minTLSVersion: VersionTLS10\n",
+			resolved:      ResolvedProfile{Honor: true, Spec: intermediate},
+			wantEmptyPath: true,
+			wantErr:       []string{`servingInfo.minTLSVersion is "VersionTLS10"`},
+		},
+		{
+			name: "every conflict is reported",
+			content: userConfig + "  minTLSVersion: VersionTLS13\n  cipherSuites:\n" +
+				"  - TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256\n",
+			resolved:      ResolvedProfile{Honor: true, Spec: intermediate},
+			wantEmptyPath: true,
+			wantErr: []string{
+				`servingInfo.minTLSVersion is "VersionTLS13"`,
+				"servingInfo.cipherSuites is [TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256]",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configFile, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			path, err := MergeConfigFile(configFile, tt.resolved)
+			if (err != nil) != (len(tt.wantErr) > 0) {
+				t.Fatalf("MergeConfigFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("MergeConfigFile() error = %v, want it to contain %q", err, want)
+				}
+			}
+			if tt.wantEmptyPath {
+				if path != "" {
+					t.Errorf("path = %q, want empty", path)
+					cleanupTempFile(t, path)
+				}
+				return
+			}
+			if path == "" {
+				t.Fatal("path is empty, want merged config file")
+			}
+			cleanupTempFile(t, path)
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read %q: %v", path, err)
+			}
+			var config operatorv1alpha1.GenericOperatorConfig
+			if err := sigsyaml.UnmarshalStrict(content, &config); err != nil {
+				t.Fatalf("failed to unmarshal merged config: %v", err)
+			}
+			if config.Kind != "GenericOperatorConfig" {
+				t.Errorf("Kind = %q, want GenericOperatorConfig", config.Kind)
+			}
+			if config.LeaderElection.LeaseDuration.Duration != 137*time.Second {
+				t.Errorf("LeaseDuration = %v, want it kept from --config", config.LeaderElection.LeaseDuration)
+			}
+			if config.ServingInfo.CertFile != "/etc/serving/tls.crt" || config.ServingInfo.KeyFile != "/etc/serving/tls.key" {
+				t.Errorf("CertFile, KeyFile = %q, %q, want them kept from --config", config.ServingInfo.CertFile, config.ServingInfo.KeyFile)
+			}
+			if config.ServingInfo.MinTLSVersion != string(intermediate.MinTLSVersion) {
+				t.Errorf("MinTLSVersion = %q, want %q", config.ServingInfo.MinTLSVersion, intermediate.MinTLSVersion)
+			}
+			if !reflect.DeepEqual(config.ServingInfo.CipherSuites, intermediateCiphers) {
+				t.Errorf("CipherSuites = %v, want %v", config.ServingInfo.CipherSuites, intermediateCiphers)
+			}
+		})
+	}
+}
+
+func TestReadConfigServingInfo(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	content := "servingInfo:\n  certFile: /etc/serving/tls.crt\n  minTLSVersion: VersionTLS12\n  cipherSuites:\n  - TLS_AES_128_GCM_SHA256\n"
+	if err := os.WriteFile(configFile, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadConfigServingInfo(configFile)
+	if err != nil {
+		t.Fatalf("ReadConfigServingInfo() error = %v", err)
+	}
+	if got.MinTLSVersion != "VersionTLS12" || !reflect.DeepEqual(got.CipherSuites, []string{"TLS_AES_128_GCM_SHA256"}) || got.CertFile != "" {
+		t.Errorf("ReadConfigServingInfo() = %+v, want only the TLS settings of the file", got)
+	}
+
+	if got, err := ReadConfigServingInfo(""); err != nil || got.MinTLSVersion != "" || got.CipherSuites != nil {
+		t.Errorf("ReadConfigServingInfo(\"\") = %+v, %v, want no settings", got, err)
+	}
+}
@@ -0,0 +1,85 @@
+package tls
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+)
+
+// RestartCoordinator schedules the restarts of an operator replica that can
+// no longer apply the cluster TLS security profile, see
+// SecurityProfileWatcher.OnFailure.
+//
+// Every replica watches the profile, so a bad profile makes all of them
+// request a restart at once. The leader delays its restart by
+// LeaderHandoverDelay, so that the standby replicas are back before it
+// releases its lease. Delays follow Backoff: a profile that flaps between
+// broken and fixed, canceling the restarts, makes each next restart wait
+// longer.
+type RestartCoordinator struct {
+	// IsLeader reports whether this replica holds the leader lease.
+	IsLeader func() bool
+	// Restart restarts the replica.
+	Restart func()
+	// Backoff gives the delay of each restart request.
+	Backoff wait.Backoff
+	// LeaderHandoverDelay is added to the delay of the leader.
+	LeaderHandoverDelay time.Duration
+	// Clock schedules the restarts.
+	Clock clock.WithDelayedExecution
+
+	mu      sync.Mutex
+	pending clock.Timer
+}
+
+// NewRestartCoordinator returns a RestartCoordinator with the default delays:
+// 10s, doubling up to 5m, plus 30s for the leader.
+func NewRestartCoordinator(isLeader func() bool, restart func()) *RestartCoordinator {
+	return &RestartCoordinator{
+		IsLeader: isLeader,
+		Restart:  restart,
+		Backoff: wait.Backoff{
+			Duration: 10 * time.Second,
+			Factor:   2,
+			Steps:    10,
+			Cap:      5 * time.Minute,
+		},
+		LeaderHandoverDelay: 30 * time.Second,
+		Clock:               clock.RealClock{},
+	}
+}
+
+// RequestRestart schedules a restart, unless one is already pending.
+func (c *RestartCoordinator) RequestRestart() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pending != nil {
+		return
+	}
+	delay := c.Backoff.Step()
+	role := "standby"
+	if c.IsLeader() {
+		delay += c.LeaderHandoverDelay
+		role = "leader"
+	}
+	klog.Infof("Restarting the operator %s replica in %s to re-resolve the TLS security profile", role, delay)
+	c.pending = c.Clock.AfterFunc(delay, c.Restart)
+}
+
+// Cancel cancels the pending restart, if any. The delay of the next
+// RequestRestart keeps growing.
+func (c *RestartCoordinator) Cancel() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pending == nil {
+		return
+	}
+	c.pending.Stop()
+	c.pending = nil
+	klog.Info("TLS security profile applied again; canceled the pending operator restart")
+}
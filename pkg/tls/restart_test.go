@@ -0,0 +1,109 @@
+package tls
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/clock"
+)
+
+// fakeDelayedClock records the delays of AfterFunc instead of waiting.
+type fakeDelayedClock struct {
+	clock.RealClock
+	timers []*fakeTimer
+}
+
+func (c *fakeDelayedClock) AfterFunc(d time.Duration, f func()) clock.Timer {
+	timer := &fakeTimer{delay: d, f: f}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+type fakeTimer struct {
+	delay   time.Duration
+	f       func()
+	stopped bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time      { return nil }
+func (t *fakeTimer) Stop() bool               { t.stopped = true; return true }
+func (t *fakeTimer) Reset(time.Duration) bool { return false }
+func (t *fakeTimer) fire()                    { t.f() }
+
+func TestRestartCoordinator(t *testing.T) {
+	tests := []struct {
+		name        string
+		leader      bool
+		calls       []string
+		wantDelays  []time.Duration
+		wantRestart bool
+	}{
+		{
+			name:        "standby restarts after the backoff",
+			calls:       []string{"request", "fire"},
+			wantDelays:  []time.Duration{10 * time.Second},
+			wantRestart: true,
+		},
+		{
+			name:        "leader hands over last",
+			leader:      true,
+			calls:       []string{"request", "fire"},
+			wantDelays:  []time.Duration{40 * time.Second},
+			wantRestart: true,
+		},
+		{
+			name:       "a pending restart is not rescheduled",
+			calls:      []string{"request", "request"},
+			wantDelays: []time.Duration{10 * time.Second},
+		},
+		{
+			name:       "flapping grows the delay",
+			calls:      []string{"request", "cancel", "request", "cancel", "request"},
+			wantDelays: []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second},
+		},
+		{
+			name:       "the delay is capped",
+			calls:      []string{"request", "cancel", "request", "cancel", "request", "cancel", "request", "cancel", "request", "cancel", "request"},
+			wantDelays: []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second, 160 * time.Second, 300 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restarted := false
+			fakeClock := &fakeDelayedClock{}
+			c := NewRestartCoordinator(func() bool { return tt.leader }, func() { restarted = true })
+			c.Clock = fakeClock
+			c.Backoff = wait.Backoff{Duration: 10 * time.Second, Factor: 2, Steps: 10, Cap: 5 * time.Minute}
+
+			for _, call := range tt.calls {
+				switch call {
+				case "request":
+					c.RequestRestart()
+				case "cancel":
+					c.Cancel()
+				case "fire":
+					fakeClock.timers[len(fakeClock.timers)-1].fire()
+				}
+			}
+
+			var delays []time.Duration
+			for _, timer := range fakeClock.timers {
+				delays = append(delays, timer.delay)
+			}
+			if !reflect.DeepEqual(delays, tt.wantDelays) {
+				t.Errorf("restart delays = %v, want %v", delays, tt.wantDelays)
+			}
+			if restarted != tt.wantRestart {
+				t.Errorf("restarted = %t, want %t", restarted, tt.wantRestart)
+			}
+			for _, timer := range fakeClock.timers[:len(fakeClock.timers)-1] {
+				if !timer.stopped {
+					t.Errorf("restart in %s was not canceled", timer.delay)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package tls
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	operatorv1alpha1 "github.com/openshift/api/operator/v1alpha1"
+	"github.com/openshift/library-go/pkg/authorization/hardcodedauthorizer"
+	libgoclient "github.com/openshift/library-go/pkg/config/client"
+	"github.com/openshift/library-go/pkg/config/configdefaults"
+	"github.com/openshift/library-go/pkg/config/serving"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/apiserver/pkg/authorization/union"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/apiserver/pkg/server/dynamiccertificates"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+)
+
+// ServeMetrics serves the operator's metrics and health checks with the
+// server Controllercmd builds from servingInfo, plus complianceAudit at
+// ComplianceAuditPath, until ctx is done. The server is built once, and
+// negotiates every new connection with the current settings of
+// servingConfig, see Serve. It returns once the server listens.
+func ServeMetrics(
+	ctx context.Context,
+	componentName string,
+	servingInfo configv1.HTTPServingInfo,
+	authentication operatorv1alpha1.DelegatedAuthentication,
+	authorization operatorv1alpha1.DelegatedAuthorization,
+	kubeConfigFile string,
+	leaderElection *configv1.LeaderElection,
+	versionInfo version.Info,
+	servingConfig *DynamicServingConfig,
+	complianceAudit *ComplianceAudit,
+) error {
+	configdefaults.SetRecommendedHTTPServingInfoDefaults(&servingInfo)
+
+	restConfig, err := libgoclient.GetKubeConfigOrInClusterConfig(kubeConfigFile, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build kubeconfig: %w", err)
+	}
+	kubeClient, err := kubernetes.NewForConfig(rest.AddUserAgent(restConfig, componentName))
+	if err != nil {
+		return fmt.Errorf("failed to create kube client: %w", err)
+	}
+
+	server, err := NewMetricsServer(ctx, componentName, servingInfo, authentication, authorization, kubeConfigFile, kubeClient, leaderElection, versionInfo, complianceAudit)
+	if err != nil {
+		return err
+	}
+	return Serve(ctx, server, servingConfig)
+}
+
+// NewMetricsServer builds the server Controllercmd builds from servingInfo,
+// serving complianceAudit at ComplianceAuditPath. The server listens once
+// built.
+func NewMetricsServer(
+	ctx context.Context,
+	componentName string,
+	servingInfo configv1.HTTPServingInfo,
+	authentication operatorv1alpha1.DelegatedAuthentication,
+	authorization operatorv1alpha1.DelegatedAuthorization,
+	kubeConfigFile string,
+	kubeClient *kubernetes.Clientset,
+	leaderElection *configv1.LeaderElection,
+	versionInfo version.Info,
+	complianceAudit *ComplianceAudit,
+) (*genericapiserver.GenericAPIServer, error) {
+	serverConfig, err := serving.ToServerConfig(ctx, servingInfo, authentication, authorization, kubeConfigFile, kubeClient, leaderElection, false, false, &versionInfo)
+	if err != nil {
+		return nil, err
+	}
+	if serverConfig.Authorization.Authorizer != nil {
+		serverConfig.Authorization.Authorizer = union.New(
+			// As Controllercmd does, allow the well-known metrics scrapers.
+			hardcodedauthorizer.NewHardCodedMetricsAuthorizer(),
+			serverConfig.Authorization.Authorizer,
+		)
+	}
+	server, err := serverConfig.Complete(nil).New(componentName, genericapiserver.NewEmptyDelegate())
+	if err != nil {
+		return nil, err
+	}
+	server.Handler.NonGoRestfulMux.Handle(ComplianceAuditPath, complianceAudit)
+	return server, nil
+}
+
+// Serve serves server until ctx is done, as its SecureServingInfo.Serve
+// does, except that new connections negotiate the current settings of
+// servingConfig, when it has any, instead of the MinTLSVersion and
+// CipherSuites of the SecureServingInfo, see
+// DynamicServingConfig.WrapGetConfigForClient. Only the tls.Config differs:
+// the handler, with its authentication, authorization and health checks, is
+// the one of server. HTTP/2 is not served, as Controllercmd does not by
+// default. It returns once the server listens, recording its address in
+// servingConfig.
+func Serve(ctx context.Context, server *genericapiserver.GenericAPIServer, servingConfig *DynamicServingConfig) error {
+	secureServing := server.SecureServingInfo
+	if secureServing.Cert == nil && len(secureServing.SNICerts) == 0 {
+		return fmt.Errorf("failed to serve: no serving certificate")
+	}
+	server.PrepareRun()
+
+	baseTLSConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"http/1.1"},
+	}
+	if secureServing.MinTLSVersion > 0 {
+		baseTLSConfig.MinVersion = secureServing.MinTLSVersion
+	}
+	if len(secureServing.CipherSuites) > 0 {
+		baseTLSConfig.CipherSuites = secureServing.CipherSuites
+	}
+	if secureServing.ClientCA != nil {
+		// Request client certificates for the authenticator to verify,
+		// without rejecting the connections that do not present one.
+		baseTLSConfig.ClientAuth = tls.RequestClientCert
+	}
+
+	certificateController := dynamiccertificates.NewDynamicServingCertificateController(
+		baseTLSConfig,
+		secureServing.ClientCA,
+		secureServing.Cert,
+		secureServing.SNICerts,
+		nil,
+	)
+	var runners []dynamiccertificates.ControllerRunner
+	if secureServing.ClientCA != nil {
+		secureServing.ClientCA.AddListener(certificateController)
+		if runner, ok := secureServing.ClientCA.(dynamiccertificates.ControllerRunner); ok {
+			runners = append(runners, runner)
+		}
+	}
+	if secureServing.Cert != nil {
+		secureServing.Cert.AddListener(certificateController)
+		if runner, ok := secureServing.Cert.(dynamiccertificates.ControllerRunner); ok {
+			runners = append(runners, runner)
+		}
+	}
+	for _, sniCert := range secureServing.SNICerts {
+		sniCert.AddListener(certificateController)
+		if runner, ok := sniCert.(dynamiccertificates.ControllerRunner); ok {
+			runners = append(runners, runner)
+		}
+	}
+	for _, runner := range runners {
+		// Failing to prime the content is not fatal: connections fail
+		// closed until it is loaded.
+		if err := runner.RunOnce(ctx); err != nil {
+			klog.Warningf("Initial population of serving certificates failed: %v", err)
+		}
+		go runner.Run(ctx, 1)
+	}
+	if err := certificateController.RunOnce(); err != nil {
+		klog.Warningf("Initial population of dynamic certificates failed: %v", err)
+	}
+	go certificateController.Run(1, ctx.Done())
+
+	tlsConfig := baseTLSConfig.Clone()
+	tlsConfig.GetConfigForClient = servingConfig.WrapGetConfigForClient(certificateController.GetConfigForClient)
+	httpServer := &http.Server{
+		Addr:              secureServing.Listener.Addr().String(),
+		Handler:           server.Handler,
+		MaxHeaderBytes:    1 << 20,
+		TLSConfig:         tlsConfig,
+		IdleTimeout:       90 * time.Second,
+		ReadHeaderTimeout: 32 * time.Second,
+		// Keep HTTP/2 off, it is negotiated by NextProtos only.
+		TLSNextProto: map[string]func(*http.Server, *tls.Conn, http.Handler){},
+	}
+	if _, _, err := genericapiserver.RunServer(httpServer, secureServing.Listener, server.ShutdownTimeout, ctx.Done()); err != nil {
+		return err
+	}
+	klog.Infof("Serving securely on %s", secureServing.Listener.Addr())
+	address := secureServing.Listener.Addr().String()
+	servingConfig.address.Store(&address)
+	server.RunPostStartHooks(ctx)
+	return nil
+}
@@ -12,14 +12,16 @@ import (
 
 // SecurityProfileWatcher watches apiserver.config.openshift.io/cluster for
 // tlsSecurityProfile and tlsAdherence changes and invokes OnChange so the
-// operator can restart and pick up the new configuration.
+// operator can reconfigure itself in place.
 //
 // Initial values must be seeded from the profile that was applied (or skipped)
 // at process start, including when adherence is Legacy, so Strict↔Legacy
-// transitions still trigger a restart.
+// transitions are still detected.
 //
-// OnChange is invoked at most once per process lifetime. Controllercmd HTTPS
-// cannot be reconfigured in place; a single graceful restart is enough.
+// OnChange is invoked for every change relative to the last profile it
+// applied. When the live settings cannot be resolved or OnChange fails,
+// OnFailure is invoked instead, and OnRecover once the live settings are
+// applied again, whether or not they changed in between.
 type SecurityProfileWatcher struct {
 	mu sync.Mutex
 
@@ -27,12 +29,23 @@ type SecurityProfileWatcher struct {
 	InitialTLSAdherencePolicy configv1.TLSAdherencePolicy
 
 	// OnChange is invoked when either the resolved TLS profile spec or the
-	// adherence policy differs from the seeded initial values, or when the
-	// live APIServer TLS settings become unresolvable (fail-hard, consistent
-	// with bootstrap). Typically this cancels the operator context.
-	OnChange func()
+	// adherence policy differs from the last applied values, which start as
+	// the seeded initial values. It applies resolved and returns an error
+	// when it could not.
+	OnChange func(resolved ResolvedProfile) error
 
-	fired bool
+	// OnFailure is invoked with the error every time the live APIServer TLS
+	// settings are unresolvable or OnChange fails (fail-hard, consistent
+	// with bootstrap). Typically this schedules a restart, see
+	// RestartCoordinator.
+	OnFailure func(err error)
+
+	// OnRecover is invoked when the live APIServer TLS settings are applied
+	// after a failure. Typically this cancels the scheduled restart.
+	OnRecover func()
+
+	applied *ResolvedProfile
+	failing bool
 }
 
 // Start registers an informer handler for the cluster APIServer. The informer
@@ -80,41 +93,50 @@ func (w *SecurityProfileWatcher) handle(apiServer *configv1.APIServer) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	if w.fired {
-		return
-	}
-
 	resolved, err := ResolveFromAPIServer(apiServer)
 	if err != nil {
 		// Consistent with bootstrap fail-hard: an unresolvable live config
 		// means we can no longer vouch for serving TLS settings.
-		klog.Errorf("failed to resolve APIServer TLS settings, restarting to re-resolve: %v", err)
-		w.fireLocked()
+		klog.Errorf("failed to resolve APIServer TLS settings: %v", err)
+		w.failLocked(err)
 		return
 	}
 
-	profileChanged := !reflect.DeepEqual(w.InitialTLSProfileSpec, resolved.Spec)
-	adherenceChanged := w.InitialTLSAdherencePolicy != resolved.Adherence
-	if !profileChanged && !adherenceChanged {
-		return
+	appliedSpec, appliedAdherence := w.InitialTLSProfileSpec, w.InitialTLSAdherencePolicy
+	if w.applied != nil {
+		appliedSpec, appliedAdherence = w.applied.Spec, w.applied.Adherence
 	}
+	profileChanged := !reflect.DeepEqual(appliedSpec, resolved.Spec)
+	adherenceChanged := appliedAdherence != resolved.Adherence
 
 	if profileChanged {
-		klog.Infof("TLS security profile changed from %#v to %#v; triggering operator restart",
-			w.InitialTLSProfileSpec, resolved.Spec)
+		klog.Infof("TLS security profile changed from %#v to %#v", appliedSpec, resolved.Spec)
 	}
 	if adherenceChanged {
-		klog.Infof("TLS adherence policy changed from %q to %q; triggering operator restart",
-			w.InitialTLSAdherencePolicy, resolved.Adherence)
+		klog.Infof("TLS adherence policy changed from %q to %q", appliedAdherence, resolved.Adherence)
+	}
+
+	if (profileChanged || adherenceChanged) && w.OnChange != nil {
+		if err := w.OnChange(resolved); err != nil {
+			klog.Errorf("failed to apply the changed TLS settings: %v", err)
+			w.failLocked(err)
+			return
+		}
 	}
+	w.applied = &resolved
 
-	w.fireLocked()
+	if w.failing {
+		w.failing = false
+		if w.OnRecover != nil {
+			w.OnRecover()
+		}
+	}
 }
 
-// fireLocked must be called with w.mu held.
-func (w *SecurityProfileWatcher) fireLocked() {
-	w.fired = true
-	if w.OnChange != nil {
-		w.OnChange()
+// failLocked must be called with w.mu held.
+func (w *SecurityProfileWatcher) failLocked(err error) {
+	w.failing = true
+	if w.OnFailure != nil {
+		w.OnFailure(err)
 	}
 }
@@ -2,6 +2,8 @@ package tls
 
 import (
 	"context"
+	"errors"
+	"reflect"
 	"sync/atomic"
 	"testing"
 
@@ -46,71 +48,147 @@ func TestSecurityProfileWatcherHandle(t *testing.T) {
 	}
 
 	tests := []struct {
-		name              string
-		initialSpec       configv1.TLSProfileSpec
-		initialAdherence  configv1.TLSAdherencePolicy
-		handles           []*configv1.APIServer
-		wantOnChangeCount int32
+		name               string
+		initialSpec        configv1.TLSProfileSpec
+		initialAdherence   configv1.TLSAdherencePolicy
+		onChangeErr        error
+		handles            []*configv1.APIServer
+		wantApplied        []configv1.TLSProfileType
+		wantOnFailureCount int32
+		wantOnRecoverCount int32
 	}{
 		{
-			name:              "no change does not fire OnChange",
-			initialSpec:       intermediate,
-			initialAdherence:  configv1.TLSAdherencePolicyNoOpinion,
-			handles:           []*configv1.APIServer{{}},
-			wantOnChangeCount: 0,
+			name:             "no change does not fire OnChange",
+			initialSpec:      intermediate,
+			initialAdherence: configv1.TLSAdherencePolicyNoOpinion,
+			handles:          []*configv1.APIServer{{}},
 		},
 		{
-			name:              "profile change fires OnChange",
-			initialSpec:       intermediate,
-			initialAdherence:  configv1.TLSAdherencePolicyStrictAllComponents,
-			handles:           []*configv1.APIServer{modernAPI},
-			wantOnChangeCount: 1,
+			name:             "profile change fires OnChange",
+			initialSpec:      intermediate,
+			initialAdherence: configv1.TLSAdherencePolicyStrictAllComponents,
+			handles:          []*configv1.APIServer{modernAPI},
+			wantApplied:      []configv1.TLSProfileType{configv1.TLSProfileModernType},
 		},
 		{
-			name:              "adherence change fires OnChange",
-			initialSpec:       intermediate,
-			initialAdherence:  configv1.TLSAdherencePolicyLegacyAdheringComponentsOnly,
-			handles:           []*configv1.APIServer{strictIntermediateAPI},
-			wantOnChangeCount: 1,
+			name:             "adherence change fires OnChange",
+			initialSpec:      intermediate,
+			initialAdherence: configv1.TLSAdherencePolicyLegacyAdheringComponentsOnly,
+			handles:          []*configv1.APIServer{strictIntermediateAPI},
+			wantApplied:      []configv1.TLSProfileType{configv1.TLSProfileIntermediateType},
 		},
 		{
-			name:              "unresolvable live config fires OnChange",
-			initialSpec:       intermediate,
-			initialAdherence:  configv1.TLSAdherencePolicyStrictAllComponents,
-			handles:           []*configv1.APIServer{unresolvableCustomAPI},
-			wantOnChangeCount: 1,
+			name:             "every change fires OnChange, relative to the last applied profile",
+			initialSpec:      intermediate,
+			initialAdherence: configv1.TLSAdherencePolicyStrictAllComponents,
+			handles: []*configv1.APIServer{
+				modernAPI,
+				modernAPI,
+				oldAPI,
+				strictIntermediateAPI,
+			},
+			wantApplied: []configv1.TLSProfileType{
+				configv1.TLSProfileModernType,
+				configv1.TLSProfileOldType,
+				configv1.TLSProfileIntermediateType,
+			},
 		},
 		{
-			name:             "OnChange fires at most once",
+			name:               "unresolvable live config fires OnFailure",
+			initialSpec:        intermediate,
+			initialAdherence:   configv1.TLSAdherencePolicyStrictAllComponents,
+			handles:            []*configv1.APIServer{unresolvableCustomAPI},
+			wantOnFailureCount: 1,
+		},
+		{
+			name:               "OnChange error fires OnFailure",
+			initialSpec:        intermediate,
+			initialAdherence:   configv1.TLSAdherencePolicyStrictAllComponents,
+			onChangeErr:        errors.New("test error"),
+			handles:            []*configv1.APIServer{modernAPI},
+			wantApplied:        []configv1.TLSProfileType{configv1.TLSProfileModernType},
+			wantOnFailureCount: 1,
+		},
+		{
+			name:             "OnFailure fires on every failure",
 			initialSpec:      intermediate,
 			initialAdherence: configv1.TLSAdherencePolicyStrictAllComponents,
 			handles: []*configv1.APIServer{
 				modernAPI,
+				unresolvableCustomAPI,
+				unresolvableCustomAPI,
+			},
+			wantApplied:        []configv1.TLSProfileType{configv1.TLSProfileModernType},
+			wantOnFailureCount: 2,
+		},
+		{
+			name:             "OnRecover fires once the live config is applied again",
+			initialSpec:      intermediate,
+			initialAdherence: configv1.TLSAdherencePolicyStrictAllComponents,
+			handles: []*configv1.APIServer{
+				unresolvableCustomAPI,
+				oldAPI,
 				oldAPI,
+			},
+			wantApplied:        []configv1.TLSProfileType{configv1.TLSProfileOldType},
+			wantOnFailureCount: 1,
+			wantOnRecoverCount: 1,
+		},
+		{
+			name:             "OnRecover fires when the live config is back to the applied one",
+			initialSpec:      intermediate,
+			initialAdherence: configv1.TLSAdherencePolicyStrictAllComponents,
+			handles: []*configv1.APIServer{
 				unresolvableCustomAPI,
+				strictIntermediateAPI,
 			},
-			wantOnChangeCount: 1,
+			wantOnFailureCount: 1,
+			wantOnRecoverCount: 1,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			var fireCount atomic.Int32
+			var applied []configv1.TLSProfileType
+			var failureCount, recoverCount atomic.Int32
 			w := &SecurityProfileWatcher{
 				InitialTLSProfileSpec:     tt.initialSpec,
 				InitialTLSAdherencePolicy: tt.initialAdherence,
-				OnChange:                  func() { fireCount.Add(1) },
+				OnChange: func(resolved ResolvedProfile) error {
+					applied = append(applied, profileType(t, resolved.Spec))
+					return tt.onChangeErr
+				},
+				OnFailure: func(error) { failureCount.Add(1) },
+				OnRecover: func() { recoverCount.Add(1) },
 			}
 			for _, api := range tt.handles {
 				w.handle(api)
 			}
-			if got := fireCount.Load(); got != tt.wantOnChangeCount {
-				t.Fatalf("OnChange fired %d times, want %d", got, tt.wantOnChangeCount)
+			if !reflect.DeepEqual(applied, tt.wantApplied) {
+				t.Errorf("OnChange applied %v, want %v", applied, tt.wantApplied)
+			}
+			if got := failureCount.Load(); got != tt.wantOnFailureCount {
+				t.Errorf("OnFailure fired %d times, want %d", got, tt.wantOnFailureCount)
+			}
+			if got := recoverCount.Load(); got != tt.wantOnRecoverCount {
+				t.Errorf("OnRecover fired %d times, want %d", got, tt.wantOnRecoverCount)
 			}
 		})
 	}
 }
 
+// profileType returns the type of the predefined profile spec is the spec of.
+func profileType(t *testing.T, spec configv1.TLSProfileSpec) configv1.TLSProfileType {
+	t.Helper()
+	for profileType, profile := range configv1.TLSProfiles {
+		if reflect.DeepEqual(*profile, spec) {
+			return profileType
+		}
+	}
+	t.Fatalf("spec %#v is not a predefined profile", spec)
+	return ""
+}
+
 func TestResolveFromClusterCanceledContext(t *testing.T) {
 	tests := []struct {
 		name    string